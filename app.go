@@ -3,18 +3,19 @@ package main
 import (
 	"context"
 	"embed"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/ad-on-is/resticity/frontend"
 	"github.com/ad-on-is/resticity/internal"
 	"github.com/adrg/xdg"
 
 	"github.com/charmbracelet/log"
 	"github.com/energye/systray"
 	"github.com/go-co-op/gocron/v2"
-	"github.com/google/uuid"
-	"github.com/thoas/go-funk"
 	"github.com/wailsapp/wails/v2/pkg/runtime"
 )
 
@@ -24,7 +25,18 @@ type App struct {
 	scheduler *internal.Scheduler
 	restic    *internal.Restic
 	settings  *internal.Settings
+	auth      *internal.Auth
+	state     *internal.AppState
 	assets    *embed.FS
+	hidden    bool
+	trayMenu  string
+	trayLast  *systray.MenuItem
+	trayNext  *systray.MenuItem
+
+	trayPause    *systray.MenuItem
+	trayPauseAll *systray.MenuItem
+	trayResume   *systray.MenuItem
+	trayMaint    *systray.MenuItem
 }
 
 // NewApp creates a new App application struct
@@ -32,93 +44,322 @@ func NewApp(
 	restic *internal.Restic,
 	scheduler *internal.Scheduler,
 	settings *internal.Settings,
+	auth *internal.Auth,
+	state *internal.AppState,
 	assets *embed.FS,
+	hidden bool,
 ) *App {
-	return &App{restic: restic, scheduler: scheduler, settings: settings}
+	return &App{restic: restic, scheduler: scheduler, settings: settings, auth: auth, state: state, hidden: hidden}
 }
 
+// SaveIcon writes an icon to the cache, where desktop notifications pick
+// it up.
 func (a *App) SaveIcon(icon []byte, file string) {
 	path := filepath.Join(xdg.CacheHome, "resticity")
-	os.WriteFile(filepath.Join(path, file), icon, 0644)
+	if err := os.MkdirAll(path, 0755); err != nil {
+		log.Error("Error creating cache directory", "err", err)
+		return
+	}
+	if err := os.WriteFile(filepath.Join(path, file), icon, 0644); err != nil {
+		log.Error("Error saving icon", "file", file, "err", err)
+	}
 }
 
 func (a *App) toggleSysTrayIcon() {
-	default_icon, err := assets.ReadFile(
-		"frontend/.output/public/appicon.png",
-	)
-	if err != nil {
-		log.Error(err)
-	} else {
-		a.SaveIcon(default_icon, "appicon.png")
+	a.SaveIcon(frontend.Icon(false), "appicon.png")
+	a.SaveIcon(frontend.Icon(true), "appicon_active.png")
 
-	}
-	active_icon, err := assets.ReadFile(
-		"frontend/.output/public/appicon_active.png",
-	)
+	running := make(chan int, 1)
+	a.scheduler.OnRunningChange(func(n int) {
+		// only the latest count matters
+		select {
+		case <-running:
+		default:
+		}
+		running <- n
+	})
+	go animateTrayIcon(running)
+}
 
-	if err != nil {
-		log.Error(err)
-	} else {
-		a.SaveIcon(active_icon, "appicon_active.png")
+func (a *App) systemTray() {
 
-	}
+	systray.CreateMenu()
+
+	systray.SetTitle("resticity")
+	a.toggleSysTrayIcon()
 
-	_, err = a.scheduler.Gocron.NewJob(
-		gocron.DurationJob(500*time.Millisecond),
+	a.buildTrayMenu()
+	// rebuild the menu when schedules are added, removed or renamed
+	_, err := a.scheduler.Gocron.NewJob(
+		gocron.DurationJob(2*time.Second),
 		gocron.NewTask(func() {
-			running := funk.Filter(
-				a.scheduler.Jobs,
-				func(j internal.Job) bool { return j.Running == true },
-			).([]internal.Job)
-			if len(running) > 0 {
-				systray.SetIcon(active_icon)
-			} else {
-				systray.SetIcon(default_icon)
+			if a.traySchedules() != a.trayMenu {
+				a.buildTrayMenu()
 			}
-
+			a.updateTrayStatus()
 		}),
 	)
 	if err != nil {
 		log.Error("Error creating job", err)
 	}
 
+	systray.SetOnClick(func(menu systray.IMenu) { a.showWindow() })
+	// systray.SetOnRClick(func(menu systray.IMenu) { menu.ShowMenu() })
+	systray.SetOnRClick(func(menu systray.IMenu) { a.hideWindow() })
 }
 
-func (a *App) systemTray() {
+// traySchedules identifies the schedules shown in the tray menu.
+func (a *App) traySchedules() string {
+	names := []string{}
+	for _, s := range a.settings.Config.Schedules {
+		names = append(names, s.Id+":"+a.scheduler.ScheduleName(s))
+	}
+	return strings.Join(names, "\n")
+}
 
-	systray.CreateMenu()
+func (a *App) buildTrayMenu() {
+	a.trayMenu = a.traySchedules()
+	systray.ResetMenu()
 
-	systray.SetTitle("resticity")
-	systray.SetTooltip("Resticity")
+	a.trayLast = systray.AddMenuItem("", "")
+	a.trayLast.Disable()
+	a.trayNext = systray.AddMenuItem("", "")
+	a.trayNext.Disable()
+	systray.AddSeparator()
 
 	show := systray.AddMenuItem("Open resticity", "Show the main window")
+	show.Click(func() {
+		a.showWindow()
+	})
 	systray.AddSeparator()
 
-	exit := systray.AddMenuItem("Quit", "Quit resticity")
+	for _, s := range a.settings.Config.Schedules {
+		id := s.Id
+		item := systray.AddMenuItem(a.scheduler.ScheduleName(s), s.Cron)
+		run := item.AddSubMenuItem("Run now", "Run this schedule now")
+		if internal.IsReadOnly() {
+			run.Disable()
+		}
+		run.Click(func() { a.scheduler.RunJobById(id) })
+		logs := item.AddSubMenuItem("Open logs", "Show the logs of this schedule")
+		logs.Click(func() {
+			a.showWindow()
+			runtime.EventsEmit(a.ctx, "navigate", "/logs?schedule="+id)
+		})
+	}
+	if len(a.settings.Config.Schedules) > 0 {
+		systray.AddSeparator()
+	}
 
-	show.Click(func() {
+	a.trayPause = systray.AddMenuItem("Pause backups for 1h", "Skip scheduled runs for one hour")
+	a.trayPause.Click(func() { a.scheduler.Pause(time.Hour) })
+	a.trayPauseAll = systray.AddMenuItem("Pause backups until resumed", "Skip scheduled runs until resumed")
+	a.trayPauseAll.Click(func() { a.scheduler.Pause(0) })
+	a.trayResume = systray.AddMenuItem("Resume backups", "Run schedules again")
+	a.trayResume.Click(func() { a.scheduler.Resume() })
+	a.trayMaint = systray.AddMenuItem("Start maintenance mode", "Stop all scheduled and manual runs until ended")
+	a.trayMaint.Click(func() {
+		a.scheduler.SetMaintenance(!a.scheduler.PauseState().Maintenance.Enabled, "")
+		a.updateTrayStatus()
+	})
+	if internal.IsReadOnly() {
+		a.trayPause.Disable()
+		a.trayPauseAll.Disable()
+		a.trayResume.Disable()
+		a.trayMaint.Disable()
+	}
+	a.updateTrayStatus()
+	systray.AddSeparator()
 
-		runtime.WindowShow(a.ctx)
+	exit := systray.AddMenuItem("Quit", "Quit resticity")
+	exit.Click(func() {
+		a.saveWindowState()
+		runtime.Quit(a.ctx)
 	})
-	exit.Click(func() { os.Exit(0) })
+}
 
-	systray.SetOnClick(func(menu systray.IMenu) { runtime.WindowShow(a.ctx) })
-	// systray.SetOnRClick(func(menu systray.IMenu) { menu.ShowMenu() })
-	systray.SetOnRClick(func(menu systray.IMenu) { runtime.WindowHide(a.ctx) })
+// trayStatus summarizes the most recent run and the next scheduled one.
+func (a *App) trayStatus() (string, string) {
+	last := "No runs yet"
+	var lastTime time.Time
+	next := "Nothing scheduled"
+	var nextTime time.Time
+	for _, s := range a.settings.Config.Schedules {
+		if t, err := time.Parse(time.RFC3339, s.LastRun); err == nil && t.After(lastTime) {
+			lastTime = t
+			result := "OK"
+			if s.LastError != "" {
+				result = "failed"
+			}
+			last = fmt.Sprintf("Last: %s, %s ago, %s", a.scheduler.ScheduleName(s), humanDuration(time.Since(t)), result)
+		}
+		if t, ok := a.scheduler.NextRun(s.Id); ok && (nextTime.IsZero() || t.Before(nextTime)) {
+			nextTime = t
+			next = fmt.Sprintf("Next: %s in %s", a.scheduler.ScheduleName(s), humanDuration(time.Until(t)))
+		}
+	}
+	if pause := a.scheduler.PauseState(); pause.Maintenance.Enabled {
+		next = "Maintenance mode"
+	} else if pause.Paused {
+		next = "Paused until resumed"
+		if pause.Until != nil {
+			next = fmt.Sprintf("Paused for %s", humanDuration(time.Until(*pause.Until)))
+		}
+	}
+	return last, next
+}
+
+func (a *App) updateTrayStatus() {
+	last, next := a.trayStatus()
+	systray.SetTooltip("Resticity\n" + last + "\n" + next)
+	if a.trayLast == nil || a.trayPause == nil {
+		return
+	}
+	a.trayLast.SetTitle(last)
+	a.trayNext.SetTitle(next)
+	pause := a.scheduler.PauseState()
+	if pause.Maintenance.Enabled {
+		a.trayPause.Hide()
+		a.trayPauseAll.Hide()
+		a.trayResume.Hide()
+		a.trayMaint.SetTitle("End maintenance mode")
+		return
+	}
+	a.trayMaint.SetTitle("Start maintenance mode")
+	if pause.Paused {
+		a.trayPause.Hide()
+		a.trayPauseAll.Hide()
+		a.trayResume.Show()
+	} else {
+		a.trayPause.Show()
+		a.trayPauseAll.Show()
+		a.trayResume.Hide()
+	}
+}
+
+// humanDuration rounds to what matters in the tray, e.g. 2d 3h or 15m.
+func humanDuration(d time.Duration) string {
+	switch {
+	case d >= 24*time.Hour:
+		return fmt.Sprintf("%dd %dh", int(d.Hours())/24, int(d.Hours())%24)
+	case d >= time.Hour:
+		return fmt.Sprintf("%dh %dm", int(d.Hours()), int(d.Minutes())%60)
+	case d >= time.Minute:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	}
+	return "less than a minute"
 }
 
 // startup is called when the app starts. The context is saved
 // so we can call the runtime methods
 func (a *App) startup(ctx context.Context) {
 	a.ctx = ctx
-	a.toggleSysTrayIcon()
+	internal.OnShowWindow(a.showWindow)
+	internal.OnPublish(func(env internal.Envelope) {
+		runtime.EventsEmit(a.ctx, "message", env)
+	})
 	go systray.Run(a.systemTray, func() {})
 
 }
 
-func (a *App) StopBackup(id uuid.UUID) {
-	// a.scheduler.RemoveJob(id)
-	// a.RescheduleBackups()
+func (a *App) showWindow() {
+	runtime.WindowShow(a.ctx)
+	a.hidden = false
+	a.saveWindowState()
+}
+
+func (a *App) hideWindow() {
+	a.saveWindowState()
+	runtime.WindowHide(a.ctx)
+	a.hidden = true
+	a.saveWindowState()
+}
+
+// saveWindowState remembers size and position of a normal window, and
+// whether it is maximised or hidden in the tray.
+func (a *App) saveWindowState() {
+	w := a.state.Window()
+	w.Hidden = a.hidden
+	if !a.hidden && !runtime.WindowIsMinimised(a.ctx) {
+		w.Maximised = runtime.WindowIsMaximised(a.ctx)
+		if !w.Maximised {
+			w.Width, w.Height = runtime.WindowGetSize(a.ctx)
+			w.X, w.Y = runtime.WindowGetPosition(a.ctx)
+		}
+	}
+	a.state.SetWindow(w)
+}
+
+// domReady restores the window position, size and maximised state are
+// set on creation.
+func (a *App) domReady(ctx context.Context) {
+	w := a.state.Window()
+	if !w.Maximised && (w.X != 0 || w.Y != 0) {
+		runtime.WindowSetPosition(ctx, w.X, w.Y)
+	}
+	// there is no event for resizing or moving the window
+	_, err := a.scheduler.Gocron.NewJob(
+		gocron.DurationJob(5*time.Second),
+		gocron.NewTask(a.saveWindowState),
+	)
+	if err != nil {
+		log.Error("Error creating job", err)
+	}
+}
+
+// beforeClose is called when the window is closed, which hides it in the
+// tray.
+func (a *App) beforeClose(ctx context.Context) bool {
+	a.saveWindowState()
+	a.hidden = true
+	a.saveWindowState()
+	return false
+}
+
+// shutdown is called when the app is quitting, giving the API server a
+// chance to finish in-flight requests
+func (a *App) shutdown(ctx context.Context) {
+	if err := internal.ShutdownServer(5 * time.Second); err != nil {
+		log.Error("Error shutting down server", "err", err)
+	}
+	a.scheduler.Store.Close()
+}
+
+// StopBackup cancels the running job of a schedule.
+func (a *App) StopBackup(id string) error {
+	if internal.IsReadOnly() {
+		return internal.ErrReadOnly
+	}
+	a.scheduler.StopJobById(id)
+	return nil
+}
+
+func (a *App) RunNow(id string) error {
+	if internal.IsReadOnly() {
+		return internal.ErrReadOnly
+	}
+	return a.scheduler.RunJobById(id)
+}
+
+// PauseSchedule skips the scheduled runs of a schedule until resumed.
+func (a *App) PauseSchedule(id string, paused bool) (internal.PauseState, error) {
+	if internal.IsReadOnly() {
+		return internal.PauseState{}, internal.ErrReadOnly
+	}
+	return a.scheduler.PauseSchedule(id, paused), nil
+}
+
+// GetRunningJobs returns the ids of the schedules currently running.
+func (a *App) GetRunningJobs() []string {
+	ids := []string{}
+	for _, j := range a.scheduler.GetRunningJobs() {
+		ids = append(ids, j.Id)
+	}
+	return ids
+}
+
+func (a *App) GetApiToken() string {
+	return a.auth.Token()
 }
 
 func (a *App) SelectDirectory(title string) string {
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ad-on-is/resticity/internal"
+)
+
+// The bindings below mirror the HTTP API, so the desktop app keeps working
+// when the server is disabled with --no-server.
+
+var errRepositoryNotFound = errors.New("Repository not found")
+
+// ConfigResult carries either the saved state or the validation errors
+// that rejected the config.
+type ConfigResult struct {
+	Errors []internal.FieldError `json:"errors"`
+}
+
+func (a *App) repository(id string) (internal.Repository, error) {
+	r := a.settings.Config.GetRepositoryById(id)
+	if r == nil {
+		return internal.Repository{}, errRepositoryNotFound
+	}
+	return *r, nil
+}
+
+// audit records a change made in the desktop app like the API records its
+// requests.
+func (a *App) audit(call string, summary string, err error) {
+	e := internal.AuditEntry{User: "desktop", Role: internal.RoleAdmin, Method: "CALL", Path: call, Status: 200, Summary: summary}
+	if err != nil {
+		e.Status = 500
+	}
+	a.scheduler.Store.Audit(e)
+}
+
+// GetConfig returns the config including secrets, the desktop app runs on
+// the same machine.
+func (a *App) GetConfig() internal.Config {
+	a.settings.Refresh()
+	return a.settings.Config
+}
+
+func (a *App) SaveConfig(c internal.Config) (ConfigResult, error) {
+	if internal.IsReadOnly() {
+		return ConfigResult{}, internal.ErrReadOnly
+	}
+	errs, err := a.settings.Update(c, "")
+	if len(errs) > 0 {
+		return ConfigResult{Errors: errs}, nil
+	}
+	a.audit("SaveConfig", fmt.Sprintf("repositories=[%d] backups=[%d] schedules=[%d]", len(c.Repositories), len(c.Backups), len(c.Schedules)), err)
+	if err != nil {
+		return ConfigResult{Errors: errs}, err
+	}
+	a.scheduler.RescheduleBackups()
+	return ConfigResult{}, nil
+}
+
+func (a *App) GetActivity(recent int) (internal.Activity, error) {
+	return a.scheduler.Activity(recent)
+}
+
+func (a *App) PreviewCron(data internal.CronPreviewData) (internal.CronPreview, error) {
+	return internal.PreviewCron(data)
+}
+
+func (a *App) GetAuditLog(limit int) ([]internal.AuditEntry, error) {
+	return a.scheduler.Store.AuditLog(limit)
+}
+
+func (a *App) GetLastRuns() ([]internal.RunRecord, error) {
+	return a.scheduler.Store.LastRuns()
+}
+
+func (a *App) GetSnapshots(repositoryId string, groupBy string) ([]internal.SnapshotGroup, error) {
+	r, err := a.repository(repositoryId)
+	if err != nil {
+		return nil, err
+	}
+	if groupBy == "" {
+		groupBy = "host"
+	}
+	return a.restic.Snapshots(r, groupBy)
+}
+
+func (a *App) PreviewRetention(repositoryId string, data internal.ForgetPreviewData) ([]internal.ForgetGroup, error) {
+	r, err := a.repository(repositoryId)
+	if err != nil {
+		return nil, err
+	}
+	if len(data.PruneParams) == 0 {
+		data.PruneParams = r.PruneParams
+	}
+	return a.restic.ForgetPreview(r, data.PruneParams)
+}
+
+func (a *App) PinSnapshot(repositoryId string, snapshotId string, pin bool) error {
+	if internal.IsReadOnly() {
+		return internal.ErrReadOnly
+	}
+	r, err := a.repository(repositoryId)
+	if err != nil {
+		return err
+	}
+	if r.ReadOnly {
+		return internal.ErrRepositoryReadOnly
+	}
+	err = a.restic.PinSnapshot(r, snapshotId, pin)
+	a.audit("PinSnapshot", fmt.Sprintf("repository=%q snapshot=%q pin=%t", r.Name, snapshotId, pin), err)
+	return err
+}
+
+func (a *App) AnalyzeSnapshot(repositoryId string, snapshotId string, data internal.AnalyzeData) (internal.SizeAnalysis, error) {
+	r, err := a.repository(repositoryId)
+	if err != nil {
+		return internal.SizeAnalysis{}, err
+	}
+	data.Path = internal.FixPath(data.Path)
+	return a.restic.AnalyzeSnapshot(r, snapshotId, data)
+}
+
+func (a *App) BrowseSnapshot(
+	repositoryId string,
+	snapshotId string,
+	data internal.BrowseData,
+	opts internal.BrowseOptions,
+) (internal.BrowseResult, error) {
+	r, err := a.repository(repositoryId)
+	if err != nil {
+		return internal.BrowseResult{}, err
+	}
+	if err := opts.Validate(); err != nil {
+		return internal.BrowseResult{}, err
+	}
+	if data.Limit <= 0 || data.Limit > internal.MaxBrowseLimit {
+		data.Limit = internal.MaxBrowseLimit
+	}
+	return a.restic.BrowseSnapshot(r, snapshotId, internal.FixPath(data.Path), data.Offset, data.Limit, opts)
+}
+
+func (a *App) CheckRestore(repositoryId string, snapshotId string, data internal.RestoreData) (internal.RestoreCheck, error) {
+	r, err := a.repository(repositoryId)
+	if err != nil {
+		return internal.RestoreCheck{}, err
+	}
+	return a.restic.CheckRestore(r, snapshotId, data), nil
+}
+
+// Restore restores files from a snapshot. Unless forced, nothing is
+// restored while the check has warnings, they are returned instead.
+func (a *App) Restore(repositoryId string, snapshotId string, data internal.RestoreData) (internal.RestoreCheck, error) {
+	if internal.IsReadOnly() {
+		return internal.RestoreCheck{}, internal.ErrReadOnly
+	}
+	r, err := a.repository(repositoryId)
+	if err != nil {
+		return internal.RestoreCheck{}, err
+	}
+	if !data.Force {
+		if check := a.restic.CheckRestore(r, snapshotId, data); len(check.Warnings) > 0 {
+			return check, nil
+		}
+	}
+	err = a.restic.Restore(r, snapshotId, data)
+	a.audit("Restore", fmt.Sprintf("repository=%q snapshot=%q from_path=%q to_path=%q", r.Name, snapshotId, data.FromPath, data.ToPath), err)
+	if err != nil {
+		return internal.RestoreCheck{}, err
+	}
+	return internal.RestoreCheck{}, nil
+}
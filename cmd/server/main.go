@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/ad-on-is/resticity/frontend"
 	"github.com/ad-on-is/resticity/internal"
 
 	"github.com/charmbracelet/log"
@@ -26,24 +27,40 @@ func main() {
 	if r.FlagArgs.Help {
 		fmt.Println("resticity " + Version + " (build " + Build + ")")
 		flag.PrintDefaults()
+		internal.PrintCommands(os.Stdout)
 		os.Exit(0)
 	}
+	if len(r.Command()) > 0 {
+		runCommand(r, err)
+	}
 	if err == nil {
-		(r.Scheduler).RescheduleBackups()
-		internal.RunServer(
-			r.Scheduler,
-			r.Restic,
-			r.Settings,
-
-			&r.OutputChan,
-			&r.ErrorChan,
-			Version,
-			Build,
-		)
-
+		public, err := frontend.Public(r.FlagArgs.FrontendDir)
+		if err != nil {
+			log.Error("Resticity failed to load frontend", "error", err)
+			os.Exit(1)
+		}
+		if err := r.Serve(public, Version, Build); err != nil {
+			log.Error("Resticity failed to serve", "error", err)
+			os.Exit(1)
+		}
 	} else {
 		log.Error("Resticity failed to start", "error", err)
 		os.Exit(1)
 	}
 
 }
+
+// runCommand runs a command given on the command line instead of the app
+// and exits.
+func runCommand(r internal.Resticity, err error) {
+	if err != nil {
+		log.Error("Resticity failed to start", "error", err)
+		os.Exit(1)
+	}
+	public, err := frontend.Public(r.FlagArgs.FrontendDir)
+	if err != nil {
+		log.Error("Resticity failed to load frontend", "error", err)
+		os.Exit(1)
+	}
+	os.Exit(r.RunCommand(public, Version, Build))
+}
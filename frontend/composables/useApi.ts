@@ -1,51 +1,227 @@
 import _ from 'lodash'
 
 export const useApi = defineStore('useApi', () => {
-	const browseSnapshot = async (repoId: string, snapshotId: string, path: string): Promise<FileDescriptor[]> =>
-		(await useHttp.post(`/repositories/${repoId}/snapshots/${snapshotId}/browse`, { path: path })) ?? []
-	const restoreFromSnapshot = async (repoId: string, snapshotId: string, rootPath: string, fromPath: string, toPath: string) =>
-		(await useHttp.post(
-			`/repositories/${repoId}/snapshots/${snapshotId}/restore`,
-			{ root_path: rootPath, from_path: fromPath, to_path: toPath },
-			{},
-			{ title: 'Restoring', text: 'Successfully restored' }
-		)) ?? []
+	// the desktop app talks to its bindings instead of HTTP, which may be disabled
+	const desktopCall = async (fn: () => Promise<any>) => {
+		try {
+			return (await fn()) ?? 'OK'
+		} catch (e: any) {
+			useToast().add({ title: 'Error', description: String(e), icon: 'i-heroicons-exclamation-triangle', color: 'red' })
+			return null
+		}
+	}
+	const browseSnapshot = async (
+		repoId: string,
+		snapshotId: string,
+		path: string,
+		offset: number = 0,
+		limit: number = 200,
+		opts: { sort?: string; order?: string; filter?: string; dirs_first?: boolean } = { dirs_first: true }
+	): Promise<BrowseResult> =>
+		(isDesktop()
+			? await desktopCall(() =>
+					BrowseSnapshot(repoId, snapshotId, { path, offset, limit }, { Sort: opts.sort ?? '', Order: opts.order ?? '', Filter: opts.filter ?? '', DirsFirst: opts.dirs_first ?? false })
+				)
+			: await useHttp.post(`/repositories/${repoId}/snapshots/${snapshotId}/browse`, { path, offset, limit }, opts)) ?? { items: [], total: 0, offset, limit }
+	// the largest directories and files below path, to find what to exclude
+	const analyzeSnapshot = async (repoId: string, snapshotId: string, path: string, limit: number = 20, depth: number = 0): Promise<SizeAnalysis | null> =>
+		isDesktop()
+			? await desktopCall(() => AnalyzeSnapshot(repoId, snapshotId, { path, limit, depth }))
+			: await useHttp.post(`/repositories/${repoId}/snapshots/${snapshotId}/analyze`, { path, limit, depth })
+	const checkRestore = async (repoId: string, snapshotId: string, rootPath: string, fromPath: string, toPath: string): Promise<RestoreCheck> =>
+		(isDesktop()
+			? await desktopCall(() => CheckRestore(repoId, snapshotId, { root_path: rootPath, from_path: fromPath, to_path: toPath, force: false }))
+			: await useHttp.post(`/repositories/${repoId}/snapshots/${snapshotId}/restore-check`, { root_path: rootPath, from_path: fromPath, to_path: toPath })) ?? {
+			size: 0,
+			free: 0,
+			warnings: [],
+		}
+	const restoreFromSnapshot = async (repoId: string, snapshotId: string, rootPath: string, fromPath: string, toPath: string, force: boolean = false) => {
+		const data = { root_path: rootPath, from_path: fromPath, to_path: toPath, force }
+		if (isDesktop()) {
+			const res = await desktopCall(() => Restore(repoId, snapshotId, data))
+			if (res && !res.warnings?.length) {
+				useToast().add({ title: 'Restoring', description: 'Successfully restored', icon: 'i-heroicons-eye' })
+			}
+			return res ?? []
+		}
+		return (await useHttp.post(`/repositories/${repoId}/snapshots/${snapshotId}/restore`, data, {}, { title: 'Restoring', text: 'Successfully restored' })) ?? []
+	}
+	const exportHistory = async (format: string, from: string = '', to: string = '') => await useHttp.download(`/history/export`, { format, from, to })
+	const download = async (repoId: string, snapshotId: string, path: string, format: string = 'tar.gz') =>
+		await useHttp.download(`/repositories/${repoId}/snapshots/${snapshotId}/download`, { path, format })
 	const getSnapshots = async (repoId: string, groupBy: string = 'host'): Promise<SnapshotGroup[]> => {
-		const data = (await useHttp.post(`/repositories/${repoId}/snapshots?group_by=${groupBy}`)) ?? []
+		const data = (isDesktop() ? await desktopCall(async () => (await GetSnapshots(repoId, groupBy)) ?? []) : await useHttp.post(`/repositories/${repoId}/snapshots?group_by=${groupBy}`)) ?? []
 		return _.orderBy(data, ['time'], ['desc'])
 	}
+	// pinned snapshots survive every retention policy, restic gives them a new id
+	const pinSnapshot = async (repoId: string, snapshotId: string, pin: boolean) =>
+		isDesktop()
+			? await desktopCall(() => PinSnapshot(repoId, snapshotId, pin))
+			: await useHttp.post(`/repositories/${repoId}/snapshots/${snapshotId}/${pin ? 'pin' : 'unpin'}`, {}, {}, { title: pin ? 'Pinned' : 'Unpinned', text: pin ? 'The snapshot is kept by every retention policy' : 'The snapshot is subject to retention again' })
+	// an empty policy previews the one of the repository
+	const previewRetention = async (repoId: string, pruneParams: string[][] = []): Promise<ForgetGroup[]> =>
+		(isDesktop()
+			? await desktopCall(() => PreviewRetention(repoId, { prune_params: pruneParams }))
+			: await useHttp.post(`/repositories/${repoId}/forget-preview`, { prune_params: pruneParams })) ?? []
 	const mount = async (repoId: string, path: string) =>
 		(await useHttp.post(`/repositories/${repoId}/mount`, { path: path }, {}, { title: 'Mount', text: `Mounted to ${path}` })) ?? {}
 	const unmount = async (repoId: string, path: string) =>
 		(await useHttp.post(`/repositories/${repoId}/unmount`, { path: path }, {}, { title: 'Unmount', text: `Unmounted: ${path}` })) ?? {}
 
+	const deleteRepository = async (repoId: string) => (await useHttp.del(`/repositories/${repoId}`)) ?? {}
 	const statRepository = async (repoId: string) => (await useHttp.get(`/repositories/${repoId}/stats`)) ?? {}
-	const runSchedule = async (scheduleId: string) => (await useHttp.get(`/schedules/${scheduleId}/run`)) ?? {}
-	const stopSchedule = async (scheduleId: string) => (await useHttp.get(`/schedules/${scheduleId}/stop`)) ?? {}
-	const getConfig = async (): Promise<Config> => (await useHttp.get(`/config`)) ?? {}
-	const saveConfig = async (config: any) => (await useHttp.post(`/config`, config, {}, { title: 'Settings', text: 'Settings saved successfully' })) ?? {}
+	const runSchedule = async (scheduleId: string) =>
+		isDesktop() ? await desktopCall(() => RunNow(scheduleId)) : ((await useHttp.get(`/schedules/${scheduleId}/run`)) ?? {})
+	const stopSchedule = async (scheduleId: string) =>
+		isDesktop() ? await desktopCall(() => StopBackup(scheduleId)) : ((await useHttp.get(`/schedules/${scheduleId}/stop`)) ?? {})
+	const pauseSchedule = async (scheduleId: string, paused: boolean) =>
+		isDesktop() ? await desktopCall(() => PauseSchedule(scheduleId, paused)) : await useHttp.get(`/schedules/${scheduleId}/${paused ? 'pause' : 'resume'}`)
+	// only the desktop app gets to see the secrets
+	const getConfig = async (): Promise<Config> => (isDesktop() ? await desktopCall(() => GetConfig()) : await useHttp.get(`/config`)) ?? {}
+	const exportConfig = async (redact: boolean = true) => await useHttp.download(`/config/export`, { redact: String(redact) })
+	const importRepositories = async (text: string, dryRun: boolean) =>
+		await useHttp.post(`/repositories/import`, { text }, { dry_run: dryRun }, dryRun ? false : { title: 'Repositories', text: 'Repositories imported' })
+	const importConfig = async (config: any, dryRun: boolean) =>
+		await useHttp.post(`/config/import`, config, { dry_run: dryRun }, dryRun ? false : { title: 'Settings', text: 'Configuration imported' })
+	const importToolConfig = async (tool: string, text: string, dryRun: boolean) =>
+		await useHttp.post(`/config/import/${tool}`, { text }, { dry_run: dryRun }, dryRun ? false : { title: 'Settings', text: `${tool} configuration imported` })
+	const getConfigHistory = async () => (await useHttp.get(`/config/history`)) ?? []
+	const diffConfigVersion = async (id: string) => await useHttp.get(`/config/history/${id}/diff`)
+	const rollbackConfig = async (id: string) => await useHttp.post(`/config/history/${id}/rollback`, {}, {}, { title: 'Settings', text: 'Configuration restored' })
+	const getProfiles = async () => await useHttp.get(`/profiles`)
+	const switchProfile = async (name: string) => await useHttp.post(`/profiles/${encodeURIComponent(name)}`, {}, {}, { title: 'Profiles', text: `Switched to ${name}` })
+	const saveConfig = async (config: any) => {
+		if (!isDesktop()) {
+			return (await useHttp.post(`/config`, config, {}, { title: 'Settings', text: 'Settings saved successfully' })) ?? {}
+		}
+		const res = await desktopCall(() => SaveConfig(config))
+		if (res?.errors?.length) {
+			const description = res.errors.map((err: { field: string; message: string }) => `${err.field}: ${err.message}`).join('\n')
+			useToast().add({ title: 'Settings', description, icon: 'i-heroicons-exclamation-triangle', color: 'red' })
+			return { errors: res.errors }
+		}
+		if (res) {
+			useToast().add({ id: '/config', title: 'Settings', description: 'Settings saved successfully', icon: 'i-heroicons-eye' })
+		}
+		return res ?? {}
+	}
 	const checkRepository = async (repo: any) => (await useHttp.post(`/check`, repo, {}, { title: 'Check Repository', text: 'Repository can be used' })) ?? {}
+	const testCredentials = async (repo: any) => (await useHttp.post(`/repositories/test-credentials`, repo)) ?? null
 	const initRepository = async (repo: any) => (await useHttp.post(`/init`, repo, {}, { title: 'Init Repository', text: 'Repository initialized' })) ?? {}
-	const autoCompletePath = async (path: string) => (await useHttp.get(`/path/autocomplete`, { path })) ?? []
+	const autoCompletePath = async (path: string, files: boolean = false, hidden: boolean = true): Promise<PathEntry[]> =>
+		(await useHttp.get(`/path/autocomplete`, { path, files, hidden })) ?? []
+	const autoCompleteRemotePath = async (path: string): Promise<PathEntry[]> => (await useHttp.get(`/path/remote-autocomplete`, { path })) ?? []
+	const testNotification = async (provider: string) =>
+		(await useHttp.post(`/notifications/test/${provider}`, {}, {}, { title: 'Notifications', text: `Test notification sent via ${provider}` })) ?? ''
 	const getLogs = async () => (await useHttp.get(`/logs`)) ?? ({ logs: [], errors: [] } as { logs: string[]; errors: string[] })
+	const getAppLog = async (since: string = '', level: string = ''): Promise<LogEntry[]> => (await useHttp.get(`/applog`, { since, level })) ?? []
+	const followAppLog = (since: string, level: string, onEntry: (entry: LogEntry) => void) =>
+		useHttp.stream(`/applog`, { follow: 'true', since, level }, (data) => onEntry(JSON.parse(data)))
 	const getLogFile = async (file: string) => (await useHttp.get(`/logs/${file}`)) ?? ''
+	const getAuditLog = async (limit: number = 200): Promise<AuditEntry[]> =>
+		(isDesktop() ? await desktopCall(() => GetAuditLog(limit)) : await useHttp.get(`/audit`, { limit })) ?? []
+	// stats are summed per schedule or repository, or over time for one of them
+	const getStats = async (by: 'schedules' | 'repositories', since: string = '30d'): Promise<RunStats[]> => (await useHttp.get(`/stats/${by}`, { since })) ?? []
+	const getStatsOverTime = async (by: 'schedules' | 'repositories', id: string, since: string = '30d', bucket: string = 'day'): Promise<RunStats[]> =>
+		(await useHttp.get(`/stats/${by}/${id}`, { since, bucket })) ?? []
+	const getRepositoryGrowth = async (id: string, since: string = '90d'): Promise<RepositoryGrowth> =>
+		(await useHttp.get(`/repositories/${id}/growth`, { since })) ?? { points: [], bytes_per_day: 0, projected_30d: 0, projected_365d: 0 }
+	const getActivity = async (recent: number = 20): Promise<Activity | null> =>
+		isDesktop() ? await desktopCall(() => GetActivity(recent)) : await useHttp.get(`/activity`, { recent })
+	const previewCron = async (cron: string, timezone: string = Intl.DateTimeFormat().resolvedOptions().timeZone): Promise<CronPreview | null> =>
+		isDesktop() ? await desktopCall(() => PreviewCron({ cron, timezone })) : await useHttp.post(`/schedules/validate`, { cron, timezone })
+	// webhook tokens only exist over HTTP, the trigger needs the server
+	const createWebhookToken = async (id: string): Promise<string> => (await useHttp.post(`/schedules/${id}/webhook-token`))?.token ?? ''
+	const revokeWebhookToken = async (id: string) => await useHttp.del(`/schedules/${id}/webhook-token`, {}, { title: 'Webhook', text: 'Token revoked' })
+	// the latest run of every schedule, known right after a restart
+	const getLastRuns = async (): Promise<RunRecord[]> => (isDesktop() ? await desktopCall(() => GetLastRuns()) : await useHttp.get(`/schedules/last-runs`)) ?? []
+	const getScheduleRuns = async (id: string): Promise<RunInfo[]> => (await useHttp.get(`/schedules/${id}/runs`)) ?? []
+	const getRunLog = async (id: string, runId: string) => (await useHttp.get(`/schedules/${id}/runs/${runId}/log`)) ?? ''
+	const getPause = async () => await useHttp.get(`/pause`)
+	const pause = async (duration: string = '') =>
+		await useHttp.post(`/pause`, {}, duration ? { duration } : {}, { title: 'Backups paused', text: duration ? `Scheduled runs are skipped for ${duration}` : 'Scheduled runs are skipped until resumed' })
+	const resume = async () => await useHttp.del(`/pause`, {}, { title: 'Backups resumed', text: 'Schedules run again' })
+	const startMaintenance = async (reason: string = '') =>
+		await useHttp.post(`/maintenance`, { reason }, {}, { title: 'Maintenance mode', text: 'No runs are started until it ends' })
+	const endMaintenance = async () => await useHttp.del(`/maintenance`, {}, { title: 'Maintenance mode ended', text: 'Schedules run again' })
+	const restoreLatest = async (backupId: string, data: LatestRestoreData): Promise<LatestRestore> =>
+		await useHttp.post(`/backups/${backupId}/restore-latest`, data, {}, { title: 'Restoring', text: 'Restored from the latest snapshot' })
+	const getSetup = async (): Promise<SetupStatus> => await useHttp.get(`/setup`)
+	const detectRepositories = async (paths: string[] = []): Promise<DetectedRepository[]> =>
+		(await useHttp.get(`/setup/repositories`, paths.length > 0 ? { paths: paths.join(',') } : {})) ?? []
+	const setup = async (data: SetupData, dryRun: boolean = false) =>
+		await useHttp.post(`/setup`, data, { dry_run: dryRun }, dryRun ? false : { title: 'Setup', text: 'Configuration created' })
+	const getErrors = async (): Promise<ErrorEntry[]> => (await useHttp.get(`/errors`)) ?? []
+	const acknowledgeError = async (id: string = '') => await useHttp.post(id ? `/errors/${id}/acknowledge` : `/errors/acknowledge`, {})
+	const dismissError = async (id: string = '') => await useHttp.del(id ? `/errors/${id}` : `/errors`)
+	const getAutostart = async () => await useHttp.get(`/autostart`)
+	const setAutostart = async (autostart: { enabled: boolean; headless: boolean }) =>
+		await useHttp.put(`/autostart`, autostart, {}, { title: 'Autostart', text: autostart.enabled ? 'Resticity starts on login' : 'Autostart disabled' })
 	const getVersion = async () => (await useHttp.get(`/version`)) ?? { version: 'unknown', build: 'unknown' }
 	return {
 		browseSnapshot,
+		analyzeSnapshot,
+		checkRestore,
 		restoreFromSnapshot,
+		restoreLatest,
+		download,
+		exportHistory,
 		getSnapshots,
+		previewRetention,
+		pinSnapshot,
 		runSchedule,
 		stopSchedule,
+		pauseSchedule,
+		getPause,
+		pause,
+		startMaintenance,
+		endMaintenance,
+		resume,
+		getSetup,
+		detectRepositories,
+		setup,
+		getErrors,
+		acknowledgeError,
+		dismissError,
+		getAutostart,
+		setAutostart,
 		mount,
 		unmount,
 		getConfig,
 		saveConfig,
+		getConfigHistory,
+		diffConfigVersion,
+		rollbackConfig,
+		getProfiles,
+		switchProfile,
+		exportConfig,
+		importConfig,
+		importRepositories,
+		importToolConfig,
 		checkRepository,
+		testCredentials,
 		initRepository,
 		statRepository,
+		deleteRepository,
 		autoCompletePath,
+		autoCompleteRemotePath,
+		testNotification,
 		getLogs,
+		getAppLog,
+		followAppLog,
 		getLogFile,
+		getAuditLog,
+		getStats,
+		getStatsOverTime,
+		getRepositoryGrowth,
+		getActivity,
+		previewCron,
+		createWebhookToken,
+		revokeWebhookToken,
+		getLastRuns,
+		getScheduleRuns,
+		getRunLog,
 		getVersion,
 	}
 })
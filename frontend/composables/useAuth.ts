@@ -0,0 +1,29 @@
+export const useAuth = defineStore('useAuth', () => {
+	const token = ref('')
+
+	async function init() {
+		try {
+			token.value = await GetApiToken()
+			return
+		} catch (e) {
+			console.log('Not running in desktop mode, reading token from storage')
+		}
+		const fromUrl = useRoute().query.token
+		if (typeof fromUrl === 'string' && fromUrl !== '') {
+			setToken(fromUrl)
+			return
+		}
+		token.value = localStorage.getItem('resticity_token') ?? ''
+	}
+
+	function setToken(t: string) {
+		token.value = t
+		localStorage.setItem('resticity_token', t)
+	}
+
+	return {
+		token,
+		init,
+		setToken,
+	}
+})
@@ -0,0 +1,14 @@
+export const useErrors = defineStore('useErrors', () => {
+	const errors = ref<ErrorEntry[]>([])
+	const unread = computed(() => errors.value.filter((e) => !e.acknowledged).length)
+
+	async function refresh() {
+		errors.value = await useApi().getErrors()
+	}
+
+	return {
+		errors,
+		unread,
+		refresh,
+	}
+})
@@ -10,12 +10,14 @@ export default class HttpClient {
 	public static put = async (url: string, data: any, query: any = {}, notify: false | { title: string; text: string; type?: string } = false) =>
 		await this.doFetch(url, { method: 'put', query, body: data }, notify)
 
+	public static baseUrl = (): string => {
+		const url = useRequestURL()
+		const host = isDesktop() ? 'http://localhost:11278' : `${url.protocol}//${url.host}`
+		return `${host}/api`
+	}
+
 	public static doFetch = async (url: string, opts: { method: FetchMethod; body?: any; query?: any }, notify: false | { title: string; text: string; type?: string } = false) => {
-		const getUrl = (): string => {
-			const url = useRequestURL()
-			return url.protocol === 'wails:' || url.host.includes('wails.localhost') ? 'http://localhost:11278' : `${url.protocol}//${url.host}`
-		}
-		const baseUrl = `${getUrl()}/api`
+		const baseUrl = this.baseUrl()
 		try {
 			const res = await $fetch.raw(`${baseUrl}${url}`, {
 				method: opts.method,
@@ -23,6 +25,7 @@ export default class HttpClient {
 				query: opts.query,
 				headers: {
 					'content-type': 'application/json',
+					authorization: `Bearer ${useAuth().token}`,
 				},
 			})
 
@@ -38,13 +41,68 @@ export default class HttpClient {
 		}
 	}
 
+	// fetches a file with the token as header and saves it, a plain link
+	// would have to put the token into the URL
+	public static download = async (url: string, query: any = {}) => {
+		try {
+			const res = await $fetch.raw<Blob>(`${this.baseUrl()}${url}`, {
+				query,
+				responseType: 'blob',
+				headers: { authorization: `Bearer ${useAuth().token}` },
+			})
+			const a = document.createElement('a')
+			a.href = URL.createObjectURL(res._data as Blob)
+			a.download = /filename="?([^";]+)"?/.exec(res.headers.get('content-disposition') ?? '')?.[1] ?? 'download'
+			a.click()
+			setTimeout(() => URL.revokeObjectURL(a.href), 1000)
+		} catch (e: any) {
+			console.error(e)
+			this.notifyError(e)
+		}
+	}
+
+	// reads Server-Sent Events with fetch, EventSource can't send the token
+	// as header. Returns a function that stops reading.
+	public static stream = (url: string, query: any, onData: (data: string) => void): (() => void) => {
+		const ctrl = new AbortController()
+		const read = async () => {
+			const res = await fetch(`${this.baseUrl()}${url}?${new URLSearchParams(query)}`, {
+				headers: { authorization: `Bearer ${useAuth().token}` },
+				signal: ctrl.signal,
+			})
+			const reader = res.body!.pipeThrough(new TextDecoderStream()).getReader()
+			let buf = ''
+			for (;;) {
+				const { value, done } = await reader.read()
+				if (done) return
+				buf += value
+				const events = buf.split('\n\n')
+				buf = events.pop() ?? ''
+				for (const ev of events) {
+					const data = ev
+						.split('\n')
+						.filter((l) => l.startsWith('data:'))
+						.map((l) => l.slice(5).trimStart())
+						.join('\n')
+					if (data) onData(data)
+				}
+			}
+		}
+		read().catch((e) => {
+			if (e.name !== 'AbortError') console.error(e)
+		})
+		return () => ctrl.abort()
+	}
+
 	private static notifyError(e: any, notify: false | { title: string; text: string; type?: string } = false) {
 		let title = 'Error'
 		let message = 'Unexpected error occured'
 		if (notify) {
 			title = notify.title
 		}
-		if (e.data) {
+		if (e.data?.errors) {
+			message = e.data.errors.map((err: { field: string; message: string }) => `${err.field}: ${err.message}`).join('\n')
+		} else if (e.data) {
 			message = e.data
 		}
 		useToast().add({ title: title, description: message, icon: 'i-heroicons-exclamation-triangle', color: 'red' })
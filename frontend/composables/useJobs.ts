@@ -1,6 +1,26 @@
 export const useJobs = defineStore('useJobs', () => {
 	const running = ref([])
 	const progress = ref([])
+	const lastRuns = ref<RunRecord[]>([])
+	const queued = ref<QueuedJob[]>([])
+
+	// loadActivity takes the running and queued jobs from the server, instead
+	// of waiting for the next websocket message
+	async function loadActivity() {
+		const activity = await useApi().getActivity()
+		if (!activity) return
+		running.value = activity.running.map((r) => ({ id: r.schedule_id, out: r.progress ?? { running: true } })) as any
+		queued.value = activity.queued
+	}
+
+	async function loadLastRuns() {
+		const runs = await useApi().getLastRuns()
+		if (Array.isArray(runs)) lastRuns.value = runs
+	}
+
+	function lastRun(id: string): RunRecord | null {
+		return lastRuns.value.find((r) => r.schedule_id === id) ?? null
+	}
 
 	function scheduleIsRunning(id: string) {
 		const j = running.value?.find((job: any) => job.id === id)
@@ -55,6 +75,11 @@ export const useJobs = defineStore('useJobs', () => {
 	return {
 		running,
 		progress,
+		lastRuns,
+		loadLastRuns,
+		queued,
+		loadActivity,
+		lastRun,
 		scheduleIsRunning,
 		scheduleProgress,
 		repoIsRunning,
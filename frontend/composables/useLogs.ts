@@ -2,30 +2,38 @@ type Log = {
 	[id: string]: string[]
 }
 
+// like the server, only the recent output of a schedule is kept
+const maxLines = 500
+
+function append(log: Log, id: string, data: string) {
+	if (log[id] === undefined) {
+		log[id] = []
+	}
+	if (data !== '') {
+		log[id].push(data)
+		if (log[id].length > maxLines) {
+			log[id].splice(0, log[id].length - maxLines)
+		}
+	}
+}
+
 export const useLogs = defineStore('useLogs', () => {
 	const out = ref<Log>({})
 	const err = ref<Log>({})
 	const serverErr = ref<string[]>([])
 
 	function setOut(id: string, data: string) {
-		if (out.value[id] === undefined) {
-			out.value[id] = []
-		}
-		if (data !== '') {
-			out.value[id].push(data)
-		}
+		append(out.value, id, data)
 	}
 	function setErr(id: string, data: string) {
-		if (err.value[id] === undefined) {
-			err.value[id] = []
-		}
-		if (data !== '') {
-			err.value[id].push(data)
-		}
+		append(err.value, id, data)
 	}
 
 	function setServerError(data: string) {
 		serverErr.value.push(data)
+		if (serverErr.value.length > maxLines) {
+			serverErr.value.splice(0, serverErr.value.length - maxLines)
+		}
 	}
 
 	return {
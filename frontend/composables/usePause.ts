@@ -0,0 +1,18 @@
+export const usePause = defineStore('usePause', () => {
+	const empty = () => ({ paused: false, until: null, schedules: [], maintenance: { enabled: false, reason: '', since: null } })
+	const state = ref<{ paused: boolean; until: string | null; schedules: string[]; maintenance: { enabled: boolean; reason: string; since: string | null } }>(empty())
+
+	async function refresh() {
+		state.value = (await useApi().getPause()) ?? empty()
+	}
+
+	function scheduleIsPaused(id: string) {
+		return state.value.schedules?.includes(id) ?? false
+	}
+
+	return {
+		state,
+		refresh,
+		scheduleIsPaused,
+	}
+})
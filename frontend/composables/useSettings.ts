@@ -7,7 +7,11 @@ export const useSettings = defineStore('useSettings', () => {
 		settings.value = await useApi().getConfig()
 	}
 	async function save() {
-		await useApi().saveConfig(settings.value)
+		const res = await useApi().saveConfig(settings.value)
+		if (res?.errors) {
+			// rejected, show what is actually saved
+			await refresh()
+		}
 	}
 	return {
 		settings,
@@ -1,44 +1,77 @@
 export const useSocket = defineStore('useSocket', () => {
+	function setJob(id: string, out: any) {
+		useJobs().running = [...useJobs().running.filter((r: any) => r.id !== id), { id, out }]
+	}
+
+	function handleMessage(msg: any) {
+		const payload = typeof msg.payload === 'string' ? msg.payload : JSON.stringify(msg.payload)
+		switch (msg.type) {
+			case 'mounts':
+				useMounts().mounts = msg.payload || []
+				break
+			case 'errors':
+				useErrors().errors = msg.payload || []
+				break
+			case 'pause':
+				usePause().state = msg.payload
+				break
+			case 'config_reloaded':
+				useSettings().refresh()
+				useToast().add({ title: 'Settings', description: 'Configuration reloaded from disk', icon: 'i-heroicons-arrow-path' })
+				break
+			case 'component_restarted':
+				useLogs().setServerError(`${msg.payload?.component}: ${msg.payload?.error}`)
+				useToast().add({ title: 'Recovered from an error', description: `${msg.payload?.component} was restarted, see the logs`, icon: 'i-heroicons-exclamation-triangle', color: 'red' })
+				break
+			case 'warning':
+				useToast().add({ title: msg.payload?.title ?? 'Backup looks incomplete', description: msg.payload?.reason ?? payload, icon: 'i-heroicons-exclamation-triangle', color: 'orange' })
+				break
+			case 'job_started':
+				useLogs().setOut(msg.id, payload)
+				setJob(msg.id, msg.payload)
+				break
+			case 'job_done':
+				useLogs().setOut(msg.id, payload)
+				setJob(msg.id, msg.payload)
+				useJobs().loadLastRuns()
+				break
+			case 'job_progress':
+				useLogs().setOut(msg.id, payload)
+				setJob(msg.id, typeof msg.payload === 'object' ? msg.payload : {})
+				break
+			case 'error':
+				if (msg.id) {
+					useLogs().setErr(msg.id, payload)
+				} else {
+					useLogs().setServerError(payload)
+				}
+				break
+		}
+	}
+
 	function init() {
+		useJobs().loadActivity()
+		useJobs().loadLastRuns()
+		// the desktop app gets the same messages as runtime events
+		if (isDesktop()) {
+			EventsOn('message', handleMessage)
+			return
+		}
 		const getUrl = (): string => {
 			const url = useRequestURL()
 			return url.protocol === 'wails:' || url.host.includes('wails.localhost') ? 'ws://localhost:11278' : `${url.protocol === 'http:' ? 'ws:' : 'wss:'}//${url.host}`
 		}
-		const socket = new WebSocket(`${getUrl()}/api/ws`)
+		const socket = new WebSocket(`${getUrl()}/api/ws?token=${encodeURIComponent(useAuth().token)}`)
+		socket.onopen = () => {
+			socket.send(JSON.stringify({ action: 'subscribe', topics: ['job:*', 'system'] }))
+		}
 		socket.onmessage = (event) => {
 			try {
-				const data = JSON.parse(event.data)
-
-				data['jobs'].forEach((j: any) => {
-					if (j.out !== undefined) {
-						useLogs().setOut(j.id, j.out)
-					}
-					if (j.err !== undefined) {
-						useLogs().setErr(j.id, j.err)
-					}
-				})
-				console.log(data['mounts'])
-				useMounts().mounts = data['mounts'] || []
-				useJobs().running =
-					data['jobs'].map((j: any) => {
-						try {
-							j.out = JSON.parse(j.out)
-						} catch {
-							j.out = {}
-						}
-						return j
-					}) || []
+				handleMessage(JSON.parse(event.data))
 			} catch (e) {
-				useJobs().running = []
 				console.error(e)
 			}
 		}
-
-		const interval = setInterval(() => {
-			if (socket.readyState === 1) {
-				socket.send('ping')
-			}
-		}, 1000)
 	}
 
 	return {
@@ -0,0 +1,25 @@
+package frontend
+
+import (
+	"embed"
+	"io/fs"
+	"os"
+)
+
+// Assets holds the built frontend, run `./build.sh frontend` before
+// building any of the binaries.
+//
+//go:embed all:.output/public
+var Assets embed.FS
+
+// Public returns the root of the frontend. A non-empty dir overrides the
+// embedded files, which is useful to serve a development build from disk.
+func Public(dir string) (fs.FS, error) {
+	if dir != "" {
+		if _, err := os.Stat(dir); err != nil {
+			return nil, err
+		}
+		return os.DirFS(dir), nil
+	}
+	return fs.Sub(Assets, ".output/public")
+}
@@ -0,0 +1,21 @@
+package frontend
+
+import (
+	"embed"
+)
+
+// icons are embedded on their own, so the tray and notifications don't
+// depend on the frontend build.
+//
+//go:embed public/appicon.png public/appicon_active.png
+var icons embed.FS
+
+// Icon returns the app icon as PNG, highlighted while jobs are running.
+func Icon(active bool) []byte {
+	name := "public/appicon.png"
+	if active {
+		name = "public/appicon_active.png"
+	}
+	data, _ := icons.ReadFile(name)
+	return data
+}
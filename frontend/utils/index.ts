@@ -11,6 +11,23 @@ export function humanFileSize(size: number) {
 	return Number((size / Math.pow(1024, i)).toFixed(2)) * 1 + ' ' + ['B', 'kB', 'MB', 'GB', 'TB'][i]
 }
 
+// timeAgo turns a date into e.g. "2h ago"
+export function timeAgo(date: string | Date) {
+	const s = Math.max(0, Math.floor((Date.now() - new Date(date).getTime()) / 1000))
+	if (s < 60) return 'just now'
+	if (s < 3600) return `${Math.floor(s / 60)}m ago`
+	if (s < 86400) return `${Math.floor(s / 3600)}h ago`
+	return `${Math.floor(s / 86400)}d ago`
+}
+
+// humanDuration turns seconds into e.g. "1h 5m"
+export function humanDuration(seconds: number) {
+	const s = Math.max(0, Math.round(seconds))
+	if (s < 60) return `${s}s`
+	if (s < 3600) return `${Math.floor(s / 60)}m ${s % 60}s`
+	return `${Math.floor(s / 3600)}h ${Math.floor((s % 3600) / 60)}m`
+}
+
 export function getRepoIcon(r: Repository) {
 	switch (r.type) {
 		case 's3':
@@ -19,3 +36,26 @@ export function getRepoIcon(r: Repository) {
 			return 'i-heroicons-server'
 	}
 }
+
+// isDesktop tells whether the frontend runs inside the desktop app
+export function isDesktop() {
+	const url = useRequestURL()
+	return url.protocol === 'wails:' || url.host.includes('wails.localhost')
+}
+
+export type LabelSelection = { group: string; labels: string[] }
+
+// matchesLabels is the filter of the list endpoints: the group and all
+// labels have to match, empty matches everything
+export function matchesLabels(item: { group?: string; labels?: string[] }, filter: LabelSelection) {
+	if (filter.group && (item.group ?? '').toLowerCase() !== filter.group.toLowerCase()) return false
+	return filter.labels.every((l) => (item.labels ?? []).some((x) => x.toLowerCase() === l.toLowerCase()))
+}
+
+// parseLabels turns "a, b" into a list without empty labels or commas
+export function parseLabels(text: string) {
+	return text
+		.split(',')
+		.map((l) => l.trim())
+		.filter((l) => l !== '')
+}
@@ -1,14 +1,48 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
 import {internal} from '../models';
-import {uuid} from '../models';
+import {main} from '../models';
+
+export function AnalyzeSnapshot(arg1:string,arg2:string,arg3:internal.AnalyzeData):Promise<internal.SizeAnalysis>;
+
+export function BrowseSnapshot(arg1:string,arg2:string,arg3:internal.BrowseData,arg4:internal.BrowseOptions):Promise<internal.BrowseResult>;
+
+export function CheckRestore(arg1:string,arg2:string,arg3:internal.RestoreData):Promise<internal.RestoreCheck>;
 
 export function FakeCreateForModels():Promise<internal.SnapshotGroup>;
 
+export function GetActivity(arg1:number):Promise<internal.Activity>;
+
+export function GetApiToken():Promise<string>;
+
+export function GetAuditLog(arg1:number):Promise<Array<internal.AuditEntry>>;
+
+export function GetConfig():Promise<internal.Config>;
+
+export function GetLastRuns():Promise<Array<internal.RunRecord>>;
+
+export function GetRunningJobs():Promise<Array<string>>;
+
+export function GetSnapshots(arg1:string,arg2:string):Promise<Array<internal.SnapshotGroup>>;
+
+export function PauseSchedule(arg1:string,arg2:boolean):Promise<internal.PauseState>;
+
+export function PinSnapshot(arg1:string,arg2:string,arg3:boolean):Promise<void>;
+
+export function PreviewCron(arg1:internal.CronPreviewData):Promise<internal.CronPreview>;
+
+export function PreviewRetention(arg1:string,arg2:internal.ForgetPreviewData):Promise<Array<internal.ForgetGroup>>;
+
+export function Restore(arg1:string,arg2:string,arg3:internal.RestoreData):Promise<internal.RestoreCheck>;
+
+export function RunNow(arg1:string):Promise<void>;
+
+export function SaveConfig(arg1:internal.Config):Promise<main.ConfigResult>;
+
 export function SaveIcon(arg1:Array<number>,arg2:string):Promise<void>;
 
 export function SelectDirectory(arg1:string):Promise<string>;
 
 export function SelectFile(arg1:string):Promise<string>;
 
-export function StopBackup(arg1:uuid.UUID):Promise<void>;
+export function StopBackup(arg1:string):Promise<void>;
@@ -2,10 +2,78 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
 
+export function AnalyzeSnapshot(arg1, arg2, arg3) {
+  return window['go']['main']['App']['AnalyzeSnapshot'](arg1, arg2, arg3);
+}
+
+export function BrowseSnapshot(arg1, arg2, arg3, arg4) {
+  return window['go']['main']['App']['BrowseSnapshot'](arg1, arg2, arg3, arg4);
+}
+
+export function CheckRestore(arg1, arg2, arg3) {
+  return window['go']['main']['App']['CheckRestore'](arg1, arg2, arg3);
+}
+
 export function FakeCreateForModels() {
   return window['go']['main']['App']['FakeCreateForModels']();
 }
 
+export function GetActivity(arg1) {
+  return window['go']['main']['App']['GetActivity'](arg1);
+}
+
+export function GetApiToken() {
+  return window['go']['main']['App']['GetApiToken']();
+}
+
+export function GetAuditLog(arg1) {
+  return window['go']['main']['App']['GetAuditLog'](arg1);
+}
+
+export function GetConfig() {
+  return window['go']['main']['App']['GetConfig']();
+}
+
+export function GetLastRuns() {
+  return window['go']['main']['App']['GetLastRuns']();
+}
+
+export function GetRunningJobs() {
+  return window['go']['main']['App']['GetRunningJobs']();
+}
+
+export function GetSnapshots(arg1, arg2) {
+  return window['go']['main']['App']['GetSnapshots'](arg1, arg2);
+}
+
+export function PauseSchedule(arg1, arg2) {
+  return window['go']['main']['App']['PauseSchedule'](arg1, arg2);
+}
+
+export function PinSnapshot(arg1, arg2, arg3) {
+  return window['go']['main']['App']['PinSnapshot'](arg1, arg2, arg3);
+}
+
+export function PreviewCron(arg1) {
+  return window['go']['main']['App']['PreviewCron'](arg1);
+}
+
+export function PreviewRetention(arg1, arg2) {
+  return window['go']['main']['App']['PreviewRetention'](arg1, arg2);
+}
+
+export function Restore(arg1, arg2, arg3) {
+  return window['go']['main']['App']['Restore'](arg1, arg2, arg3);
+}
+
+export function RunNow(arg1) {
+  return window['go']['main']['App']['RunNow'](arg1);
+}
+
+export function SaveConfig(arg1) {
+  return window['go']['main']['App']['SaveConfig'](arg1);
+}
+
 export function SaveIcon(arg1, arg2) {
   return window['go']['main']['App']['SaveIcon'](arg1, arg2);
 }
@@ -1,18 +1,103 @@
 export namespace internal {
 	
+	export interface AuditEntry {
+	    // Go type: time
+	    time: any;
+	    user: string;
+	    role: string;
+	    method: string;
+	    path: string;
+	    status: number;
+	    summary: string;
+	    request_id?: string;
+	}
+	export interface AppSettingsAutostart {
+	    enabled: boolean;
+	    headless: boolean;
+	}
+	export interface AppSettingsLogging {
+	    level: string;
+	    format: string;
+	    max_size_mb: number;
+	    max_files: number;
+	}
 	export interface AppSettingsNotifications {
 	    on_schedule_error: boolean;
 	    on_schedule_success: boolean;
 	    on_schedule_start: boolean;
+	    on_warning: boolean;
 	}
 	export interface AppSettingsHooks {
 	    on_schedule_error: string;
 	    on_schedule_success: string;
 	    on_schedule_start: string;
 	}
+	export interface AppSettingsSmtp {
+	    enabled: boolean;
+	    host: string;
+	    port: number;
+	    username: string;
+	    password: string;
+	    from: string;
+	    to: string[];
+	    on_failure: boolean;
+	    on_success: boolean;
+	    daily_digest: boolean;
+	    digest_hour: number;
+	}
+	export interface AppSettingsNtfy {
+	    enabled: boolean;
+	    server: string;
+	    topic: string;
+	    token: string;
+	    on_failure: boolean;
+	    on_success: boolean;
+	    priority_failure: number;
+	    priority_success: number;
+	}
+	export interface AppSettingsGotify {
+	    enabled: boolean;
+	    server: string;
+	    token: string;
+	    on_failure: boolean;
+	    on_success: boolean;
+	    priority_failure: number;
+	    priority_success: number;
+	}
+	export interface AppSettingsTelegram {
+	    enabled: boolean;
+	    bot_token: string;
+	    chat_id: string;
+	    on_failure: boolean;
+	    on_success: boolean;
+	    on_warning: boolean;
+	    ui_url: string;
+	}
+	export interface NotificationRule {
+	    id: string;
+	    event: string;
+	    schedules: string[];
+	    consecutive: number;
+	    notifiers: string[];
+	    title: string;
+	    body: string;
+	}
 	export interface AppSettings {
 	    theme: string;
 	    preserve_error_logs_days: number;
+	    auto_unlock_hours: number;
+	    smtp: AppSettingsSmtp;
+	    ntfy: AppSettingsNtfy;
+	    gotify: AppSettingsGotify;
+	    telegram: AppSettingsTelegram;
+	    notification_rules: NotificationRule[];
+	    autostart: AppSettingsAutostart;
+	    logging: AppSettingsLogging;
+	    config_history: number;
+	    run_logs: number;
+	    anomaly_percent: number;
+	    catch_up_after_sleep: boolean;
+	    cache_dir: string;
 	    hooks: AppSettingsHooks;
 	    notifications: AppSettingsNotifications;
 	}
@@ -25,6 +110,13 @@ export namespace internal {
 	    cron: string;
 	    backup_params: string[][];
 	    targets: string[];
+	    tuning: BackupTuning;
+	}
+	export interface BackupTuning {
+	    read_concurrency: number;
+	    no_scan: boolean;
+	    ignore_inode: boolean;
+	    ignore_ctime: boolean;
 	}
 	export interface Schedule {
 	    id: string;
@@ -36,15 +128,70 @@ export namespace internal {
 	    active: boolean;
 	    last_run: string;
 	    last_error: string;
+	    ping_start_url: string;
+	    ping_success_url: string;
+	    ping_fail_url: string;
+	    prune_params: string[][];
+	    trigger: ScheduleTrigger;
+	    webhook_token_hash: string;
+	    group: string;
+	    labels: string[];
+	}
+	export interface ScheduleTrigger {
+	    type: string;
+	    quiet_minutes: number;
+	    min_interval_minutes: number;
+	    mountpoint: string;
+	    uuid: string;
 	}
 	export interface Options {
 	    s3_key: string;
 	    s3_secret: string;
+	    s3_session_token: string;
+	    s3_profile: string;
+	    s3_shared_credentials_file: string;
 	    azure_account_name: string;
 	    azure_account_key: string;
 	    azure_account_sas: string;
+	    azure_endpoint_suffix: string;
 	    google_project_id: string;
 	    google_application_credentials: string;
+	    google_credentials_json: string;
+	    tls_cacert: string;
+	    tls_client_cert: string;
+	    tls_insecure: boolean;
+	}
+	export interface Maintenance {
+	    enabled: boolean;
+	    reason: string;
+	    since?: string;
+	}
+	export interface DetectedRepository {
+	    path: string;
+	    location: string;
+	    configured: boolean;
+	}
+	export interface ErrorEntry {
+	    id: string;
+	    source: string;
+	    subject: string;
+	    title: string;
+	    message: string;
+	    count: number;
+	    first: string;
+	    last: string;
+	    acknowledged: boolean;
+	}
+	export interface PauseState {
+	    paused: boolean;
+	    until?: string;
+	    schedules: string[];
+	    maintenance: Maintenance;
+	}
+	export interface RepositoryQuota {
+	    bytes: number;
+	    warn_at: number[];
+	    block: boolean;
 	}
 	export interface Repository {
 	    id: string;
@@ -56,13 +203,71 @@ export namespace internal {
 	    password_file: string;
 	    // Go type: Options
 	    options: any;
+	    compression: string;
+	    env: {[key: string]: string};
+	    quota: RepositoryQuota;
+	    read_only: boolean;
+	    group: string;
+	    labels: string[];
+	}
+	export interface RepositoryImport {
+	    repositories: Repository[];
+	    skipped: string[];
+	    warnings: string[];
+	}
+	export interface SectionDiff {
+	    added: string[];
+	    removed: string[];
+	    changed: string[];
+	}
+	export interface ConfigDiff {
+	    repositories: SectionDiff;
+	    backups: SectionDiff;
+	    schedules: SectionDiff;
+	    app_settings_changed: boolean;
+	}
+	export interface ToolImport {
+	    diff: ConfigDiff;
+	    repositories: Repository[];
+	    backups: Backup[];
+	    schedules: Schedule[];
+	    skipped: string[];
+	    warnings: string[];
+	}
+	export interface HistoryEntry {
+	    id: string;
+	    time: string;
+	    user: string;
+	}
+	export interface LabelIndex {
+	    groups: string[];
+	    labels: string[];
 	}
 	export interface Config {
+	    schema_version: number;
 	    repositories: Repository[];
 	    backups: Backup[];
 	    schedules: Schedule[];
 	    app_settings: AppSettings;
 	}
+	export interface ResticInfo {
+	    found: boolean;
+	    path: string;
+	    version: string;
+	    error: string;
+	}
+	export interface SetupStatus {
+	    first_run: boolean;
+	    restic: ResticInfo;
+	    config_file: string;
+	    cache_dir: string;
+	}
+	export interface SetupData {
+	    repositories: Repository[];
+	    backups: Backup[];
+	    schedules: Schedule[];
+	    cache_dir: string;
+	}
 	export interface FileDescriptor {
 	    name: string;
 	    type: string;
@@ -70,6 +275,23 @@ export namespace internal {
 	    size: number;
 	    mtime: string;
 	}
+	export interface BrowseData {
+	    path: string;
+	    offset: number;
+	    limit: number;
+	}
+	export interface BrowseOptions {
+	    Sort: string;
+	    Order: string;
+	    Filter: string;
+	    DirsFirst: boolean;
+	}
+	export interface BrowseResult {
+	    items: FileDescriptor[];
+	    total: number;
+	    offset: number;
+	    limit: number;
+	}
 	export interface GroupKey {
 	    hostname: string;
 	    paths: string[];
@@ -77,12 +299,172 @@ export namespace internal {
 	}
 	
 	
-	export interface ScheduleObject {
+	export interface LogEntry {
+	    // Go type: time
+	    time: any;
+	    level: string;
+	    line: string;
+	}
+	export interface GrowthPoint {
+	    // Go type: time
+	    time: any;
+	    size: number;
+	}
+	export interface RepositoryGrowth {
+	    points: GrowthPoint[];
+	    bytes_per_day: number;
+	    projected_30d: number;
+	    projected_365d: number;
+	}
+	export interface RunStats {
+	    key: string;
+	    runs: number;
+	    failed: number;
+	    duration_seconds: number;
+	    files_new: number;
+	    files_changed: number;
+	    data_added: number;
+	    data_added_packed: number;
+	    total_bytes_processed: number;
+	}
+	export interface AnalyzeData {
+	    path: string;
+	    limit: number;
+	    depth: number;
+	}
+	export interface DirSize {
+	    path: string;
+	    size: number;
+	    files: number;
+	}
+	export interface SizeAnalysis {
+	    path: string;
+	    size: number;
+	    files: number;
+	    dirs: DirSize[];
+	    largest_files: FileDescriptor[];
+	}
+	export interface CronPreviewData {
+	    cron: string;
+	    timezone: string;
+	}
+	export interface CronPreview {
+	    valid: boolean;
+	    error?: string;
+	    description: string;
+	    timezone: string;
+	    // Go type: time
+	    next: any[];
+	}
+	export interface RunningJob {
+	    schedule_id: string;
+	    run_id: string;
+	    name: string;
+	    action: string;
+	    // Go type: time
+	    started: any;
+	    progress: any;
+	}
+	export interface QueuedJob {
+	    schedule_id: string;
+	    name: string;
+	    action: string;
+	    // Go type: time
+	    at: any;
+	    manual: boolean;
+	}
+	export interface Activity {
+	    running: RunningJob[];
+	    queued: QueuedJob[];
+	    recent: RunRecord[];
+	}
+	export interface BackupSummary {
+	    files_new: number;
+	    files_changed: number;
+	    files_unmodified: number;
+	    data_added: number;
+	    data_added_packed: number;
+	    total_files_processed: number;
+	    total_bytes_processed: number;
+	    total_duration: number;
+	    snapshot_id: string;
+	}
+	export interface RunRecord {
+	    id: string;
+	    schedule_id: string;
+	    action: string;
+	    // Go type: time
+	    started: any;
+	    // nanoseconds
+	    duration: number;
+	    error: string;
+	    snapshot_id: string;
+	    repository_id: string;
+	    summary?: BackupSummary;
+	}
+	export interface RunInfo {
+	    id: string;
+	    // Go type: time
+	    started: any;
+	    size: number;
+	}
+	export interface PathEntry {
+	    name: string;
+	    path: string;
+	    is_dir: boolean;
+	    size: number;
+	}
+	export interface FieldError {
+	    field: string;
+	    message: string;
+	}
+	export interface RestoreData {
+	    root_path: string;
+	    from_path: string;
+	    to_path: string;
+	    force: boolean;
+	}
+	export interface RestoreWarning {
+	    code: string;
+	    message: string;
+	}
+	export interface LatestRestoreData {
+	    repository_id: string;
+	    paths: string[];
+	    to_path: string;
+	    host: string;
+	    force: boolean;
+	}
+	export interface RestoreCheck {
+	    size: number;
+	    free: number;
+	    warnings: RestoreWarning[];
+	}
+	export interface LatestRestore {
+	    snapshot: Snapshot;
+	    check: RestoreCheck;
+	}
+		export interface ScheduleObject {
 	    schedule: Schedule;
 	    to_repository?: Repository;
 	    from_repository?: Repository;
 	    backup?: Backup;
 	}
+	export interface ForgetPreviewData {
+	    prune_params: string[][];
+	}
+	export interface KeepReason {
+	    snapshot: Snapshot;
+	    matches: string[];
+	}
+	export interface ForgetGroup {
+	    host: string;
+	    paths: string[];
+	    tags: string[];
+	    keep: Snapshot[];
+	    remove: Snapshot[];
+	    reasons: KeepReason[];
+	}
 	export interface Snapshot {
 	    id: string;
 	    // Go type: time
@@ -103,3 +485,11 @@ export namespace internal {
 
 }
 
+export namespace main {
+	
+	export interface ConfigResult {
+	    errors: internal.FieldError[];
+	}
+
+}
+
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/png"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/ad-on-is/resticity/frontend"
+	"github.com/charmbracelet/log"
+	"github.com/energye/systray"
+)
+
+// trayIcons are the monochrome idle icon for the current desktop theme
+// and the colored one shown while jobs are running.
+type trayIcons struct {
+	dark   bool
+	idle   []byte
+	active []byte
+}
+
+func newTrayIcons(dark bool) trayIcons {
+	fg := color.NRGBA{A: 255}
+	if dark {
+		fg = color.NRGBA{R: 255, G: 255, B: 255, A: 255}
+	}
+	return trayIcons{
+		dark:   dark,
+		idle:   monochromeIcon(frontend.Icon(false), fg),
+		active: frontend.Icon(true),
+	}
+}
+
+// animateTrayIcon blinks the icon while running reports jobs, and follows
+// changes of the desktop theme.
+func animateTrayIcon(running chan int) {
+	icons := newTrayIcons(darkTheme())
+	setTrayIcon(icons, false)
+	blink := time.NewTicker(700 * time.Millisecond)
+	blink.Stop()
+	theme := time.NewTicker(30 * time.Second)
+	active := 0
+	on := false
+	for {
+		select {
+		case n := <-running:
+			if n > 0 && active == 0 {
+				blink.Reset(700 * time.Millisecond)
+				on = true
+				setTrayIcon(icons, true)
+			} else if n == 0 && active > 0 {
+				blink.Stop()
+				on = false
+				setTrayIcon(icons, false)
+			}
+			active = n
+		case <-blink.C:
+			on = !on
+			setTrayIcon(icons, on)
+		case <-theme.C:
+			if dark := darkTheme(); dark != icons.dark {
+				icons = newTrayIcons(dark)
+				setTrayIcon(icons, on)
+			}
+		}
+	}
+}
+
+// setTrayIcon shows an icon in the format the platform expects. On macOS
+// the idle icon is a template, which the menu bar tints by itself.
+func setTrayIcon(icons trayIcons, active bool) {
+	icon := icons.idle
+	if active {
+		icon = icons.active
+	}
+	switch runtime.GOOS {
+	case "windows":
+		systray.SetIcon(pngToIco(icon))
+	case "darwin":
+		if active {
+			systray.SetIcon(icon)
+			return
+		}
+		systray.SetTemplateIcon(icon, icon)
+	default:
+		systray.SetIcon(icon)
+	}
+}
+
+// darkTheme asks the desktop whether it uses a dark theme, the tray of
+// most desktops follows it.
+func darkTheme() bool {
+	switch runtime.GOOS {
+	case "windows":
+		out, err := exec.Command("reg", "query", `HKCU\Software\Microsoft\Windows\CurrentVersion\Themes\Personalize`, "/v", "SystemUsesLightTheme").Output()
+		return err == nil && strings.Contains(string(out), "0x0")
+	case "darwin":
+		out, err := exec.Command("defaults", "read", "-g", "AppleInterfaceStyle").Output()
+		return err == nil && strings.Contains(string(out), "Dark")
+	default:
+		if out, err := exec.Command("gsettings", "get", "org.gnome.desktop.interface", "color-scheme").Output(); err == nil {
+			return strings.Contains(string(out), "dark")
+		}
+		if out, err := exec.Command("gsettings", "get", "org.gnome.desktop.interface", "gtk-theme").Output(); err == nil {
+			return strings.Contains(strings.ToLower(string(out)), "dark")
+		}
+		// most panels are dark
+		return true
+	}
+}
+
+// pngToIco wraps a PNG in an ICO container, which Windows requires and
+// which may hold PNG data as is since Vista.
+func pngToIco(icon []byte) []byte {
+	cfg, err := png.DecodeConfig(bytes.NewReader(icon))
+	if err != nil {
+		log.Error("tray: decode icon", "err", err)
+		return icon
+	}
+	// 0 stands for 256 pixels or more
+	size := func(n int) uint8 {
+		if n >= 256 {
+			return 0
+		}
+		return uint8(n)
+	}
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, []uint16{0, 1, 1})
+	buf.Write([]byte{size(cfg.Width), size(cfg.Height), 0, 0})
+	binary.Write(&buf, binary.LittleEndian, []uint16{1, 32})
+	binary.Write(&buf, binary.LittleEndian, []uint32{uint32(len(icon)), 6 + 16})
+	buf.Write(icon)
+	return buf.Bytes()
+}
+
+// monochromeIcon keeps only the shape of the icon, drawn in fg. macOS
+// template icons are drawn from their alpha channel the same way.
+func monochromeIcon(icon []byte, fg color.NRGBA) []byte {
+	img, err := png.Decode(bytes.NewReader(icon))
+	if err != nil {
+		log.Error("tray: decode icon", "err", err)
+		return icon
+	}
+	b := img.Bounds()
+	out := image.NewNRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			_, _, _, a := img.At(x, y).RGBA()
+			c := fg
+			c.A = uint8(a >> 8)
+			out.SetNRGBA(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, out); err != nil {
+		log.Error("tray: encode monochrome icon", "err", err)
+		return icon
+	}
+	return buf.Bytes()
+}
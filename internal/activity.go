@@ -0,0 +1,108 @@
+package internal
+
+import (
+	"slices"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Activity is everything the scheduler is doing and has just done, so a
+// client gets the whole picture in one request.
+type Activity struct {
+	Running []RunningJob `json:"running"`
+	Queued  []QueuedJob  `json:"queued"`
+	Recent  []RunRecord  `json:"recent"`
+}
+
+type RunningJob struct {
+	ScheduleId string    `json:"schedule_id"`
+	RunId      string    `json:"run_id"`
+	Name       string    `json:"name"`
+	Action     string    `json:"action"`
+	Started    time.Time `json:"started"`
+	// Progress is the last status line restic printed, nil before the first
+	Progress any `json:"progress"`
+}
+
+// QueuedJob is a run that hasn't started yet, either triggered manually or
+// the next one of its cron expression.
+type QueuedJob struct {
+	ScheduleId string    `json:"schedule_id"`
+	Name       string    `json:"name"`
+	Action     string    `json:"action"`
+	At         time.Time `json:"at"`
+	Manual     bool      `json:"manual"`
+}
+
+// defaultRecentRuns is how many finished runs Activity returns by default.
+const defaultRecentRuns = 20
+
+// jobProgress returns when the current run of a job started and the last
+// progress restic sent for it.
+func jobProgress(id string) (time.Time, any) {
+	stateMux.Lock()
+	defer stateMux.Unlock()
+	var started time.Time
+	var progress any
+	if out, ok := jobOutput[id]; ok {
+		for _, env := range out.all() {
+			switch env.Type {
+			case MsgJobStarted:
+				if started.IsZero() {
+					started = env.Timestamp
+				}
+			case MsgJobProgress:
+				progress = env.Payload
+			}
+		}
+	}
+	return started, progress
+}
+
+// Activity collects the running jobs with their progress, the runs that are
+// about to start, soonest first, and the last finished runs.
+func (s *Scheduler) Activity(recent int) (Activity, error) {
+	activity := Activity{Running: []RunningJob{}, Queued: []QueuedJob{}}
+	pause := s.PauseState()
+	for _, j := range s.jobs.All() {
+		name := s.ScheduleName(j.Schedule)
+		switch {
+		case j.Running:
+			started, progress := jobProgress(j.Id)
+			activity.Running = append(activity.Running, RunningJob{
+				ScheduleId: j.Id,
+				RunId:      j.RunId,
+				Name:       name,
+				Action:     j.Schedule.Action,
+				Started:    started,
+				Progress:   progress,
+			})
+		case j.Force:
+			activity.Queued = append(activity.Queued, QueuedJob{ScheduleId: j.Id, Name: name, Action: j.Schedule.Action, At: time.Now(), Manual: true})
+		case !pause.Paused && !slices.Contains(pause.Schedules, j.Id):
+			if at, ok := s.NextRun(j.Id); ok {
+				activity.Queued = append(activity.Queued, QueuedJob{ScheduleId: j.Id, Name: name, Action: j.Schedule.Action, At: at})
+			}
+		}
+	}
+	slices.SortStableFunc(activity.Queued, func(a, b QueuedJob) int { return a.At.Compare(b.At) })
+
+	runs, err := s.Store.Runs("", recent)
+	if err != nil {
+		return activity, err
+	}
+	activity.Recent = runs
+	return activity, nil
+}
+
+func serveActivity(scheduler *Scheduler) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		activity, err := scheduler.Activity(c.QueryInt("recent", defaultRecentRuns))
+		if err != nil {
+			c.SendStatus(500)
+			return c.SendString(err.Error())
+		}
+		return c.JSON(activity)
+	}
+}
@@ -0,0 +1,96 @@
+package internal
+
+import (
+	"path"
+	"strings"
+)
+
+// defaultAnalyzeLimit is how many directories and files an analysis
+// returns by default.
+const defaultAnalyzeLimit = 20
+
+type AnalyzeData struct {
+	Path  string `json:"path"`
+	Limit int    `json:"limit"`
+	// Depth only counts directories at most this far below path, 0 counts
+	// all
+	Depth int `json:"depth"`
+}
+
+// DirSize is a directory with everything below it.
+type DirSize struct {
+	Path  string `json:"path"`
+	Size  uint64 `json:"size"`
+	Files uint64 `json:"files"`
+}
+
+// SizeAnalysis tells where the space of a snapshot goes, to find what's
+// worth excluding.
+type SizeAnalysis struct {
+	Path         string           `json:"path"`
+	Size         uint64           `json:"size"`
+	Files        uint64           `json:"files"`
+	Dirs         []DirSize        `json:"dirs"`
+	LargestFiles []FileDescriptor `json:"largest_files"`
+}
+
+// AnalyzeSnapshot sums up the sizes of the files below data.Path per
+// directory and returns the largest directories and files. Directories
+// contain their subdirectories, so a big one shows up with its parents.
+func (r *Restic) AnalyzeSnapshot(repository Repository, snapshotId string, data AnalyzeData) (SizeAnalysis, error) {
+	root := strings.TrimSuffix(data.Path, "/")
+	if root == "" {
+		root = "/"
+	}
+	limit := data.Limit
+	if limit <= 0 || limit > MaxBrowseLimit {
+		limit = defaultAnalyzeLimit
+	}
+	res := SizeAnalysis{Path: root, Dirs: []DirSize{}, LargestFiles: []FileDescriptor{}}
+	dirs := map[string]*DirSize{}
+	bySize := BrowseOptions{Sort: "size", Order: "desc"}
+	files := &browseHeap{opts: bySize}
+
+	err := r.ListSnapshot(repository, snapshotId, data.Path, true, func(fd FileDescriptor) {
+		if fd.Type != "file" {
+			return
+		}
+		res.Size += fd.Size
+		res.Files++
+		files.add(fd, limit)
+		for dir := path.Dir(fd.Path); dir != root && strings.HasPrefix(dir, root) && dir != "/" && dir != "."; dir = path.Dir(dir) {
+			if data.Depth > 0 && dirDepth(root, dir) > data.Depth {
+				continue
+			}
+			d, ok := dirs[dir]
+			if !ok {
+				d = &DirSize{Path: dir}
+				dirs[dir] = d
+			}
+			d.Size += fd.Size
+			d.Files++
+		}
+	})
+	if err != nil {
+		return res, err
+	}
+
+	top := &browseHeap{opts: bySize}
+	for _, d := range dirs {
+		top.add(FileDescriptor{Name: path.Base(d.Path), Type: "dir", Path: d.Path, Size: d.Size}, limit)
+	}
+	for _, fd := range top.sorted() {
+		res.Dirs = append(res.Dirs, *dirs[fd.Path])
+	}
+	res.LargestFiles = append(res.LargestFiles, files.sorted()...)
+	return res, nil
+}
+
+// dirDepth is how many levels dir is below root.
+func dirDepth(root string, dir string) int {
+	rel := strings.Trim(strings.TrimPrefix(dir, root), "/")
+	if rel == "" {
+		return 0
+	}
+	return strings.Count(rel, "/") + 1
+}
@@ -0,0 +1,126 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+)
+
+const (
+	// anomalyBaselineRuns successful backups make the baseline, at least
+	// anomalyMinRuns of them before anything is reported
+	anomalyBaselineRuns = 10
+	anomalyMinRuns      = 3
+)
+
+// BackupAnomaly is sent as MsgWarning when a backup processed far less
+// than the schedule usually does, e.g. because its source wasn't mounted.
+type BackupAnomaly struct {
+	ScheduleId     string `json:"schedule_id"`
+	RunId          string `json:"run_id"`
+	Reason         string `json:"reason"`
+	FilesProcessed uint64 `json:"files_processed"`
+	BaselineFiles  uint64 `json:"baseline_files"`
+	BytesProcessed uint64 `json:"bytes_processed"`
+	BaselineBytes  uint64 `json:"baseline_bytes"`
+}
+
+// Baseline returns a metric of the latest successful runs of a schedule,
+// newest first, leaving out the given run.
+func (s *Store) Baseline(scheduleId string, name string, excludeRunId string, n int) ([]float64, error) {
+	values := []float64{}
+	if s == nil {
+		return values, nil
+	}
+	rows, err := s.db.Query(
+		`SELECT m.value FROM runs r JOIN metrics m ON m.run_id = r.id
+		WHERE r.schedule_id = ? AND r.error = '' AND r.id != ? AND m.name = ?
+		ORDER BY r.started DESC LIMIT ?`,
+		scheduleId, excludeRunId, name, n,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var v float64
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, rows.Err()
+}
+
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	m := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[m-1] + sorted[m]) / 2
+	}
+	return sorted[m]
+}
+
+// detectAnomaly compares a finished backup with the median of the previous
+// ones. Backups that process nothing, or less than AnomalyPercent of the
+// usual files or bytes, are suspicious.
+func (s *Scheduler) detectAnomaly(report JobReport) *BackupAnomaly {
+	percent := s.settings.Config.AppSettings.AnomalyPercent
+	if percent == 0 || report.Action != "backup" || report.Error != "" || report.Summary == nil {
+		return nil
+	}
+	files, err := s.Store.Baseline(report.ScheduleId, "total_files_processed", report.RunId, anomalyBaselineRuns)
+	if err != nil {
+		s.jobLog(report.ScheduleId).Warn("anomaly baseline", "err", err)
+		return nil
+	}
+	bytes, err := s.Store.Baseline(report.ScheduleId, "total_bytes_processed", report.RunId, anomalyBaselineRuns)
+	if err != nil {
+		s.jobLog(report.ScheduleId).Warn("anomaly baseline", "err", err)
+		return nil
+	}
+	if len(files) < anomalyMinRuns || len(bytes) < anomalyMinRuns {
+		return nil
+	}
+	a := &BackupAnomaly{
+		ScheduleId:     report.ScheduleId,
+		RunId:          report.RunId,
+		FilesProcessed: report.Summary.TotalFilesProcessed,
+		BaselineFiles:  uint64(median(files)),
+		BytesProcessed: report.Summary.TotalBytesProcessed,
+		BaselineBytes:  uint64(median(bytes)),
+	}
+	below := func(v uint64, baseline uint64) bool {
+		return float64(v) < float64(baseline)*float64(percent)/100
+	}
+	switch {
+	case a.FilesProcessed == 0 && a.BaselineFiles > 0:
+		a.Reason = "no files were backed up"
+	case below(a.FilesProcessed, a.BaselineFiles):
+		a.Reason = fmt.Sprintf("%d files instead of usually %d", a.FilesProcessed, a.BaselineFiles)
+	case below(a.BytesProcessed, a.BaselineBytes):
+		a.Reason = fmt.Sprintf("%d bytes instead of usually %d", a.BytesProcessed, a.BaselineBytes)
+	default:
+		return nil
+	}
+	return a
+}
+
+// reportAnomaly warns about a suspicious backup through the log, the
+// clients and the notifiers.
+func (s *Scheduler) reportAnomaly(report JobReport) {
+	a := s.detectAnomaly(report)
+	if a == nil {
+		return
+	}
+	s.jobLog(report.ScheduleId).Warn("backup anomaly", "reason", a.Reason)
+	if j, err := json.Marshal(a); err == nil {
+		(*s.OutputCh) <- ChanMsg{Id: report.ScheduleId, Type: MsgWarning, Msg: string(j), Time: time.Now()}
+	}
+	s.Notify.Warning("Backup looks incomplete", report.Name+": "+a.Reason+", is the source available?")
+}
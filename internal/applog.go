@@ -0,0 +1,212 @@
+package internal
+
+import (
+	"bufio"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/gofiber/fiber/v2"
+)
+
+const appLogSize = 1000
+
+type LogEntry struct {
+	Time  time.Time `json:"time"`
+	Level string    `json:"level"`
+	Line  string    `json:"line"`
+}
+
+// appLogBuffer keeps the latest lines of the application log for the log
+// viewer. It must never log itself, it sits behind the logger.
+type appLogBuffer struct {
+	mu          sync.Mutex
+	entries     []LogEntry
+	subscribers map[chan LogEntry]bool
+}
+
+var appLog = &appLogBuffer{subscribers: make(map[chan LogEntry]bool)}
+
+var textLevels = map[string]string{"DEBU": "debug", "INFO": "info", "WARN": "warn", "ERRO": "error", "FATA": "fatal"}
+
+// lineLevel reads the level of a line in text or json format.
+func lineLevel(line string) string {
+	if strings.HasPrefix(line, "{") {
+		var l struct {
+			Level string `json:"level"`
+		}
+		if json.Unmarshal([]byte(line), &l) == nil && l.Level != "" {
+			return l.Level
+		}
+		return "info"
+	}
+	fields := strings.Fields(line)
+	for i := 0; i < len(fields) && i < 4; i++ {
+		if l, ok := textLevels[fields[i]]; ok {
+			return l
+		}
+	}
+	return "info"
+}
+
+// atLeast tells whether level is as severe as min, an empty min matches
+// everything.
+func atLeast(level string, min string) bool {
+	if min == "" || level == "fatal" {
+		return true
+	}
+	return slices.Index(logLevels, level) >= slices.Index(logLevels, min)
+}
+
+func (b *appLogBuffer) Write(p []byte) (int, error) {
+	now := time.Now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		e := LogEntry{Time: now, Level: lineLevel(line), Line: line}
+		b.entries = append(b.entries, e)
+		for ch := range b.subscribers {
+			select {
+			case ch <- e:
+			default:
+				delete(b.subscribers, ch)
+				close(ch)
+			}
+		}
+	}
+	if len(b.entries) > appLogSize {
+		b.entries = b.entries[len(b.entries)-appLogSize:]
+	}
+	return len(p), nil
+}
+
+// Entries returns the buffered lines logged after since with at least the
+// given level.
+func (b *appLogBuffer) Entries(since time.Time, level string) []LogEntry {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.entriesLocked(since, level)
+}
+
+func (b *appLogBuffer) entriesLocked(since time.Time, level string) []LogEntry {
+	res := []LogEntry{}
+	for _, e := range b.entries {
+		if e.Time.After(since) && atLeast(e.Level, level) {
+			res = append(res, e)
+		}
+	}
+	return res
+}
+
+// Subscribe returns a channel receiving new lines and the buffered lines
+// Entries would return.
+func (b *appLogBuffer) Subscribe(since time.Time, level string) (chan LogEntry, []LogEntry) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ch := make(chan LogEntry, 256)
+	b.subscribers[ch] = true
+	return ch, b.entriesLocked(since, level)
+}
+
+func (b *appLogBuffer) Unsubscribe(ch chan LogEntry) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subscribers[ch]; ok {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+// Close ends all subscriptions, used on shutdown.
+func (b *appLogBuffer) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+// parseSince accepts a time in RFC 3339 or a duration like 15m or 30d back
+// from now.
+func parseSince(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return time.Now().AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// serveAppLog returns the recent application log, with follow=true as
+// Server-Sent Events that continue with new lines.
+func serveAppLog(c *fiber.Ctx) error {
+	since, err := parseSince(c.Query("since"))
+	if err != nil {
+		c.SendStatus(400)
+		return c.SendString("Invalid since, use RFC 3339 or a duration like 15m")
+	}
+	level := c.Query("level")
+	if level != "" && !slices.Contains(logLevels, level) {
+		c.SendStatus(400)
+		return c.SendString("Invalid level, use debug, info, warn or error")
+	}
+	if !c.QueryBool("follow") {
+		return c.JSON(appLog.Entries(since, level))
+	}
+
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	ch, replay := appLog.Subscribe(since, level)
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer appLog.Unsubscribe(ch)
+		write := func(e LogEntry) {
+			if j, err := json.Marshal(e); err == nil {
+				writeEvent(w, Event{Data: string(j)})
+			}
+		}
+		for _, e := range replay {
+			write(e)
+		}
+		if err := w.Flush(); err != nil {
+			return
+		}
+
+		keepalive := time.NewTicker(15 * time.Second)
+		defer keepalive.Stop()
+		for {
+			select {
+			case e, ok := <-ch:
+				if !ok {
+					return
+				}
+				if !atLeast(e.Level, level) {
+					continue
+				}
+				write(e)
+			case <-keepalive.C:
+				fmt.Fprint(w, ": keepalive\n\n")
+			}
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	})
+	return nil
+}
@@ -0,0 +1,77 @@
+package internal
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/charmbracelet/log"
+)
+
+// WindowState is where the desktop window was left, restored on start.
+type WindowState struct {
+	Width     int  `json:"width"`
+	Height    int  `json:"height"`
+	X         int  `json:"x"`
+	Y         int  `json:"y"`
+	Maximised bool `json:"maximised"`
+	// minimized to the tray
+	Hidden bool `json:"hidden"`
+}
+
+// AppState keeps what the app remembers between starts but isn't a
+// setting, in state.json next to the config file.
+type AppState struct {
+	file  string
+	state struct {
+		Window WindowState `json:"window"`
+	}
+	mux sync.Mutex
+}
+
+func NewAppState(settings *Settings) *AppState {
+	a := &AppState{}
+	a.file = filepath.Join(filepath.Dir(settings.file), "state.json")
+	a.state.Window = WindowState{Width: 1024, Height: 768}
+
+	if data, err := os.ReadFile(a.file); err == nil {
+		if err := json.Unmarshal(data, &a.state); err != nil {
+			log.Error("state: unmarshal", "err", err)
+		}
+	} else if !os.IsNotExist(err) {
+		log.Error("state: read file", "err", err)
+	}
+
+	return a
+}
+
+func (a *AppState) save() error {
+	str, err := json.MarshalIndent(a.state, " ", " ")
+	if err != nil {
+		log.Error("state: marshal indent", "err", err)
+		return err
+	}
+	if err := os.WriteFile(a.file, str, 0644); err != nil {
+		log.Error("state: write", "err", err)
+		return err
+	}
+	return nil
+}
+
+func (a *AppState) Window() WindowState {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	return a.state.Window
+}
+
+// SetWindow stores the window state, writing only when it changed.
+func (a *AppState) SetWindow(w WindowState) error {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	if w == a.state.Window {
+		return nil
+	}
+	a.state.Window = w
+	return a.save()
+}
@@ -0,0 +1,118 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// AuditEntry is a change made through the API or the desktop app.
+type AuditEntry struct {
+	Time      time.Time `json:"time"`
+	User      string    `json:"user"`
+	Role      Role      `json:"role"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Status    int       `json:"status"`
+	Summary   string    `json:"summary"`
+	RequestId string    `json:"request_id,omitempty"`
+}
+
+const (
+	// summaries stay short, the audit log is not a backup of the payloads
+	auditSummaryMax = 500
+	auditValueMax   = 60
+)
+
+// auditLog records every request that changes something, the same
+// requests read-only mode refuses. It has to run after the auth middleware.
+func auditLog(store *Store) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !changesState(c) {
+			return c.Next()
+		}
+		summary := auditSummary(c)
+		err := c.Next()
+		status := c.Response().StatusCode()
+		if e, ok := err.(*fiber.Error); ok {
+			status = e.Code
+		} else if err != nil {
+			status = 500
+		}
+		e := AuditEntry{
+			Method:    c.Method(),
+			Path:      c.Path(),
+			Status:    status,
+			Summary:   summary,
+			RequestId: requestID(c),
+		}
+		if i := identityFromCtx(c); i != nil {
+			e.User = i.Username
+			e.Role = i.Role
+		}
+		store.Audit(e)
+		return err
+	}
+}
+
+// auditSummary describes the query and body of a request, secrets are
+// masked and nested values only counted.
+func auditSummary(c *fiber.Ctx) string {
+	parts := []string{}
+	c.Context().QueryArgs().VisitAll(func(k []byte, v []byte) {
+		if string(k) != "token" {
+			parts = append(parts, auditValue(string(k), string(v)))
+		}
+	})
+	var body map[string]any
+	if len(c.Body()) > 0 && json.Unmarshal(c.Body(), &body) == nil {
+		keys := make([]string, 0, len(body))
+		for k := range body {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			parts = append(parts, auditValue(k, body[k]))
+		}
+	}
+	summary := strings.Join(parts, " ")
+	if len(summary) > auditSummaryMax {
+		summary = summary[:auditSummaryMax] + "…"
+	}
+	return summary
+}
+
+func auditValue(key string, v any) string {
+	switch t := v.(type) {
+	case []any:
+		return fmt.Sprintf("%s=[%d]", key, len(t))
+	case map[string]any:
+		return fmt.Sprintf("%s={%d}", key, len(t))
+	case nil:
+		return key + "=null"
+	case string:
+		if t != "" && isSecretKey(key) {
+			return key + "=" + redacted
+		}
+		t = MaskSecrets(t)
+		if len(t) > auditValueMax {
+			t = t[:auditValueMax] + "…"
+		}
+		return fmt.Sprintf("%s=%q", key, t)
+	}
+	return fmt.Sprintf("%s=%v", key, v)
+}
+
+func isSecretKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, s := range []string{"password", "token", "secret", "key", "sas"} {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,146 @@
+package internal
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+)
+
+type Auth struct {
+	file  string
+	token string
+	mux   sync.RWMutex
+	Users *Users
+}
+
+// NewAuth loads the API token and generates it if there is none yet.
+// Commands pass generate false, they must not replace the token of a
+// running instance.
+func NewAuth(settings *Settings, generate bool) *Auth {
+	a := &Auth{}
+	a.file = filepath.Join(filepath.Dir(settings.file), "token")
+	a.Users = NewUsers(settings)
+
+	if data, err := os.ReadFile(a.file); err == nil && len(strings.TrimSpace(string(data))) > 0 {
+		a.token = strings.TrimSpace(string(data))
+		log.Info("Loaded API token", "file", a.file)
+	} else if generate {
+		if _, err := a.Rotate(); err != nil {
+			log.Error("auth: generate token", "err", err)
+		} else {
+			log.Info("Generated new API token", "file", a.file)
+			// shown once on the console, the log file and the logs page
+			// must not hand it out
+			fmt.Fprintf(os.Stderr, "API token: %s\n", a.token)
+		}
+	}
+
+	return a
+}
+
+func (a *Auth) Token() string {
+	a.mux.RLock()
+	defer a.mux.RUnlock()
+	return a.token
+}
+
+func (a *Auth) Rotate() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	a.token = token
+	if err := os.WriteFile(a.file, []byte(token), 0600); err != nil {
+		log.Error("auth: write token", "err", err)
+		return token, err
+	}
+	return token, nil
+}
+
+func (a *Auth) Valid(token string) bool {
+	t := a.Token()
+	if t == "" || token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1
+}
+
+// queryTokenPaths can't send headers from a browser: websocket upgrades and
+// EventSource. Anywhere else a token in the URL would end up in access
+// logs and Referer headers.
+var queryTokenPaths = []string{"/api/ws", "/api/events"}
+
+// tokenFromRequest reads the bearer token from the Authorization header,
+// falling back to the token query param on queryTokenPaths.
+func tokenFromRequest(c *fiber.Ctx) string {
+	if h := c.Get(fiber.HeaderAuthorization); strings.HasPrefix(h, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(h, "Bearer "))
+	}
+	if slices.Contains(queryTokenPaths, c.Path()) {
+		return c.Query("token")
+	}
+	return ""
+}
+
+// Identify resolves a request token to an identity. The API token always
+// acts as admin, anything else has to be a user session.
+func (a *Auth) Identify(token string) *Identity {
+	if a.Valid(token) {
+		return &Identity{Username: "api-token", Role: RoleAdmin}
+	}
+	return a.Users.Identify(token)
+}
+
+func (a *Auth) Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if c.Method() == fiber.MethodOptions {
+			return c.Next()
+		}
+		identity := a.Identify(tokenFromRequest(c))
+		if identity == nil {
+			c.SendStatus(401)
+			return c.SendString("Unauthorized")
+		}
+		c.Locals("identity", identity)
+		return c.Next()
+	}
+}
+
+func identityFromCtx(c *fiber.Ctx) *Identity {
+	if i, ok := c.Locals("identity").(*Identity); ok {
+		return i
+	}
+	return nil
+}
+
+func hasRole(c *fiber.Ctx, role Role) bool {
+	i := identityFromCtx(c)
+	return i != nil && i.Role.Allows(role)
+}
+
+func forbidden(c *fiber.Ctx) error {
+	c.SendStatus(403)
+	return c.SendString("Forbidden")
+}
+
+func RequireRole(role Role) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !hasRole(c, role) {
+			return forbidden(c)
+		}
+		return c.Next()
+	}
+}
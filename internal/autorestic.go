@@ -0,0 +1,392 @@
+package internal
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// autoresticBackendPrefixes are the restic location prefixes of autorestic's
+// backend types, local paths have none.
+var autoresticBackendPrefixes = map[string]string{
+	"local": "", "b2": "b2:", "s3": "s3:", "sftp": "sftp:", "rest": "rest:",
+	"azure": "azure:", "gs": "gs:", "rclone": "rclone:", "swift": "swift:",
+}
+
+// parseAutorestic maps backends to repositories and locations to backups
+// with a backup schedule per backend, and a forget schedule when the
+// location forgets after backing up.
+func parseAutorestic(text string) (toolConfig, error) {
+	root, err := parseYamlSubset(text)
+	if err != nil {
+		return toolConfig{}, fmt.Errorf("not an autorestic config: %w", err)
+	}
+	doc, ok := root.(*yamlMap)
+	if !ok {
+		return toolConfig{}, fmt.Errorf("not an autorestic config: expected locations and backends")
+	}
+	t := toolConfig{warnings: []string{}}
+	repos := map[string]string{}
+	if backends, ok := doc.get("backends").(*yamlMap); ok {
+		for _, name := range backends.keys {
+			b, _ := backends.get(name).(*yamlMap)
+			if b == nil {
+				continue
+			}
+			typ := b.str("type")
+			prefix, ok := autoresticBackendPrefixes[typ]
+			if !ok {
+				t.warn("%s has the unknown type %s, it was left out", name, typ)
+				continue
+			}
+			location := b.str("path")
+			if !strings.HasPrefix(location, prefix) {
+				location = prefix + location
+			}
+			vars := map[string]string{"RESTIC_REPOSITORY": location, "RESTIC_PASSWORD": b.str("key")}
+			if env, ok := b.get("env").(*yamlMap); ok {
+				for _, k := range env.keys {
+					// autorestic upper-cases the variables it passes
+					vars[strings.ToUpper(k)] = env.str(k)
+				}
+			}
+			r := repositoryFromEnv(vars)
+			r.Name = name
+			if r.Password == "" {
+				t.warn("%s has no key, autorestic may read it from .autorestic.env as AUTORESTIC_%s_RESTIC_PASSWORD", name, strings.ToUpper(name))
+			}
+			if b.get("options") != nil {
+				t.warn("The options of %s were left out", name)
+			}
+			repos[name] = r.Id
+			t.repositories = append(t.repositories, r)
+		}
+	}
+	if locations, ok := doc.get("locations").(*yamlMap); ok {
+		for _, name := range locations.keys {
+			l, _ := locations.get(name).(*yamlMap)
+			if l == nil {
+				continue
+			}
+			if l.str("type") == "volume" {
+				t.warn("%s backs up a docker volume, it was left out", name)
+				continue
+			}
+			targets := []string{}
+			for _, to := range l.list("to") {
+				if id, ok := repos[to]; ok {
+					targets = append(targets, id)
+				} else {
+					t.warn("%s backs up to the unknown backend %s", name, to)
+				}
+			}
+			if len(targets) == 0 {
+				continue
+			}
+			options, _ := l.get("options").(*yamlMap)
+			params := autoresticOptions(options, "backup")
+			retention := [][]string{}
+			for _, p := range autoresticOptions(options, "forget") {
+				if isRetentionParam(p) {
+					retention = append(retention, p)
+				}
+			}
+			if l.get("hooks") != nil {
+				t.warn("The hooks of %s were left out", name)
+			}
+			b := t.addBackup(name, l.list("from"), params, targets)
+			if b == nil {
+				continue
+			}
+			cron := l.str("cron")
+			forget := l.str("forget")
+			for _, id := range targets {
+				t.addSchedule("backup", b.Id, id, cron, [][]string{})
+				if (forget == "yes" || forget == "prune" || forget == "true") && len(retention) > 0 {
+					t.addSchedule("forget-repository", "", id, cron, retention)
+				}
+				if forget == "prune" {
+					t.addSchedule("prune-repository", "", id, cron, [][]string{})
+				}
+			}
+		}
+	}
+	return t, nil
+}
+
+// autoresticOptions turns the options of a command, and those for all
+// commands, into restic flags, e.g. exclude: [a, b] into --exclude a
+// --exclude b.
+func autoresticOptions(options *yamlMap, command string) [][]string {
+	params := [][]string{}
+	if options == nil {
+		return params
+	}
+	for _, section := range []string{"all", command} {
+		o, _ := options.get(section).(*yamlMap)
+		if o == nil {
+			continue
+		}
+		for _, k := range o.keys {
+			flag := "--" + k
+			if len(k) == 1 {
+				flag = "-" + k
+			}
+			values := o.list(k)
+			if len(values) == 0 || (len(values) == 1 && (values[0] == "true" || values[0] == "")) {
+				params = append(params, []string{flag})
+				continue
+			}
+			for _, v := range values {
+				params = append(params, []string{flag, v})
+			}
+		}
+	}
+	return params
+}
+
+// yamlMap keeps the order of its keys, so imported backups keep the order of
+// the file.
+type yamlMap struct {
+	keys   []string
+	values map[string]any
+}
+
+func (m *yamlMap) get(key string) any {
+	if m == nil {
+		return nil
+	}
+	return m.values[key]
+}
+
+func (m *yamlMap) str(key string) string {
+	s, _ := m.get(key).(string)
+	return s
+}
+
+// list reads a value that may be a single string or a list of them.
+func (m *yamlMap) list(key string) []string {
+	switch v := m.get(key).(type) {
+	case string:
+		return []string{v}
+	case []any:
+		l := []string{}
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				l = append(l, s)
+			}
+		}
+		return l
+	}
+	return []string{}
+}
+
+type yamlLine struct {
+	indent int
+	text   string
+	number int
+}
+
+// parseYamlSubset reads the YAML autorestic configs are written in: block
+// mappings and sequences, flow sequences, quoted and plain scalars and
+// literal blocks. Scalars stay strings, anchors and tags aren't supported.
+func parseYamlSubset(text string) (any, error) {
+	lines := []yamlLine{}
+	for i, l := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		content := strings.TrimRight(stripYamlComment(l), " \t")
+		trimmed := strings.TrimLeft(content, " ")
+		if trimmed == "" || trimmed == "---" {
+			continue
+		}
+		lines = append(lines, yamlLine{indent: len(content) - len(trimmed), text: trimmed, number: i + 1})
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("empty document")
+	}
+	p := &yamlParser{lines: lines}
+	v, err := p.block(lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.lines) {
+		return nil, fmt.Errorf("line %d: unexpected indentation", p.lines[p.pos].number)
+	}
+	return v, nil
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+func (p *yamlParser) block(indent int) (any, error) {
+	if isYamlItem(p.lines[p.pos].text) {
+		return p.sequence(indent)
+	}
+	return p.mapping(indent)
+}
+
+func (p *yamlParser) sequence(indent int) (any, error) {
+	items := []any{}
+	for p.pos < len(p.lines) && p.lines[p.pos].indent == indent && isYamlItem(p.lines[p.pos].text) {
+		l := p.lines[p.pos]
+		rest := strings.TrimLeft(l.text[1:], " ")
+		if rest == "" {
+			p.pos++
+			if p.pos < len(p.lines) && p.lines[p.pos].indent > indent {
+				v, err := p.block(p.lines[p.pos].indent)
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, v)
+			} else {
+				items = append(items, "")
+			}
+			continue
+		}
+		if _, _, isKey := splitYamlKey(rest); isKey {
+			// - key: value starts a mapping indented like its first key
+			p.lines[p.pos] = yamlLine{indent: indent + len(l.text) - len(rest), text: rest, number: l.number}
+			v, err := p.mapping(p.lines[p.pos].indent)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, v)
+			continue
+		}
+		p.pos++
+		items = append(items, yamlScalar(rest))
+	}
+	return items, nil
+}
+
+func (p *yamlParser) mapping(indent int) (any, error) {
+	m := &yamlMap{keys: []string{}, values: map[string]any{}}
+	for p.pos < len(p.lines) && p.lines[p.pos].indent == indent {
+		l := p.lines[p.pos]
+		key, value, ok := splitYamlKey(l.text)
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key: value", l.number)
+		}
+		p.pos++
+		var v any = value
+		switch {
+		case value == "|" || value == ">" || value == "|-" || value == ">-":
+			block := []string{}
+			for p.pos < len(p.lines) && p.lines[p.pos].indent > indent {
+				block = append(block, p.lines[p.pos].text)
+				p.pos++
+			}
+			sep := "\n"
+			if value[0] == '>' {
+				sep = " "
+			}
+			v = strings.Join(block, sep)
+		case value != "":
+			v = yamlScalar(value)
+		case p.pos < len(p.lines) && (p.lines[p.pos].indent > indent || (p.lines[p.pos].indent == indent && isYamlItem(p.lines[p.pos].text))):
+			var err error
+			if v, err = p.block(p.lines[p.pos].indent); err != nil {
+				return nil, err
+			}
+		}
+		if !slices.Contains(m.keys, key) {
+			m.keys = append(m.keys, key)
+		}
+		m.values[key] = v
+	}
+	return m, nil
+}
+
+func isYamlItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// splitYamlKey splits key: value at the first colon outside of quotes that
+// is followed by a space or ends the line.
+func splitYamlKey(s string) (string, string, bool) {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case (c == '"' || c == '\'') && i == 0:
+			quote = c
+		case c == '[' || c == '{':
+			if i == 0 {
+				return "", "", false
+			}
+		case c == ':' && (i == len(s)-1 || s[i+1] == ' '):
+			return unquote(strings.TrimSpace(s[:i])), strings.TrimSpace(s[i+1:]), true
+		}
+	}
+	return "", "", false
+}
+
+// yamlScalar reads a quoted or plain scalar or a flow sequence.
+func yamlScalar(s string) any {
+	if strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]") {
+		items := []any{}
+		for _, item := range splitYamlFlow(s[1 : len(s)-1]) {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, yamlScalar(item))
+			}
+		}
+		return items
+	}
+	if strings.HasPrefix(s, "'") {
+		return strings.ReplaceAll(unquote(s), "''", "'")
+	}
+	if strings.HasPrefix(s, `"`) {
+		return strings.ReplaceAll(unquote(s), `\"`, `"`)
+	}
+	if s == "~" || s == "null" {
+		return ""
+	}
+	return s
+}
+
+// splitYamlFlow splits at commas outside of quotes.
+func splitYamlFlow(s string) []string {
+	parts := []string{}
+	var quote byte
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// stripYamlComment cuts a # comment that starts the line or follows a
+// space, outside of quotes.
+func stripYamlComment(l string) string {
+	var quote byte
+	for i := 0; i < len(l); i++ {
+		switch c := l[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			if i == 0 || l[i-1] == ' ' || l[i-1] == '[' || l[i-1] == ',' || l[i-1] == '-' {
+				quote = c
+			}
+		case c == '#' && (i == 0 || l[i-1] == ' ' || l[i-1] == '\t'):
+			return l[:i]
+		}
+	}
+	return l
+}
@@ -0,0 +1,62 @@
+package internal
+
+import (
+	"errors"
+	"os"
+
+	"github.com/charmbracelet/log"
+)
+
+var ErrAutostartUnsupported = errors.New("Autostart is not supported on this system")
+
+// AutostartState is the setting along with what is actually installed.
+type AutostartState struct {
+	AppSettingsAutostart
+	Installed bool `json:"installed"`
+	Supported bool `json:"supported"`
+}
+
+// autostartCommand starts this binary with the current config and profile,
+// hidden in the tray or headless.
+func (s *Settings) autostartCommand(a AppSettingsAutostart) (string, []string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", nil, err
+	}
+	args := []string{"--background"}
+	if a.Headless {
+		args = []string{"--headless"}
+	}
+	args = append(args, "--config", s.base)
+	if p := s.Profile(); p != DefaultProfile {
+		args = append(args, "--profile", p)
+	}
+	return exe, args, nil
+}
+
+// SyncAutostart installs or removes the autostart entry to match the
+// setting. Installing again keeps the path current if the binary moved.
+func (s *Settings) SyncAutostart() error {
+	a := s.Config.AppSettings.Autostart
+	if !a.Enabled {
+		if !autostartInstalled() {
+			return nil
+		}
+		log.Info("Removing autostart entry")
+		return removeAutostart()
+	}
+	exe, args, err := s.autostartCommand(a)
+	if err != nil {
+		return err
+	}
+	log.Info("Installing autostart entry", "exe", exe, "args", args)
+	return installAutostart(exe, args)
+}
+
+func (s *Settings) AutostartState() AutostartState {
+	return AutostartState{
+		AppSettingsAutostart: s.Config.AppSettings.Autostart,
+		Installed:            autostartInstalled(),
+		Supported:            autostartSupported,
+	}
+}
@@ -0,0 +1,59 @@
+//go:build darwin
+
+package internal
+
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const autostartSupported = true
+
+func autostartFile() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, "Library", "LaunchAgents", "com.ad-on-is.resticity.plist")
+}
+
+func plistString(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return "<string>" + b.String() + "</string>"
+}
+
+// installAutostart writes a launchd agent, loaded on the next login.
+func installAutostart(exe string, args []string) error {
+	program := []string{plistString(exe)}
+	for _, a := range args {
+		program = append(program, plistString(a))
+	}
+	plist := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>com.ad-on-is.resticity</string>
+	<key>ProgramArguments</key>
+	<array>
+		` + strings.Join(program, "\n\t\t") + `
+	</array>
+	<key>RunAtLoad</key>
+	<true/>
+</dict>
+</plist>
+`
+	if err := os.MkdirAll(filepath.Dir(autostartFile()), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(autostartFile(), []byte(plist), 0644)
+}
+
+func removeAutostart() error {
+	return os.Remove(autostartFile())
+}
+
+func autostartInstalled() bool {
+	_, err := os.Stat(autostartFile())
+	return err == nil
+}
@@ -0,0 +1,57 @@
+//go:build linux
+
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/adrg/xdg"
+)
+
+const autostartSupported = true
+
+func autostartFile() string {
+	return filepath.Join(xdg.ConfigHome, "autostart", "resticity.desktop")
+}
+
+// desktopExecArg quotes an argument for the Exec key of a desktop entry.
+func desktopExecArg(arg string) string {
+	if !strings.ContainsAny(arg, " \t\n\"'\\><~|&;$*?#()`") {
+		return arg
+	}
+	// escaped twice, as string values unescape backslashes before quoting
+	r := strings.NewReplacer(`\`, `\\\\`, `"`, `\\"`, "`", "\\\\`", `$`, `\\$`)
+	return `"` + r.Replace(arg) + `"`
+}
+
+func installAutostart(exe string, args []string) error {
+	cmd := []string{desktopExecArg(exe)}
+	for _, a := range args {
+		cmd = append(cmd, desktopExecArg(a))
+	}
+	entry := strings.Join([]string{
+		"[Desktop Entry]",
+		"Type=Application",
+		"Name=resticity",
+		"Comment=Backups with restic",
+		"Exec=" + strings.Join(cmd, " "),
+		"Terminal=false",
+		"X-GNOME-Autostart-enabled=true",
+		"",
+	}, "\n")
+	if err := os.MkdirAll(filepath.Dir(autostartFile()), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(autostartFile(), []byte(entry), 0644)
+}
+
+func removeAutostart() error {
+	return os.Remove(autostartFile())
+}
+
+func autostartInstalled() bool {
+	_, err := os.Stat(autostartFile())
+	return err == nil
+}
@@ -0,0 +1,17 @@
+//go:build !linux && !darwin && !windows
+
+package internal
+
+const autostartSupported = false
+
+func installAutostart(exe string, args []string) error {
+	return ErrAutostartUnsupported
+}
+
+func removeAutostart() error {
+	return ErrAutostartUnsupported
+}
+
+func autostartInstalled() bool {
+	return false
+}
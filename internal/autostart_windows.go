@@ -0,0 +1,47 @@
+//go:build windows
+
+package internal
+
+import (
+	"strings"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+const autostartSupported = true
+
+const autostartKey = `Software\Microsoft\Windows\CurrentVersion\Run`
+
+// installAutostart adds a value to the Run key of the current user.
+func installAutostart(exe string, args []string) error {
+	k, _, err := registry.CreateKey(registry.CURRENT_USER, autostartKey, registry.SET_VALUE)
+	if err != nil {
+		return err
+	}
+	defer k.Close()
+	cmd := []string{windows.EscapeArg(exe)}
+	for _, a := range args {
+		cmd = append(cmd, windows.EscapeArg(a))
+	}
+	return k.SetStringValue("resticity", strings.Join(cmd, " "))
+}
+
+func removeAutostart() error {
+	k, err := registry.OpenKey(registry.CURRENT_USER, autostartKey, registry.SET_VALUE)
+	if err != nil {
+		return err
+	}
+	defer k.Close()
+	return k.DeleteValue("resticity")
+}
+
+func autostartInstalled() bool {
+	k, err := registry.OpenKey(registry.CURRENT_USER, autostartKey, registry.QUERY_VALUE)
+	if err != nil {
+		return false
+	}
+	defer k.Close()
+	_, _, err = k.GetStringValue("resticity")
+	return err == nil
+}
@@ -0,0 +1,188 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/goccy/go-json"
+)
+
+type backrestConfig struct {
+	Repos []backrestRepo `json:"repos"`
+	Plans []backrestPlan `json:"plans"`
+}
+
+// backrestSchedule is either a cron expression or a maximum frequency,
+// older versions only had a cron string on the plan.
+type backrestSchedule struct {
+	Disabled          bool   `json:"disabled"`
+	Cron              string `json:"cron"`
+	MaxFrequencyDays  int    `json:"maxFrequencyDays"`
+	MaxFrequencyHours int    `json:"maxFrequencyHours"`
+}
+
+type backrestRepo struct {
+	Id          string   `json:"id"`
+	Uri         string   `json:"uri"`
+	Password    string   `json:"password"`
+	Env         []string `json:"env"`
+	Flags       []string `json:"flags"`
+	PrunePolicy struct {
+		Schedule *backrestSchedule `json:"schedule"`
+	} `json:"prunePolicy"`
+	CheckPolicy struct {
+		Schedule *backrestSchedule `json:"schedule"`
+	} `json:"checkPolicy"`
+	Hooks []json.RawMessage `json:"hooks"`
+}
+
+type backrestPlan struct {
+	Id          string            `json:"id"`
+	Repo        string            `json:"repo"`
+	Paths       []string          `json:"paths"`
+	Excludes    []string          `json:"excludes"`
+	Iexcludes   []string          `json:"iexcludes"`
+	Cron        string            `json:"cron"`
+	Schedule    *backrestSchedule `json:"schedule"`
+	Retention   backrestRetention `json:"retention"`
+	BackupFlags []string          `json:"backup_flags"`
+	Hooks       []json.RawMessage `json:"hooks"`
+}
+
+// backrestRetention holds the policies of current versions and the keep*
+// counts of older ones.
+type backrestRetention struct {
+	PolicyKeepAll      bool `json:"policyKeepAll"`
+	PolicyKeepLastN    int  `json:"policyKeepLastN"`
+	PolicyTimeBucketed *struct {
+		Hourly    int `json:"hourly"`
+		Daily     int `json:"daily"`
+		Weekly    int `json:"weekly"`
+		Monthly   int `json:"monthly"`
+		Yearly    int `json:"yearly"`
+		KeepLastN int `json:"keepLastN"`
+	} `json:"policyTimeBucketed"`
+	KeepLastN          int    `json:"keepLastN"`
+	KeepHourly         int    `json:"keepHourly"`
+	KeepDaily          int    `json:"keepDaily"`
+	KeepWeekly         int    `json:"keepWeekly"`
+	KeepMonthly        int    `json:"keepMonthly"`
+	KeepYearly         int    `json:"keepYearly"`
+	KeepWithinDuration string `json:"keepWithinDuration"`
+}
+
+func (r backrestRetention) params() [][]string {
+	policy := [][]string{}
+	if r.PolicyKeepAll {
+		return policy
+	}
+	policy = retentionParam(policy, "--keep-last", r.PolicyKeepLastN)
+	if b := r.PolicyTimeBucketed; b != nil {
+		policy = retentionParam(policy, "--keep-last", b.KeepLastN)
+		policy = retentionParam(policy, "--keep-hourly", b.Hourly)
+		policy = retentionParam(policy, "--keep-daily", b.Daily)
+		policy = retentionParam(policy, "--keep-weekly", b.Weekly)
+		policy = retentionParam(policy, "--keep-monthly", b.Monthly)
+		policy = retentionParam(policy, "--keep-yearly", b.Yearly)
+	}
+	policy = retentionParam(policy, "--keep-last", r.KeepLastN)
+	policy = retentionParam(policy, "--keep-hourly", r.KeepHourly)
+	policy = retentionParam(policy, "--keep-daily", r.KeepDaily)
+	policy = retentionParam(policy, "--keep-weekly", r.KeepWeekly)
+	policy = retentionParam(policy, "--keep-monthly", r.KeepMonthly)
+	policy = retentionParam(policy, "--keep-yearly", r.KeepYearly)
+	if r.KeepWithinDuration != "" {
+		policy = append(policy, []string{"--keep-within", r.KeepWithinDuration})
+	}
+	return policy
+}
+
+// cron turns a schedule into a cron expression, empty when disabled.
+// Maximum frequencies become a fixed time.
+func (t *toolConfig) backrestCron(name string, s *backrestSchedule) string {
+	switch {
+	case s == nil || s.Disabled:
+		return ""
+	case s.Cron != "":
+		return s.Cron
+	case s.MaxFrequencyHours > 0:
+		t.warn("%s runs at most every %d hours in backrest, it's scheduled at a fixed interval instead", name, s.MaxFrequencyHours)
+		return fmt.Sprintf("0 */%d * * *", s.MaxFrequencyHours)
+	case s.MaxFrequencyDays > 0:
+		t.warn("%s runs at most every %d days in backrest, it's scheduled at a fixed interval instead", name, s.MaxFrequencyDays)
+		return fmt.Sprintf("0 0 */%d * *", s.MaxFrequencyDays)
+	}
+	return ""
+}
+
+// parseBackrest maps repos to repositories with prune and check schedules,
+// and plans to backups with a backup schedule and a forget schedule for
+// their retention, which backrest applies after each backup.
+func parseBackrest(text string) (toolConfig, error) {
+	var c backrestConfig
+	if err := json.Unmarshal([]byte(text), &c); err != nil {
+		return toolConfig{}, fmt.Errorf("not a backrest config: %w", err)
+	}
+	t := toolConfig{warnings: []string{}}
+	repos := map[string]string{}
+	for _, br := range c.Repos {
+		vars := map[string]string{"RESTIC_REPOSITORY": br.Uri, "RESTIC_PASSWORD": br.Password}
+		for _, e := range br.Env {
+			if k, v, ok := strings.Cut(e, "="); ok {
+				vars[k] = v
+			}
+		}
+		r := repositoryFromEnv(vars)
+		r.Name = br.Id
+		if r.Password == "" && r.PasswordFile == "" && r.Env["RESTIC_PASSWORD_COMMAND"] == "" {
+			t.warn("No password found for %s", br.Id)
+		}
+		if len(br.Flags) > 0 {
+			t.warn("The flags of %s (%s) aren't supported, set them through env if restic has a variable for them", br.Id, strings.Join(br.Flags, " "))
+		}
+		if len(br.Hooks) > 0 {
+			t.warn("The hooks of %s were left out", br.Id)
+		}
+		repos[br.Id] = r.Id
+		t.repositories = append(t.repositories, r)
+		if cron := t.backrestCron("Pruning "+br.Id, br.PrunePolicy.Schedule); cron != "" {
+			t.addSchedule("prune-repository", "", r.Id, cron, [][]string{})
+		}
+		if cron := t.backrestCron("Checking "+br.Id, br.CheckPolicy.Schedule); cron != "" {
+			t.addSchedule("check-repository", "", r.Id, cron, [][]string{})
+		}
+	}
+	for _, p := range c.Plans {
+		repo, ok := repos[p.Repo]
+		if !ok {
+			t.warn("%s backs up to the unknown repo %s, it was left out", p.Id, p.Repo)
+			continue
+		}
+		params := [][]string{}
+		for _, e := range p.Excludes {
+			params = append(params, []string{"--exclude", e})
+		}
+		for _, e := range p.Iexcludes {
+			params = append(params, []string{"--iexclude", e})
+		}
+		for _, f := range p.BackupFlags {
+			params = append(params, strings.Fields(f))
+		}
+		if len(p.Hooks) > 0 {
+			t.warn("The hooks of %s were left out", p.Id)
+		}
+		b := t.addBackup(p.Id, p.Paths, params, []string{repo})
+		if b == nil {
+			continue
+		}
+		cron := p.Cron
+		if p.Schedule != nil {
+			cron = t.backrestCron(p.Id, p.Schedule)
+		}
+		t.addSchedule("backup", b.Id, repo, cron, [][]string{})
+		if retention := p.Retention.params(); len(retention) > 0 {
+			t.addSchedule("forget-repository", "", repo, cron, retention)
+		}
+	}
+	return t, nil
+}
@@ -0,0 +1,95 @@
+package internal
+
+import (
+	"container/heap"
+	"errors"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+var ErrInvalidSort = errors.New("Invalid sort, must be one of name, size, mtime and asc or desc")
+
+// Sorted reports whether entries have to be reordered, restic itself lists
+// them by name.
+func (o BrowseOptions) Sorted() bool {
+	return (o.Sort != "" && o.Sort != "name") || o.Order == "desc" || o.DirsFirst
+}
+
+// Validate checks the sort keys and the filter pattern.
+func (o BrowseOptions) Validate() error {
+	switch o.Sort {
+	case "", "name", "size", "mtime":
+	default:
+		return ErrInvalidSort
+	}
+	switch o.Order {
+	case "", "asc", "desc":
+	default:
+		return ErrInvalidSort
+	}
+	_, err := path.Match(o.Filter, "")
+	return err
+}
+
+func (o BrowseOptions) Matches(fd FileDescriptor) bool {
+	if o.Filter == "" {
+		return true
+	}
+	ok, _ := path.Match(strings.ToLower(o.Filter), strings.ToLower(fd.Name))
+	return ok
+}
+
+// Less reports whether a is listed before b.
+func (o BrowseOptions) Less(a FileDescriptor, b FileDescriptor) bool {
+	if o.DirsFirst && (a.Type == "dir") != (b.Type == "dir") {
+		return a.Type == "dir"
+	}
+	if o.Order == "desc" {
+		a, b = b, a
+	}
+	switch o.Sort {
+	case "size":
+		if a.Size != b.Size {
+			return a.Size < b.Size
+		}
+	case "mtime":
+		ta, _ := time.Parse(time.RFC3339Nano, a.Mtime)
+		tb, _ := time.Parse(time.RFC3339Nano, b.Mtime)
+		if !ta.Equal(tb) {
+			return ta.Before(tb)
+		}
+	}
+	return a.Name < b.Name
+}
+
+// browseHeap keeps the first n entries of a listing in sort order, with the
+// last one on top so it can be dropped when a better one comes along.
+type browseHeap struct {
+	opts  BrowseOptions
+	items []FileDescriptor
+}
+
+func (h *browseHeap) Len() int           { return len(h.items) }
+func (h *browseHeap) Less(i, j int) bool { return h.opts.Less(h.items[j], h.items[i]) }
+func (h *browseHeap) Swap(i, j int)      { h.items[i], h.items[j] = h.items[j], h.items[i] }
+func (h *browseHeap) Push(x any)         { h.items = append(h.items, x.(FileDescriptor)) }
+func (h *browseHeap) Pop() any {
+	last := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return last
+}
+
+// add keeps at most n entries, n <= 0 keeps all.
+func (h *browseHeap) add(fd FileDescriptor, n int) {
+	heap.Push(h, fd)
+	if n > 0 && h.Len() > n {
+		heap.Pop(h)
+	}
+}
+
+func (h *browseHeap) sorted() []FileDescriptor {
+	sort.Slice(h.items, func(i, j int) bool { return h.opts.Less(h.items[i], h.items[j]) })
+	return h.items
+}
@@ -0,0 +1,239 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Commands let cron, scripts and CI drive resticity without the HTTP API.
+// Everything but serve runs next to an already running instance.
+const commandUsage = `Commands:
+  serve                     Run the API and the scheduler (same as --headless)
+  run <schedule-id>         Run a schedule and wait until it is done
+  list schedules            List the schedules
+  list repos                List the repositories
+  list snapshots <repo>     List the snapshots of a repository (id or name)
+  check <repo>              Check the integrity of a repository (id or name)
+  restic <repo> -- <args>   Run a restic command against a repository, commands
+                            that change it need --confirm <token>
+  completion bash|zsh|fish  Print a shell completion script
+
+List commands print JSON with --json, list schedules and list repos only
+those of a group with --group <name> and with labels with --labels a,b.
+`
+
+var ErrUnknownCommand = errors.New("Unknown command")
+
+// PrintCommands writes the usage of the commands to w.
+func PrintCommands(w io.Writer) {
+	fmt.Fprint(w, commandUsage)
+}
+
+// Command returns the command and its arguments given after the flags.
+func (r *Resticity) Command() []string {
+	return r.FlagArgs.Command
+}
+
+// RunCommand runs the command given on the command line and returns the
+// exit code.
+func (r *Resticity) RunCommand(public fs.FS, version string, build string) int {
+	args := r.Command()
+	if args[0] == "serve" {
+		if err := r.Serve(public, version, build); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return 1
+		}
+		return 0
+	}
+	if err := r.runCommand(args, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		if errors.Is(err, ErrUnknownCommand) {
+			PrintCommands(os.Stderr)
+			return 2
+		}
+		return 1
+	}
+	return 0
+}
+
+func (r *Resticity) runCommand(args []string, w io.Writer) error {
+	arg := func(i int, name string) (string, error) {
+		if len(args) <= i {
+			return "", fmt.Errorf("%w: missing %s", ErrUnknownCommand, name)
+		}
+		return args[i], nil
+	}
+	switch args[0] {
+	case "run":
+		id, err := arg(1, "schedule id")
+		if err != nil {
+			return err
+		}
+		r.Scheduler.ManualOnly()
+		r.Scheduler.RescheduleBackups()
+		return r.Scheduler.RunJobAndWait(id)
+	case "check":
+		name, err := arg(1, "repository")
+		if err != nil {
+			return err
+		}
+		repository, err := r.findRepository(name)
+		if err != nil {
+			return err
+		}
+		return r.Restic.Check(repository, w)
+	case "restic":
+		name, err := arg(1, "repository")
+		if err != nil {
+			return err
+		}
+		if _, err := arg(2, "restic command"); err != nil {
+			return err
+		}
+		repository, err := r.findRepository(name)
+		if err != nil {
+			return err
+		}
+		write, err := checkResticArgs(args[2:])
+		if err != nil {
+			return err
+		}
+		if write && repository.ReadOnly {
+			return ErrRepositoryReadOnly
+		}
+		if token := confirmToken(r.Auth.Token(), repository.Id, args[2:]); write && r.FlagArgs.Confirm != token {
+			return fmt.Errorf("%w, run it again with --confirm %s", ErrConfirmRequired, token)
+		}
+		if write && r.Scheduler.repositoryBusy(repository.Id) {
+			return errors.New("A schedule is running on this repository")
+		}
+		return r.Restic.RunCommand(context.Background(), repository, args[2:], w)
+	case "completion":
+		shell, err := arg(1, "shell")
+		if err != nil {
+			return err
+		}
+		script, err := Completion(shell)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprint(w, script)
+		return err
+	case "list":
+		what, err := arg(1, "schedules, repos or snapshots")
+		if err != nil {
+			return err
+		}
+		switch what {
+		case "schedules":
+			return r.listSchedules(w)
+		case "repos":
+			return r.listRepositories(w)
+		case "snapshots":
+			name, err := arg(2, "repository")
+			if err != nil {
+				return err
+			}
+			return r.listSnapshots(w, name)
+		}
+		return fmt.Errorf("%w: list %s", ErrUnknownCommand, what)
+	}
+	return fmt.Errorf("%w: %s", ErrUnknownCommand, args[0])
+}
+
+// findRepository looks a repository up by id, then by name.
+func (r *Resticity) findRepository(name string) (Repository, error) {
+	if repository := r.Settings.Config.GetRepositoryById(name); repository != nil {
+		return *repository, nil
+	}
+	for _, repository := range r.Settings.Config.Repositories {
+		if repository.Name == name {
+			return repository, nil
+		}
+	}
+	return Repository{}, fmt.Errorf("Repository not found: %s", name)
+}
+
+func writeJson(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+type scheduleListItem struct {
+	Schedule
+	Name string `json:"name"`
+}
+
+func (r *Resticity) labelFilter() LabelFilter {
+	return ParseLabelFilter(r.FlagArgs.Group, r.FlagArgs.Labels)
+}
+
+func (r *Resticity) listSchedules(w io.Writer) error {
+	schedules := r.Settings.Config.FilterSchedules(r.labelFilter())
+	if r.FlagArgs.Json {
+		items := []scheduleListItem{}
+		for _, s := range schedules {
+			items = append(items, scheduleListItem{s, r.Scheduler.ScheduleName(s)})
+		}
+		return writeJson(w, items)
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tACTION\tCRON\tLAST RUN\tLAST ERROR")
+	for _, s := range schedules {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", s.Id, r.Scheduler.ScheduleName(s), s.Action, s.Cron, s.LastRun, firstLine(s.LastError))
+	}
+	return tw.Flush()
+}
+
+func (r *Resticity) listRepositories(w io.Writer) error {
+	repositories := Config{Repositories: r.Settings.Config.FilterRepositories(r.labelFilter())}.Redacted().Repositories
+	if r.FlagArgs.Json {
+		return writeJson(w, repositories)
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tGROUP\tLABELS\tTYPE\tPATH")
+	for _, repository := range repositories {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", repository.Id, repository.Name, repository.Group, strings.Join(repository.Labels, ","), repository.Type, MaskSecrets(repository.Path))
+	}
+	return tw.Flush()
+}
+
+func (r *Resticity) listSnapshots(w io.Writer, name string) error {
+	repository, err := r.findRepository(name)
+	if err != nil {
+		return err
+	}
+	groups, err := r.Restic.Snapshots(repository, "host")
+	if err != nil {
+		return err
+	}
+	if r.FlagArgs.Json {
+		snapshots := []Snapshot{}
+		for _, g := range groups {
+			snapshots = append(snapshots, g.Snapshots...)
+		}
+		return writeJson(w, snapshots)
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tTIME\tHOST\tPATHS\tTAGS")
+	for _, g := range groups {
+		for _, s := range g.Snapshots {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", s.ShortId, s.Time.Local().Format(time.DateTime), s.Hostname, strings.Join(s.Paths, ","), strings.Join(s.Tags, ","))
+		}
+	}
+	return tw.Flush()
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(s), "\n")
+	return line
+}
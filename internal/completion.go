@@ -0,0 +1,178 @@
+package internal
+
+import "fmt"
+
+// The scripts complete flags, commands and subcommands, schedule and
+// repository ids are taken from the list commands of the config in use.
+
+const bashCompletion = `# bash completion for resticity
+# source <(resticity completion bash)
+
+_resticity_ids() {
+    resticity list "$1" 2>/dev/null | tail -n +2 | cut -d' ' -f1
+}
+
+_resticity() {
+    local cur prev cmd="" sub="" i
+    cur="${COMP_WORDS[COMP_CWORD]}"
+    prev="${COMP_WORDS[COMP_CWORD-1]}"
+
+    case "$prev" in
+        -c|--config|-config)
+            COMPREPLY=($(compgen -f -- "$cur"))
+            return ;;
+        --frontend|-frontend)
+            COMPREPLY=($(compgen -d -- "$cur"))
+            return ;;
+        --profile|-profile)
+            return ;;
+    esac
+
+    for ((i = 1; i < COMP_CWORD; i++)); do
+        case "${COMP_WORDS[i]}" in
+            -c|--config|-config|--profile|-profile|--frontend|-frontend) ((i++)) ;;
+            -*) ;;
+            *)
+                if [[ -z "$cmd" ]]; then
+                    cmd="${COMP_WORDS[i]}"
+                elif [[ -z "$sub" ]]; then
+                    sub="${COMP_WORDS[i]}"
+                fi ;;
+        esac
+    done
+
+    if [[ "$cur" == -* ]]; then
+        COMPREPLY=($(compgen -W "--config --profile --frontend --background --headless --no-server --read-only --json --group --labels --confirm --help --version" -- "$cur"))
+        return
+    fi
+
+    case "$cmd" in
+        "")
+            COMPREPLY=($(compgen -W "serve run list check restic completion" -- "$cur")) ;;
+        run)
+            [[ -z "$sub" ]] && COMPREPLY=($(compgen -W "$(_resticity_ids schedules)" -- "$cur")) ;;
+        check|restic)
+            [[ -z "$sub" ]] && COMPREPLY=($(compgen -W "$(_resticity_ids repos)" -- "$cur")) ;;
+        list)
+            if [[ -z "$sub" ]]; then
+                COMPREPLY=($(compgen -W "schedules repos snapshots" -- "$cur"))
+            elif [[ "$sub" == snapshots && "$prev" == snapshots ]]; then
+                COMPREPLY=($(compgen -W "$(_resticity_ids repos)" -- "$cur"))
+            fi ;;
+        completion)
+            [[ -z "$sub" ]] && COMPREPLY=($(compgen -W "bash zsh fish" -- "$cur")) ;;
+    esac
+}
+
+complete -F _resticity resticity
+`
+
+const zshCompletion = `#compdef resticity
+# source <(resticity completion zsh)
+
+_resticity_ids() {
+    compadd -- ${(f)"$(resticity list $1 2>/dev/null | tail -n +2 | cut -d' ' -f1)"}
+}
+
+_resticity() {
+    local -a commands
+    local state
+    commands=(
+        'serve:Run the API and the scheduler'
+        'run:Run a schedule and wait until it is done'
+        'list:List schedules, repositories or snapshots'
+        'check:Check the integrity of a repository'
+        'restic:Run a restic command against a repository'
+        'completion:Print a shell completion script'
+    )
+
+    _arguments -C \
+        '(-c --config)'{-c,--config}'[Specify a config file]:file:_files' \
+        '--profile[Use a named configuration profile]:profile:' \
+        '--frontend[Serve the frontend from this directory]:directory:_files -/' \
+        '(-b --background)'{-b,--background}'[Run in background mode]' \
+        '--headless[Run only the API and scheduler]' \
+        '--no-server[Do not start the HTTP server in the desktop app]' \
+        '--read-only[Refuse all changes]' \
+        '--json[Print the output of list commands as JSON]' \
+        '--group[Only list repositories and schedules of this group]:group:' \
+        '--labels[Only list repositories and schedules with these comma separated labels]:labels:' \
+        '--confirm[Confirm token of a restic command that changes the repository]:token:' \
+        '(-h --help)'{-h,--help}'[Show help]' \
+        '(-v --version)'{-v,--version}'[Show version]' \
+        '1:command:->command' \
+        '*::argument:->argument'
+
+    case $state in
+        command)
+            _describe 'command' commands ;;
+        argument)
+            case $words[1] in
+                run)
+                    (( CURRENT == 2 )) && _resticity_ids schedules ;;
+                check|restic)
+                    (( CURRENT == 2 )) && _resticity_ids repos ;;
+                list)
+                    if (( CURRENT == 2 )); then
+                        compadd schedules repos snapshots
+                    elif (( CURRENT == 3 )) && [[ $words[2] == snapshots ]]; then
+                        _resticity_ids repos
+                    fi ;;
+                completion)
+                    (( CURRENT == 2 )) && compadd bash zsh fish ;;
+            esac ;;
+    esac
+}
+
+compdef _resticity resticity
+`
+
+const fishCompletion = `# fish completion for resticity
+# resticity completion fish | source
+
+function __resticity_ids
+    resticity list $argv[1] 2>/dev/null | tail -n +2 | string split -f1 ' '
+end
+
+complete -c resticity -f
+complete -c resticity -s c -l config -r -F -d 'Specify a config file'
+complete -c resticity -l profile -x -d 'Use a named configuration profile'
+complete -c resticity -l frontend -x -a '(__fish_complete_directories)' -d 'Serve the frontend from this directory'
+complete -c resticity -s b -l background -d 'Run in background mode'
+complete -c resticity -l headless -d 'Run only the API and scheduler'
+complete -c resticity -l no-server -d 'Do not start the HTTP server in the desktop app'
+complete -c resticity -l read-only -d 'Refuse all changes'
+complete -c resticity -l json -d 'Print the output of list commands as JSON'
+complete -c resticity -l group -x -d 'Only list repositories and schedules of this group'
+complete -c resticity -l labels -x -d 'Only list repositories and schedules with these comma separated labels'
+complete -c resticity -l confirm -x -d 'Confirm token of a restic command that changes the repository'
+complete -c resticity -s h -l help -d 'Show help'
+complete -c resticity -s v -l version -d 'Show version'
+
+set -l commands serve run list check restic completion
+complete -c resticity -n "not __fish_seen_subcommand_from $commands" -a serve -d 'Run the API and the scheduler'
+complete -c resticity -n "not __fish_seen_subcommand_from $commands" -a run -d 'Run a schedule and wait until it is done'
+complete -c resticity -n "not __fish_seen_subcommand_from $commands" -a list -d 'List schedules, repositories or snapshots'
+complete -c resticity -n "not __fish_seen_subcommand_from $commands" -a check -d 'Check the integrity of a repository'
+complete -c resticity -n "not __fish_seen_subcommand_from $commands" -a restic -d 'Run a restic command against a repository'
+complete -c resticity -n "not __fish_seen_subcommand_from $commands" -a completion -d 'Print a shell completion script'
+
+complete -c resticity -n "__fish_seen_subcommand_from run" -a '(__resticity_ids schedules)'
+complete -c resticity -n "__fish_seen_subcommand_from check restic" -a '(__resticity_ids repos)'
+complete -c resticity -n "__fish_seen_subcommand_from list; and not __fish_seen_subcommand_from schedules repos snapshots" -a 'schedules repos snapshots'
+complete -c resticity -n "__fish_seen_subcommand_from snapshots" -a '(__resticity_ids repos)'
+complete -c resticity -n "__fish_seen_subcommand_from completion" -a 'bash zsh fish'
+`
+
+// Completion returns the completion script for bash, zsh or fish.
+func Completion(shell string) (string, error) {
+	switch shell {
+	case "bash":
+		return bashCompletion, nil
+	case "zsh":
+		return zshCompletion, nil
+	case "fish":
+		return fishCompletion, nil
+	}
+	return "", fmt.Errorf("%w: completion %s, use bash, zsh or fish", ErrUnknownCommand, shell)
+}
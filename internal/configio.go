@@ -0,0 +1,74 @@
+package internal
+
+import (
+	"reflect"
+
+	"github.com/goccy/go-json"
+)
+
+// ConfigDiff lists the ids added, removed or changed per section.
+type ConfigDiff struct {
+	Repositories       SectionDiff `json:"repositories"`
+	Backups            SectionDiff `json:"backups"`
+	Schedules          SectionDiff `json:"schedules"`
+	AppSettingsChanged bool        `json:"app_settings_changed"`
+}
+
+type SectionDiff struct {
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+	Changed []string `json:"changed"`
+}
+
+func diffSection[T any](old []T, new []T, id func(T) string) SectionDiff {
+	d := SectionDiff{Added: []string{}, Removed: []string{}, Changed: []string{}}
+	before := map[string]T{}
+	for _, o := range old {
+		before[id(o)] = o
+	}
+	seen := map[string]bool{}
+	for _, n := range new {
+		seen[id(n)] = true
+		o, ok := before[id(n)]
+		if !ok {
+			d.Added = append(d.Added, id(n))
+		} else if !reflect.DeepEqual(o, n) {
+			d.Changed = append(d.Changed, id(n))
+		}
+	}
+	for _, o := range old {
+		if !seen[id(o)] {
+			d.Removed = append(d.Removed, id(o))
+		}
+	}
+	return d
+}
+
+func DiffConfig(old Config, new Config) ConfigDiff {
+	// last runs change all the time and aren't part of an edit, the
+	// schedules are copied so the caller's config stays as it is
+	new.Schedules = append([]Schedule{}, new.Schedules...)
+	keepRunState(&new, old)
+	return ConfigDiff{
+		Repositories:       diffSection(old.Repositories, new.Repositories, func(r Repository) string { return r.Id }),
+		Backups:            diffSection(old.Backups, new.Backups, func(b Backup) string { return b.Id }),
+		Schedules:          diffSection(old.Schedules, new.Schedules, func(s Schedule) string { return s.Id }),
+		AppSettingsChanged: !reflect.DeepEqual(old.AppSettings, new.AppSettings),
+	}
+}
+
+// ParseImport reads an exported config, possibly of an older schema version,
+// on top of the defaults.
+func (s *Settings) ParseImport(data []byte) (Config, error) {
+	migrated, _, err := migrateConfig(data)
+	if err != nil {
+		return Config{}, err
+	}
+	c := s.freshConfig()
+	if err := json.Unmarshal(migrated, &c); err != nil {
+		return Config{}, err
+	}
+	c.SchemaVersion = currentSchemaVersion
+	c.RestoreSecrets(s.Config)
+	return c, nil
+}
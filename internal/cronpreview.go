@@ -0,0 +1,167 @@
+package internal
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/robfig/cron/v3"
+)
+
+// cronPreviewRuns is how many next runs a preview shows.
+const cronPreviewRuns = 5
+
+type CronPreviewData struct {
+	Cron string `json:"cron"`
+	// Timezone is an IANA name like Europe/Vienna, the server's when empty
+	Timezone string `json:"timezone"`
+}
+
+// CronPreview tells whether a cron expression is valid, what it means and
+// when it runs next.
+type CronPreview struct {
+	Valid       bool        `json:"valid"`
+	Error       string      `json:"error,omitempty"`
+	Description string      `json:"description"`
+	Timezone    string      `json:"timezone"`
+	Next        []time.Time `json:"next"`
+}
+
+// PreviewCron parses a cron expression like the scheduler does. Only an
+// unknown timezone is an error, invalid expressions are part of the preview.
+func PreviewCron(data CronPreviewData) (CronPreview, error) {
+	loc := time.Local
+	if data.Timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(data.Timezone); err != nil {
+			return CronPreview{}, fmt.Errorf("Unknown timezone %s", data.Timezone)
+		}
+	}
+	preview := CronPreview{Timezone: loc.String(), Next: []time.Time{}}
+	expr := strings.TrimSpace(data.Cron)
+	schedule, err := cron.ParseStandard(expr)
+	if err != nil {
+		preview.Error = err.Error()
+		return preview, nil
+	}
+	preview.Valid = true
+	preview.Description = describeCron(expr)
+	t := time.Now().In(loc)
+	for i := 0; i < cronPreviewRuns; i++ {
+		t = schedule.Next(t)
+		if t.IsZero() {
+			break
+		}
+		preview.Next = append(preview.Next, t)
+	}
+	return preview, nil
+}
+
+var cronDescriptors = map[string]string{
+	"@yearly":   "At 00:00 on January 1",
+	"@annually": "At 00:00 on January 1",
+	"@monthly":  "At 00:00 on day 1 of the month",
+	"@weekly":   "At 00:00 on Sunday",
+	"@daily":    "At 00:00 every day",
+	"@midnight": "At 00:00 every day",
+	"@hourly":   "At minute 0 past every hour",
+}
+
+var cronWeekdays = []string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday", "Sunday"}
+
+var cronMonths = []string{"", "January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"}
+
+// describeCron turns a valid cron expression into a sentence like "At 03:00
+// every day". Unusual fields are quoted as they are.
+func describeCron(expr string) string {
+	if strings.HasPrefix(expr, "@every ") {
+		return "Every " + strings.TrimPrefix(expr, "@every ")
+	}
+	if d, ok := cronDescriptors[expr]; ok {
+		return d
+	}
+	fields := strings.Fields(expr)
+	if len(fields) > 0 && (strings.HasPrefix(fields[0], "TZ=") || strings.HasPrefix(fields[0], "CRON_TZ=")) {
+		fields = fields[1:]
+	}
+	if len(fields) != 5 {
+		return expr
+	}
+	minute, hour, dom, month, dow := fields[0], fields[1], fields[2], fields[3], fields[4]
+
+	var when string
+	m, mErr := strconv.Atoi(minute)
+	h, hErr := strconv.Atoi(hour)
+	switch {
+	case mErr == nil && hErr == nil:
+		when = fmt.Sprintf("At %02d:%02d", h, m)
+	case minute == "*" && hour == "*":
+		when = "Every minute"
+	case strings.HasPrefix(minute, "*/") && hour == "*":
+		when = "Every " + strings.TrimPrefix(minute, "*/") + " minutes"
+	case mErr == nil && hour == "*":
+		when = fmt.Sprintf("At minute %d past every hour", m)
+	case mErr == nil && strings.HasPrefix(hour, "*/"):
+		when = fmt.Sprintf("At minute %d past every %s hours", m, strings.TrimPrefix(hour, "*/"))
+	default:
+		when = fmt.Sprintf("At minute %s past hour %s", minute, hour)
+	}
+
+	days := []string{}
+	if dom != "*" && dom != "?" {
+		days = append(days, "on day "+dom+" of the month")
+	}
+	if dow != "*" && dow != "?" {
+		days = append(days, "on "+cronNames(dow, cronWeekdays))
+	}
+	if month != "*" {
+		days = append(days, "in "+cronNames(month, cronMonths))
+	}
+	if len(days) == 0 {
+		if strings.HasPrefix(when, "At ") && hErr == nil {
+			return when + " every day"
+		}
+		return when
+	}
+	return when + " " + strings.Join(days, " ")
+}
+
+// cronNames replaces the numbers of a list or range with names, anything
+// else stays as it is.
+func cronNames(field string, names []string) string {
+	name := func(s string) string {
+		if i, err := strconv.Atoi(s); err == nil && i >= 0 && i < len(names) && names[i] != "" {
+			return names[i]
+		}
+		return s
+	}
+	if from, to, ok := strings.Cut(field, "-"); ok && !strings.Contains(field, ",") {
+		return name(from) + " through " + name(to)
+	}
+	parts := strings.Split(field, ",")
+	for i, p := range parts {
+		parts[i] = name(p)
+	}
+	if len(parts) == 1 {
+		return parts[0]
+	}
+	return strings.Join(parts[:len(parts)-1], ", ") + " and " + parts[len(parts)-1]
+}
+
+func serveCronPreview() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var data CronPreviewData
+		if err := c.BodyParser(&data); err != nil {
+			c.SendStatus(400)
+			return c.SendString(err.Error())
+		}
+		preview, err := PreviewCron(data)
+		if err != nil {
+			c.SendStatus(400)
+			return c.SendString(err.Error())
+		}
+		return c.JSON(preview)
+	}
+}
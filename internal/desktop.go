@@ -0,0 +1,72 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/adrg/xdg"
+	"github.com/charmbracelet/log"
+	"github.com/gen2brain/beeep"
+)
+
+// Desktop shows OS notifications, it stays silent unless enabled by the
+// desktop app, as a headless server has nobody to show them to.
+type Desktop struct {
+	settings *Settings
+	enabled  bool
+}
+
+func NewDesktop(settings *Settings) *Desktop {
+	return &Desktop{settings: settings}
+}
+
+func (d *Desktop) Enable() {
+	d.enabled = true
+}
+
+func (d *Desktop) Show(title string, description string) error {
+	if !d.enabled {
+		return nil
+	}
+	return beeep.Notify(title, description, xdg.CacheHome+"/resticity/appicon_active.png")
+}
+
+func (d *Desktop) JobFinished(report JobReport) {
+	cfg := d.settings.Config.AppSettings.Notifications
+	failed := report.Error != ""
+	if (failed && !cfg.OnScheduleError) || (!failed && !cfg.OnScheduleSuccess) {
+		return
+	}
+	title := report.Name + " finished"
+	description := "Took " + report.Duration.Round(1e9).String()
+	if report.Summary != nil {
+		description += fmt.Sprintf(", added %d bytes", report.Summary.DataAdded)
+	}
+	if failed {
+		title = report.Name + " failed"
+		description = strings.SplitN(strings.TrimSpace(report.Error), "\n", 2)[0]
+	}
+	if err := d.Show(title, description); err != nil {
+		log.Error("desktop: notify", "err", err)
+	}
+}
+
+func (d *Desktop) Warning(title string, msg string) {
+	if !d.settings.Config.AppSettings.Notifications.OnWarning {
+		return
+	}
+	if err := d.Show(title, msg); err != nil {
+		log.Error("desktop: notify", "err", err)
+	}
+}
+
+func (d *Desktop) Message(title string, body string, failure bool) error {
+	return d.Show(title, body)
+}
+
+func (d *Desktop) SendTest() error {
+	if !d.enabled {
+		return fmt.Errorf("Desktop notifications are only available in the desktop app")
+	}
+	return d.Show("resticity", "Desktop notifications are set up correctly.")
+}
@@ -0,0 +1,104 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// deviceCheckInterval is how often device triggers look for their drive.
+const deviceCheckInterval = 10 * time.Second
+
+// DeviceAbsent is sent as MsgWarning when a run is skipped because its
+// drive isn't plugged in.
+type DeviceAbsent struct {
+	Title      string `json:"title"`
+	ScheduleId string `json:"schedule_id"`
+	Reason     string `json:"reason"`
+}
+
+// devicePresent tells whether the drive of a device trigger is connected.
+// A mountpoint counts when it has entries, the empty directory left
+// behind when a drive is unmounted doesn't.
+func devicePresent(t ScheduleTrigger) bool {
+	if t.Uuid != "" {
+		if _, err := os.Stat(filepath.Join("/dev/disk/by-uuid", t.Uuid)); err != nil {
+			return false
+		}
+	}
+	if t.Mountpoint != "" {
+		entries, err := os.ReadDir(t.Mountpoint)
+		if err != nil || len(entries) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (t ScheduleTrigger) device() string {
+	if t.Mountpoint != "" {
+		return t.Mountpoint
+	}
+	return "UUID " + t.Uuid
+}
+
+// deviceMissing is true for schedules with a device trigger whose drive is
+// absent, their runs are skipped with a warning instead of failing.
+func (s *Scheduler) deviceMissing(schedule Schedule) bool {
+	if schedule.Trigger.Type != "device" || devicePresent(schedule.Trigger) {
+		return false
+	}
+	w := DeviceAbsent{
+		Title:      "Drive not connected",
+		ScheduleId: schedule.Id,
+		Reason:     fmt.Sprintf("%s skipped, %s is not connected", s.ScheduleName(schedule), schedule.Trigger.device()),
+	}
+	s.jobLog(schedule.Id).Info("Drive not connected, skipping run", "device", schedule.Trigger.device())
+	if j, err := json.Marshal(w); err == nil {
+		(*s.OutputCh) <- ChanMsg{Id: schedule.Id, Type: MsgWarning, Msg: string(j), Time: time.Now()}
+	}
+	return true
+}
+
+// deviceTrigger runs a schedule when its drive is plugged in. Drives already
+// connected when it starts don't count.
+type deviceTrigger struct {
+	schedule Schedule
+	done     chan struct{}
+}
+
+func (t *deviceTrigger) stop() {
+	close(t.done)
+}
+
+func (t *deviceTrigger) run(s *Scheduler) {
+	ticker := time.NewTicker(deviceCheckInterval)
+	defer ticker.Stop()
+	present := devicePresent(t.schedule.Trigger)
+	for {
+		select {
+		case <-t.done:
+			return
+		case <-ticker.C:
+		}
+		now := devicePresent(t.schedule.Trigger)
+		plugged := now && !present
+		present = now
+		if !plugged {
+			continue
+		}
+		pause := s.PauseState()
+		if pause.Paused || slices.Contains(pause.Schedules, t.schedule.Id) {
+			s.jobLog(t.schedule.Id).Info("Paused, skipping run for plugged in drive")
+			continue
+		}
+		if j, ok := s.jobs.Get(t.schedule.Id); ok && j.Running {
+			continue
+		}
+		s.jobLog(t.schedule.Id).Info("Drive plugged in, running schedule", "device", t.schedule.Trigger.device())
+		s.RunJobById(t.schedule.Id)
+	}
+}
@@ -0,0 +1,256 @@
+package internal
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+)
+
+// downloadTTL is how long a dumped file is kept for resumed downloads.
+const downloadTTL = 24 * time.Hour
+
+// fileDump is a single file dumped from a snapshot into the cache. It is
+// readable while restic is still writing it.
+type fileDump struct {
+	file string
+	size int64
+	done chan struct{}
+	err  error
+}
+
+type dumpCache struct {
+	mux   sync.Mutex
+	dumps map[string]*fileDump
+}
+
+var dumps = &dumpCache{dumps: make(map[string]*fileDump)}
+
+func downloadsPath() string {
+	return filepath.Join(getPath(), "downloads")
+}
+
+// Get returns the dump of path, starting restic in the background if it is
+// neither cached nor running. Snapshots are immutable, so a finished dump
+// can be served for every later request.
+func (d *dumpCache) Get(
+	r *Restic,
+	repository Repository,
+	snapshotId string,
+	path string,
+	size int64,
+) (*fileDump, error) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	sum := sha256.Sum256([]byte(repository.Id + ":" + snapshotId + ":" + path))
+	key := hex.EncodeToString(sum[:])
+	if fd, ok := d.dumps[key]; ok {
+		select {
+		case <-fd.done:
+			if _, err := os.Stat(fd.file); fd.err == nil && err == nil {
+				return fd, nil
+			}
+		default:
+			return fd, nil
+		}
+	}
+
+	d.cleanup()
+	if err := os.MkdirAll(downloadsPath(), 0700); err != nil {
+		return nil, err
+	}
+	fd := &fileDump{file: filepath.Join(downloadsPath(), key), size: size, done: make(chan struct{})}
+	if info, err := os.Stat(fd.file); err == nil && info.Size() == size {
+		// left over from a previous run
+		close(fd.done)
+		d.dumps[key] = fd
+		return fd, nil
+	}
+
+	f, err := os.OpenFile(fd.file, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	d.dumps[key] = fd
+	go func() {
+		defer close(fd.done)
+		fd.err = r.Dump(repository, snapshotId, path, "", f)
+		if err := f.Close(); fd.err == nil {
+			fd.err = err
+		}
+		if fd.err != nil {
+			log.Error("dump file", "snapshot", snapshotId, "path", path, "err", fd.err)
+			os.Remove(fd.file)
+		}
+	}()
+	return fd, nil
+}
+
+// cleanup removes finished dumps older than downloadTTL. Expects mux to be
+// held.
+func (d *dumpCache) cleanup() {
+	for key, fd := range d.dumps {
+		select {
+		case <-fd.done:
+		default:
+			continue
+		}
+		if info, err := os.Stat(fd.file); err != nil || time.Since(info.ModTime()) > downloadTTL {
+			os.Remove(fd.file)
+			delete(d.dumps, key)
+		}
+	}
+	files, _ := filepath.Glob(filepath.Join(downloadsPath(), "*"))
+	for _, file := range files {
+		if _, ok := d.dumps[filepath.Base(file)]; ok {
+			continue
+		}
+		if info, err := os.Stat(file); err == nil && time.Since(info.ModTime()) > downloadTTL {
+			os.Remove(file)
+		}
+	}
+}
+
+// resolveSnapshotId returns the id of the newest snapshot for latest, so a
+// cached dump of latest isn't served after the next backup.
+func (r *Restic) resolveSnapshotId(repository Repository, snapshotId string) (string, error) {
+	if snapshotId != "latest" {
+		return snapshotId, nil
+	}
+	var latest *Snapshot
+	err := decodeJSON(r, context.Background(), repository, []string{"snapshots", "--json", "--", "latest"}, func(s Snapshot) error {
+		latest = &s
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if latest == nil {
+		return "", ErrNoSnapshot
+	}
+	return latest.Id, nil
+}
+
+// serveFileDump sends a single file of a snapshot. The file is dumped to
+// the cache first, so interrupted downloads can be resumed with a Range
+// request instead of starting over.
+func serveFileDump(c *fiber.Ctx, r *Restic, repository Repository, snapshotId string, path string) error {
+	snapshotId, err := r.resolveSnapshotId(repository, snapshotId)
+	if err == ErrNoSnapshot {
+		c.SendStatus(404)
+		return c.SendString(err.Error())
+	}
+	if err != nil {
+		c.SendStatus(500)
+		return c.SendString(err.Error())
+	}
+	var file *FileDescriptor
+	err = r.ListSnapshot(repository, snapshotId, path, false, func(fd FileDescriptor) {
+		if fd.Type == "file" && fd.Path == path {
+			file = &fd
+		}
+	})
+	if err != nil {
+		c.SendStatus(500)
+		return c.SendString(err.Error())
+	}
+	if file == nil {
+		c.SendStatus(404)
+		return c.SendString("File not found")
+	}
+
+	fd, err := dumps.Get(r, repository, snapshotId, path, int64(file.Size))
+	if err != nil {
+		c.SendStatus(500)
+		return c.SendString(err.Error())
+	}
+
+	size := int64(file.Size)
+	start, end := int64(0), size-1
+	c.Set("Accept-Ranges", "bytes")
+	c.Set("ETag", fmt.Sprintf("%q", filepath.Base(fd.file)))
+	c.Set("Content-Type", "application/octet-stream")
+	c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", file.Name))
+
+	ifRange := c.Get("If-Range")
+	if c.Get("Range") != "" && size > 0 && (ifRange == "" || ifRange == c.GetRespHeader("ETag")) {
+		ranges, err := c.Range(int(size))
+		if err != nil || ranges.Type != "bytes" || len(ranges.Ranges) == 0 {
+			c.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+			return c.SendStatus(416)
+		}
+		// only the first range is served, multipart responses aren't worth it here
+		start, end = int64(ranges.Ranges[0].Start), int64(ranges.Ranges[0].End)
+		c.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, size))
+		c.Status(206)
+	}
+
+	reader, err := fd.Reader(start, end)
+	if err != nil {
+		c.SendStatus(500)
+		return c.SendString(err.Error())
+	}
+	return c.SendStream(reader, int(end-start+1))
+}
+
+// Reader returns a reader for the bytes [start, end] of the dump, waiting
+// for restic where it hasn't written them yet.
+func (fd *fileDump) Reader(start int64, end int64) (io.ReadCloser, error) {
+	f, err := os.Open(fd.file)
+	if err != nil {
+		return nil, err
+	}
+	return &dumpReader{dump: fd, f: f, off: start, end: end + 1}, nil
+}
+
+type dumpReader struct {
+	dump *fileDump
+	f    *os.File
+	off  int64
+	end  int64
+}
+
+func (dr *dumpReader) Read(p []byte) (int, error) {
+	if dr.off >= dr.end {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > dr.end-dr.off {
+		p = p[:dr.end-dr.off]
+	}
+	for {
+		n, err := dr.f.ReadAt(p, dr.off)
+		dr.off += int64(n)
+		if err != nil && err != io.EOF {
+			return n, err
+		}
+		if n > 0 {
+			return n, nil
+		}
+		select {
+		case <-dr.dump.done:
+			if dr.dump.err != nil {
+				return 0, dr.dump.err
+			}
+			if n, _ := dr.f.ReadAt(p, dr.off); n > 0 {
+				dr.off += int64(n)
+				return n, nil
+			}
+			return 0, errors.New("dump is shorter than expected")
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+}
+
+func (dr *dumpReader) Close() error {
+	return dr.f.Close()
+}
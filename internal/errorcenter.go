@@ -0,0 +1,137 @@
+package internal
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ErrorSourceJob        = "job"
+	ErrorSourceConfig     = "config"
+	ErrorSourceRepository = "repository"
+	ErrorSourceComponent  = "component"
+)
+
+// errorCenterSize is how many errors are kept, the oldest go first.
+const errorCenterSize = 200
+
+// ErrorEntry is a problem that stays visible until it is dismissed. The
+// same problem happening again, like a schedule failing every night,
+// updates the entry instead of adding one.
+type ErrorEntry struct {
+	Id     string `json:"id"`
+	Source string `json:"source"`
+	// Subject is the schedule, repository or component the error is about
+	Subject      string    `json:"subject"`
+	Title        string    `json:"title"`
+	Message      string    `json:"message"`
+	Count        int       `json:"count"`
+	First        time.Time `json:"first"`
+	Last         time.Time `json:"last"`
+	Acknowledged bool      `json:"acknowledged"`
+}
+
+var ErrUnknownError = errors.New("Unknown error")
+
+// errorStore collects recent errors in memory, so they don't vanish with
+// the toast that announced them.
+type errorStore struct {
+	mux     sync.Mutex
+	entries []ErrorEntry
+}
+
+var errorCenter = &errorStore{}
+
+// Report records an error, or counts it again if it is still listed for
+// the same source and subject. An acknowledged entry becomes unread when
+// the error comes back.
+func (e *errorStore) Report(source string, subject string, title string, msg string) {
+	msg = MaskSecrets(msg)
+	now := time.Now()
+	e.mux.Lock()
+	found := false
+	for i := range e.entries {
+		en := &e.entries[i]
+		if en.Source == source && en.Subject == subject {
+			en.Title, en.Message, en.Last = title, msg, now
+			en.Count++
+			en.Acknowledged = false
+			found = true
+			break
+		}
+	}
+	if !found {
+		e.entries = append(e.entries, ErrorEntry{
+			Id:      uuid.NewString(),
+			Source:  source,
+			Subject: subject,
+			Title:   title,
+			Message: msg,
+			Count:   1,
+			First:   now,
+			Last:    now,
+		})
+		if len(e.entries) > errorCenterSize {
+			e.entries = e.entries[len(e.entries)-errorCenterSize:]
+		}
+	}
+	e.mux.Unlock()
+	e.changed()
+}
+
+// List returns the errors, the most recent first.
+func (e *errorStore) List() []ErrorEntry {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	list := append([]ErrorEntry{}, e.entries...)
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Last.After(list[j].Last) })
+	return list
+}
+
+// Acknowledge marks an error as seen, it stays listed until dismissed.
+// An empty id acknowledges all of them.
+func (e *errorStore) Acknowledge(id string) error {
+	e.mux.Lock()
+	found := id == ""
+	for i := range e.entries {
+		if id == "" || e.entries[i].Id == id {
+			e.entries[i].Acknowledged = true
+			found = true
+		}
+	}
+	e.mux.Unlock()
+	if !found {
+		return ErrUnknownError
+	}
+	e.changed()
+	return nil
+}
+
+// Dismiss removes an error. An empty id removes all acknowledged ones.
+func (e *errorStore) Dismiss(id string) error {
+	e.mux.Lock()
+	before := len(e.entries)
+	kept := []ErrorEntry{}
+	for _, en := range e.entries {
+		if (id == "" && !en.Acknowledged) || (id != "" && en.Id != id) {
+			kept = append(kept, en)
+		}
+	}
+	e.entries = kept
+	e.mux.Unlock()
+	if id != "" && len(kept) == before {
+		return ErrUnknownError
+	}
+	e.changed()
+	return nil
+}
+
+// changed sends the whole list, it is short and the clients don't have to
+// merge anything.
+func (e *errorStore) changed() {
+	publish(Envelope{Type: MsgErrors, Payload: e.List(), Timestamp: time.Now()})
+}
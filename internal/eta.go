@@ -0,0 +1,97 @@
+package internal
+
+import (
+	"encoding/json"
+	"math"
+	"time"
+)
+
+// BackupStatus is the part of restic's JSON status lines the ETA needs.
+type BackupStatus struct {
+	MessageType      string  `json:"message_type"`
+	SecondsElapsed   float64 `json:"seconds_elapsed"`
+	SecondsRemaining float64 `json:"seconds_remaining"`
+	PercentDone      float64 `json:"percent_done"`
+	TotalBytes       uint64  `json:"total_bytes"`
+	BytesDone        uint64  `json:"bytes_done"`
+}
+
+// etaEstimator adds an ETA to the status lines of a backup. restic only
+// knows the remaining time once it has scanned everything and its rate
+// jumps around with small files and slow uploads, so the ETA starts from
+// how long the schedule usually takes and moves to the current rate as the
+// backup progresses.
+type etaEstimator struct {
+	// usual is the median duration of the last successful backups, 0
+	// without history
+	usual time.Duration
+}
+
+// newETA returns nil for actions without status lines.
+func (s *Scheduler) newETA(schedule Schedule, runId string) *etaEstimator {
+	if schedule.Action != "backup" {
+		return nil
+	}
+	durations, err := s.Store.Baseline(schedule.Id, "total_duration", runId, anomalyBaselineRuns)
+	if err != nil {
+		s.jobLog(schedule.Id).Warn("eta baseline", "err", err)
+	}
+	return &etaEstimator{usual: time.Duration(median(durations) * float64(time.Second))}
+}
+
+// remaining blends the usual remaining time with the one from the rate,
+// weighted by how far the backup is. It returns false when neither is
+// known yet.
+func (e *etaEstimator) remaining(st BackupStatus) (time.Duration, bool) {
+	elapsed := time.Duration(st.SecondsElapsed * float64(time.Second))
+	var rate time.Duration
+	rateOk := false
+	if st.BytesDone > 0 && st.TotalBytes > st.BytesDone && st.SecondsElapsed > 0 {
+		bytesPerSec := float64(st.BytesDone) / st.SecondsElapsed
+		rate = time.Duration(float64(st.TotalBytes-st.BytesDone) / bytesPerSec * float64(time.Second))
+		rateOk = true
+	} else if st.SecondsRemaining > 0 {
+		rate = time.Duration(st.SecondsRemaining * float64(time.Second))
+		rateOk = true
+	}
+	usualOk := e.usual > 0
+	usual := max(e.usual-elapsed, 0)
+
+	switch {
+	case rateOk && usualOk:
+		w := math.Min(math.Max(st.PercentDone, 0), 1)
+		return time.Duration(w*float64(rate) + (1-w)*float64(usual)), true
+	case rateOk:
+		return rate, true
+	case usualOk:
+		return usual, true
+	}
+	return 0, false
+}
+
+// annotate adds eta_seconds and eta to a status line, other lines are
+// returned as they are.
+func (e *etaEstimator) annotate(line string) string {
+	if e == nil {
+		return line
+	}
+	var st BackupStatus
+	if json.Unmarshal([]byte(line), &st) != nil || st.MessageType != "status" {
+		return line
+	}
+	left, ok := e.remaining(st)
+	if !ok {
+		return line
+	}
+	var fields map[string]any
+	if json.Unmarshal([]byte(line), &fields) != nil {
+		return line
+	}
+	fields["eta_seconds"] = int64(left.Round(time.Second).Seconds())
+	fields["eta"] = time.Now().Add(left).Format(time.RFC3339)
+	j, err := json.Marshal(fields)
+	if err != nil {
+		return line
+	}
+	return string(j)
+}
@@ -0,0 +1,169 @@
+package internal
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/goccy/go-json"
+	"github.com/gofiber/fiber/v2"
+)
+
+const eventLogSize = 500
+
+type Event struct {
+	Id    uint64
+	Topic string
+	Data  string
+}
+
+// eventLog keeps the most recent broadcasts so clients that reconnect can
+// resume where they left off.
+type eventLog struct {
+	mux         sync.Mutex
+	nextId      uint64
+	events      []Event
+	subscribers map[chan Event]bool
+}
+
+var events = &eventLog{subscribers: make(map[chan Event]bool)}
+
+func (e *eventLog) Publish(topic string, data string) Event {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	e.nextId++
+	ev := Event{Id: e.nextId, Topic: topic, Data: data}
+	e.events = append(e.events, ev)
+	if len(e.events) > eventLogSize {
+		e.events = e.events[len(e.events)-eventLogSize:]
+	}
+	for ch := range e.subscribers {
+		select {
+		case ch <- ev:
+		default:
+			// slow consumer, it will catch up via Last-Event-ID on reconnect
+			delete(e.subscribers, ch)
+			close(ch)
+		}
+	}
+	return ev
+}
+
+// Subscribe returns a channel receiving new events and the buffered events
+// after lastId. Without a lastId nothing is replayed.
+func (e *eventLog) Subscribe(lastId uint64) (chan Event, []Event) {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	ch := make(chan Event, 64)
+	e.subscribers[ch] = true
+
+	replay := []Event{}
+	if lastId == 0 {
+		return ch, replay
+	}
+	for _, ev := range e.events {
+		if ev.Id > lastId {
+			replay = append(replay, ev)
+		}
+	}
+	return ch, replay
+}
+
+func (e *eventLog) Unsubscribe(ch chan Event) {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	if _, ok := e.subscribers[ch]; ok {
+		delete(e.subscribers, ch)
+		close(ch)
+	}
+}
+
+// Close ends all subscriptions, used on shutdown.
+func (e *eventLog) Close() {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	for ch := range e.subscribers {
+		delete(e.subscribers, ch)
+		close(ch)
+	}
+}
+
+// streamEvents serves the event log as Server-Sent Events, optionally
+// filtered by a comma separated list of topics. Fresh connections get a
+// snapshot of the current state.
+func streamEvents(c *fiber.Ctx) error {
+	topics := parseTopics(c.Query("topics"))
+	lastId := c.Get("Last-Event-ID")
+	if lastId == "" {
+		lastId = c.Query("last_event_id")
+	}
+	id, _ := strconv.ParseUint(lastId, 10, 64)
+
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	ch, replay := events.Subscribe(id)
+	snapshot := []Envelope{}
+	if id == 0 {
+		snapshot = topicSnapshot(topics)
+	}
+	addr := c.IP()
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer events.Unsubscribe(ch)
+		log.Debug("sse client connected", "addr", addr, "last_event_id", id)
+
+		for _, env := range snapshot {
+			if j, err := json.Marshal(env); err == nil {
+				writeEvent(w, Event{Topic: msgTopic(env), Data: string(j)})
+			}
+		}
+		for _, ev := range replay {
+			if topicMatches(topics, ev.Topic) {
+				writeEvent(w, ev)
+			}
+		}
+		if err := w.Flush(); err != nil {
+			return
+		}
+
+		keepalive := time.NewTicker(15 * time.Second)
+		defer keepalive.Stop()
+		for {
+			select {
+			case ev, ok := <-ch:
+				if !ok {
+					return
+				}
+				if !topicMatches(topics, ev.Topic) {
+					continue
+				}
+				writeEvent(w, ev)
+			case <-keepalive.C:
+				fmt.Fprint(w, ": keepalive\n\n")
+			}
+			if err := w.Flush(); err != nil {
+				log.Debug("sse client disconnected", "addr", addr)
+				return
+			}
+		}
+	})
+
+	return nil
+}
+
+func writeEvent(w *bufio.Writer, ev Event) {
+	if ev.Id > 0 {
+		fmt.Fprintf(w, "id: %d\n", ev.Id)
+	}
+	for _, line := range strings.Split(ev.Data, "\n") {
+		fmt.Fprintf(w, "data: %s\n", line)
+	}
+	fmt.Fprint(w, "\n")
+}
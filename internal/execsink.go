@@ -0,0 +1,106 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// execSinkQueue lines are buffered for the websocket and the file logger
+// before reading restic's output waits for them.
+const execSinkQueue = 256
+
+// execMaxLine is the longest line read, restic prints the JSON of
+// snapshots or forget as a single line.
+const execMaxLine = 16 * 1024 * 1024
+
+// execSink takes the output of one restic run. It keeps stdout for the
+// caller and stderr for the error, writes both to the run log of the job
+// and forwards them tagged with the job or request id, in the order restic
+// printed them.
+type execSink struct {
+	restic *Restic
+	job    *Job
+	runLog *RunLog
+	eta    *etaEstimator
+	// stdout holds the lines without line breaks
+	stdout bytes.Buffer
+	stderr bytes.Buffer
+	queue  chan ChanMsg
+	done   chan struct{}
+}
+
+func (r *Restic) newExecSink(job *Job) *execSink {
+	s := &execSink{restic: r, job: job, runLog: activeRunLog(job), queue: make(chan ChanMsg, execSinkQueue), done: make(chan struct{})}
+	if job != nil {
+		s.eta = job.eta
+	}
+	go s.forward()
+	return s
+}
+
+func (s *execSink) forward() {
+	defer close(s.done)
+	for msg := range s.queue {
+		(*s.restic.OutputCh) <- msg
+	}
+}
+
+func (s *execSink) message(typ string, text string) ChanMsg {
+	msg := ChanMsg{Type: typ, Msg: text, Time: time.Now(), RequestId: s.restic.requestId}
+	if s.job != nil {
+		msg.Id = s.job.Id
+	}
+	return msg
+}
+
+// attach reads the output of c. The returned func waits until both streams
+// are read, call it before c.Wait, which closes them.
+func (s *execSink) attach(c *exec.Cmd) func() {
+	var wg sync.WaitGroup
+	if stdout, err := c.StdoutPipe(); err == nil {
+		typ := MsgLog
+		if s.job != nil {
+			typ = MsgJobProgress
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			scanLines(stdout, func(line string) {
+				s.queue <- s.message(typ, s.eta.annotate(line))
+				s.runLog.Line("stdout", line)
+				s.stdout.WriteString(line)
+			})
+		}()
+	}
+	if stderr, err := c.StderrPipe(); err == nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			scanLines(stderr, func(line string) {
+				s.queue <- s.message(MsgError, line)
+				s.runLog.Line("stderr", line)
+				s.stderr.WriteString(line)
+			})
+		}()
+	}
+	return wg.Wait
+}
+
+// close returns once everything read was forwarded, call it after the
+// streams were read.
+func (s *execSink) close() {
+	close(s.queue)
+	<-s.done
+}
+
+func scanLines(r io.Reader, fn func(string)) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), execMaxLine)
+	for scanner.Scan() {
+		fn(scanner.Text())
+	}
+}
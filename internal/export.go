@@ -0,0 +1,117 @@
+package internal
+
+import (
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ExportedRun is a run with the names of its schedule and repository, for
+// reports read without resticity at hand.
+type ExportedRun struct {
+	RunRecord
+	Schedule   string `json:"schedule"`
+	Repository string `json:"repository"`
+	Status     string `json:"status"`
+}
+
+var exportColumns = []string{
+	"id", "schedule_id", "schedule", "action", "repository_id", "repository",
+	"started", "duration_seconds", "status", "error", "snapshot_id",
+	"files_new", "files_changed", "data_added", "total_bytes_processed",
+}
+
+func (r ExportedRun) csvRecord() []string {
+	record := []string{
+		r.Id, r.ScheduleId, r.Schedule, r.Action, r.RepositoryId, r.Repository,
+		r.Started.Format(time.RFC3339), strconv.FormatFloat(r.Duration.Seconds(), 'f', 0, 64),
+		r.Status, r.Error, r.SnapshotId,
+	}
+	if r.Summary == nil {
+		return append(record, "", "", "", "")
+	}
+	return append(record,
+		strconv.FormatUint(r.Summary.FilesNew, 10),
+		strconv.FormatUint(r.Summary.FilesChanged, 10),
+		strconv.FormatUint(r.Summary.DataAdded, 10),
+		strconv.FormatUint(r.Summary.TotalBytesProcessed, 10),
+	)
+}
+
+// parseExportTime takes a date like 2024-01-31 next to what parseSince
+// takes. With end set a date means the end of that day, so it is included.
+func parseExportTime(s string, end bool) (time.Time, error) {
+	if t, err := time.ParseInLocation(time.DateOnly, s, time.Local); err == nil {
+		if end {
+			return t.AddDate(0, 0, 1), nil
+		}
+		return t, nil
+	}
+	return parseSince(s)
+}
+
+// serveHistoryExport returns the run history between from and to as JSON or
+// as a CSV file, by default of the last 30 days.
+func serveHistoryExport(settings *Settings, scheduler *Scheduler) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		format := c.Query("format", "json")
+		if format != "json" && format != "csv" {
+			c.SendStatus(400)
+			return c.SendString("Invalid format, use csv or json")
+		}
+		from := time.Now().Add(-defaultStatsSince)
+		var to time.Time
+		var err error
+		if c.Query("from") != "" {
+			if from, err = parseExportTime(c.Query("from"), false); err != nil {
+				c.SendStatus(400)
+				return c.SendString("Invalid from, use a date, RFC 3339 or a duration like 30d")
+			}
+		}
+		if c.Query("to") != "" {
+			if to, err = parseExportTime(c.Query("to"), true); err != nil {
+				c.SendStatus(400)
+				return c.SendString("Invalid to, use a date, RFC 3339 or a duration like 30d")
+			}
+		}
+		runs, err := scheduler.Store.RunsBetween(from, to)
+		if err != nil {
+			c.SendStatus(500)
+			return c.SendString(err.Error())
+		}
+
+		exported := make([]ExportedRun, 0, len(runs))
+		for _, r := range runs {
+			e := ExportedRun{RunRecord: r, Schedule: r.ScheduleId, Status: "success"}
+			for _, s := range settings.Config.Schedules {
+				if s.Id == r.ScheduleId {
+					e.Schedule = scheduler.ScheduleName(s)
+				}
+			}
+			if repo := settings.Config.GetRepositoryById(r.RepositoryId); repo != nil {
+				e.Repository = repo.Name
+			}
+			if r.Error != "" {
+				e.Status = "error"
+			}
+			exported = append(exported, e)
+		}
+
+		name := fmt.Sprintf("resticity-history-%s.%s", time.Now().Format(time.DateOnly), format)
+		c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+		if format == "json" {
+			return c.JSON(exported)
+		}
+		c.Set("Content-Type", "text/csv; charset=utf-8")
+		w := csv.NewWriter(c)
+		w.Write(exportColumns)
+		for _, e := range exported {
+			w.Write(e.csvRecord())
+		}
+		w.Flush()
+		return w.Error()
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/adrg/xdg"
@@ -54,6 +55,7 @@ func getFile(t string) string {
 
 func appendToFile(f string, m ChanMsg) {
 
+	m.Msg = MaskSecrets(m.Msg)
 	d, err := json.Marshal(m)
 	if err != nil {
 		log.Error("filelogger: marshal "+f, "error", err)
@@ -86,24 +88,30 @@ func WriteFile(name string, data []byte) error {
 	return nil
 }
 
+// chanHandler gets the job messages once the hub runs. NewFileLogger is
+// the only reader of the channels, so every message reaches both.
+var chanHandler atomic.Pointer[func(ChanMsg)]
+
 func NewFileLogger(outputChan *chan ChanMsg, errorChan *chan ChanMsg) {
 	if _, err := os.Stat(getPath()); os.IsNotExist(err) {
 		os.Mkdir(getPath(), 0755)
 	}
 	log.Info("filelogger", "path", getPath())
 	for {
+		var m ChanMsg
 		select {
-		case o := <-*outputChan:
+		case m = <-*outputChan:
 			if os.Getenv("LOG_TO_FILE") == "true" {
-				f := getFile("logs")
-				appendToFile(f, o)
+				appendToFile(getFile("logs"), m)
+			}
+		case m = <-*errorChan:
+			if m.Type == "" {
+				m.Type = MsgError
 			}
-			break
-		case e := <-*errorChan:
-			f := getFile("errors")
-			appendToFile(f, e)
-			break
+			appendToFile(getFile("errors"), m)
+		}
+		if h := chanHandler.Load(); h != nil {
+			(*h)(m)
 		}
-
 	}
 }
@@ -0,0 +1,43 @@
+package internal
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+)
+
+func (s *Settings) credentialsDir() string {
+	return filepath.Join(filepath.Dir(s.base), "credentials", s.Profile())
+}
+
+// gcsCredentialsFile writes the pasted service account key of a repository
+// to a file only the current user can read, as restic takes the key as a
+// path. It's rewritten when the key changes.
+func (s *Settings) gcsCredentialsFile(repository Repository) (string, error) {
+	dir := s.credentialsDir()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	file := filepath.Join(dir, "gcs-"+repository.Id+".json")
+	key := []byte(repository.Options.GoogleCredentialsJson)
+	if current, err := os.ReadFile(file); err == nil && bytes.Equal(current, key) {
+		return file, nil
+	}
+	if err := os.WriteFile(file, key, 0600); err != nil {
+		return "", err
+	}
+	return file, nil
+}
+
+// removeStaleCredentials deletes the key files of repositories that were
+// removed or now point at a key file of their own.
+func (s *Settings) removeStaleCredentials(c Config) {
+	files, _ := filepath.Glob(filepath.Join(s.credentialsDir(), "gcs-*.json"))
+	for _, f := range files {
+		id := filepath.Base(f)
+		id = id[len("gcs-") : len(id)-len(".json")]
+		if r := c.GetRepositoryById(id); r == nil || r.Options.GoogleCredentialsJson == "" || r.Options.GoogleApplicationCredentials != "" {
+			os.Remove(f)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/goccy/go-json"
+)
+
+// Gotify sends schedule reports as messages of a Gotify application.
+type Gotify struct {
+	settings *Settings
+	client   *http.Client
+}
+
+func NewGotify(settings *Settings) *Gotify {
+	return &Gotify{settings: settings, client: &http.Client{Timeout: 15 * time.Second}}
+}
+
+func (g *Gotify) JobFinished(report JobReport) {
+	cfg := g.settings.Config.AppSettings.Gotify
+	if !cfg.Enabled {
+		return
+	}
+	failed := report.Error != ""
+	if (failed && !cfg.OnFailure) || (!failed && !cfg.OnSuccess) {
+		return
+	}
+	title := report.Name + " succeeded"
+	priority := cfg.PrioritySuccess
+	if failed {
+		title = report.Name + " failed"
+		priority = cfg.PriorityFailure
+	}
+	if err := g.Send(title, formatReport(report), priority); err != nil {
+		log.Error("gotify: send report", "err", err)
+	}
+}
+
+func (g *Gotify) Message(title string, body string, failure bool) error {
+	cfg := g.settings.Config.AppSettings.Gotify
+	if !cfg.Enabled {
+		return nil
+	}
+	if failure {
+		return g.Send(title, body, cfg.PriorityFailure)
+	}
+	return g.Send(title, body, cfg.PrioritySuccess)
+}
+
+func (g *Gotify) SendTest() error {
+	return g.Send("Test notification", "Gotify notifications are set up correctly.", g.settings.Config.AppSettings.Gotify.PrioritySuccess)
+}
+
+func (g *Gotify) Send(title string, body string, priority uint8) error {
+	cfg := g.settings.Config.AppSettings.Gotify
+	if cfg.Server == "" || cfg.Token == "" {
+		return errors.New("Gotify server and app token are required")
+	}
+	data, err := json.Marshal(map[string]any{
+		"title":    "[resticity] " + title,
+		"message":  body,
+		"priority": priority,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(cfg.Server, "/")+"/message", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gotify-Key", cfg.Token)
+	res, err := g.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("Gotify responded %d: %s", res.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
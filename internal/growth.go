@@ -0,0 +1,134 @@
+package internal
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RepositorySize is the output of restic stats --mode raw-data, what the
+// repository takes up in the backend.
+type RepositorySize struct {
+	TotalSize             uint64 `json:"total_size"`
+	TotalUncompressedSize uint64 `json:"total_uncompressed_size"`
+	TotalBlobCount        uint64 `json:"total_blob_count"`
+	SnapshotsCount        uint64 `json:"snapshots_count"`
+}
+
+type GrowthPoint struct {
+	Time time.Time `json:"time"`
+	Size uint64    `json:"size"`
+}
+
+// RepositoryGrowth is the size of a repository over time with a linear
+// trend, projections are 0 with less than two points.
+type RepositoryGrowth struct {
+	Points        []GrowthPoint `json:"points"`
+	BytesPerDay   float64       `json:"bytes_per_day"`
+	Projected30d  uint64        `json:"projected_30d"`
+	Projected365d uint64        `json:"projected_365d"`
+}
+
+// growthActions change the size of the repository they write to.
+var growthActions = []string{"backup", "copy-snapshots", "prune-repository", "forget-repository"}
+
+func (r *Restic) RepositorySize(repository Repository) (RepositorySize, error) {
+	var size RepositorySize
+	res, err := r.Exec(repository, []string{"stats", "--mode", "raw-data"}, []string{}, nil)
+	if err != nil {
+		return size, err
+	}
+	err = json.Unmarshal([]byte(res), &size)
+	return size, err
+}
+
+// recordRepositorySize keeps the size of a repository after a run that
+// changed it.
+func (s *Scheduler) recordRepositorySize(schedule Schedule, runId string) {
+	repository := s.settings.Config.GetRepositoryById(schedule.ToRepositoryId)
+	if repository == nil || (s.Store == nil && repository.Quota.Bytes == 0) {
+		return
+	}
+	size, err := s.restic.RepositorySize(*repository)
+	if err != nil {
+		s.jobLog(schedule.Id).Warn("repository size", "err", err)
+		return
+	}
+	previous, _ := s.Store.LatestMetric("repo_size", repository.Id)
+	now := time.Now()
+	for name, value := range map[string]uint64{
+		"repo_size":              size.TotalSize,
+		"repo_uncompressed_size": size.TotalUncompressedSize,
+		"repo_snapshots":         size.SnapshotsCount,
+	} {
+		s.Store.RecordMetric(Metric{Time: now, Name: name, RunId: runId, ScheduleId: schedule.Id, RepositoryId: repository.Id, Value: float64(value)})
+	}
+	s.checkQuota(schedule, *repository, uint64(previous), size.TotalSize)
+}
+
+// Growth returns the recorded sizes of a repository since the given time.
+func (s *Store) Growth(repositoryId string, since time.Time) (RepositoryGrowth, error) {
+	growth := RepositoryGrowth{Points: []GrowthPoint{}}
+	metrics, err := s.Metrics("repo_size", repositoryId, since)
+	if err != nil {
+		return growth, err
+	}
+	for _, m := range metrics {
+		growth.Points = append(growth.Points, GrowthPoint{Time: m.Time, Size: uint64(m.Value)})
+	}
+	if len(growth.Points) < 2 {
+		return growth, nil
+	}
+	slope, intercept := linearTrend(growth.Points)
+	growth.BytesPerDay = slope
+	days := func(t time.Time) float64 { return t.Sub(growth.Points[0].Time).Hours() / 24 }
+	project := func(d float64) uint64 {
+		if v := intercept + slope*(days(time.Now())+d); v > 0 {
+			return uint64(v)
+		}
+		return 0
+	}
+	growth.Projected30d = project(30)
+	growth.Projected365d = project(365)
+	return growth, nil
+}
+
+// linearTrend fits size = intercept + slope * days since the first point
+// by least squares.
+func linearTrend(points []GrowthPoint) (slope float64, intercept float64) {
+	n := float64(len(points))
+	var sx, sy, sxx, sxy float64
+	for _, p := range points {
+		x := p.Time.Sub(points[0].Time).Hours() / 24
+		y := float64(p.Size)
+		sx += x
+		sy += y
+		sxx += x * x
+		sxy += x * y
+	}
+	if d := n*sxx - sx*sx; d != 0 {
+		slope = (n*sxy - sx*sy) / d
+	}
+	intercept = (sy - slope*sx) / n
+	return slope, intercept
+}
+
+func serveGrowth(store *Store) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		since := time.Now().AddDate(0, 0, -90)
+		if c.Query("since") != "" {
+			var err error
+			if since, err = parseSince(c.Query("since")); err != nil {
+				c.SendStatus(400)
+				return c.SendString("Invalid since, use RFC 3339 or a duration like 90d")
+			}
+		}
+		growth, err := store.Growth(c.Params("id"), since)
+		if err != nil {
+			c.SendStatus(500)
+			return c.SendString(err.Error())
+		}
+		return c.JSON(growth)
+	}
+}
@@ -0,0 +1,57 @@
+package internal
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// Headless tells whether to run without window and systray, e.g. in Docker
+// or on a NAS.
+func (r *Resticity) Headless() bool {
+	return r.FlagArgs.Headless || os.Getenv("RESTICITY_HEADLESS") == "true"
+}
+
+// NoServer tells the desktop app to talk to the UI through its bindings
+// only, without listening on a port.
+func (r *Resticity) NoServer() bool {
+	return r.FlagArgs.NoServer || os.Getenv("RESTICITY_NO_SERVER") == "true"
+}
+
+// Serve runs the scheduler and the API until SIGINT or SIGTERM, then shuts
+// the server down gracefully. It returns the error when the API can't
+// listen.
+func (r *Resticity) Serve(public fs.FS, version string, build string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	r.Scheduler.RescheduleBackups()
+	listenErr := make(chan error, 1)
+	go func() {
+		listenErr <- RunServer(
+			r.Scheduler,
+			r.Restic,
+			r.Settings,
+			r.Auth,
+			public,
+			version,
+			build,
+		)
+	}()
+
+	var err error
+	select {
+	case <-ctx.Done():
+		if err := ShutdownServer(10 * time.Second); err != nil {
+			log.Error("Error shutting down server", "err", err)
+		}
+	case err = <-listenErr:
+	}
+	r.Store.Close()
+	return err
+}
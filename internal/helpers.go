@@ -1,14 +1,19 @@
 package internal
 
 import (
+	"os"
+	"path/filepath"
+	"regexp"
 	"runtime"
 	"strings"
+
+	"github.com/charmbracelet/log"
 )
 
 func FixPath(path string) string {
 	path = strings.Replace(path, ":\\", "/", -1)
 	path = strings.Replace(path, "\\", "/", -1)
-	if path[0] != '/' {
+	if !strings.HasPrefix(path, "/") {
 		path = "/" + path
 	}
 	return path
@@ -24,3 +29,83 @@ func MaybeToWindowsPath(path string) string {
 	path = strings.Join(p, "\\")
 	return path
 }
+
+// ExpandPath replaces a leading ~ with the home directory and expands
+// environment variables.
+func ExpandPath(path string) string {
+	path = os.ExpandEnv(path)
+	if path == "~" || strings.HasPrefix(path, "~/") || strings.HasPrefix(path, "~\\") {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = home + path[1:]
+		}
+	}
+	return path
+}
+
+// ListPath lists the entries of a local directory, directories only unless
+// files is set.
+func ListPath(path string, files bool, hidden bool) ([]PathEntry, error) {
+	path = ExpandPath(path)
+	entries := []PathEntry{}
+	dir, err := os.ReadDir(path)
+	if err != nil {
+		return entries, err
+	}
+	for _, f := range dir {
+		if !hidden && strings.HasPrefix(f.Name(), ".") {
+			continue
+		}
+		if !files && !f.IsDir() {
+			continue
+		}
+		entry := PathEntry{Name: f.Name(), Path: filepath.Join(path, f.Name()), IsDir: f.IsDir()}
+		if info, err := f.Info(); err == nil && !f.IsDir() {
+			entry.Size = info.Size()
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+var envRefRegex = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// ExpandEnvRefs replaces ${VAR} with the value of the environment variable.
+// Unlike os.ExpandEnv, a plain $ stays as is, as it is common in passwords,
+// and unset variables are kept so the error points at them.
+func ExpandEnvRefs(s string) string {
+	if !strings.Contains(s, "${") {
+		return s
+	}
+	return envRefRegex.ReplaceAllStringFunc(s, func(ref string) string {
+		if v, ok := os.LookupEnv(ref[2 : len(ref)-1]); ok {
+			return v
+		}
+		log.Warn("environment variable not set", "ref", ref)
+		return ref
+	})
+}
+
+// writeFileAtomic writes to a temporary file next to path and renames it,
+// so a crash or a full disk never leaves a half written file behind.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
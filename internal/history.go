@@ -0,0 +1,162 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// HistoryEntry is a saved version of the config, Config is left out of
+// listings.
+type HistoryEntry struct {
+	Id     string  `json:"id"`
+	Time   string  `json:"time"`
+	User   string  `json:"user"`
+	Config *Config `json:"config,omitempty"`
+}
+
+var ErrHistoryNotFound = errors.New("Config version not found")
+
+var historyIdRegex = regexp.MustCompile(`^\d{8}T\d{6}\.\d{9}$`)
+
+func (s *Settings) historyDir() string {
+	return filepath.Join(filepath.Dir(s.base), "history", s.Profile())
+}
+
+// SaveVersion saves the config and keeps it in the history, together with
+// the config it replaces when the history is still empty.
+func (s *Settings) SaveVersion(data Config, user string) error {
+	defer s.removeStaleCredentials(data)
+	if s.Config.AppSettings.ConfigHistory == 0 && data.AppSettings.ConfigHistory == 0 {
+		return s.Save(data)
+	}
+	if entries, _ := s.History(); len(entries) == 0 {
+		s.record(s.Config, "")
+	}
+	if err := s.Save(data); err != nil {
+		return err
+	}
+	s.record(data, user)
+	return nil
+}
+
+// Update saves an edited config, keeping secrets the editor only saw
+// redacted. Validation errors reject the config before anything is saved.
+func (s *Settings) Update(c Config, user string) ([]FieldError, error) {
+	c.RestoreSecrets(s.Config)
+	keepRunState(&c, s.Config)
+	if errs := c.Validate(); len(errs) > 0 {
+		return errs, nil
+	}
+	autostart := s.Config.AppSettings.Autostart
+	logging := s.Config.AppSettings.Logging
+	if err := s.SaveVersion(c, user); err != nil {
+		return nil, err
+	}
+	if c.AppSettings.Logging != logging {
+		ConfigureLogging(c.AppSettings.Logging)
+	}
+	if c.AppSettings.Autostart != autostart {
+		if err := s.SyncAutostart(); err != nil {
+			log.Error("autostart", "err", err)
+		}
+	}
+	return nil, nil
+}
+
+func (s *Settings) record(c Config, user string) {
+	dir := s.historyDir()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		log.Error("config history: mkdir", "err", err)
+		return
+	}
+	now := time.Now().UTC()
+	entry := HistoryEntry{Id: now.Format("20060102T150405.000000000"), Time: now.Format(time.RFC3339), User: user, Config: &c}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		log.Error("config history: marshal", "err", err)
+		return
+	}
+	if err := os.WriteFile(filepath.Join(dir, entry.Id+".json"), data, 0600); err != nil {
+		log.Error("config history: write", "err", err)
+		return
+	}
+	s.pruneHistory(dir, int(c.AppSettings.ConfigHistory))
+}
+
+func (s *Settings) pruneHistory(dir string, keep int) {
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	sort.Strings(files)
+	for len(files) > keep {
+		os.Remove(files[0])
+		files = files[1:]
+	}
+}
+
+// History lists the saved versions, newest first.
+func (s *Settings) History() ([]HistoryEntry, error) {
+	files, err := filepath.Glob(filepath.Join(s.historyDir(), "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(files)))
+	entries := []HistoryEntry{}
+	for _, f := range files {
+		entry, err := readHistoryEntry(f)
+		if err != nil {
+			log.Error("config history: read", "file", f, "err", err)
+			continue
+		}
+		entry.Config = nil
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (s *Settings) HistoryEntry(id string) (HistoryEntry, error) {
+	if !historyIdRegex.MatchString(id) {
+		return HistoryEntry{}, ErrHistoryNotFound
+	}
+	entry, err := readHistoryEntry(filepath.Join(s.historyDir(), id+".json"))
+	if os.IsNotExist(err) {
+		return entry, ErrHistoryNotFound
+	}
+	return entry, err
+}
+
+func readHistoryEntry(file string) (HistoryEntry, error) {
+	var entry HistoryEntry
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return entry, err
+	}
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return entry, err
+	}
+	if entry.Config == nil {
+		return entry, errors.New("config missing")
+	}
+	return entry, nil
+}
+
+// keepRunState carries the last run and the webhook token of schedules over
+// to a config that replaces the current one, they aren't part of what users
+// edit. New schedules get no webhook token, it's only set by its endpoint.
+func keepRunState(c *Config, current Config) {
+	for i := range c.Schedules {
+		c.Schedules[i].WebhookTokenHash = ""
+		for _, o := range current.Schedules {
+			if o.Id == c.Schedules[i].Id {
+				c.Schedules[i].LastRun = o.LastRun
+				c.Schedules[i].LastError = o.LastError
+				c.Schedules[i].WebhookTokenHash = o.WebhookTokenHash
+			}
+		}
+	}
+}
@@ -9,6 +9,7 @@ import (
 )
 
 func RunHook(cmd string, obj ScheduleObject) {
+	cmd = ExpandEnvRefs(cmd)
 	stat, err := os.Stat(cmd)
 	if os.IsNotExist(err) {
 		log.Error("Hook file not found", "file", cmd)
@@ -25,7 +26,7 @@ func RunHook(cmd string, obj ScheduleObject) {
 	}
 	s := string(u)
 	execCmd := exec.Cmd{Path: cmd, Args: []string{cmd, s}}
-	log.Debug(s)
+	log.Debug("hook", "file", cmd, "data", MaskSecrets(s))
 	if err := execCmd.Start(); err != nil {
 		log.Error("Hook failed", "file", cmd, "error", err)
 		return
@@ -0,0 +1,404 @@
+package internal
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/goccy/go-json"
+	"github.com/gofiber/contrib/websocket"
+)
+
+const (
+	TopicLogs   = "logs"
+	TopicSystem = "system"
+)
+
+const (
+	// pongWait is how long a connection may stay silent before it is
+	// considered dead, pings are sent well before that.
+	pongWait   = 30 * time.Second
+	pingPeriod = pongWait * 9 / 10
+	writeWait  = 10 * time.Second
+)
+
+func jobTopic(id string) string {
+	return "job:" + id
+}
+
+type SubscriptionMsg struct {
+	Action string   `json:"action"`
+	Topics []string `json:"topics"`
+}
+
+// client is owned by the hub. Only its writePump writes to the
+// connection, everything else queues messages on send.
+type client struct {
+	conn      *websocket.Conn
+	send      chan []byte
+	topics    map[string]bool
+	closeCode int
+}
+
+type inbound struct {
+	client *client
+	data   []byte
+}
+
+const sendBufferSize = 256
+
+var clients = make(map[*client]bool)
+var register = make(chan *client)
+var broadcast = make(chan Event)
+var received = make(chan inbound)
+var unregister = make(chan *client)
+var closeAll = make(chan chan bool)
+
+// hubRunning is false for commands, nothing reads broadcast then.
+var hubRunning atomic.Bool
+
+// stateMux guards the recent job messages and the mounts, which are
+// written by the channel handler and the API and read on subscribe.
+var stateMux sync.Mutex
+var jobOutput = make(map[string]*ring)
+var mountTracker = make(map[string]*MountTracker)
+
+// topicMatches reports whether topic is in topics, either literally or
+// through a wildcard like job:*.
+func topicMatches(topics map[string]bool, topic string) bool {
+	if topics[topic] {
+		return true
+	}
+	if i := strings.Index(topic, ":"); i >= 0 {
+		return topics[topic[:i]+":*"]
+	}
+	return false
+}
+
+func parseTopics(s string) map[string]bool {
+	topics := make(map[string]bool)
+	for _, t := range strings.Split(s, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			topics[t] = true
+		}
+	}
+	if len(topics) == 0 {
+		topics[jobTopic("*")] = true
+		topics[TopicLogs] = true
+		topics[TopicSystem] = true
+	}
+	return topics
+}
+
+// topicSnapshot returns the current state for the given topics, so new
+// subscribers don't have to wait for the next update. Jobs are replayed
+// from the start of their last run, at most jobOutputSize messages.
+func topicSnapshot(topics map[string]bool) []Envelope {
+	stateMux.Lock()
+	defer stateMux.Unlock()
+	snapshot := []Envelope{}
+	for id, out := range jobOutput {
+		if topicMatches(topics, jobTopic(id)) {
+			snapshot = append(snapshot, out.all()...)
+		}
+	}
+	if topics[TopicSystem] {
+		snapshot = append(snapshot, Envelope{Type: MsgMounts, Payload: currentMounts(), Timestamp: time.Now()})
+		snapshot = append(snapshot, Envelope{Type: MsgErrors, Payload: errorCenter.List(), Timestamp: time.Now()})
+	}
+	return snapshot
+}
+
+// msgPayload embeds JSON output from restic as is, anything else is sent
+// as a string.
+func msgPayload(msg string) any {
+	if json.Valid([]byte(msg)) {
+		return json.RawMessage(msg)
+	}
+	return msg
+}
+
+// msgTopic decides which subscribers receive an envelope.
+func msgTopic(env Envelope) string {
+	switch env.Type {
+	case MsgLog:
+		return TopicLogs
+	case MsgNotification, MsgMounts, MsgConfigReload, MsgPause, MsgComponentRestarted, MsgErrors:
+		return TopicSystem
+	}
+	if env.Id == "" {
+		return TopicSystem
+	}
+	return jobTopic(env.Id)
+}
+
+// enqueue hands data to the client's writer, dropping clients that can't
+// keep up instead of blocking everybody else. Only called by the hub.
+func enqueue(cl *client, data []byte) bool {
+	select {
+	case cl.send <- data:
+		return true
+	default:
+		log.Warn("socket: client too slow, dropping", "addr", cl.conn.RemoteAddr().String())
+		removeClient(cl, websocket.ClosePolicyViolation)
+		return false
+	}
+}
+
+// removeClient unregisters cl and closes its send channel, which makes the
+// writer send a close frame and exit. Only called by the hub.
+func removeClient(cl *client, code int) {
+	if _, ok := clients[cl]; !ok {
+		return
+	}
+	delete(clients, cl)
+	cl.closeCode = code
+	close(cl.send)
+	log.Debug(
+		"connection unregistered",
+		"addr",
+		cl.conn.RemoteAddr().String(),
+		"clients",
+		len(clients),
+	)
+}
+
+func runHub() {
+	hubRunning.Store(true)
+	defer hubRunning.Store(false)
+	for {
+		select {
+		case cl := <-register:
+			clients[cl] = true
+			log.Debug(
+				"connection registered",
+				"addr",
+				cl.conn.RemoteAddr().String(),
+				"clients",
+				len(clients),
+			)
+
+		case ev := <-broadcast:
+			for cl := range clients {
+				if topicMatches(cl.topics, ev.Topic) {
+					enqueue(cl, []byte(ev.Data))
+				}
+			}
+
+		case in := <-received:
+			cl := in.client
+			if _, ok := clients[cl]; !ok {
+				break
+			}
+			if string(in.data) == "ping" {
+				// legacy keepalive from older clients
+				break
+			}
+			var sub SubscriptionMsg
+			if err := json.Unmarshal(in.data, &sub); err != nil {
+				log.Warn("socket: invalid message", "addr", cl.conn.RemoteAddr().String(), "err", err)
+				break
+			}
+			switch sub.Action {
+			case "subscribe":
+				added := make(map[string]bool)
+				for _, t := range sub.Topics {
+					cl.topics[t] = true
+					added[t] = true
+				}
+				for _, env := range topicSnapshot(added) {
+					j, err := json.Marshal(env)
+					if err != nil {
+						log.Error("socket: marshal", "err", err)
+						continue
+					}
+					if !enqueue(cl, j) {
+						break
+					}
+				}
+			case "unsubscribe":
+				for _, t := range sub.Topics {
+					delete(cl.topics, t)
+				}
+			}
+
+		case done := <-closeAll:
+			for cl := range clients {
+				removeClient(cl, websocket.CloseGoingAway)
+			}
+			log.Debug("all connections closed")
+			done <- true
+
+		case cl := <-unregister:
+			removeClient(cl, websocket.CloseNormalClosure)
+
+		}
+	}
+}
+
+// serveClient runs a websocket connection until either side gives up. The
+// connection must not be touched after it returns.
+func serveClient(c *websocket.Conn) {
+	cl := &client{
+		conn:   c,
+		send:   make(chan []byte, sendBufferSize),
+		topics: make(map[string]bool),
+	}
+	register <- cl
+
+	done := make(chan bool)
+	go func() {
+		runGuarded("websocket", func() { writePump(cl) })
+		done <- true
+	}()
+
+	readPump(cl)
+	unregister <- cl
+	<-done
+}
+
+// writePump is the only writer of a connection. It sends queued messages
+// and pings, and a close frame once the hub closes the send channel.
+func writePump(cl *client) {
+	ping := time.NewTicker(pingPeriod)
+	defer func() {
+		ping.Stop()
+		// unblock readPump
+		cl.conn.Close()
+	}()
+
+	for {
+		select {
+		case msg, ok := <-cl.send:
+			cl.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				cl.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(cl.closeCode, ""))
+				return
+			}
+			if err := cl.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				log.Debug("socket: write", "addr", cl.conn.RemoteAddr().String(), "err", err)
+				return
+			}
+		case <-ping.C:
+			if err := cl.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait)); err != nil {
+				log.Debug("ping failed", "addr", cl.conn.RemoteAddr().String(), "err", err)
+				return
+			}
+		}
+	}
+}
+
+// readPump reads until the connection is closed or the peer stops
+// answering pings within pongWait.
+func readPump(cl *client) {
+	c := cl.conn
+	c.SetReadDeadline(time.Now().Add(pongWait))
+	c.SetPongHandler(func(string) error {
+		return c.SetReadDeadline(time.Now().Add(pongWait))
+	})
+	for {
+		_, msg, err := c.ReadMessage()
+		if err != nil {
+			log.Debug("socket: read", "addr", c.RemoteAddr().String(), "err", err)
+			return
+		}
+		c.SetReadDeadline(time.Now().Add(pongWait))
+		received <- inbound{client: cl, data: msg}
+	}
+}
+
+// publishHooks receive every published message, the desktop app forwards
+// them as runtime events.
+var publishHooks []func(Envelope)
+var hooksMux sync.Mutex
+
+// OnPublish registers fn for every message published to the clients.
+func OnPublish(fn func(Envelope)) {
+	hooksMux.Lock()
+	defer hooksMux.Unlock()
+	publishHooks = append(publishHooks, fn)
+}
+
+// publish sends env to websocket subscribers of its topic and records it
+// in the event log for SSE clients.
+func publish(env Envelope) {
+	j, err := json.Marshal(env)
+	if err != nil {
+		log.Error("socket: marshal", "err", err)
+		return
+	}
+	hooksMux.Lock()
+	hooks := publishHooks
+	hooksMux.Unlock()
+	for _, fn := range hooks {
+		fn(env)
+	}
+	ev := events.Publish(msgTopic(env), string(j))
+	if hubRunning.Load() {
+		broadcast <- ev
+	}
+}
+
+// currentMounts expects stateMux to be held.
+func currentMounts() []MountMsg {
+	m := []MountMsg{}
+	for _, mt := range mountTracker {
+		m = append(m, mt.mount)
+	}
+	return m
+}
+
+func broadcastMounts() {
+	stateMux.Lock()
+	m := currentMounts()
+	stateMux.Unlock()
+	publish(Envelope{Type: MsgMounts, Payload: m, Timestamp: time.Now()})
+}
+
+func handleMsg(m ChanMsg) {
+	env := Envelope{Type: m.Type, Id: m.Id, Payload: msgPayload(MaskSecrets(m.Msg)), Timestamp: m.Time, RequestId: m.RequestId}
+	if env.Type == "" {
+		env.Type = MsgLog
+		if m.Id != "" {
+			env.Type = MsgJobProgress
+		}
+	}
+
+	if env.Id != "" {
+		stateMux.Lock()
+		switch env.Type {
+		case MsgJobStarted, MsgJobProgress, MsgJobDone, MsgError:
+			out, ok := jobOutput[env.Id]
+			// a new run starts with an empty buffer, the scheduler and restic
+			// both announce it
+			if !ok || (env.Type == MsgJobStarted && !startedOnly(out)) {
+				out = newRing(jobOutputSize)
+				jobOutput[env.Id] = out
+			}
+			out.push(env)
+		}
+		stateMux.Unlock()
+	}
+
+	publish(env)
+	if env.Type == MsgJobProgress {
+		// keep the logs topic a complete stream of restic output
+		publish(Envelope{Type: MsgLog, Id: env.Id, Payload: env.Payload, Timestamp: env.Timestamp, RequestId: env.RequestId})
+	}
+}
+
+// startedOnly tells whether a run was announced but hasn't sent anything
+// else yet.
+func startedOnly(out *ring) bool {
+	all := out.all()
+	return len(all) > 0 && all[len(all)-1].Type == MsgJobStarted
+}
+
+func handleChanMsg(m ChanMsg) {
+	if m.Type == MsgError {
+		log.Warn("restic error", "schedule_id", m.Id, "msg", MaskSecrets(m.Msg), "request_id", m.RequestId)
+	}
+	handleMsg(m)
+}
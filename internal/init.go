@@ -3,15 +3,27 @@ package internal
 import (
 	"flag"
 	"os"
+	"path/filepath"
+	"slices"
 
 	"github.com/charmbracelet/log"
 )
 
 type FlagArgs struct {
-	ConfigFile string
-	Help       bool
-	Version    bool
-	Background bool
+	ConfigFile  string
+	Profile     string
+	FrontendDir string
+	Help        bool
+	Version     bool
+	Background  bool
+	Headless    bool
+	NoServer    bool
+	ReadOnly    bool
+	Json        bool
+	Group       string
+	Labels      string
+	Confirm     string
+	Command     []string
 }
 
 type Resticity struct {
@@ -22,18 +34,41 @@ type Resticity struct {
 	Settings   *Settings
 	Restic     *Restic
 	Scheduler  *Scheduler
+	Auth       *Auth
+	State      *AppState
+	Store      *Store
 }
 
 func NewResticity() (Resticity, error) {
 	flagArgs := ParseFlags()
+	SetReadOnly(flagArgs.ReadOnly || os.Getenv("RESTICITY_READ_ONLY") == "true")
 	outputChan := make(chan ChanMsg)
 	errorChan := make(chan ChanMsg)
-	go NewFileLogger(&outputChan, &errorChan)
-	settings := NewSettings(flagArgs.ConfigFile)
+	go supervise("file logger", func() { NewFileLogger(&outputChan, &errorChan) })
+	// one-off commands run next to the instance owning the config
+	isApp := len(flagArgs.Command) == 0 || flagArgs.Command[0] == "serve"
+	logConsole = isApp
+	settings := NewSettings(flagArgs.ConfigFile, flagArgs.Profile)
+	ConfigureLogging(settings.Config.AppSettings.Logging)
+	if isApp {
+		if err := settings.LockInstance(); err != nil {
+			return Resticity{FlagArgs: flagArgs, Settings: settings, Auth: NewAuth(settings, false)}, err
+		}
+	}
+	if settings.Config.AppSettings.Autostart.Enabled {
+		if err := settings.SyncAutostart(); err != nil {
+			log.Error("autostart", "err", err)
+		}
+	}
+	store, err := OpenStore(filepath.Join(filepath.Dir(settings.file), "state.db"))
+	if err != nil {
+		log.Error("store: open, history and statistics are not recorded", "err", err)
+	}
 	restic := NewRestic(settings, &outputChan, &errorChan)
-	scheduler, err := NewScheduler(settings, restic, &outputChan, &errorChan)
+	scheduler, err := NewScheduler(settings, restic, store, &outputChan, &errorChan)
+	auth := NewAuth(settings, isApp)
 
-	return Resticity{flagArgs, outputChan, errorChan, settings, restic, scheduler}, err
+	return Resticity{flagArgs, outputChan, errorChan, settings, restic, scheduler, auth, NewAppState(settings), store}, err
 }
 
 func ParseFlags() FlagArgs {
@@ -41,13 +76,38 @@ func ParseFlags() FlagArgs {
 
 	flag.StringVar(&flagArgs.ConfigFile, "config", "", "Specify a config file")
 	flag.StringVar(&flagArgs.ConfigFile, "c", "", "Specify a config file")
+	flag.StringVar(&flagArgs.Profile, "profile", "", "Use a named configuration profile")
+	flag.StringVar(&flagArgs.FrontendDir, "frontend", "", "Serve the frontend from this directory instead of the embedded files")
 	flag.BoolVar(&flagArgs.Background, "background", false, "Run in background mode")
 	flag.BoolVar(&flagArgs.Background, "b", false, "Run in background mode")
+	flag.BoolVar(&flagArgs.Headless, "headless", false, "Run only the API and scheduler, without window and systray")
+	flag.BoolVar(&flagArgs.NoServer, "no-server", false, "Don't start the HTTP server in the desktop app")
+	flag.BoolVar(&flagArgs.ReadOnly, "read-only", false, "Refuse all changes, for status displays")
+	flag.BoolVar(&flagArgs.Json, "json", false, "Print the output of list commands as JSON")
+	flag.StringVar(&flagArgs.Group, "group", "", "Only list repositories and schedules of this group")
+	flag.StringVar(&flagArgs.Labels, "labels", "", "Only list repositories and schedules with all of these comma separated labels")
+	flag.StringVar(&flagArgs.Confirm, "confirm", "", "Confirm token of a restic command that changes the repository")
 	flag.BoolVar(&flagArgs.Help, "help", false, "Show help")
 	flag.BoolVar(&flagArgs.Help, "h", false, "Show help")
 	flag.BoolVar(&flagArgs.Version, "version", false, "Show version")
 	flag.BoolVar(&flagArgs.Version, "v", false, "Show version")
-	flag.Parse()
+	// flags may follow the command too, e.g. list repos --json, everything
+	// after -- belongs to the command, e.g. restic <repo> -- snapshots --latest 1
+	args := os.Args[1:]
+	passthrough := []string{}
+	if i := slices.Index(args, "--"); i >= 0 {
+		args, passthrough = args[:i], args[i+1:]
+	}
+	for {
+		flag.CommandLine.Parse(args)
+		args = flag.Args()
+		if len(args) == 0 {
+			break
+		}
+		flagArgs.Command = append(flagArgs.Command, args[0])
+		args = args[1:]
+	}
+	flagArgs.Command = append(flagArgs.Command, passthrough...)
 
 	return flagArgs
 }
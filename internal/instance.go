@@ -0,0 +1,58 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var ErrAlreadyRunning = errors.New("resticity is already running")
+
+// instanceLock stays open, and locked, as long as the process runs.
+var instanceLock *os.File
+
+// showWindow is set by the desktop app, a headless instance has no window.
+var showWindow func()
+
+func OnShowWindow(fn func()) {
+	showWindow = fn
+}
+
+// LockInstance makes sure only one instance per config directory runs
+// schedules. The lock is released by the OS when the process exits.
+func (s *Settings) LockInstance() error {
+	f, err := os.OpenFile(filepath.Join(filepath.Dir(s.base), "resticity.lock"), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return ErrAlreadyRunning
+	}
+	f.Truncate(0)
+	f.WriteString(fmt.Sprint(os.Getpid()))
+	instanceLock = f
+	return nil
+}
+
+// ShowRunningInstance asks the running instance to show its window.
+func ShowRunningInstance(token string) error {
+	req, err := http.NewRequest("POST", "http://127.0.0.1:11278/api/instance/show", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	client := http.Client{Timeout: 3 * time.Second}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return fmt.Errorf("running instance responded %s", res.Status)
+	}
+	return nil
+}
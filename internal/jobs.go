@@ -0,0 +1,76 @@
+package internal
+
+import "sync"
+
+// JobRegistry holds the jobs of the scheduler. gocron callbacks, API
+// handlers and RescheduleBackups use it at the same time, so it only hands
+// out copies and changes jobs under its lock.
+type JobRegistry struct {
+	mu    sync.RWMutex
+	jobs  map[string]*Job
+	order []string
+}
+
+func NewJobRegistry() *JobRegistry {
+	return &JobRegistry{jobs: map[string]*Job{}}
+}
+
+// Get returns a copy of a job, changing it doesn't change the registry.
+func (r *JobRegistry) Get(id string) (Job, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if j, ok := r.jobs[id]; ok {
+		return *j, true
+	}
+	return Job{}, false
+}
+
+// All returns copies of all jobs in the order of the schedules.
+func (r *JobRegistry) All() []Job {
+	return r.filter(func(Job) bool { return true })
+}
+
+func (r *JobRegistry) Running() []Job {
+	return r.filter(func(j Job) bool { return j.Running })
+}
+
+func (r *JobRegistry) filter(keep func(Job) bool) []Job {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	jobs := []Job{}
+	for _, id := range r.order {
+		if j := *r.jobs[id]; keep(j) {
+			jobs = append(jobs, j)
+		}
+	}
+	return jobs
+}
+
+// Update changes a job under the lock, fn must not call the registry. It
+// returns false for unknown ids.
+func (r *JobRegistry) Update(id string, fn func(j *Job)) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	j, ok := r.jobs[id]
+	if ok {
+		fn(j)
+	}
+	return ok
+}
+
+// Add adds a job or replaces the one with the same id.
+func (r *JobRegistry) Add(job Job) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.jobs[job.Id]; !ok {
+		r.order = append(r.order, job.Id)
+	}
+	r.jobs[job.Id] = &job
+}
+
+func (r *JobRegistry) Clear() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.jobs = map[string]*Job{}
+	r.order = nil
+}
@@ -0,0 +1,102 @@
+package internal
+
+import (
+	"slices"
+	"sort"
+	"strings"
+)
+
+// LabelFilter selects repositories and schedules by their group and
+// labels. Empty fields match everything, all labels have to be set.
+type LabelFilter struct {
+	Group  string
+	Labels []string
+}
+
+// ParseLabelFilter reads the group and comma separated labels query
+// parameters of list endpoints and commands.
+func ParseLabelFilter(group string, labels string) LabelFilter {
+	f := LabelFilter{Group: strings.TrimSpace(group), Labels: []string{}}
+	for _, l := range strings.Split(labels, ",") {
+		if l = strings.TrimSpace(l); l != "" {
+			f.Labels = append(f.Labels, l)
+		}
+	}
+	return f
+}
+
+func (f LabelFilter) Empty() bool {
+	return f.Group == "" && len(f.Labels) == 0
+}
+
+func (f LabelFilter) Matches(group string, labels []string) bool {
+	if f.Group != "" && !strings.EqualFold(f.Group, group) {
+		return false
+	}
+	for _, l := range f.Labels {
+		if !slices.ContainsFunc(labels, func(x string) bool { return strings.EqualFold(x, l) }) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c Config) FilterRepositories(f LabelFilter) []Repository {
+	list := []Repository{}
+	for _, r := range c.Repositories {
+		if f.Matches(r.Group, r.Labels) {
+			list = append(list, r)
+		}
+	}
+	return list
+}
+
+func (c Config) FilterSchedules(f LabelFilter) []Schedule {
+	list := []Schedule{}
+	for _, s := range c.Schedules {
+		if f.Matches(s.Group, s.Labels) {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+// LabelIndex lists the groups and labels in use, for filter menus.
+type LabelIndex struct {
+	Groups []string `json:"groups"`
+	Labels []string `json:"labels"`
+}
+
+func (c Config) LabelIndex() LabelIndex {
+	groups := map[string]bool{}
+	labels := map[string]bool{}
+	add := func(group string, ls []string) {
+		if group != "" {
+			groups[group] = true
+		}
+		for _, l := range ls {
+			labels[l] = true
+		}
+	}
+	for _, r := range c.Repositories {
+		add(r.Group, r.Labels)
+	}
+	for _, s := range c.Schedules {
+		add(s.Group, s.Labels)
+	}
+	index := LabelIndex{Groups: []string{}, Labels: []string{}}
+	for g := range groups {
+		index.Groups = append(index.Groups, g)
+	}
+	for l := range labels {
+		index.Labels = append(index.Labels, l)
+	}
+	sort.Strings(index.Groups)
+	sort.Strings(index.Labels)
+	return index
+}
+
+// validLabel rejects commas, which separate labels in filters.
+func validLabel(l string) bool {
+	return strings.TrimSpace(l) == l && !strings.Contains(l, ",")
+}
@@ -0,0 +1,129 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+
+	"github.com/adrg/xdg"
+	"github.com/charmbracelet/log"
+)
+
+var logLevels = []string{"debug", "info", "warn", "error"}
+var logFormats = []string{"text", "json"}
+
+const logFileName = "resticity.log"
+
+// LogDir is where resticity writes its own log, next to the logs of other
+// applications on the platform.
+func LogDir() string {
+	if runtime.GOOS == "darwin" {
+		return filepath.Join(xdg.Home, "Library", "Logs", "resticity")
+	}
+	return filepath.Join(xdg.StateHome, "resticity", "logs")
+}
+
+// rotatingFile renames the log to .1, .2, ... once it grows beyond
+// maxSize, the oldest beyond maxFiles is overwritten.
+type rotatingFile struct {
+	mu       sync.Mutex
+	path     string
+	maxSize  int64
+	maxFiles int
+	f        *os.File
+	size     int64
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f != nil && r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		r.rotate()
+	}
+	if r.f == nil {
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *rotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(r.path), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(r.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.f = f
+	r.size = info.Size()
+	return nil
+}
+
+// rotate expects mu to be held.
+func (r *rotatingFile) rotate() {
+	r.f.Close()
+	r.f = nil
+	for i := r.maxFiles - 1; i > 0; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1))
+	}
+	if r.maxFiles > 0 {
+		os.Rename(r.path, r.path+".1")
+	} else {
+		os.Remove(r.path)
+	}
+}
+
+var logFile = &rotatingFile{path: filepath.Join(LogDir(), logFileName)}
+
+// logConsole is off for commands, their output goes to stdout and the log
+// only to the file.
+var logConsole = true
+
+// ConfigureLogging applies the level, format and rotation of the settings
+// and writes the log to LogDir. RESTICITY_LOG_LEVEL and RESTICITY_LOG_FORMAT
+// take precedence over the settings.
+func ConfigureLogging(c AppSettingsLogging) {
+	logFile.mu.Lock()
+	logFile.maxSize = int64(c.MaxSizeMb) * 1024 * 1024
+	logFile.maxFiles = int(c.MaxFiles)
+	logFile.mu.Unlock()
+
+	var w io.Writer = io.MultiWriter(logFile, appLog)
+	if logConsole {
+		w = io.MultiWriter(os.Stderr, logFile, appLog)
+	}
+	log.SetOutput(w)
+	log.SetReportTimestamp(true)
+
+	format := c.Format
+	if env := os.Getenv("RESTICITY_LOG_FORMAT"); env != "" {
+		format = env
+	}
+	if format == "json" {
+		log.SetFormatter(log.JSONFormatter)
+	} else {
+		log.SetFormatter(log.TextFormatter)
+	}
+
+	level := c.Level
+	if env := os.Getenv("RESTICITY_LOG_LEVEL"); env != "" {
+		level = env
+	}
+	l, err := log.ParseLevel(level)
+	if err != nil {
+		l = log.InfoLevel
+	}
+	log.SetLevel(l)
+}
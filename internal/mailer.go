@@ -0,0 +1,195 @@
+package internal
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// JobReport describes a finished schedule run for notifications.
+type JobReport struct {
+	ScheduleId string
+	RunId      string
+	Action     string
+	Name       string
+	Started    time.Time
+	Duration   time.Duration
+	Summary    *BackupSummary
+	Error      string
+}
+
+// Mailer sends schedule reports via SMTP, either right away or collected
+// in a daily digest.
+type Mailer struct {
+	settings   *Settings
+	mux        sync.Mutex
+	digest     []JobReport
+	lastDigest time.Time
+}
+
+func NewMailer(settings *Settings) *Mailer {
+	return &Mailer{settings: settings}
+}
+
+func (m *Mailer) JobFinished(report JobReport) {
+	cfg := m.settings.Config.AppSettings.Smtp
+	if !cfg.Enabled {
+		return
+	}
+	failed := report.Error != ""
+	if cfg.DailyDigest {
+		m.mux.Lock()
+		m.digest = append(m.digest, report)
+		m.mux.Unlock()
+	}
+	if (failed && cfg.OnFailure) || (!failed && cfg.OnSuccess) {
+		status := "succeeded"
+		if failed {
+			status = "failed"
+		}
+		subject := fmt.Sprintf("[resticity] %s %s", report.Name, status)
+		if err := m.Send(subject, formatReport(report)); err != nil {
+			log.Error("mailer: send report", "err", err)
+		}
+	}
+}
+
+func (m *Mailer) Message(title string, body string, failure bool) error {
+	if !m.settings.Config.AppSettings.Smtp.Enabled {
+		return nil
+	}
+	return m.Send("[resticity] "+title, body)
+}
+
+// RunDigest sends the collected reports once a day at the configured hour.
+func (m *Mailer) RunDigest() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		cfg := m.settings.Config.AppSettings.Smtp
+		if !cfg.Enabled || !cfg.DailyDigest || now.Hour() != int(cfg.DigestHour) {
+			continue
+		}
+		if now.Sub(m.lastDigest) < 23*time.Hour {
+			continue
+		}
+		m.mux.Lock()
+		reports := m.digest
+		m.digest = nil
+		m.lastDigest = now
+		m.mux.Unlock()
+
+		failed := 0
+		body := []string{}
+		for _, r := range reports {
+			if r.Error != "" {
+				failed++
+			}
+			body = append(body, formatReport(r))
+		}
+		if len(reports) == 0 {
+			body = append(body, "No schedules ran since the last digest.")
+		}
+		subject := fmt.Sprintf("[resticity] Daily digest: %d runs, %d failed", len(reports), failed)
+		if err := m.Send(subject, strings.Join(body, "\n----\n\n")); err != nil {
+			log.Error("mailer: send digest", "err", err)
+		}
+	}
+}
+
+func (m *Mailer) SendTest() error {
+	return m.Send("[resticity] Test email", "SMTP notifications are set up correctly.")
+}
+
+func formatReport(r JobReport) string {
+	lines := []string{
+		"Schedule: " + r.Name,
+		"Started:  " + r.Started.Format(time.RFC1123),
+		"Duration: " + r.Duration.Round(time.Second).String(),
+	}
+	if r.Summary != nil {
+		lines = append(lines,
+			"Snapshot: "+r.Summary.SnapshotId,
+			fmt.Sprintf("Added:    %d bytes (%d new, %d changed files)", r.Summary.DataAdded, r.Summary.FilesNew, r.Summary.FilesChanged),
+		)
+	}
+	if r.Error != "" {
+		lines = append(lines, "", "Error:", r.Error)
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// Send delivers a plain text mail to all recipients. Port 465 uses
+// implicit TLS, other ports upgrade via STARTTLS when offered.
+func (m *Mailer) Send(subject string, body string) error {
+	cfg := m.settings.Config.AppSettings.Smtp
+	if cfg.Host == "" || cfg.From == "" || len(cfg.To) == 0 {
+		return errors.New("SMTP host, sender and recipients are required")
+	}
+	port := cfg.Port
+	if port == 0 {
+		port = 587
+	}
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(int(port)))
+
+	msg := strings.Join([]string{
+		"From: " + cfg.From,
+		"To: " + strings.Join(cfg.To, ", "),
+		"Subject: " + subject,
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=utf-8",
+		"",
+		body,
+	}, "\r\n")
+
+	var auth smtp.Auth
+	if cfg.Username != "" {
+		auth = smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)
+	}
+	if port != 465 {
+		return smtp.SendMail(addr, auth, cfg.From, cfg.To, []byte(msg))
+	}
+
+	conn, err := tls.Dial("tcp", addr, &tls.Config{ServerName: cfg.Host})
+	if err != nil {
+		return err
+	}
+	c, err := smtp.NewClient(conn, cfg.Host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if auth != nil {
+		if err := c.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(cfg.From); err != nil {
+		return err
+	}
+	for _, to := range cfg.To {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte(msg)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
@@ -0,0 +1,68 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+var ErrMaintenance = errors.New("resticity is in maintenance mode, no runs are started until it ends")
+
+// Maintenance stops all scheduling and manual runs, e.g. while the host or
+// a repository moves. Unlike a pause it is kept across restarts.
+type Maintenance struct {
+	Enabled bool       `json:"enabled"`
+	Reason  string     `json:"reason"`
+	Since   *time.Time `json:"since"`
+}
+
+type MaintenanceData struct {
+	// Reason is shown to everyone using resticity
+	Reason string `json:"reason"`
+}
+
+func (m Maintenance) err() error {
+	if m.Reason == "" {
+		return ErrMaintenance
+	}
+	return fmt.Errorf("%w: %s", ErrMaintenance, m.Reason)
+}
+
+// SetMaintenance turns maintenance mode on or off. Running jobs finish.
+func (s *Scheduler) SetMaintenance(enabled bool, reason string) PauseState {
+	m := Maintenance{}
+	if enabled {
+		now := time.Now()
+		m = Maintenance{Enabled: true, Reason: reason, Since: &now}
+	}
+	s.pmu.Lock()
+	s.maintenance = m
+	s.pmu.Unlock()
+	if enabled {
+		b, _ := json.Marshal(m)
+		s.Store.SetState("maintenance", string(b))
+		log.Warn("Maintenance mode started", "reason", reason)
+	} else {
+		s.Store.SetState("maintenance", "")
+		log.Info("Maintenance mode ended")
+	}
+	state := s.PauseState()
+	publish(Envelope{Type: MsgPause, Payload: state, Timestamp: time.Now()})
+	return state
+}
+
+// loadMaintenance picks up maintenance mode from before a restart.
+func (s *Scheduler) loadMaintenance() {
+	v := s.Store.State("maintenance")
+	if v == "" {
+		return
+	}
+	if err := json.Unmarshal([]byte(v), &s.maintenance); err != nil {
+		log.Error("maintenance state", "err", err)
+		return
+	}
+	log.Warn("Still in maintenance mode", "reason", s.maintenance.Reason, "since", s.maintenance.Since)
+}
@@ -0,0 +1,91 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/charmbracelet/log"
+)
+
+// currentSchemaVersion is stored as schema_version in the settings file,
+// bump it together with a new entry in migrations.
+const currentSchemaVersion = 1
+
+// migrations[i] upgrades a raw config from schema version i to i+1. They
+// work on the decoded JSON, so renamed or moved fields can still be read.
+var migrations = []func(cfg map[string]any){
+	migrateV1,
+}
+
+// migrateV1 replaces nulls written by early versions with empty lists.
+func migrateV1(cfg map[string]any) {
+	for _, key := range []string{"repositories", "backups", "schedules"} {
+		if cfg[key] == nil {
+			cfg[key] = []any{}
+		}
+	}
+	for _, r := range listOf(cfg["repositories"]) {
+		if r["prune_params"] == nil {
+			r["prune_params"] = []any{}
+		}
+	}
+	for _, b := range listOf(cfg["backups"]) {
+		if b["backup_params"] == nil {
+			b["backup_params"] = []any{}
+		}
+		if b["targets"] == nil {
+			b["targets"] = []any{}
+		}
+	}
+}
+
+func listOf(v any) []map[string]any {
+	items := []map[string]any{}
+	list, _ := v.([]any)
+	for _, i := range list {
+		if m, ok := i.(map[string]any); ok {
+			items = append(items, m)
+		}
+	}
+	return items
+}
+
+func schemaVersion(data []byte) int {
+	var v struct {
+		SchemaVersion int `json:"schema_version"`
+	}
+	json.Unmarshal(data, &v)
+	return v.SchemaVersion
+}
+
+// migrateConfig runs the pending migrations on a settings file content and
+// returns it unchanged when it is up to date.
+func migrateConfig(data []byte) ([]byte, int, error) {
+	from := schemaVersion(data)
+	if from >= currentSchemaVersion {
+		return data, from, nil
+	}
+	cfg := map[string]any{}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return data, from, err
+	}
+	for v := from; v < currentSchemaVersion; v++ {
+		log.Info("settings: migrating", "from", v, "to", v+1)
+		migrations[v](cfg)
+	}
+	cfg["schema_version"] = currentSchemaVersion
+	out, err := json.Marshal(cfg)
+	return out, from, err
+}
+
+// backupConfigFile keeps the file as it was before a migration, in case
+// something went missing on the way.
+func backupConfigFile(file string, data []byte, version int) {
+	backup := fmt.Sprintf("%s.v%d.bak", file, version)
+	if err := os.WriteFile(backup, data, 0600); err != nil {
+		log.Error("settings: backup before migration", "err", err)
+		return
+	}
+	log.Info("settings: saved previous version", "file", backup)
+}
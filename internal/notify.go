@@ -0,0 +1,188 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"sort"
+	"sync"
+	"text/template"
+
+	"github.com/charmbracelet/log"
+)
+
+// Notifier is a notification provider for finished schedule runs.
+type Notifier interface {
+	JobFinished(report JobReport)
+	// Message sends a pre-rendered notification, used by notification rules.
+	Message(title string, body string, failure bool) error
+	SendTest() error
+}
+
+// Warner is implemented by providers that also report repository warnings.
+type Warner interface {
+	Warning(title string, msg string)
+}
+
+const (
+	EventJobFailed    = "job_failed"
+	EventJobSucceeded = "job_succeeded"
+	EventCheckFailed  = "check_failed"
+	EventWarning      = "warning"
+)
+
+// NotificationEvent is what notification rules match on and what their
+// templates render.
+type NotificationEvent struct {
+	Type string
+	JobReport
+	// Failures counts the failed runs in a row of the schedule.
+	Failures int
+	Message  string
+}
+
+func (e NotificationEvent) failure() bool {
+	return e.Type != EventJobSucceeded
+}
+
+// Notifications dispatches events to the registered providers. Without any
+// rules every provider decides by its own settings, with rules only the
+// matching ones are notified.
+type Notifications struct {
+	settings  *Settings
+	store     *Store
+	providers map[string]Notifier
+	mux       sync.Mutex
+	failures  map[string]int
+}
+
+var ErrUnknownNotifier = errors.New("Unknown notification provider")
+
+func NewNotifications(settings *Settings, store *Store, providers map[string]Notifier) *Notifications {
+	return &Notifications{settings: settings, store: store, providers: providers, failures: map[string]int{}}
+}
+
+func (n *Notifications) JobFinished(report JobReport) {
+	n.mux.Lock()
+	if report.Error != "" {
+		n.failures[report.ScheduleId]++
+	} else {
+		n.failures[report.ScheduleId] = 0
+	}
+	failures := n.failures[report.ScheduleId]
+	n.mux.Unlock()
+
+	if len(n.settings.Config.AppSettings.NotificationRules) == 0 {
+		// each provider checks its own settings, in its own goroutine so a
+		// slow server doesn't block others
+		for _, p := range n.providers {
+			go runGuarded("notifier", func() { p.JobFinished(report) })
+		}
+		return
+	}
+	ev := NotificationEvent{Type: EventJobSucceeded, JobReport: report, Failures: failures}
+	if report.Error != "" {
+		ev.Type = EventJobFailed
+		if report.Action == "check-repository" {
+			n.applyRules(NotificationEvent{Type: EventCheckFailed, JobReport: report, Failures: failures})
+		}
+	}
+	n.applyRules(ev)
+}
+
+func (n *Notifications) Warning(title string, msg string) {
+	if len(n.settings.Config.AppSettings.NotificationRules) == 0 {
+		for _, p := range n.providers {
+			if w, ok := p.(Warner); ok {
+				go runGuarded("notifier", func() { w.Warning(title, msg) })
+			}
+		}
+		return
+	}
+	n.applyRules(NotificationEvent{Type: EventWarning, JobReport: JobReport{Name: title}, Message: msg})
+}
+
+func (n *Notifications) applyRules(ev NotificationEvent) {
+	for _, rule := range n.settings.Config.AppSettings.NotificationRules {
+		if !rule.Matches(ev) {
+			continue
+		}
+		title, body := rule.Render(ev)
+		for _, name := range rule.Notifiers {
+			p, ok := n.providers[name]
+			if !ok {
+				log.Warn("notification rule: unknown notifier", "rule", rule.Id, "notifier", name)
+				continue
+			}
+			go runGuarded("notifier "+name, func() {
+				record := NotificationRecord{Notifier: name, Event: ev.Type, ScheduleId: ev.ScheduleId, Title: title}
+				if err := p.Message(title, body, ev.failure()); err != nil {
+					log.Error("notification rule", "rule", rule.Id, "notifier", name, "err", err)
+					record.Error = err.Error()
+				}
+				n.store.RecordNotification(record)
+			})
+		}
+	}
+}
+
+func (n *Notifications) SendTest(provider string) error {
+	p, ok := n.providers[provider]
+	if !ok {
+		return ErrUnknownNotifier
+	}
+	return p.SendTest()
+}
+
+func (n *Notifications) Providers() []string {
+	names := []string{}
+	for name := range n.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (r NotificationRule) Matches(ev NotificationEvent) bool {
+	if r.Event != ev.Type {
+		return false
+	}
+	if len(r.Schedules) > 0 && !slices.Contains(r.Schedules, ev.ScheduleId) {
+		return false
+	}
+	return ev.Type != EventJobFailed || ev.Failures >= int(r.Consecutive)
+}
+
+// Render executes the title and body templates, falling back to the
+// default texts when a template is empty or broken.
+func (r NotificationRule) Render(ev NotificationEvent) (string, string) {
+	title := ev.Name
+	switch ev.Type {
+	case EventJobFailed, EventCheckFailed:
+		title += " failed"
+	case EventJobSucceeded:
+		title += " succeeded"
+	}
+	body := ev.Message
+	if ev.Type != EventWarning {
+		body = formatReport(ev.JobReport)
+	}
+	return r.render("title", r.Title, ev, title), r.render("body", r.Body, ev, body)
+}
+
+func (r NotificationRule) render(name string, text string, ev NotificationEvent, fallback string) string {
+	if text == "" {
+		return fallback
+	}
+	t, err := template.New(name).Parse(text)
+	if err != nil {
+		log.Error("notification rule: template", "rule", r.Id, "err", err)
+		return fallback
+	}
+	var b bytes.Buffer
+	if err := t.Execute(&b, ev); err != nil {
+		log.Error("notification rule: template", "rule", r.Id, "err", err)
+		return fallback
+	}
+	return b.String()
+}
@@ -0,0 +1,96 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// Ntfy publishes schedule reports to an ntfy topic.
+type Ntfy struct {
+	settings *Settings
+	client   *http.Client
+}
+
+func NewNtfy(settings *Settings) *Ntfy {
+	return &Ntfy{settings: settings, client: &http.Client{Timeout: 15 * time.Second}}
+}
+
+func (n *Ntfy) JobFinished(report JobReport) {
+	cfg := n.settings.Config.AppSettings.Ntfy
+	if !cfg.Enabled {
+		return
+	}
+	failed := report.Error != ""
+	if (failed && !cfg.OnFailure) || (!failed && !cfg.OnSuccess) {
+		return
+	}
+	title := report.Name + " succeeded"
+	priority := cfg.PrioritySuccess
+	tags := "white_check_mark"
+	if failed {
+		title = report.Name + " failed"
+		priority = cfg.PriorityFailure
+		tags = "rotating_light"
+	}
+	if err := n.Send(title, formatReport(report), priority, tags); err != nil {
+		log.Error("ntfy: send report", "err", err)
+	}
+}
+
+func (n *Ntfy) Message(title string, body string, failure bool) error {
+	cfg := n.settings.Config.AppSettings.Ntfy
+	if !cfg.Enabled {
+		return nil
+	}
+	if failure {
+		return n.Send(title, body, cfg.PriorityFailure, "rotating_light")
+	}
+	return n.Send(title, body, cfg.PrioritySuccess, "white_check_mark")
+}
+
+func (n *Ntfy) SendTest() error {
+	return n.Send("Test notification", "ntfy notifications are set up correctly.", 0, "tada")
+}
+
+// Send publishes a message, priority 0 leaves it to the server default.
+func (n *Ntfy) Send(title string, body string, priority uint8, tags string) error {
+	cfg := n.settings.Config.AppSettings.Ntfy
+	if cfg.Topic == "" {
+		return errors.New("ntfy topic is required")
+	}
+	server := strings.TrimSuffix(cfg.Server, "/")
+	if server == "" {
+		server = "https://ntfy.sh"
+	}
+	req, err := http.NewRequest(http.MethodPost, server+"/"+cfg.Topic, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Title", "[resticity] "+title)
+	if priority > 0 {
+		req.Header.Set("Priority", strconv.Itoa(int(priority)))
+	}
+	if tags != "" {
+		req.Header.Set("Tags", tags)
+	}
+	if cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+cfg.Token)
+	}
+	res, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("ntfy responded %d: %s", res.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
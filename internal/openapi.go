@@ -0,0 +1,288 @@
+package internal
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+)
+
+type apiOperation struct {
+	Method   string
+	Path     string
+	Summary  string
+	Role     Role
+	Query    []string
+	Body     any
+	Response any
+}
+
+type tokenResponse struct {
+	Token string `json:"token"`
+}
+
+type profilesResponse struct {
+	Active   string   `json:"active"`
+	Profiles []string `json:"profiles"`
+}
+
+type versionResponse struct {
+	Version  string `json:"version"`
+	Build    string `json:"build"`
+	ReadOnly bool   `json:"read_only"`
+}
+
+type loginResponse struct {
+	Token string   `json:"token"`
+	User  Identity `json:"user"`
+}
+
+type logsResponse struct {
+	Logs   []string `json:"logs"`
+	Errors []string `json:"errors"`
+}
+
+// apiOperations documents the routes registered in RunServer. Keep it in
+// sync when adding or changing routes. A nil Response means a plain text
+// response.
+var apiOperations = []apiOperation{
+	{Method: "get", Path: "/openapi.json", Summary: "This document", Response: map[string]any{}},
+	{Method: "post", Path: "/auth/login", Summary: "Log in with username and password", Body: LoginData{}, Response: loginResponse{}},
+	{Method: "get", Path: "/auth/me", Summary: "Current identity", Role: RoleReadOnly, Response: Identity{}},
+	{Method: "post", Path: "/auth/logout", Summary: "End the current session", Role: RoleReadOnly},
+	{Method: "get", Path: "/users", Summary: "List users", Role: RoleAdmin, Response: []User{}},
+	{Method: "post", Path: "/users", Summary: "Create or update a user", Role: RoleAdmin, Body: UserData{}, Response: User{}},
+	{Method: "delete", Path: "/users/:id", Summary: "Delete a user", Role: RoleAdmin},
+	{Method: "get", Path: "/ws", Summary: "Websocket sending {type, id, payload, timestamp} envelopes, send {action: subscribe, topics: [job:<id>, job:*, logs, system]}", Role: RoleReadOnly},
+	{Method: "get", Path: "/activity", Summary: "Running jobs with their progress, runs about to start and the last finished runs", Role: RoleReadOnly, Query: []string{"recent"}, Response: Activity{}},
+	{Method: "get", Path: "/events", Summary: "Server-Sent Events stream of job and mount updates, resumable via Last-Event-ID", Role: RoleReadOnly, Query: []string{"last_event_id", "topics"}},
+	{Method: "get", Path: "/path/autocomplete", Summary: "List entries of a local path, ~ and environment variables are expanded", Role: RoleOperator, Query: []string{"path", "files", "hidden"}, Response: []PathEntry{}},
+	{Method: "get", Path: "/path/remote-autocomplete", Summary: "List directories of an sftp: or rclone: location", Role: RoleOperator, Query: []string{"path"}, Response: []PathEntry{}},
+	{Method: "post", Path: "/schedules/:id/trigger", Summary: "Run a schedule, authenticated with its webhook token instead of API credentials", Role: RoleOperator},
+	{Method: "post", Path: "/schedules/:id/webhook-token", Summary: "Create the webhook token of a schedule, replacing the old one, it is only shown once", Role: RoleAdmin, Response: tokenResponse{}},
+	{Method: "delete", Path: "/schedules/:id/webhook-token", Summary: "Revoke the webhook token of a schedule", Role: RoleAdmin},
+	{Method: "post", Path: "/schedules/validate", Summary: "Check a cron expression, describe it and list its next 5 runs in a timezone", Role: RoleReadOnly, Body: CronPreviewData{}, Response: CronPreview{}},
+	{Method: "get", Path: "/schedules", Summary: "Schedules in a group and with all of the comma separated labels", Role: RoleReadOnly, Query: []string{"group", "labels"}, Response: []Schedule{}},
+	{Method: "get", Path: "/labels", Summary: "Groups and labels used by repositories and schedules", Role: RoleReadOnly, Response: LabelIndex{}},
+	{Method: "get", Path: "/schedules/last-runs", Summary: "Latest recorded run of every schedule, kept across restarts, optionally only of schedules in a group and with all of the comma separated labels", Role: RoleReadOnly, Query: []string{"group", "labels"}, Response: []RunRecord{}},
+	{Method: "get", Path: "/schedules/:id/runs", Summary: "Runs of a schedule whose output is kept, newest first", Role: RoleReadOnly, Response: []RunInfo{}},
+	{Method: "get", Path: "/schedules/:id/runs/:run_id/log", Summary: "Full restic output of a run as text", Role: RoleReadOnly},
+	{Method: "get", Path: "/schedules/:id/:action", Summary: "Run, stop, pause or resume a schedule (action: run, stop, pause, resume)", Role: RoleOperator},
+	{Method: "post", Path: "/instance/show", Summary: "Show the window of the desktop app, used when it is started a second time", Role: RoleAdmin},
+	{Method: "get", Path: "/pause", Summary: "Whether scheduled runs are paused", Role: RoleReadOnly, Response: PauseState{}},
+	{Method: "post", Path: "/pause", Summary: "Pause scheduled runs for a duration like 1h, or until resumed without one", Role: RoleOperator, Query: []string{"duration"}, Response: PauseState{}},
+	{Method: "delete", Path: "/pause", Summary: "Resume scheduled runs", Role: RoleOperator, Response: PauseState{}},
+	{Method: "get", Path: "/errors", Summary: "Recent job failures, config problems and unreachable repositories, newest first", Role: RoleReadOnly, Response: []ErrorEntry{}},
+	{Method: "post", Path: "/errors/acknowledge", Summary: "Mark all errors as seen", Role: RoleOperator, Response: []ErrorEntry{}},
+	{Method: "post", Path: "/errors/:id/acknowledge", Summary: "Mark an error as seen, it comes back unread when it happens again", Role: RoleOperator, Response: []ErrorEntry{}},
+	{Method: "delete", Path: "/errors", Summary: "Dismiss all acknowledged errors", Role: RoleOperator, Response: []ErrorEntry{}},
+	{Method: "delete", Path: "/errors/:id", Summary: "Dismiss an error", Role: RoleOperator, Response: []ErrorEntry{}},
+	{Method: "post", Path: "/maintenance", Summary: "Start maintenance mode, stopping scheduled and manual runs until it ends", Role: RoleAdmin, Body: MaintenanceData{}, Response: PauseState{}},
+	{Method: "delete", Path: "/maintenance", Summary: "End maintenance mode", Role: RoleAdmin, Response: PauseState{}},
+	{Method: "post", Path: "/notifications/test/:provider", Summary: "Send a test notification with the saved settings of a provider (desktop, email, ntfy, gotify, telegram)", Role: RoleAdmin},
+	{Method: "post", Path: "/token/rotate", Summary: "Rotate the API token", Role: RoleAdmin, Response: tokenResponse{}},
+	{Method: "get", Path: "/setup", Summary: "Whether this is the first run, the restic binary and version found, the config file and the suggested cache directory", Role: RoleReadOnly, Response: SetupStatus{}},
+	{Method: "get", Path: "/setup/repositories", Summary: "Search the home directory, mounted drives and common backup directories for restic repositories (paths: comma separated extra directories)", Role: RoleAdmin, Query: []string{"paths"}, Response: []DetectedRepository{}},
+	{Method: "post", Path: "/setup", Summary: "Create the initial config in one save, only while nothing is configured", Role: RoleAdmin, Query: []string{"dry_run"}, Body: SetupData{}, Response: Config{}},
+	{Method: "get", Path: "/version", Summary: "Version and build", Role: RoleReadOnly, Response: versionResponse{}},
+	{Method: "get", Path: "/applog", Summary: "Recent application log lines, streamed as Server-Sent Events with follow=true", Role: RoleOperator, Query: []string{"since", "level", "follow"}, Response: []LogEntry{}},
+	{Method: "get", Path: "/history/export", Summary: "Run history as a JSON or CSV download (format: json or csv, from and to: a date, RFC 3339 or a duration like 30d, default the last 30 days)", Role: RoleReadOnly, Query: []string{"format", "from", "to"}, Response: []ExportedRun{}},
+	{Method: "get", Path: "/stats/schedules", Summary: "Runs, failures and backup numbers per schedule (since: RFC 3339 or a duration like 30d, default 30d)", Role: RoleReadOnly, Query: []string{"since"}, Response: []RunStats{}},
+	{Method: "get", Path: "/stats/schedules/:id", Summary: "Runs, failures and backup numbers of a schedule over time (bucket: day, week or month)", Role: RoleReadOnly, Query: []string{"since", "bucket"}, Response: []RunStats{}},
+	{Method: "get", Path: "/stats/repositories", Summary: "Runs, failures and backup numbers per repository written to", Role: RoleReadOnly, Query: []string{"since"}, Response: []RunStats{}},
+	{Method: "get", Path: "/stats/repositories/:id", Summary: "Runs, failures and backup numbers of a repository over time (bucket: day, week or month)", Role: RoleReadOnly, Query: []string{"since", "bucket"}, Response: []RunStats{}},
+	{Method: "get", Path: "/repositories/:id/growth", Summary: "Size of a repository after each backup, copy and prune with its trend (since: default 90d)", Role: RoleReadOnly, Query: []string{"since"}, Response: RepositoryGrowth{}},
+	{Method: "get", Path: "/audit", Summary: "Changes made through the API and the desktop app, newest first", Role: RoleAdmin, Query: []string{"limit"}, Response: []AuditEntry{}},
+	{Method: "get", Path: "/logs", Summary: "List log files", Role: RoleOperator, Response: logsResponse{}},
+	{Method: "get", Path: "/logs/:file", Summary: "Content of a log file", Role: RoleOperator},
+	{Method: "post", Path: "/check", Summary: "Check whether a repository exists (OK_REPO_EMPTY, OK_REPO_EXISTING), fails with ERR_WRONG_PASSWORD or ERR_ACCESS_DENIED (422), ERR_UNREACHABLE, ERR_BUCKET_MISSING or ERR_TIMEOUT (502)", Role: RoleAdmin, Body: Repository{}},
+	{Method: "post", Path: "/init", Summary: "Initialize a repository, optionally with a format version and the chunker params of another repository", Role: RoleAdmin, Body: InitData{}},
+	{Method: "get", Path: "/config", Summary: "Current configuration with secrets redacted. reveal=true shows them to admins on the local machine", Role: RoleReadOnly, Query: []string{"reveal"}, Response: Config{}},
+	{Method: "post", Path: "/config", Summary: "Validate and save the configuration and reschedule, redacted secrets keep their current value. Responds 422 with field errors", Role: RoleAdmin, Body: Config{}},
+	{Method: "get", Path: "/config/export", Summary: "Download the configuration, secrets are redacted unless redact=false is asked for on the local machine", Role: RoleAdmin, Query: []string{"redact"}, Response: Config{}},
+	{Method: "post", Path: "/config/import", Summary: "Validate and replace the configuration, redacted secrets keep their current value. dry_run only returns the diff", Role: RoleAdmin, Query: []string{"dry_run"}, Body: Config{}, Response: ConfigDiff{}},
+	{Method: "post", Path: "/config/import/:tool", Summary: "Add the repositories, backups and schedules of an autorestic or backrest (tool) config sent as text, secrets in the answer are redacted. dry_run only returns what would be added", Role: RoleAdmin, Query: []string{"dry_run"}, Body: RepositoryImportData{}, Response: ToolImport{}},
+	{Method: "get", Path: "/config/history", Summary: "Saved versions of the configuration, newest first", Role: RoleReadOnly, Response: []HistoryEntry{}},
+	{Method: "get", Path: "/config/history/:id/diff", Summary: "What rolling back to a version would change", Role: RoleAdmin, Response: ConfigDiff{}},
+	{Method: "post", Path: "/config/history/:id/rollback", Summary: "Restore a saved version of the configuration", Role: RoleAdmin},
+	{Method: "get", Path: "/autostart", Summary: "Autostart setting and whether the entry is installed", Role: RoleReadOnly, Response: AutostartState{}},
+	{Method: "put", Path: "/autostart", Summary: "Install or remove the autostart entry for the tray or headless mode", Role: RoleAdmin, Body: AppSettingsAutostart{}, Response: AutostartState{}},
+	{Method: "get", Path: "/profiles", Summary: "Active and available configuration profiles", Role: RoleReadOnly, Response: profilesResponse{}},
+	{Method: "post", Path: "/profiles/:name", Summary: "Switch to a profile, creating it if needed. Responds 409 while jobs are running", Role: RoleAdmin, Response: profilesResponse{}},
+	{Method: "get", Path: "/repositories", Summary: "Repositories in a group and with all of the comma separated labels, secrets redacted", Role: RoleReadOnly, Query: []string{"group", "labels"}, Response: []Repository{}},
+	{Method: "post", Path: "/repositories/test-credentials", Summary: "Test backend credentials and reachability without initializing anything", Role: RoleAdmin, Body: Repository{}, Response: CredentialsCheck{}},
+	{Method: "post", Path: "/repositories/import", Summary: "Add the repositories found in an env file or backup script, secrets in the answer are redacted. dry_run only returns what was found", Role: RoleAdmin, Query: []string{"dry_run"}, Body: RepositoryImportData{}, Response: RepositoryImport{}},
+	{Method: "delete", Path: "/repositories/:id", Summary: "Remove a repository from the config, keeping its data. Responds 409 with the schedules still using it", Role: RoleAdmin},
+	{Method: "post", Path: "/repositories/:id/snapshots", Summary: "List snapshots", Role: RoleReadOnly, Query: []string{"group_by"}, Response: []SnapshotGroup{}},
+	{Method: "post", Path: "/repositories/:id/repair/:what", Summary: "Run restic repair index or repair snapshots (what) and stream its output as text, the last line is Done or Error. Needs confirm=true unless dry_run (snapshots only), read_all_packs is for index and forget for snapshots. Responds 409 while a schedule runs on the repository", Role: RoleAdmin, Query: []string{"confirm", "dry_run", "read_all_packs", "forget"}},
+	{Method: "post", Path: "/repositories/:id/rewrite", Summary: "Remove excluded paths from existing snapshots (restic rewrite), all snapshots unless listed, and stream the output as text. Needs confirm unless dry_run", Role: RoleAdmin, Body: RewriteData{}},
+	{Method: "post", Path: "/repositories/:id/restic", Summary: "Run a restic subcommand against the repository and stream its output as text. Commands that change the repository respond 409 with a ConfirmRequired until sent again with its confirm token", Role: RoleAdmin, Body: ResticCommand{}},
+	{Method: "post", Path: "/repositories/:id/forget-preview", Summary: "Snapshots a retention policy would keep and remove (forget --dry-run), the policy of the repository when prune_params is empty", Role: RoleReadOnly, Body: ForgetPreviewData{}, Response: []ForgetGroup{}},
+	{Method: "post", Path: "/repositories/:id/mount", Summary: "Mount a repository", Role: RoleOperator, Body: MountData{}},
+	{Method: "post", Path: "/repositories/:id/unmount", Summary: "Unmount a repository", Role: RoleOperator, Body: MountData{}},
+	{Method: "post", Path: "/repositories/:id/snapshots/:snapshot_id/browse", Summary: "List one directory level of a snapshot, paginated by offset and limit (sort: name, size, mtime; order: asc, desc; filter: glob)", Role: RoleReadOnly, Query: []string{"sort", "order", "filter", "dirs_first"}, Body: BrowseData{}, Response: BrowseResult{}},
+	{Method: "get", Path: "/repositories/:id/snapshots/:snapshot_id/download", Summary: "Download a snapshot path as archive (format: tar.gz, tar, zip) or a single file (format: file, supports Range requests)", Role: RoleOperator, Query: []string{"path", "format"}},
+	{Method: "post", Path: "/repositories/:id/snapshots/:snapshot_id/analyze", Summary: "Largest directories and files below a path of a snapshot, directories with everything below them (limit: default 20; depth: 0 for all)", Role: RoleReadOnly, Body: AnalyzeData{}, Response: SizeAnalysis{}},
+	{Method: "post", Path: "/repositories/:id/snapshots/:snapshot_id/restore-check", Summary: "Validate a restore target and estimate the needed space", Role: RoleOperator, Body: RestoreData{}, Response: RestoreCheck{}},
+	{Method: "post", Path: "/backups/:id/restore-latest", Summary: "Restore paths of a backup from its newest snapshot, matched by the backup's path, host and tags. Responds 409 with the check on warnings unless force is set", Role: RoleOperator, Body: LatestRestoreData{}, Response: LatestRestore{}},
+	{Method: "post", Path: "/repositories/:id/snapshots/:snapshot_id/pin", Summary: "Tag a snapshot as pinned, retention policies always keep it. The snapshot gets a new id", Role: RoleOperator},
+	{Method: "post", Path: "/repositories/:id/snapshots/:snapshot_id/unpin", Summary: "Remove the pinned tag of a snapshot. The snapshot gets a new id", Role: RoleOperator},
+	{Method: "post", Path: "/repositories/:id/snapshots/:snapshot_id/restore", Summary: "Restore files from a snapshot, responds 409 with a RestoreCheck on warnings unless force is set", Role: RoleOperator, Body: RestoreData{}},
+}
+
+var pathParamRe = regexp.MustCompile(`:([a-z_]+)`)
+
+func OpenAPISpec(version string) map[string]any {
+	components := map[string]any{}
+	paths := map[string]any{}
+
+	for _, op := range apiOperations {
+		path := pathParamRe.ReplaceAllString(op.Path, "{$1}")
+		params := []any{}
+		for _, m := range pathParamRe.FindAllStringSubmatch(op.Path, -1) {
+			params = append(params, map[string]any{
+				"name": m[1], "in": "path", "required": true,
+				"schema": map[string]any{"type": "string"},
+			})
+		}
+		for _, q := range op.Query {
+			params = append(params, map[string]any{
+				"name": q, "in": "query",
+				"schema": map[string]any{"type": "string"},
+			})
+		}
+
+		operation := map[string]any{
+			"summary":    op.Summary,
+			"parameters": params,
+			"responses":  map[string]any{"200": responseSchema(op.Response, components)},
+		}
+		if op.Role != "" {
+			operation["description"] = "Requires role: " + string(op.Role)
+		} else {
+			operation["security"] = []any{}
+		}
+		if op.Body != nil {
+			operation["requestBody"] = map[string]any{
+				"required": true,
+				"content": map[string]any{
+					"application/json": map[string]any{
+						"schema": schemaFor(reflect.TypeOf(op.Body), components),
+					},
+				},
+			}
+		}
+
+		if _, ok := paths[path]; !ok {
+			paths[path] = map[string]any{}
+		}
+		paths[path].(map[string]any)[op.Method] = operation
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "resticity",
+			"version": version,
+		},
+		"servers": []any{map[string]any{"url": "/api"}},
+		"paths":   paths,
+		"components": map[string]any{
+			"schemas": components,
+			"securitySchemes": map[string]any{
+				"bearer": map[string]any{"type": "http", "scheme": "bearer"},
+			},
+		},
+		"security": []any{map[string]any{"bearer": []any{}}},
+	}
+}
+
+func responseSchema(res any, components map[string]any) map[string]any {
+	if res == nil {
+		return map[string]any{
+			"description": "OK",
+			"content": map[string]any{
+				"text/plain": map[string]any{"schema": map[string]any{"type": "string"}},
+			},
+		}
+	}
+	return map[string]any{
+		"description": "OK",
+		"content": map[string]any{
+			"application/json": map[string]any{
+				"schema": schemaFor(reflect.TypeOf(res), components),
+			},
+		},
+	}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaFor builds a JSON schema for t. Named structs are added to
+// components and referenced, so shared types show up only once.
+func schemaFor(t reflect.Type, components map[string]any) map[string]any {
+	if t == timeType {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		s := schemaFor(t.Elem(), components)
+		if _, ok := s["$ref"]; ok {
+			// siblings of $ref are ignored, so the reference is wrapped
+			return map[string]any{"allOf": []any{s}, "nullable": true}
+		}
+		s["nullable"] = true
+		return s
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": schemaFor(t.Elem(), components)}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": schemaFor(t.Elem(), components)}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return structSchema(t, components)
+		}
+		if _, ok := components[t.Name()]; !ok {
+			// reserve the name first to break recursive types
+			components[t.Name()] = map[string]any{}
+			components[t.Name()] = structSchema(t, components)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + t.Name()}
+	}
+
+	return map[string]any{}
+}
+
+func structSchema(t reflect.Type, components map[string]any) map[string]any {
+	props := map[string]any{}
+	collectProperties(t, props, components)
+	return map[string]any{"type": "object", "properties": props}
+}
+
+func collectProperties(t reflect.Type, props map[string]any, components map[string]any) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if f.Anonymous && tag == "" {
+			collectProperties(f.Type, props, components)
+			continue
+		}
+		if !f.IsExported() || tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = schemaFor(f.Type, components)
+	}
+}
@@ -0,0 +1,163 @@
+package internal
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+)
+
+// ResticCommand is a restic subcommand with its arguments, run against a
+// configured repository. Commands that change the repository need the
+// confirm token of the exact same command.
+type ResticCommand struct {
+	Args    []string `json:"args"`
+	Confirm string   `json:"confirm"`
+}
+
+// ConfirmRequired is the answer to a command that changes the repository
+// but wasn't confirmed.
+type ConfirmRequired struct {
+	Message string   `json:"message"`
+	Args    []string `json:"args"`
+	Confirm string   `json:"confirm"`
+}
+
+var ErrConfirmRequired = errors.New("This command changes the repository, repeat it with its confirm token")
+
+// resticReadCommands only read the repository.
+var resticReadCommands = []string{"cat", "check", "diff", "find", "list", "ls", "snapshots", "stats"}
+
+// resticWriteCommands change or remove data and need a confirm token.
+// Everything else, like backup, restore, mount or init, has its own place in
+// resticity and is refused.
+var resticWriteCommands = []string{"forget", "key", "migrate", "prune", "recover", "repair", "rewrite", "tag", "unlock"}
+
+// resticBlockedFlags would point restic at another repository, password,
+// backend option or certificate than the configured ones, or weaken its TLS
+// settings.
+var resticBlockedFlags = []string{
+	"--repo", "--repository-file",
+	"--password-file", "--password-command", "--insecure-no-password",
+	"--from-repo", "--from-repository-file", "--from-password-file", "--from-password-command",
+	"--option", "--cacert", "--tls-client-cert", "--insecure-tls",
+}
+
+// resticBlockedShorthands are the short forms of blocked flags: -r, -p
+// and -o.
+var resticBlockedShorthands = "rpo"
+
+// resticShorthandRegex matches single dash clusters of shorthands.
+var resticShorthandRegex = regexp.MustCompile(`^-[^-]`)
+
+// checkResticArgs tells whether args may run and whether they change the
+// repository. The subcommand has to come first.
+func checkResticArgs(args []string) (bool, error) {
+	if len(args) == 0 {
+		return false, errors.New("No restic command")
+	}
+	write := slices.Contains(resticWriteCommands, args[0])
+	if !write && !slices.Contains(resticReadCommands, args[0]) {
+		return false, fmt.Errorf("restic %s is not allowed, use one of %s", args[0], strings.Join(append(slices.Clone(resticReadCommands), resticWriteCommands...), ", "))
+	}
+	if args[0] == "cat" && slices.Contains(args, "masterkey") {
+		return false, errors.New("restic cat masterkey is not allowed")
+	}
+	for _, a := range args[1:] {
+		if a == "--" {
+			// only arguments follow
+			break
+		}
+		name, _, _ := strings.Cut(a, "=")
+		if slices.Contains(resticBlockedFlags, name) {
+			return false, fmt.Errorf("%s is not allowed, the repository comes from the config", name)
+		}
+		// shorthands can be combined and take their value attached, like
+		// -vr/other/repo, so any blocked letter refuses the cluster
+		if resticShorthandRegex.MatchString(a) {
+			if i := strings.IndexAny(a[1:], resticBlockedShorthands); i >= 0 {
+				return false, fmt.Errorf("-%c is not allowed, the repository comes from the config", a[1+i])
+			}
+		}
+	}
+	return write, nil
+}
+
+// confirmToken is bound to the repository and the exact arguments, keyed by
+// the API token so it can't be made up without it.
+func confirmToken(key string, repositoryId string, args []string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(repositoryId))
+	for _, a := range args {
+		mac.Write([]byte{0})
+		mac.Write([]byte(a))
+	}
+	return hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// RunCommand runs a restic subcommand checked by checkResticArgs and writes
+// all it prints to w.
+func (r *Restic) RunCommand(ctx context.Context, repository Repository, args []string, w io.Writer) error {
+	if _, err := checkResticArgs(args); err != nil {
+		return err
+	}
+	log.Info("restic command", "repository_id", repository.Id, "repo", MaskSecrets(repository.Path), "cmd", args, "request_id", r.requestId)
+	out := &flushWriter{w: w}
+	return r.streamOutErr(ctx, repository, args, out, out)
+}
+
+// serveResticCommand runs a restic command for power users and streams its
+// output. Unconfirmed commands that change the repository get 409 with the
+// token to confirm them.
+func serveResticCommand(settings *Settings, scheduler *Scheduler, restic *Restic, auth *Auth) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		repository := settings.Config.GetRepositoryById(c.Params("id"))
+		if repository == nil {
+			c.SendStatus(404)
+			return c.SendString("Repository not found")
+		}
+		var cmd ResticCommand
+		if err := c.BodyParser(&cmd); err != nil {
+			c.SendStatus(400)
+			return c.SendString(err.Error())
+		}
+		write, err := checkResticArgs(cmd.Args)
+		if err != nil {
+			c.SendStatus(400)
+			return c.SendString(err.Error())
+		}
+		if write && repository.ReadOnly {
+			c.SendStatus(403)
+			return c.SendString(ErrRepositoryReadOnly.Error())
+		}
+		if write {
+			token := confirmToken(auth.Token(), repository.Id, cmd.Args)
+			if !hmac.Equal([]byte(cmd.Confirm), []byte(token)) {
+				c.Status(409)
+				return c.JSON(ConfirmRequired{Message: ErrConfirmRequired.Error(), Args: cmd.Args, Confirm: token})
+			}
+			if scheduler.repositoryBusy(repository.Id) {
+				c.SendStatus(409)
+				return c.SendString("A schedule is running on this repository")
+			}
+		}
+
+		rq := restic.ForRequest(requestID(c))
+		return streamOutput(c, func(w io.Writer) error {
+			err := rq.RunCommand(context.Background(), *repository, cmd.Args, w)
+			if err != nil {
+				log.Error("restic command", "repository", repository.Name, "cmd", cmd.Args[0], "err", err)
+			}
+			return err
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package internal
+
+import (
+	"slices"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// PauseState tells whether scheduled runs are skipped. Until is nil when
+// paused until resumed.
+type PauseState struct {
+	Paused bool       `json:"paused"`
+	Until  *time.Time `json:"until"`
+	// ids of schedules paused on their own
+	Schedules []string `json:"schedules"`
+	// Maintenance pauses everything, Paused is true while it is enabled
+	Maintenance Maintenance `json:"maintenance"`
+}
+
+// Pause skips all scheduled runs for d, or until resumed if d is 0.
+// Running jobs finish and manual runs still work.
+func (s *Scheduler) Pause(d time.Duration) PauseState {
+	s.pmu.Lock()
+	if s.resumeTimer != nil {
+		s.resumeTimer.Stop()
+		s.resumeTimer = nil
+	}
+	s.pause = PauseState{Paused: true, Schedules: s.pause.Schedules}
+	if d > 0 {
+		until := time.Now().Add(d)
+		s.pause.Until = &until
+		s.resumeTimer = time.AfterFunc(d, s.Resume)
+	}
+	s.pmu.Unlock()
+	state := s.PauseState()
+	log.Info("Backups paused", "until", state.Until)
+	publish(Envelope{Type: MsgPause, Payload: state, Timestamp: time.Now()})
+	return state
+}
+
+func (s *Scheduler) Resume() {
+	s.pmu.Lock()
+	if s.resumeTimer != nil {
+		s.resumeTimer.Stop()
+		s.resumeTimer = nil
+	}
+	s.pause = PauseState{Schedules: s.pause.Schedules}
+	s.pmu.Unlock()
+	log.Info("Backups resumed")
+	publish(Envelope{Type: MsgPause, Payload: s.PauseState(), Timestamp: time.Now()})
+}
+
+// PauseSchedule skips the scheduled runs of one schedule until it is
+// resumed, independent of pausing all backups.
+func (s *Scheduler) PauseSchedule(id string, paused bool) PauseState {
+	s.pmu.Lock()
+	schedules := []string{}
+	for _, p := range s.pause.Schedules {
+		if p != id {
+			schedules = append(schedules, p)
+		}
+	}
+	if paused {
+		schedules = append(schedules, id)
+	}
+	s.pause.Schedules = schedules
+	s.pmu.Unlock()
+	state := s.PauseState()
+	s.jobLog(id).Info("Schedule paused", "paused", paused)
+	publish(Envelope{Type: MsgPause, Payload: state, Timestamp: time.Now()})
+	return state
+}
+
+func (s *Scheduler) PauseState() PauseState {
+	s.pmu.Lock()
+	defer s.pmu.Unlock()
+	state := s.pause
+	state.Maintenance = s.maintenance
+	if s.maintenance.Enabled {
+		state.Paused = true
+	}
+	return state
+}
+
+// skipRun marks a scheduled run of a paused scheduler, or any run of a
+// schedule whose drive isn't connected, as skipped, so the job and its
+// listeners do nothing.
+func (s *Scheduler) skipRun(id string) bool {
+	if j, ok := s.jobs.Get(id); ok && s.deviceMissing(j.Schedule) {
+		s.jobs.Update(id, func(j *Job) {
+			j.skipped = true
+			j.Force = false
+		})
+		return true
+	}
+	pause := s.PauseState()
+	if !pause.Paused && !slices.Contains(pause.Schedules, id) {
+		return false
+	}
+	skipped := false
+	s.jobs.Update(id, func(j *Job) {
+		if !j.Force {
+			jobLog(j).Info("Paused, skipping scheduled run")
+			j.skipped = true
+			skipped = true
+		}
+	})
+	return skipped
+}
+
+func (s *Scheduler) wasSkipped(id string) bool {
+	j, ok := s.jobs.Get(id)
+	return ok && j.skipped
+}
+
+func (s *Scheduler) clearSkipped(id string) bool {
+	cleared := false
+	s.jobs.Update(id, func(j *Job) {
+		cleared = j.skipped
+		j.skipped = false
+	})
+	return cleared
+}
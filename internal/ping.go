@@ -0,0 +1,43 @@
+package internal
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+var pingClient = &http.Client{Timeout: 10 * time.Second}
+
+// Ping calls a dead man's switch url like the ones of healthchecks.io or
+// Uptime Kuma push monitors, retrying a few times as a missed ping raises
+// an alert.
+func Ping(url string) error {
+	if url == "" {
+		return nil
+	}
+	var err error
+	for attempt := 0; attempt < 3; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(attempt) * 2 * time.Second)
+		}
+		var res *http.Response
+		res, err = pingClient.Get(url)
+		if err != nil {
+			continue
+		}
+		res.Body.Close()
+		if res.StatusCode < 300 {
+			return nil
+		}
+		err = fmt.Errorf("ping responded %d", res.StatusCode)
+	}
+	return err
+}
+
+func pingSchedule(schedule Schedule, url string) {
+	if err := Ping(url); err != nil {
+		log.Error("ping", "schedule", schedule.Id, "err", err)
+	}
+}
@@ -0,0 +1,44 @@
+package internal
+
+import (
+	"errors"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DefaultProfile uses the config file itself, other profiles live next to
+// it as config.<name>.json.
+const DefaultProfile = "default"
+
+var profileNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+var ErrInvalidProfile = errors.New("Invalid profile name, use letters, digits, - and _")
+
+func (s *Settings) profileFile(name string) string {
+	if name == DefaultProfile {
+		return s.base
+	}
+	return strings.TrimSuffix(s.base, filepath.Ext(s.base)) + "." + name + ".json"
+}
+
+func (s *Settings) Profile() string {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.profile
+}
+
+func (s *Settings) Profiles() []string {
+	profiles := []string{DefaultProfile}
+	prefix := strings.TrimSuffix(s.base, filepath.Ext(s.base)) + "."
+	files, _ := filepath.Glob(prefix + "*.json")
+	sort.Strings(files)
+	for _, f := range files {
+		name := strings.TrimSuffix(strings.TrimPrefix(f, prefix), ".json")
+		if profileNameRegex.MatchString(name) && name != DefaultProfile {
+			profiles = append(profiles, name)
+		}
+	}
+	return profiles
+}
@@ -0,0 +1,138 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+)
+
+// LatestRestoreData restores paths of a backup from its newest snapshot.
+type LatestRestoreData struct {
+	// RepositoryId is one of the backup's targets, the first one if empty
+	RepositoryId string `json:"repository_id"`
+	// Paths below the backup's path, the whole backup if empty
+	Paths  []string `json:"paths"`
+	ToPath string   `json:"to_path"`
+	// Host of the snapshot, the --host of the backup or this machine
+	Host  string `json:"host"`
+	Force bool   `json:"force"`
+}
+
+// LatestRestore tells which snapshot was restored, or would be when the
+// check has warnings.
+type LatestRestore struct {
+	Snapshot Snapshot     `json:"snapshot"`
+	Check    RestoreCheck `json:"check"`
+}
+
+var (
+	ErrNoSnapshot       = errors.New("No snapshot of this backup found")
+	ErrNotBackupPath    = errors.New("Paths must be below the path of the backup")
+	ErrNotBackupTarget  = errors.New("The repository is not a target of this backup")
+	ErrNoRestoreTarget  = errors.New("to_path is required")
+	ErrRestoreHasIssues = errors.New("The restore target has warnings")
+)
+
+// backupFlag returns the values a backup passes to restic for flag, like
+// its --host or --tag options.
+func backupFlag(backup Backup, flag string) []string {
+	values := []string{}
+	for _, p := range backup.BackupParams {
+		for i := 0; i < len(p); i++ {
+			if p[i] == flag && i+1 < len(p) {
+				values = append(values, p[i+1])
+				i++
+			} else if strings.HasPrefix(p[i], flag+"=") {
+				values = append(values, strings.TrimPrefix(p[i], flag+"="))
+			}
+		}
+	}
+	return values
+}
+
+// LatestSnapshot returns the newest snapshot of backup in repository,
+// matched by the backup's path, host and tags.
+func (r *Restic) LatestSnapshot(repository Repository, backup Backup, host string) (*Snapshot, error) {
+	if host == "" {
+		if hosts := backupFlag(backup, "--host"); len(hosts) > 0 {
+			host = hosts[len(hosts)-1]
+		} else if host, _ = os.Hostname(); host == "" {
+			return nil, errors.New("Could not tell the host name, pass host")
+		}
+	}
+	tags := append([]string{"resticity"}, backupFlag(backup, "--tag")...)
+	cmd := []string{"snapshots", "--json", "--latest", "1", "--path", backup.Path, "--host", host, "--tag", strings.Join(tags, ",")}
+	var latest *Snapshot
+	err := decodeJSON(r, context.Background(), repository, cmd, func(s Snapshot) error {
+		if latest == nil || s.Time.After(latest.Time) {
+			latest = &s
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if latest == nil {
+		return nil, ErrNoSnapshot
+	}
+	return latest, nil
+}
+
+// RestoreLatest restores data.Paths of backup from its newest snapshot into
+// data.ToPath, relative to the backup's path. Without force nothing is
+// restored when the check has warnings.
+func (r *Restic) RestoreLatest(repository Repository, backup Backup, data LatestRestoreData) (LatestRestore, error) {
+	if data.ToPath == "" {
+		return LatestRestore{}, ErrNoRestoreTarget
+	}
+	root := path.Clean(FixPath(backup.Path))
+	paths := []string{}
+	for _, p := range data.Paths {
+		if p == "" {
+			continue
+		}
+		p = path.Clean(FixPath(p))
+		if p != root && !strings.HasPrefix(p, strings.TrimSuffix(root, "/")+"/") {
+			return LatestRestore{}, ErrNotBackupPath
+		}
+		paths = append(paths, p)
+	}
+	if len(paths) == 0 {
+		paths = []string{root}
+	}
+
+	snapshot, err := r.LatestSnapshot(repository, backup, data.Host)
+	if err != nil {
+		return LatestRestore{}, err
+	}
+	res := LatestRestore{Snapshot: *snapshot}
+	res.Check = r.CheckRestore(repository, snapshot.Id, RestoreData{RootPath: root, FromPath: paths[0], ToPath: data.ToPath})
+	for _, p := range paths[1:] {
+		size, err := r.RestoreSize(repository, snapshot.Id, p)
+		if err != nil {
+			res.Check.Warnings = append(res.Check.Warnings, RestoreWarning{Code: RestoreSizeUnknown, Message: "Could not estimate the restore size: " + err.Error()})
+			break
+		}
+		res.Check.Size += size
+	}
+	if res.Check.Free > 0 && res.Check.Size > res.Check.Free && !slices.ContainsFunc(res.Check.Warnings, func(w RestoreWarning) bool { return w.Code == RestoreNotEnoughSpace }) {
+		res.Check.Warnings = append(res.Check.Warnings, RestoreWarning{Code: RestoreNotEnoughSpace, Message: fmt.Sprintf("Restoring needs %d bytes, but only %d bytes are free", res.Check.Size, res.Check.Free)})
+	}
+	if len(res.Check.Warnings) > 0 && !data.Force {
+		return res, ErrRestoreHasIssues
+	}
+
+	cmd := []string{"restore", "--target", MaybeToWindowsPath(data.ToPath)}
+	for _, p := range paths {
+		if p != root {
+			cmd = append(cmd, "--include", strings.TrimPrefix(p, strings.TrimSuffix(root, "/")))
+		}
+	}
+	cmd = append(cmd, "--", snapshot.Id+":"+root)
+	_, err = r.Exec(repository, cmd, []string{}, nil)
+	return res, err
+}
@@ -0,0 +1,108 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// RepositoryQuota is an optional size limit of a repository, checked
+// against its size after every backup, copy, prune and forget.
+type RepositoryQuota struct {
+	// Bytes is the quota, 0 turns it off
+	Bytes uint64 `json:"bytes"`
+	// WarnAt are percentages of the quota that warn once when crossed
+	WarnAt []uint32 `json:"warn_at"`
+	// Block refuses backups and copies into the repository while it's over
+	Block bool `json:"block"`
+}
+
+var defaultQuotaWarnAt = []uint32{80, 90, 100}
+
+// QuotaWarning is sent as MsgWarning when a repository grows past a
+// threshold of its quota.
+type QuotaWarning struct {
+	Title        string `json:"title"`
+	RepositoryId string `json:"repository_id"`
+	Reason       string `json:"reason"`
+	Size         uint64 `json:"size"`
+	Quota        uint64 `json:"quota"`
+	Percent      uint32 `json:"percent"`
+}
+
+func (q RepositoryQuota) thresholds() []uint32 {
+	if len(q.WarnAt) == 0 {
+		return defaultQuotaWarnAt
+	}
+	return q.WarnAt
+}
+
+// crossed returns the highest threshold a size is at or over, 0 for none.
+func (q RepositoryQuota) crossed(size uint64) uint32 {
+	crossed := uint32(0)
+	for _, t := range q.thresholds() {
+		if float64(size) >= float64(q.Bytes)*float64(t)/100 && t > crossed {
+			crossed = t
+		}
+	}
+	return crossed
+}
+
+// LatestMetric returns the newest value of a metric of a repository.
+func (s *Store) LatestMetric(name string, repositoryId string) (float64, bool) {
+	if s == nil {
+		return 0, false
+	}
+	var v float64
+	err := s.db.QueryRow(
+		`SELECT value FROM metrics WHERE name = ? AND repository_id = ? ORDER BY time DESC LIMIT 1`,
+		name, repositoryId,
+	).Scan(&v)
+	return v, err == nil
+}
+
+// checkQuota warns when a repository grew past another threshold of its
+// quota since the last recorded size.
+func (s *Scheduler) checkQuota(schedule Schedule, repository Repository, previous uint64, size uint64) {
+	q := repository.Quota
+	if q.Bytes == 0 {
+		return
+	}
+	t := q.crossed(size)
+	if t == 0 || q.crossed(previous) >= t {
+		return
+	}
+	w := QuotaWarning{
+		Title:        "Repository quota",
+		RepositoryId: repository.Id,
+		Reason:       fmt.Sprintf("%s uses %d%% of its quota (%d of %d bytes)", repository.Name, size*100/q.Bytes, size, q.Bytes),
+		Size:         size,
+		Quota:        q.Bytes,
+		Percent:      t,
+	}
+	if q.Block && size >= q.Bytes {
+		w.Reason += ", backups into it are blocked until it's pruned"
+	}
+	s.jobLog(schedule.Id).Warn("repository quota", "repository", repository.Name, "size", size, "quota", q.Bytes)
+	if j, err := json.Marshal(w); err == nil {
+		(*s.OutputCh) <- ChanMsg{Id: schedule.Id, Type: MsgWarning, Msg: string(j), Time: time.Now()}
+	}
+	s.Notify.Warning(w.Title, w.Reason)
+}
+
+// quotaBlocks refuses backups and copies into a repository that is over
+// its quota and set to block, prunes and forgets still run to free space.
+func (s *Scheduler) quotaBlocks(schedule Schedule) error {
+	if schedule.Action != "backup" && schedule.Action != "copy-snapshots" {
+		return nil
+	}
+	repository := s.settings.Config.GetRepositoryById(schedule.ToRepositoryId)
+	if repository == nil || !repository.Quota.Block || repository.Quota.Bytes == 0 {
+		return nil
+	}
+	size, ok := s.Store.LatestMetric("repo_size", repository.Id)
+	if !ok || uint64(size) < repository.Quota.Bytes {
+		return nil
+	}
+	return fmt.Errorf("%s is over its quota of %d bytes (%d bytes), prune it or raise the quota", repository.Name, repository.Quota.Bytes, uint64(size))
+}
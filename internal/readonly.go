@@ -0,0 +1,71 @@
+package internal
+
+import (
+	"errors"
+	"regexp"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var ErrReadOnly = errors.New("Read-only mode: changes are disabled on this server")
+
+// readOnly is set on start for wall displays and demos, every request that
+// changes something is refused.
+var readOnly bool
+
+func SetReadOnly(enabled bool) {
+	readOnly = enabled
+}
+
+func IsReadOnly() bool {
+	return readOnly
+}
+
+// readOnlyAllowed are requests that don't use GET but only read.
+var readOnlyAllowed = []*regexp.Regexp{
+	regexp.MustCompile(`^/api/auth/(login|logout)$`),
+	regexp.MustCompile(`^/api/check$`),
+	regexp.MustCompile(`^/api/schedules/validate$`),
+	regexp.MustCompile(`^/api/instance/show$`),
+	regexp.MustCompile(`^/api/repositories/test-credentials$`),
+	regexp.MustCompile(`^/api/repositories/[^/]+/(snapshots|forget-preview)$`),
+	regexp.MustCompile(`^/api/repositories/[^/]+/snapshots/[^/]+/(browse|analyze|restore-check)$`),
+}
+
+// readOnlyDenied are GET requests that change something.
+var readOnlyDenied = []*regexp.Regexp{
+	regexp.MustCompile(`^/api/schedules/[^/]+/(run|stop|pause|resume)$`),
+}
+
+// changesState tells requests that change something apart from those that
+// only read, by method and the exceptions above.
+func changesState(c *fiber.Ctx) bool {
+	if c.Method() == fiber.MethodOptions {
+		return false
+	}
+	rules, matched := readOnlyAllowed, false
+	if c.Method() == fiber.MethodGet || c.Method() == fiber.MethodHead {
+		rules, matched = readOnlyDenied, true
+	}
+	for _, r := range rules {
+		if r.MatchString(c.Path()) {
+			return matched
+		}
+	}
+	return !matched
+}
+
+func readOnlyGuard() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if readOnly && changesState(c) {
+			return readOnlyRefused(c)
+		}
+		return c.Next()
+	}
+}
+
+func readOnlyRefused(c *fiber.Ctx) error {
+	c.Set("X-Resticity-Read-Only", "true")
+	c.SendStatus(403)
+	return c.SendString(ErrReadOnly.Error())
+}
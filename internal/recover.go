@@ -0,0 +1,61 @@
+package internal
+
+import (
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// ComponentRestart is the payload of MsgComponentRestarted.
+type ComponentRestart struct {
+	Component string `json:"component"`
+	Error     string `json:"error"`
+}
+
+// reportPanic logs a recovered panic with its stack and tells the clients
+// which component went down. It must be called from the deferred function
+// that recovered, so the stack still shows where it happened.
+func reportPanic(component string, r any) error {
+	err := fmt.Errorf("panic in %s: %v", component, r)
+	log.Error("panic recovered", "component", component, "err", r, "stack", string(debug.Stack()))
+	// the hub might be the one that panicked, don't wait for it
+	go publish(Envelope{
+		Type:      MsgComponentRestarted,
+		Payload:   ComponentRestart{Component: component, Error: fmt.Sprint(r)},
+		Timestamp: time.Now(),
+	})
+	go errorCenter.Report(ErrorSourceComponent, component, "Recovered from a panic", fmt.Sprint(r))
+	return err
+}
+
+// recoverAs is deferred by functions returning an error, a panic becomes
+// that error.
+func recoverAs(component string, err *error) {
+	if r := recover(); r != nil {
+		*err = reportPanic(component, r)
+	}
+}
+
+// runGuarded runs fn and reports whether it panicked instead of letting
+// the panic take down the app.
+func runGuarded(component string, fn func()) (panicked bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			reportPanic(component, r)
+			panicked = true
+		}
+	}()
+	fn()
+	return false
+}
+
+// supervise runs a long-living fn and restarts it after a panic, until it
+// returns normally.
+func supervise(component string, fn func()) {
+	for runGuarded(component, fn) {
+		log.Warn("component restarted", "component", component)
+		time.Sleep(time.Second)
+	}
+}
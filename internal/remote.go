@@ -0,0 +1,147 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-json"
+)
+
+const remoteListTimeout = 15 * time.Second
+
+// ListRemotePath lists the directories of a remote repository location,
+// given in restic's sftp: or rclone: notation.
+func ListRemotePath(path string) ([]PathEntry, error) {
+	switch {
+	case strings.HasPrefix(path, "sftp:"):
+		return listSftp(path, strings.TrimPrefix(path, "sftp:"))
+	case strings.HasPrefix(path, "rclone:"):
+		return listRclone(path, strings.TrimPrefix(path, "rclone:"))
+	}
+	return []PathEntry{}, errors.New("Unsupported remote, must start with sftp: or rclone:")
+}
+
+// joinRemote appends name to a remote location, keeping it in the notation
+// restic expects.
+func joinRemote(path string, name string) string {
+	if strings.HasSuffix(path, ":") || strings.HasSuffix(path, "/") {
+		return path + name
+	}
+	return path + "/" + name
+}
+
+func runRemoteList(name string, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), remoteListTimeout)
+	defer cancel()
+	var sout bytes.Buffer
+	var serr bytes.Buffer
+	c := exec.CommandContext(ctx, name, args...)
+	c.Stdout = &sout
+	c.Stderr = &serr
+	if err := c.Run(); err != nil {
+		if serr.Len() > 0 {
+			return nil, errors.New(strings.TrimSpace(serr.String()))
+		}
+		return nil, err
+	}
+	return sout.Bytes(), nil
+}
+
+// listSftp uses the ssh client, so the same keys and ~/.ssh/config apply
+// as for restic itself. Accepts user@host:/path and //user@host:port/path.
+func listSftp(path string, location string) ([]PathEntry, error) {
+	host, port, dir := "", "", ""
+	if strings.HasPrefix(location, "//") {
+		u, err := url.Parse("sftp:" + location)
+		if err != nil {
+			return []PathEntry{}, err
+		}
+		host = u.Hostname()
+		if u.User != nil {
+			host = u.User.Username() + "@" + host
+		}
+		port = u.Port()
+		dir = strings.TrimPrefix(u.Path, "/")
+	} else {
+		i := strings.Index(location, ":")
+		if i < 0 {
+			return []PathEntry{}, errors.New("Invalid sftp location, expected user@host:/path")
+		}
+		host, dir = location[:i], location[i+1:]
+	}
+	if host == "" || strings.HasPrefix(host, "-") {
+		// would be read as an option of ssh
+		return []PathEntry{}, errors.New("Invalid sftp host")
+	}
+	if dir == "" {
+		dir = "."
+	}
+
+	args := []string{"-o", "BatchMode=yes"}
+	if port != "" {
+		args = append(args, "-p", port)
+	}
+	// the remote shell parses the command, so quote the directory
+	args = append(args, "--", host, "ls", "-1pA", "--", "'"+strings.ReplaceAll(dir, "'", `'\''`)+"'")
+	out, err := runRemoteList("ssh", args...)
+	if err != nil {
+		return []PathEntry{}, err
+	}
+
+	entries := []PathEntry{}
+	for _, line := range strings.Split(string(out), "\n") {
+		if !strings.HasSuffix(line, "/") {
+			continue
+		}
+		name := strings.TrimSuffix(line, "/")
+		entries = append(entries, PathEntry{Name: name, Path: joinRemote(path, name), IsDir: true})
+	}
+	return entries, nil
+}
+
+// rcloneBinary prefers the rclone shipped next to restic, like
+// resticBinary does.
+func rcloneBinary() string {
+	if cd, err := os.Getwd(); err == nil {
+		for _, name := range []string{"rclone", "rclone.exe"} {
+			if _, err := os.Stat(filepath.Join(cd, name)); err == nil {
+				return filepath.Join(cd, name)
+			}
+		}
+	}
+	return "rclone"
+}
+
+func listRclone(path string, location string) ([]PathEntry, error) {
+	if strings.HasPrefix(location, "-") {
+		return []PathEntry{}, errors.New("Invalid rclone remote")
+	}
+	out, err := runRemoteList(rcloneBinary(), "lsjson", "--dirs-only", "--", location)
+	if err != nil {
+		return []PathEntry{}, err
+	}
+	var data []struct {
+		Name  string
+		Path  string
+		IsDir bool
+	}
+	if err := json.Unmarshal(out, &data); err != nil {
+		return []PathEntry{}, err
+	}
+	entries := []PathEntry{}
+	for _, d := range data {
+		entries = append(entries, PathEntry{
+			Name:  d.Name,
+			Path:  joinRemote(path, d.Path),
+			IsDir: d.IsDir,
+		})
+	}
+	return entries, nil
+}
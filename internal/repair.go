@@ -0,0 +1,155 @@
+package internal
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+)
+
+var ErrUnknownRepair = errors.New("Unknown repair, use index or snapshots")
+
+// RepairOptions are the flags of restic repair index and repair snapshots
+// that resticity allows, each only for the repair that knows it.
+type RepairOptions struct {
+	// ReadAllPacks rebuilds the index from all pack files (index)
+	ReadAllPacks bool
+	// Forget removes the damaged snapshots after repairing them (snapshots)
+	Forget bool
+	// DryRun only shows what would be repaired (snapshots)
+	DryRun bool
+}
+
+func repairArgs(what string, opts RepairOptions) ([]string, error) {
+	switch what {
+	case "index":
+		if opts.Forget || opts.DryRun {
+			return nil, errors.New("forget and dry_run are only for repairing snapshots")
+		}
+		args := []string{"repair", "index"}
+		if opts.ReadAllPacks {
+			args = append(args, "--read-all-packs")
+		}
+		return args, nil
+	case "snapshots":
+		if opts.ReadAllPacks {
+			return nil, errors.New("read_all_packs is only for repairing the index")
+		}
+		args := []string{"repair", "snapshots"}
+		if opts.Forget {
+			args = append(args, "--forget")
+		}
+		if opts.DryRun {
+			args = append(args, "--dry-run")
+		}
+		return args, nil
+	}
+	return nil, ErrUnknownRepair
+}
+
+// Repair runs restic repair index or repair snapshots and writes all it
+// prints to w.
+func (r *Restic) Repair(ctx context.Context, repository Repository, what string, opts RepairOptions, w io.Writer) error {
+	args, err := repairArgs(what, opts)
+	if err != nil {
+		return err
+	}
+	log.Info("repair", "repository_id", repository.Id, "repo", MaskSecrets(repository.Path), "cmd", args, "request_id", r.requestId)
+	out := &flushWriter{w: w}
+	return r.streamOutErr(ctx, repository, args, out, out)
+}
+
+// flushWriter lets stdout and stderr of restic write to the same response,
+// every write reaches the client right away.
+type flushWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (f *flushWriter) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n, err := f.w.Write(p)
+	if b, ok := f.w.(*bufio.Writer); ok && err == nil {
+		err = b.Flush()
+	}
+	return n, err
+}
+
+// repositoryBusy tells whether a running job reads or writes a repository.
+func (s *Scheduler) repositoryBusy(id string) bool {
+	for _, j := range s.GetRunningJobs() {
+		if j.Schedule.ToRepositoryId == id || j.Schedule.FromRepositoryId == id {
+			return true
+		}
+	}
+	return false
+}
+
+// serveRepair streams the output of a repair as plain text. Everything but
+// a dry run changes the repository and needs confirm=true.
+func serveRepair(settings *Settings, scheduler *Scheduler, restic *Restic) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		repository := settings.Config.GetRepositoryById(c.Params("id"))
+		if repository == nil {
+			c.SendStatus(404)
+			return c.SendString("Repository not found")
+		}
+		what := c.Params("what")
+		opts := RepairOptions{
+			ReadAllPacks: c.QueryBool("read_all_packs"),
+			Forget:       c.QueryBool("forget"),
+			DryRun:       c.QueryBool("dry_run"),
+		}
+		if _, err := repairArgs(what, opts); err != nil {
+			c.SendStatus(400)
+			return c.SendString(err.Error())
+		}
+		if !opts.DryRun && !c.QueryBool("confirm") {
+			c.SendStatus(400)
+			return c.SendString("Repairing changes the repository, add confirm=true")
+		}
+		if scheduler.repositoryBusy(repository.Id) {
+			c.SendStatus(409)
+			return c.SendString("A schedule is running on this repository")
+		}
+
+		rq := restic.ForRequest(requestID(c))
+		return streamOutput(c, func(w io.Writer) error {
+			err := rq.Repair(context.Background(), *repository, what, opts, w)
+			if err != nil {
+				log.Error("repair", "repository", repository.Name, "what", what, "err", err)
+			}
+			return err
+		})
+	}
+}
+
+// streamOutput sends what run writes as plain text while it runs. The
+// headers are sent before the outcome is known, so the last line is Done or
+// the error.
+func streamOutput(c *fiber.Ctx, run func(w io.Writer) error) error {
+	c.Set("Content-Type", "text/plain; charset=utf-8")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("X-Accel-Buffering", "no")
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		err := run(w)
+		var resticErr *ResticError
+		switch {
+		case errors.As(err, &resticErr):
+			fmt.Fprintf(w, "\nError: restic exited with %d\n", resticErr.Code)
+		case err != nil:
+			fmt.Fprintf(w, "\nError: %s\n", err)
+		default:
+			fmt.Fprintln(w, "\nDone")
+		}
+		w.Flush()
+	})
+	return nil
+}
@@ -0,0 +1,36 @@
+package internal
+
+// jobOutputSize is how many recent messages of a job are kept, so clients
+// that subscribe while it runs see what happened so far.
+const jobOutputSize = 500
+
+// ring keeps the last messages of a job in order, older ones are
+// overwritten.
+type ring struct {
+	items []Envelope
+	start int
+	size  int
+}
+
+func newRing(n int) *ring {
+	return &ring{items: make([]Envelope, n)}
+}
+
+func (r *ring) push(env Envelope) {
+	if r.size < len(r.items) {
+		r.items[(r.start+r.size)%len(r.items)] = env
+		r.size++
+		return
+	}
+	r.items[r.start] = env
+	r.start = (r.start + 1) % len(r.items)
+}
+
+// all returns the messages oldest first.
+func (r *ring) all() []Envelope {
+	out := make([]Envelope, 0, r.size)
+	for i := 0; i < r.size; i++ {
+		out = append(out, r.items[(r.start+i)%len(r.items)])
+	}
+	return out
+}
@@ -0,0 +1,378 @@
+package internal
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// RepositoryImportData is an env file, a systemd unit, a shell script or
+// the config of another tool from a setup resticity should take over.
+type RepositoryImportData struct {
+	Text string `json:"text"`
+}
+
+// RepositoryImport lists the repositories found in an import, with their
+// secrets redacted, and what was left out.
+type RepositoryImport struct {
+	Repositories []Repository `json:"repositories"`
+	// Skipped are locations already configured
+	Skipped  []string `json:"skipped"`
+	Warnings []string `json:"warnings"`
+}
+
+// importEnvPrefixes are the variables of restic and its backends, anything
+// else in a script, like PATH, is left out.
+var importEnvPrefixes = []string{"RESTIC_", "AWS_", "B2_", "AZURE_", "GOOGLE_", "OS_", "ST_", "RCLONE_"}
+
+// importHandledEnv are read into fields instead of env.
+var importHandledEnv = []string{
+	"RESTIC_REPOSITORY", "RESTIC_PASSWORD", "RESTIC_PASSWORD_FILE", "RESTIC_COMPRESSION",
+	"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN", "AWS_PROFILE", "AWS_SHARED_CREDENTIALS_FILE",
+	"AZURE_ACCOUNT_NAME", "AZURE_ACCOUNT_KEY", "AZURE_ACCOUNT_SAS", "AZURE_ENDPOINT_SUFFIX",
+	"GOOGLE_PROJECT_ID", "GOOGLE_APPLICATION_CREDENTIALS",
+}
+
+// assignmentRegex matches KEY=value after export, set, $env: and systemd's
+// Environment= have been cut off.
+var assignmentRegex = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*)\s*=\s*(.*)$`)
+
+// commandSeparatorRegex splits a; b and a && b into separate commands.
+var commandSeparatorRegex = regexp.MustCompile(`\s*&&\s*|;\s+`)
+
+// shellRefRegex matches $VAR and ${VAR}.
+var shellRefRegex = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}|\$([A-Za-z_][A-Za-z0-9_]*)`)
+
+type repositoryParser struct {
+	vars     map[string]string
+	found    []map[string]string
+	warnings []string
+}
+
+// ParseRepositories finds the repositories and their credentials in text.
+// A repository is taken from each RESTIC_REPOSITORY assignment, with the
+// variables set until the next one, and from the -r or --repo flag of
+// restic commands, with the variables set so far.
+func ParseRepositories(text string) ([]Repository, []string) {
+	p := &repositoryParser{vars: map[string]string{}, warnings: []string{}}
+	// index of the repository of the last RESTIC_REPOSITORY, filled in once
+	// its variables are known
+	pending := -1
+	for _, line := range importLines(text) {
+		if flags := parseResticCommand(line); flags != nil {
+			if _, ok := flags["RESTIC_REPOSITORY"]; ok {
+				for k, v := range flags {
+					flags[k] = p.expand(v)
+				}
+				p.found = append(p.found, p.snapshot(flags))
+			}
+			continue
+		}
+		if k, v, ok := parseAssignment(line); ok {
+			if k == "RESTIC_REPOSITORY" && pending >= 0 {
+				p.found[pending] = p.snapshot(nil)
+			}
+			if k == "RESTIC_REPOSITORY_FILE" {
+				p.warnings = append(p.warnings, "RESTIC_REPOSITORY_FILE isn't supported, add the repository by hand")
+			}
+			p.vars[k] = p.expand(v)
+			if k == "RESTIC_REPOSITORY" {
+				pending = len(p.found)
+				p.found = append(p.found, nil)
+			}
+		}
+	}
+	if pending >= 0 {
+		p.found[pending] = p.snapshot(nil)
+	}
+
+	repos := []Repository{}
+	seen := map[string]int{}
+	for _, vars := range p.found {
+		r := repositoryFromEnv(vars)
+		if i, ok := seen[r.Path]; ok {
+			// the same repository in several commands, e.g. backup and forget
+			mergeImported(&repos[i], r)
+			continue
+		}
+		seen[r.Path] = len(repos)
+		repos = append(repos, r)
+	}
+	for _, r := range repos {
+		if r.Password == "" && r.PasswordFile == "" && r.Env["RESTIC_PASSWORD_COMMAND"] == "" {
+			p.warnings = append(p.warnings, fmt.Sprintf("No password found for %s", r.Path))
+		}
+	}
+	return repos, p.warnings
+}
+
+// snapshot copies the restic variables, with flags of a command on top.
+func (p *repositoryParser) snapshot(flags map[string]string) map[string]string {
+	vars := map[string]string{}
+	for k, v := range p.vars {
+		for _, prefix := range importEnvPrefixes {
+			if strings.HasPrefix(k, prefix) {
+				vars[k] = v
+			}
+		}
+	}
+	if flags["RESTIC_PASSWORD_FILE"] != "" || flags["RESTIC_PASSWORD_COMMAND"] != "" {
+		// the flag replaces a password of the environment
+		delete(vars, "RESTIC_PASSWORD")
+		delete(vars, "RESTIC_PASSWORD_FILE")
+		delete(vars, "RESTIC_PASSWORD_COMMAND")
+	}
+	for k, v := range flags {
+		vars[k] = v
+	}
+	return vars
+}
+
+// expand replaces $VAR with what the script set before, variables it
+// doesn't set become ${VAR} and are resolved from the environment when
+// restic runs.
+func (p *repositoryParser) expand(s string) string {
+	return shellRefRegex.ReplaceAllStringFunc(s, func(ref string) string {
+		name := strings.Trim(ref, "${}")
+		if v, ok := p.vars[name]; ok {
+			return v
+		}
+		return "${" + name + "}"
+	})
+}
+
+// importLines splits text into logical lines, joining continuations and
+// leaving out comments.
+func importLines(text string) []string {
+	lines := []string{}
+	current := ""
+	for _, l := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		l = strings.TrimSpace(l)
+		if cont, ok := strings.CutSuffix(l, "\\"); ok {
+			current += cont + " "
+			continue
+		}
+		l = strings.TrimSpace(current + l)
+		current = ""
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		for _, part := range commandSeparatorRegex.Split(l, -1) {
+			if part = strings.TrimSuffix(part, ";"); part != "" {
+				lines = append(lines, part)
+			}
+		}
+	}
+	if current != "" {
+		lines = append(lines, strings.TrimSpace(current))
+	}
+	return lines
+}
+
+// parseAssignment reads KEY=value as written in env files, shell, fish,
+// cmd, PowerShell and systemd units.
+func parseAssignment(line string) (string, string, bool) {
+	for _, prefix := range []string{"set -gx ", "set -x "} {
+		if rest, ok := strings.CutPrefix(line, prefix); ok {
+			// fish: set -x KEY value
+			k, v, _ := strings.Cut(strings.TrimSpace(rest), " ")
+			line = k + "=" + strings.TrimSpace(v)
+		}
+	}
+	for _, prefix := range []string{"export ", "set ", "$env:", "Environment="} {
+		line = strings.TrimSpace(strings.TrimPrefix(line, prefix))
+	}
+	line = unquote(line)
+	m := assignmentRegex.FindStringSubmatch(line)
+	if m == nil {
+		return "", "", false
+	}
+	return m[1], unquote(strings.TrimSpace(m[2])), true
+}
+
+// parseResticCommand returns the repository and password flags of a restic
+// command, and variables set in front of it, nil for other lines.
+func parseResticCommand(line string) map[string]string {
+	args := shellFields(line)
+	flags := map[string]string{}
+	i := 0
+	for ; i < len(args); i++ {
+		if m := assignmentRegex.FindStringSubmatch(args[i]); m != nil {
+			flags[m[1]] = m[2]
+		} else if args[i] != "sudo" && args[i] != "env" {
+			break
+		}
+	}
+	if i >= len(args) || path.Base(args[i]) != "restic" {
+		return nil
+	}
+	names := map[string]string{
+		"-r": "RESTIC_REPOSITORY", "--repo": "RESTIC_REPOSITORY",
+		"-p": "RESTIC_PASSWORD_FILE", "--password-file": "RESTIC_PASSWORD_FILE",
+		"--password-command": "RESTIC_PASSWORD_COMMAND",
+		"--compression":      "RESTIC_COMPRESSION",
+	}
+	for j := i + 1; j < len(args); j++ {
+		name, value, hasValue := strings.Cut(args[j], "=")
+		env, ok := names[name]
+		if !ok {
+			continue
+		}
+		if !hasValue {
+			if j+1 >= len(args) {
+				break
+			}
+			j++
+			value = args[j]
+		}
+		flags[env] = value
+	}
+	return flags
+}
+
+// shellFields splits a command line at spaces outside of quotes.
+func shellFields(line string) []string {
+	fields := []string{}
+	var b strings.Builder
+	var quote rune
+	inField := false
+	for _, c := range line {
+		switch {
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+			b.WriteRune(c)
+		case c == '"' || c == '\'':
+			quote = c
+			inField = true
+		case c == ' ' || c == '\t':
+			if inField {
+				fields = append(fields, b.String())
+				b.Reset()
+				inField = false
+			}
+		default:
+			b.WriteRune(c)
+			inField = true
+		}
+	}
+	if inField {
+		fields = append(fields, b.String())
+	}
+	return fields
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// repositoryFromEnv builds a repository from restic's variables, those
+// without a field of their own go to env.
+func repositoryFromEnv(vars map[string]string) Repository {
+	r := Repository{
+		Id:           uuid.NewString(),
+		Type:         "local",
+		Path:         vars["RESTIC_REPOSITORY"],
+		Password:     vars["RESTIC_PASSWORD"],
+		PasswordFile: vars["RESTIC_PASSWORD_FILE"],
+		Compression:  vars["RESTIC_COMPRESSION"],
+		PruneParams:  [][]string{},
+		Env:          map[string]string{},
+	}
+	if r.Compression == "" {
+		r.Compression = "auto"
+	}
+	switch {
+	case strings.HasPrefix(r.Path, "s3:"):
+		r.Type = "s3"
+		r.Options.S3Key = vars["AWS_ACCESS_KEY_ID"]
+		r.Options.S3Secret = vars["AWS_SECRET_ACCESS_KEY"]
+		r.Options.S3SessionToken = vars["AWS_SESSION_TOKEN"]
+		r.Options.S3Profile = vars["AWS_PROFILE"]
+		r.Options.S3SharedCredentialsFile = vars["AWS_SHARED_CREDENTIALS_FILE"]
+	case strings.HasPrefix(r.Path, "azure:"):
+		r.Type = "azure"
+		r.Options.AzureAccountName = vars["AZURE_ACCOUNT_NAME"]
+		r.Options.AzureAccountKey = vars["AZURE_ACCOUNT_KEY"]
+		r.Options.AzureAccountSas = vars["AZURE_ACCOUNT_SAS"]
+		r.Options.AzureEndpointSuffix = vars["AZURE_ENDPOINT_SUFFIX"]
+	case strings.HasPrefix(r.Path, "gs:"):
+		r.Type = "gcs"
+		r.Options.GoogleProjectId = vars["GOOGLE_PROJECT_ID"]
+		r.Options.GoogleApplicationCredentials = vars["GOOGLE_APPLICATION_CREDENTIALS"]
+	}
+	for k, v := range vars {
+		if !slices.Contains(importHandledEnv, k) && !strings.HasPrefix(k, "RESTIC_FROM_") && k != "RESTIC_REPOSITORY_FILE" {
+			r.Env[k] = v
+		}
+	}
+	r.Name = importedName(r.Path)
+	return r
+}
+
+// importedName is the last part of a repository location, e.g. the bucket
+// or directory.
+func importedName(location string) string {
+	location = strings.TrimRight(location, "/")
+	if i := strings.LastIndexAny(location, "/:"); i >= 0 && i < len(location)-1 {
+		return location[i+1:]
+	}
+	return location
+}
+
+// mergeImported fills what a later mention of the same repository adds.
+func mergeImported(r *Repository, other Repository) {
+	if r.Password == "" && r.PasswordFile == "" {
+		r.Password = other.Password
+		r.PasswordFile = other.PasswordFile
+	}
+	for k, v := range other.Env {
+		if _, ok := r.Env[k]; !ok {
+			r.Env[k] = v
+		}
+	}
+}
+
+// ImportRepositories adds the repositories found in text to the config,
+// skipping locations already configured. With dryRun nothing is saved.
+func (s *Settings) ImportRepositories(text string, dryRun bool, user string) (RepositoryImport, []FieldError, error) {
+	found, warnings := ParseRepositories(text)
+	res := RepositoryImport{Repositories: []Repository{}, Skipped: []string{}, Warnings: warnings}
+	config := s.Config
+	config.Repositories = append([]Repository{}, s.Config.Repositories...)
+	for _, r := range found {
+		if r.Path == "" {
+			continue
+		}
+		exists := false
+		names := map[string]bool{}
+		for _, c := range config.Repositories {
+			exists = exists || c.Path == r.Path
+			names[c.Name] = true
+		}
+		if exists {
+			res.Skipped = append(res.Skipped, r.Path)
+			continue
+		}
+		for n, name := 2, r.Name; names[r.Name]; n++ {
+			r.Name = fmt.Sprintf("%s %d", name, n)
+		}
+		config.Repositories = append(config.Repositories, r)
+		redact(r.secretFields())
+		res.Repositories = append(res.Repositories, r)
+	}
+	if errs := config.Validate(); len(errs) > 0 {
+		return res, errs, nil
+	}
+	if dryRun || len(res.Repositories) == 0 {
+		return res, nil, nil
+	}
+	return res, nil, s.SaveVersion(config, user)
+}
@@ -0,0 +1,50 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var ErrRepositoryReadOnly = errors.New("The repository is read-only in resticity, turn that off in its settings first")
+
+// destructiveActions are schedule actions that remove snapshots or data.
+var destructiveActions = []string{"prune-repository", "forget-repository"}
+
+// readOnlyRepository refuses requests that change the snapshots or data of
+// a repository marked read-only, like an offsite archive. Adding snapshots
+// is still allowed.
+func readOnlyRepository(settings *Settings) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if r := settings.Config.GetRepositoryById(c.Params("id")); r != nil && r.ReadOnly {
+			c.SendStatus(403)
+			return c.SendString(ErrRepositoryReadOnly.Error())
+		}
+		return c.Next()
+	}
+}
+
+// readOnlyBlocks refuses prune and forget schedules on a read-only
+// repository, in case the config was edited by hand.
+func (s *Scheduler) readOnlyBlocks(schedule Schedule) error {
+	if !slices.Contains(destructiveActions, schedule.Action) {
+		return nil
+	}
+	if r := s.settings.Config.GetRepositoryById(schedule.ToRepositoryId); r != nil && r.ReadOnly {
+		return fmt.Errorf("%s: %w", r.Name, ErrRepositoryReadOnly)
+	}
+	return nil
+}
+
+// readOnlyPath tells whether a read-only repository is at path, so init
+// can't write over it.
+func (c *Config) readOnlyPath(path string) bool {
+	for _, r := range c.Repositories {
+		if r.ReadOnly && r.Path == path {
+			return true
+		}
+	}
+	return false
+}
@@ -3,11 +3,15 @@ package internal
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
@@ -15,9 +19,10 @@ import (
 )
 
 type Restic struct {
-	settings *Settings
-	OutputCh *chan ChanMsg
-	ErrorCh  *chan ChanMsg
+	settings  *Settings
+	OutputCh  *chan ChanMsg
+	ErrorCh   *chan ChanMsg
+	requestId string
 }
 
 func NewRestic(settings *Settings, outch *chan ChanMsg, errch *chan ChanMsg) *Restic {
@@ -29,52 +34,67 @@ func NewRestic(settings *Settings, outch *chan ChanMsg, errch *chan ChanMsg) *Re
 	return r
 }
 
-func (r *Restic) PipeOutErr(
-	c *exec.Cmd,
-	sout *bytes.Buffer,
-	serr *bytes.Buffer,
-	job *Job,
-) {
-	stdout, err := c.StdoutPipe()
-	if err == nil {
-		go func() {
-			scanner := bufio.NewScanner(stdout)
-			scanner.Split(bufio.ScanLines)
-			for scanner.Scan() {
-				go func(t string) {
-					msg := ChanMsg{Id: "", Msg: t, Time: time.Now()}
-					if job != nil {
-						msg.Id = job.Id
-					}
-					(*r.OutputCh) <- msg
-				}(scanner.Text())
-
-				sout.WriteString(scanner.Text())
-			}
-		}()
+// ForRequest returns a Restic tagging its logs and messages with the id of
+// the API request that started it.
+func (r *Restic) ForRequest(id string) *Restic {
+	rc := *r
+	rc.requestId = id
+	return &rc
+}
 
+// backendEnvs are the credentials of the repository's backend. restic reads
+// them for both repositories of a copy, so they're passed for the source
+// too.
+func (r *Restic) backendEnvs(repository Repository) []string {
+	envs := []string{}
+	// static keys take precedence over a profile in restic, so only the
+	// ones set are passed
+	if repository.Type == "s3" {
+		for _, e := range [][2]string{
+			{"AWS_ACCESS_KEY_ID", repository.Options.S3Key},
+			{"AWS_SECRET_ACCESS_KEY", repository.Options.S3Secret},
+			{"AWS_SESSION_TOKEN", repository.Options.S3SessionToken},
+			{"AWS_PROFILE", repository.Options.S3Profile},
+			{"AWS_SHARED_CREDENTIALS_FILE", repository.Options.S3SharedCredentialsFile},
+		} {
+			if e[1] != "" {
+				envs = append(envs, e[0]+"="+e[1])
+			}
+		}
+	}
+	// restic uses the key over the SAS token, and Azure's default
+	// credentials when it has neither
+	if repository.Type == "azure" {
+		for _, e := range [][2]string{
+			{"AZURE_ACCOUNT_NAME", repository.Options.AzureAccountName},
+			{"AZURE_ACCOUNT_KEY", repository.Options.AzureAccountKey},
+			{"AZURE_ACCOUNT_SAS", repository.Options.AzureAccountSas},
+			{"AZURE_ENDPOINT_SUFFIX", repository.Options.AzureEndpointSuffix},
+		} {
+			if e[1] != "" {
+				envs = append(envs, e[0]+"="+e[1])
+			}
+		}
 	}
 
-	stderr, err := c.StderrPipe()
-
-	if err == nil {
-
-		go func() {
-			scanner := bufio.NewScanner(stderr)
-			scanner.Split(bufio.ScanLines)
-			for scanner.Scan() {
-
-				go func(t string) {
-					msg := ChanMsg{Id: "", Msg: t, Time: time.Now()}
-					if job != nil {
-						msg.Id = job.Id
-					}
-					(*r.OutputCh) <- msg
-				}(scanner.Text())
-				serr.WriteString(scanner.Text())
+	// empty values would hide the default credentials of the environment
+	if repository.Type == "gcs" {
+		if repository.Options.GoogleProjectId != "" {
+			envs = append(envs, "GOOGLE_PROJECT_ID="+repository.Options.GoogleProjectId)
+		}
+		credentials := repository.Options.GoogleApplicationCredentials
+		if credentials == "" && repository.Options.GoogleCredentialsJson != "" {
+			file, err := r.settings.gcsCredentialsFile(repository)
+			if err != nil {
+				log.Error("gcs credentials", "repository_id", repository.Id, "err", err)
 			}
-		}()
+			credentials = file
+		}
+		if credentials != "" {
+			envs = append(envs, "GOOGLE_APPLICATION_CREDENTIALS="+credentials)
+		}
 	}
+	return envs
 }
 
 func (r *Restic) getEnvs(repository Repository, envs []string) []string {
@@ -93,83 +113,94 @@ func (r *Restic) getEnvs(repository Repository, envs []string) []string {
 		envs,
 		"RESTIC_PROGRESS_FPS=5")
 
-	if repository.Type == "s3" {
-		envs = append(
-			envs,
-			[]string{
-				"AWS_ACCESS_KEY_ID=" + repository.Options.S3Key,
-				"AWS_SECRET_ACCESS_KEY=" + repository.Options.S3Secret,
-			}...)
+	if dir := r.settings.Config.AppSettings.CacheDir; dir != "" {
+		envs = append(envs, "RESTIC_CACHE_DIR="+ExpandEnvRefs(dir))
 	}
-	if repository.Type == "azure" {
-		envs = append(
-			envs,
-			[]string{
-				"AZURE_ACCOUNT_NAME=" + repository.Options.AzureAccountName,
-				"AZURE_ACCOUNT_KEY=" + repository.Options.AzureAccountKey,
-				"AZURE_ACCOUNT_SAS=" + repository.Options.AzureAccountSas,
-			}...)
+
+	if repository.Compression != "" {
+		envs = append(envs, "RESTIC_COMPRESSION="+repository.Compression)
 	}
 
-	if repository.Type == "gcs" {
-		envs = append(
-			envs,
-			[]string{
-				"GOOGLE_PROJECT_ID=" + repository.Options.GoogleProjectId,
-				"GOOGLE_APPLICATION_CREDENTIALS=" + repository.Options.GoogleApplicationCredentials,
-			}...)
+	envs = append(envs, r.backendEnvs(repository)...)
+
+	// appended last, so they override the variables above
+	keys := make([]string, 0, len(repository.Env))
+	for k := range repository.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		envs = append(envs, k+"="+repository.Env[k])
 	}
 	return envs
 
 }
 
-func (r *Restic) core(
-	repository Repository,
-	cmd []string,
-	envs []string,
-	job *Job,
-	canceler *Canceler,
-) (string, error) {
-
-	// trigger start
-
-	cmds := []string{"-r", repository.Path, "--json"}
-	cmds = append(cmds, cmd...)
-	var sout bytes.Buffer
-	var serr bytes.Buffer
-	var c *exec.Cmd
-
+// resticBinary returns the restic executable and the global options it
+// needs. A restic binary next to the working directory is preferred and
+// uses the rclone binary shipped with it.
+func resticBinary() (string, []string, error) {
 	resticCmd, err := exec.LookPath("restic")
-	isRealtive := false
 	cd, err2 := os.Getwd()
 	if err2 == nil {
 		relative := filepath.Join(cd, "restic")
 		relativeWin := filepath.Join(cd, "restic.exe")
 
 		if _, err := os.Stat(relative); err == nil {
-			isRealtive = true
-			resticCmd = relative
-			cmds = append(
-				[]string{"-o", "rclone.program=" + filepath.Join(cd, "rclone")},
-				cmd...)
+			return relative, []string{"-o", "rclone.program=" + filepath.Join(cd, "rclone")}, nil
 		}
 
 		if _, err := os.Stat(relativeWin); err == nil {
-			isRealtive = true
-			resticCmd = relativeWin
-			cmds = append(
-				[]string{"-o", "rclone.program=" + filepath.Join(cd, "rclone.exe")},
-				cmd...)
+			return relativeWin, []string{"-o", "rclone.program=" + filepath.Join(cd, "rclone.exe")}, nil
 		}
 
 	}
+	if err != nil {
+		return "", nil, err
+	}
+	return resticCmd, []string{}, nil
+}
 
-	if err != nil && !isRealtive {
-		(*r.ErrorCh) <- ChanMsg{Id: "", Msg: "restic not found", Time: time.Now()}
+// repositoryArgs are the global options pointing restic at a repository
+// and telling it how to trust its backend.
+func repositoryArgs(repository Repository) []string {
+	args := []string{"-r", repository.Path}
+	if repository.Options.TLSCACert != "" {
+		args = append(args, "--cacert", repository.Options.TLSCACert)
+	}
+	if repository.Options.TLSClientCert != "" {
+		args = append(args, "--tls-client-cert", repository.Options.TLSClientCert)
+	}
+	if repository.Options.TLSInsecure {
+		log.Warn("TLS certificate verification is disabled, the connection can be intercepted", "repository_id", repository.Id, "repo", MaskSecrets(repository.Path))
+		args = append(args, "--insecure-tls")
+	}
+	return args
+}
+
+func (r *Restic) core(
+	repository Repository,
+	cmd []string,
+	envs []string,
+	job *Job,
+	canceler *Canceler,
+) (string, error) {
+
+	// trigger start
+
+	repository = repository.Resolved()
+	var c *exec.Cmd
+
+	resticCmd, opts, err := resticBinary()
+	if err != nil {
+		(*r.ErrorCh) <- ChanMsg{Id: "", Type: MsgError, Msg: "restic not found", Time: time.Now(), RequestId: r.requestId}
 		log.Error("restic not found", "err", err)
 		return "", err
 
 	}
+	cmds := append(opts, repositoryArgs(repository)...)
+	cmds = append(cmds, "--json")
+	cmds = append(cmds, cmd...)
 
 	if job != nil && job.Canceler.Ctx != nil {
 		c = exec.CommandContext(job.Canceler.Ctx, resticCmd, cmds...)
@@ -188,10 +219,15 @@ func (r *Restic) core(
 		c = exec.Command(resticCmd, cmds...)
 	}
 
-	r.PipeOutErr(c, &sout, &serr, job)
+	sink := r.newExecSink(job)
+	wait := sink.attach(c)
 
 	envs = r.getEnvs(repository, envs)
-	log.Info("core", "repo", repository.Path, "cmd", cmd)
+	l := log.With("repository_id", repository.Id)
+	if job != nil {
+		l = jobLog(job)
+	}
+	l.Info("core", "repo", MaskSecrets(repository.Path), "cmd", cmd, "request_id", r.requestId)
 
 	c.Env = append(
 		os.Environ(),
@@ -200,15 +236,18 @@ func (r *Restic) core(
 
 	err = c.Start()
 	if err != nil {
-		log.Error("executing restic command", "err", err)
+		l.Error("executing restic command", "err", err)
 	}
+	// a failed start closes the pipes, so this returns right away
+	wait()
 	c.Wait()
-	log.Debug("restic command finished")
-	if serr.Len() > 0 {
-		return "", errors.New(serr.String())
+	sink.close()
+	l.Debug("restic command finished")
+	if sink.stderr.Len() > 0 {
+		return "", errors.New(sink.stderr.String())
 	}
 
-	return sout.String(), nil
+	return sink.stdout.String(), nil
 
 }
 
@@ -225,69 +264,526 @@ func (r *Restic) Exec(
 	}
 }
 
+// ResticError is returned when restic exits with an error, Msg holds what
+// it printed to stderr.
+type ResticError struct {
+	Code int
+	Msg  string
+}
+
+func (e *ResticError) Error() string {
+	return e.Msg
+}
+
+// exit codes of restic >= 0.17, older versions exit with 1 and are told
+// apart by their messages
+const (
+	resticExitRepoMissing   = 10
+	resticExitWrongPassword = 12
+)
+
+const (
+	RepoEmpty         = "OK_REPO_EMPTY"
+	RepoExisting      = "OK_REPO_EXISTING"
+	RepoWrongPassword = "ERR_WRONG_PASSWORD"
+	RepoUnreachable   = "ERR_UNREACHABLE"
+	RepoAccessDenied  = "ERR_ACCESS_DENIED"
+	RepoBucketMissing = "ERR_BUCKET_MISSING"
+	RepoTimeout       = "ERR_TIMEOUT"
+)
+
+// Probe tells whether a repository location is empty, holds a repository
+// that can be opened, needs another password or can't be reached at all.
+// It works the same for every backend, as it only looks at how restic
+// fails.
+func (r *Restic) Probe(repository Repository) (string, error) {
+	return r.probe(context.Background(), repository)
+}
+
+func (r *Restic) probe(ctx context.Context, repository Repository) (string, error) {
+	err := r.streamContext(ctx, repository, []string{"cat", "config", "--no-lock"}, io.Discard)
+	if err == nil {
+		return RepoExisting, nil
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return RepoTimeout, errors.New("No answer from the backend in time")
+	}
+	var rerr *ResticError
+	if !errors.As(err, &rerr) {
+		return RepoUnreachable, err
+	}
+	msg := strings.ToLower(rerr.Msg)
+	switch {
+	case rerr.Code == resticExitWrongPassword,
+		strings.Contains(msg, "wrong password"),
+		strings.Contains(msg, "no key found"):
+		return RepoWrongPassword, err
+	case strings.Contains(msg, "access denied"),
+		strings.Contains(msg, "accessdenied"),
+		strings.Contains(msg, "invalidaccesskeyid"),
+		strings.Contains(msg, "signaturedoesnotmatch"),
+		strings.Contains(msg, "authorizationfailure"),
+		strings.Contains(msg, "authenticationfailed"),
+		strings.Contains(msg, "invalid_grant"),
+		strings.Contains(msg, "permission denied"),
+		strings.Contains(msg, "forbidden"):
+		return RepoAccessDenied, err
+	case strings.Contains(msg, "bucket does not exist"),
+		strings.Contains(msg, "nosuchbucket"),
+		strings.Contains(msg, "containernotfound"):
+		return RepoBucketMissing, err
+	case rerr.Code == resticExitRepoMissing,
+		strings.Contains(msg, "repository does not exist"),
+		strings.Contains(msg, "is there a repository at the following location"),
+		strings.Contains(msg, "key does not exist"),
+		strings.Contains(msg, "config: no such file"):
+		return RepoEmpty, nil
+	}
+	return RepoUnreachable, err
+}
+
+// TestCredentials checks whether the backend accepts the credentials of a
+// repository, without ever creating anything. An empty location counts as
+// success.
+func (r *Restic) TestCredentials(repository Repository, timeout time.Duration) CredentialsCheck {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	status, err := r.probe(ctx, repository)
+	check := CredentialsCheck{Status: status, Ok: status == RepoEmpty || status == RepoExisting}
+	if err != nil {
+		check.Message = err.Error()
+	}
+	return check
+}
+
+// stream runs restic without --json and writes its output to w, for output
+// that is too large to be buffered.
+func (r *Restic) stream(repository Repository, cmd []string, w io.Writer) error {
+	return r.streamContext(context.Background(), repository, cmd, w)
+}
+
+func (r *Restic) streamContext(ctx context.Context, repository Repository, cmd []string, w io.Writer) error {
+	return r.streamOutErr(ctx, repository, cmd, w, nil)
+}
+
+// streamOutErr is streamContext that also copies stderr to errw, unless
+// it's nil.
+func (r *Restic) streamOutErr(ctx context.Context, repository Repository, cmd []string, w io.Writer, errw io.Writer) error {
+	repository = repository.Resolved()
+	resticCmd, opts, err := resticBinary()
+	if err != nil {
+		log.Error("restic not found", "err", err)
+		return err
+	}
+	cmds := append(opts, repositoryArgs(repository)...)
+	cmds = append(cmds, cmd...)
+
+	log.Debug("stream", "repository_id", repository.Id, "repo", MaskSecrets(repository.Path), "cmd", cmd, "request_id", r.requestId)
+	var serr bytes.Buffer
+	c := exec.CommandContext(ctx, resticCmd, cmds...)
+	c.Env = append(os.Environ(), r.getEnvs(repository, []string{})...)
+	c.Stdout = w
+	c.Stderr = &serr
+	if errw != nil {
+		c.Stderr = io.MultiWriter(errw, &serr)
+	}
+
+	if err := c.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			msg := serr.String()
+			if msg == "" {
+				msg = err.Error()
+			}
+			return &ResticError{Code: exitErr.ExitCode(), Msg: msg}
+		}
+		return err
+	}
+	return nil
+}
+
+// decodeJSON runs restic and calls fn for each value of its JSON output as
+// soon as it's read, every line of ls or every element of the array
+// snapshots prints. Only one value is held in memory, however large the
+// output. restic is stopped when fn returns an error.
+func decodeJSON[T any](r *Restic, ctx context.Context, repository Repository, cmd []string, fn func(T) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(r.streamContext(ctx, repository, cmd, pw))
+	}()
+	defer pr.Close()
+
+	br := bufio.NewReader(pr)
+	dec := json.NewDecoder(br)
+	array := false
+	for {
+		b, err := br.Peek(1)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if b[0] != ' ' && b[0] != '\n' && b[0] != '\r' && b[0] != '\t' {
+			array = b[0] == '['
+			break
+		}
+		br.ReadByte()
+	}
+	if array {
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+	}
+	for !array || dec.More() {
+		// restic prints null instead of an empty list at times
+		var v *T
+		if err := dec.Decode(&v); err == io.EOF && !array {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if v == nil {
+			continue
+		}
+		if err := fn(*v); err != nil {
+			return err
+		}
+	}
+	_, err := dec.Token()
+	return err
+}
+
+// Check verifies the integrity of a repository and writes the report of
+// restic to w.
+func (r *Restic) Check(repository Repository, w io.Writer) error {
+	return r.stream(repository, []string{"check"}, w)
+}
+
+// Dump streams the content of path in a snapshot to w. Directories are
+// packed into an archive (tar or zip), files are written as is when
+// archive is empty.
+func (r *Restic) Dump(
+	repository Repository,
+	snapshotId string,
+	path string,
+	archive string,
+	w io.Writer,
+) error {
+	cmds := []string{"dump"}
+	if archive != "" {
+		cmds = append(cmds, "--archive", archive)
+	}
+	cmds = append(cmds, "--", snapshotId, path)
+
+	log.Info("dump", "repository_id", repository.Id, "repo", MaskSecrets(repository.Path), "snapshot", snapshotId, "path", path, "archive", archive, "request_id", r.requestId)
+	return r.stream(repository, cmds, w)
+}
+
+// ListSnapshot calls fn for every node restic ls returns for path, one at a
+// time, so even huge listings are never held in memory.
+func (r *Restic) ListSnapshot(
+	repository Repository,
+	snapshotId string,
+	path string,
+	recursive bool,
+	fn func(FileDescriptor),
+) error {
+	cmds := []string{"ls", "--json"}
+	if recursive {
+		cmds = append(cmds, "--recursive")
+	}
+	cmds = append(cmds, "--", snapshotId, path)
+
+	return decodeJSON(r, context.Background(), repository, cmds, func(fd FileDescriptor) error {
+		// the first line describes the snapshot
+		if fd.Type != "" {
+			fn(fd)
+		}
+		return nil
+	})
+}
+
+// BrowseSnapshot lists one directory level of a snapshot, limit entries
+// starting at offset. A limit <= 0 returns everything. When sorting, only
+// the first offset+limit entries are kept in memory.
 func (r *Restic) BrowseSnapshot(
 	repository Repository,
 	snapshotId string,
 	path string,
-) ([]FileDescriptor, error) {
-
-	if res, err := r.core(repository, []string{"ls", "-l", "--human-readable", snapshotId, path}, []string{}, nil, nil); err == nil {
-		res = strings.ReplaceAll(res, "}", "},")
-		res = strings.ReplaceAll(res, "\n", "")
-		res = "[" + res + "]"
-		res = strings.ReplaceAll(res, ",]", "]")
-		var data []FileDescriptor
-		if err := json.Unmarshal([]byte(res), &data); err == nil {
-			return data, nil
-		} else {
-			log.Error("browse snapshot: unmarshal", "err", err)
-			return []FileDescriptor{}, err
+	offset int,
+	limit int,
+	opts BrowseOptions,
+) (BrowseResult, error) {
+	res := BrowseResult{Items: []FileDescriptor{}, Offset: offset, Limit: limit}
+	keep := 0
+	if limit > 0 {
+		keep = offset + limit
+	}
+	top := &browseHeap{opts: opts}
+	err := r.ListSnapshot(repository, snapshotId, path, false, func(fd FileDescriptor) {
+		if fd.Path == path && fd.Type == "dir" {
+			// the directory itself
+			return
+		}
+		if !opts.Matches(fd) {
+			return
 		}
+		if opts.Sorted() {
+			top.add(fd, keep)
+		} else if res.Total >= offset && (limit <= 0 || len(res.Items) < limit) {
+			res.Items = append(res.Items, fd)
+		}
+		res.Total++
+	})
+	if err != nil {
+		log.Error("browse snapshot", "err", err)
+	}
+	if opts.Sorted() {
+		if items := top.sorted(); offset < len(items) {
+			res.Items = items[offset:]
+		}
+	}
+	return res, err
+}
+
+// RestoreSize sums up the size of all files below path in a snapshot.
+func (r *Restic) RestoreSize(repository Repository, snapshotId string, path string) (uint64, error) {
+	var size uint64
+	err := r.ListSnapshot(repository, snapshotId, path, true, func(fd FileDescriptor) {
+		if fd.Type == "file" {
+			size += fd.Size
+		}
+	})
+	return size, err
+}
+
+// CheckRestore validates the restore target and compares the size of the
+// restored files with the free space on it.
+func (r *Restic) CheckRestore(repository Repository, snapshotId string, data RestoreData) RestoreCheck {
+	check := RestoreCheck{Warnings: []RestoreWarning{}}
+	warn := func(code string, msg string) {
+		check.Warnings = append(check.Warnings, RestoreWarning{Code: code, Message: msg})
+	}
+
+	target := MaybeToWindowsPath(data.ToPath)
+	existing := target
+	if info, err := os.Stat(target); err != nil {
+		warn(RestoreTargetMissing, fmt.Sprintf("%s does not exist and will be created", target))
+		// space and permissions are checked on the closest existing parent
+		for existing != filepath.Dir(existing) {
+			existing = filepath.Dir(existing)
+			if _, err := os.Stat(existing); err == nil {
+				break
+			}
+		}
+	} else if !info.IsDir() {
+		warn(RestoreTargetNotDir, fmt.Sprintf("%s is not a directory", target))
+		return check
+	}
+
+	if f, err := os.CreateTemp(existing, ".resticity-*"); err != nil {
+		warn(RestoreTargetNotWritable, fmt.Sprintf("%s is not writable", existing))
 	} else {
-		log.Error("browse snapshot: core", "err", err)
-		return []FileDescriptor{}, err
+		f.Close()
+		os.Remove(f.Name())
 	}
 
+	size, err := r.RestoreSize(repository, snapshotId, FixPath(data.FromPath))
+	if err != nil {
+		warn(RestoreSizeUnknown, "Could not estimate the restore size: "+err.Error())
+		return check
+	}
+	check.Size = size
+	if free, err := diskFree(existing); err == nil {
+		check.Free = free
+		if size > free {
+			warn(RestoreNotEnoughSpace, fmt.Sprintf("Restoring needs %d bytes, but only %d bytes are free", size, free))
+		}
+	} else {
+		log.Warn("restore check: disk free", "path", existing, "err", err)
+	}
+	return check
+}
+
+// Snapshots lists the snapshots of a repository, grouped by host, paths
+// or tags.
+func (r *Restic) Snapshots(repository Repository, groupBy string) ([]SnapshotGroup, error) {
+	data := []SnapshotGroup{}
+	err := decodeJSON(r, context.Background(), repository, []string{"snapshots", "--json", "--group-by", groupBy}, func(g SnapshotGroup) error {
+		data = append(data, g)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Restore restores data.FromPath of a snapshot into data.ToPath, relative
+// to data.RootPath.
+func (r *Restic) Restore(repository Repository, snapshotId string, data RestoreData) error {
+	_, err := r.Exec(
+		repository,
+		[]string{"restore",
+			"--target",
+			MaybeToWindowsPath(data.ToPath),
+			"--include", FixPath(strings.Replace(data.FromPath, FixPath(data.RootPath), "", -1)),
+			"--", snapshotId + ":" + FixPath(data.RootPath)}, []string{}, nil,
+	)
+	return err
+}
+
+type resticLock struct {
+	Time     time.Time `json:"time"`
+	Hostname string    `json:"hostname"`
+	Pid      int       `json:"pid"`
 }
 
+// UnlockStale removes the locks of a repository if all of them are older
+// than olderThan. restic unlock can't remove single locks, so nothing is
+// removed while a younger lock shows another process is still active.
+func (r *Restic) UnlockStale(repository Repository, olderThan time.Duration) ([]string, error) {
+	var out bytes.Buffer
+	if err := r.stream(repository, []string{"list", "locks", "--no-lock"}, &out); err != nil {
+		return nil, err
+	}
+	stale := []string{}
+	for _, id := range strings.Fields(out.String()) {
+		var buf bytes.Buffer
+		if err := r.stream(repository, []string{"cat", "lock", id, "--no-lock"}, &buf); err != nil {
+			// the lock was removed in the meantime
+			continue
+		}
+		var lock resticLock
+		if err := json.Unmarshal(buf.Bytes(), &lock); err != nil {
+			return nil, err
+		}
+		if time.Since(lock.Time) < olderThan {
+			log.Info("auto unlock: keeping recent lock", "repository_id", repository.Id, "repo", MaskSecrets(repository.Path), "id", id, "host", lock.Hostname, "pid", lock.Pid, "time", lock.Time)
+			return []string{}, nil
+		}
+		stale = append(stale, id)
+	}
+	if len(stale) == 0 {
+		return stale, nil
+	}
+	if err := r.stream(repository, []string{"unlock", "--remove-all"}, io.Discard); err != nil {
+		return nil, err
+	}
+	return stale, nil
+}
+
+// Init creates a repository. Chunker parameters can only be copied from a
+// repository using the same backend credentials, as restic reads them from
+// the same environment variables.
+func (r *Restic) Init(data InitData) error {
+	cmds := []string{"init"}
+	envs := []string{}
+	if data.RepositoryVersion != "" {
+		cmds = append(cmds, "--repository-version", data.RepositoryVersion)
+	}
+	if data.CopyChunkerParamsFrom != "" {
+		found := r.settings.Config.GetRepositoryById(data.CopyChunkerParamsFrom)
+		if found == nil {
+			return errors.New("Repository to copy chunker params from not found")
+		}
+		from := found.Resolved()
+		cmds = append(cmds, "--copy-chunker-params", "--from-repo", from.Path)
+		envs = append(envs, r.backendEnvs(from)...)
+		if from.Password != "" {
+			envs = append(envs, "RESTIC_FROM_PASSWORD="+from.Password)
+		}
+		if from.PasswordFile != "" {
+			envs = append(envs, "RESTIC_FROM_PASSWORD_FILE="+from.PasswordFile)
+		}
+	}
+	_, err := r.Exec(data.Repository, cmds, envs, nil)
+	return err
+}
+
+// args are the flags of restic backup for the tuning.
+func (t BackupTuning) args() []string {
+	args := []string{}
+	if t.ReadConcurrency > 0 {
+		args = append(args, "--read-concurrency", fmt.Sprint(t.ReadConcurrency))
+	}
+	if t.NoScan {
+		args = append(args, "--no-scan")
+	}
+	if t.IgnoreInode {
+		args = append(args, "--ignore-inode")
+	}
+	if t.IgnoreCtime {
+		args = append(args, "--ignore-ctime")
+	}
+	return args
+}
+
+// parseBackupSummary finds the summary in the output of restic backup,
+// which core returns without line breaks.
+func parseBackupSummary(out string) *BackupSummary {
+	i := strings.LastIndex(out, `{"message_type":"summary"`)
+	if i < 0 {
+		return nil
+	}
+	var summary BackupSummary
+	if err := json.NewDecoder(strings.NewReader(out[i:])).Decode(&summary); err != nil {
+		log.Warn("backup summary", "err", err)
+		return nil
+	}
+	return &summary
+}
+
+// RunSchedule runs the action of a job, returning the summary for backups.
 func (r *Restic) RunSchedule(
 	job *Job,
-) error {
+) (*BackupSummary, error) {
 
 	if job == nil {
-		return errors.New("No job to do")
+		return nil, errors.New("No job to do")
+	}
+	l := jobLog(job)
+	if openRunLog(job, r.settings.Config.AppSettings.RunLogs) != nil {
+		defer closeRunLog(job)
 	}
-	(*r.OutputCh) <- ChanMsg{Id: job.Schedule.Id, Msg: "{\"running\": true}", Time: time.Now()}
+	(*r.OutputCh) <- ChanMsg{Id: job.Schedule.Id, Type: MsgJobStarted, Msg: fmt.Sprintf("{\"running\": true, \"run_id\": %q}", job.RunId), Time: time.Now()}
 	toRepository := r.settings.Config.GetRepositoryById(job.Schedule.ToRepositoryId)
 	fromRepository := r.settings.Config.GetRepositoryById(job.Schedule.FromRepositoryId)
 	backup := r.settings.Config.GetBackupById(job.Schedule.BackupId)
+	var summary *BackupSummary
 
 	switch job.Schedule.Action {
 	case "backup":
 		if backup == nil || toRepository == nil {
-			log.Error("backup", "err", "missing backup and toRepository")
-			return errors.New("missing backup and toRepository")
+			l.Error("backup", "err", "missing backup and toRepository")
+			return nil, errors.New("missing backup and toRepository")
 		}
 		cmds := []string{"backup", backup.Path, "--tag", "resticity"}
 		for _, p := range backup.BackupParams {
 			cmds = append(cmds, p...)
 		}
+		cmds = append(cmds, backup.Tuning.args()...)
 
-		_, err := r.core(*toRepository, cmds, []string{}, job, nil)
+		out, err := r.core(*toRepository, cmds, []string{}, job, nil)
 		if err != nil {
-			log.Error("runschedule", "err", err)
-			return err
+			l.Error("runschedule", "err", err)
+			return nil, err
 		}
+		summary = parseBackupSummary(out)
 		break
 	case "copy-snapshots":
 		if fromRepository == nil || toRepository == nil {
-			log.Error("copy snapshots", "err", "missing fromRepository and toRepository")
-			return errors.New("missing fromRepository and toRepository")
+			l.Error("copy snapshots", "err", "missing fromRepository and toRepository")
+			return nil, errors.New("missing fromRepository and toRepository")
 		}
 		cmds := []string{"copy"}
-		envs := []string{
-			"RESTIC_FROM_REPOSITORY=" + fromRepository.Path,
-		}
+		from := fromRepository.Resolved()
+		fromRepository = &from
+		// the target's own credentials come later and win
+		envs := append(r.backendEnvs(*fromRepository), "RESTIC_FROM_REPOSITORY="+fromRepository.Path)
 
 		if fromRepository.Password != "" {
 			envs = append(
@@ -301,15 +797,21 @@ func (r *Restic) RunSchedule(
 				"RESTIC_FROM_PASSWORD_FILE="+fromRepository.PasswordFile)
 		}
 
-		r.core(*toRepository, cmds, envs, job, nil)
+		if _, err := r.core(*toRepository, cmds, envs, job, nil); err != nil {
+			l.Error("copy snapshots", "err", err)
+			return nil, err
+		}
 		break
-	case "prune-repository":
+	case "prune-repository", "forget-repository":
 		if toRepository == nil {
-			log.Error("prune-repository", "err", "missing toRepository")
-			return errors.New("missing toRepository")
+			l.Error(job.Schedule.Action, "err", "missing toRepository")
+			return nil, errors.New("missing toRepository")
+		}
+		cmds := []string{"forget"}
+		if job.Schedule.Action == "prune-repository" {
+			cmds = append(cmds, "--prune")
 		}
-		cmds := []string{"forget", "--prune"}
-		for _, p := range toRepository.PruneParams {
+		for _, p := range withPinned(job.Schedule.Retention(*toRepository)) {
 			cmds = append(cmds, p...)
 		}
 		_, err := r.core(
@@ -319,20 +821,30 @@ func (r *Restic) RunSchedule(
 			nil,
 			nil,
 		)
-		log.Debug("unlocking repository")
+		l.Debug("unlocking repository")
 		if err != nil {
-			log.Error("unlocking repository", "err", err)
-			return err
+			l.Error("unlocking repository", "err", err)
+			return nil, err
 		}
 		_, err = r.core(*toRepository, cmds, []string{}, job, nil)
 		if err != nil {
-			log.Error("prune-repository", "err", err)
-			return err
+			l.Error(job.Schedule.Action, "err", err)
+			return nil, err
 		}
 
+		break
+	case "check-repository":
+		if toRepository == nil {
+			l.Error("check-repository", "err", "missing toRepository")
+			return nil, errors.New("missing toRepository")
+		}
+		if _, err := r.core(*toRepository, []string{"check"}, []string{}, job, nil); err != nil {
+			l.Error("check-repository", "err", err)
+			return nil, err
+		}
 		break
 	}
-	(*r.OutputCh) <- ChanMsg{Id: job.Schedule.Id, Msg: "{\"running\": false}", Time: time.Now()}
-	return nil
+	(*r.OutputCh) <- ChanMsg{Id: job.Schedule.Id, Type: MsgJobDone, Msg: "{\"running\": false}", Time: time.Now()}
+	return summary, nil
 
 }
@@ -0,0 +1,100 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// PinnedTag protects a snapshot from every retention policy.
+const PinnedTag = "pinned"
+
+var ErrNoRetentionPolicy = errors.New("No retention policy, add at least one --keep-* option")
+
+var ErrInvalidSnapshotId = errors.New("Invalid snapshot id")
+
+var snapshotIdRegex = regexp.MustCompile(`^[0-9a-f]{8,64}$`)
+
+// ForgetPreviewData is the policy to try, the one of the repository when
+// it's empty.
+type ForgetPreviewData struct {
+	PruneParams [][]string `json:"prune_params"`
+}
+
+// KeepReason tells which rules of the policy keep a snapshot.
+type KeepReason struct {
+	Snapshot Snapshot `json:"snapshot"`
+	Matches  []string `json:"matches"`
+}
+
+// ForgetGroup is what restic forget --dry-run would do with a group of
+// snapshots.
+type ForgetGroup struct {
+	Host    string       `json:"host"`
+	Paths   []string     `json:"paths"`
+	Tags    []string     `json:"tags"`
+	Keep    []Snapshot   `json:"keep"`
+	Remove  []Snapshot   `json:"remove"`
+	Reasons []KeepReason `json:"reasons"`
+}
+
+// isRetentionParam allows only forget's --keep-* options in a policy, so
+// a policy can't sneak in --prune or other flags.
+func isRetentionParam(p []string) bool {
+	return len(p) > 0 && strings.HasPrefix(p[0], "--keep-")
+}
+
+// withPinned adds --keep-tag for pinned snapshots to a policy, restic
+// forgets nothing without a policy so an empty one stays empty.
+func withPinned(policy [][]string) [][]string {
+	if len(policy) == 0 {
+		return policy
+	}
+	return append(slices.Clone(policy), []string{"--keep-tag", PinnedTag})
+}
+
+// PinSnapshot adds or removes the pinned tag. restic rewrites tagged
+// snapshots, so the snapshot gets a new id.
+func (r *Restic) PinSnapshot(repository Repository, snapshotId string, pin bool) error {
+	if !snapshotIdRegex.MatchString(snapshotId) {
+		return ErrInvalidSnapshotId
+	}
+	flag := "--add"
+	if !pin {
+		flag = "--remove"
+	}
+	_, err := r.Exec(repository, []string{"tag", flag, PinnedTag, "--", snapshotId}, []string{}, nil)
+	return err
+}
+
+// ForgetPreview runs restic forget --dry-run with a policy, nothing is
+// removed.
+func (r *Restic) ForgetPreview(repository Repository, policy [][]string) ([]ForgetGroup, error) {
+	if len(policy) == 0 {
+		return nil, ErrNoRetentionPolicy
+	}
+	cmds := []string{"forget", "--dry-run"}
+	for _, p := range withPinned(policy) {
+		if !isRetentionParam(p) {
+			return nil, errors.New("Invalid retention option " + strings.Join(p, " "))
+		}
+		cmds = append(cmds, p...)
+	}
+	groups := []ForgetGroup{}
+	err := decodeJSON(r, context.Background(), repository, append(cmds, "--json"), func(g ForgetGroup) error {
+		if g.Keep == nil {
+			g.Keep = []Snapshot{}
+		}
+		if g.Remove == nil {
+			g.Remove = []Snapshot{}
+		}
+		groups = append(groups, g)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
@@ -0,0 +1,106 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+)
+
+// RewriteData removes paths from existing snapshots with restic rewrite,
+// e.g. a cache directory or a secrets file backed up by accident.
+type RewriteData struct {
+	// Excludes are exclude patterns like those of backup
+	Excludes []string `json:"excludes"`
+	// Snapshots to rewrite, all when empty
+	Snapshots []string `json:"snapshots"`
+	// DryRun only lists the snapshots that would be rewritten
+	DryRun bool `json:"dry_run"`
+	// Forget removes the original snapshots, otherwise they are kept next to
+	// the rewritten ones
+	Forget bool `json:"forget"`
+	// Confirm is required unless it's a dry run
+	Confirm bool `json:"confirm"`
+}
+
+var ErrNoExcludes = errors.New("No excludes, add at least one path or pattern")
+
+func rewriteArgs(data RewriteData) ([]string, error) {
+	if len(data.Excludes) == 0 {
+		return nil, ErrNoExcludes
+	}
+	args := []string{"rewrite"}
+	for _, e := range data.Excludes {
+		if e == "" {
+			return nil, ErrNoExcludes
+		}
+		// = keeps patterns starting with - from being read as flags
+		args = append(args, "--exclude="+e)
+	}
+	if data.Forget {
+		args = append(args, "--forget")
+	}
+	if data.DryRun {
+		args = append(args, "--dry-run")
+	}
+	args = append(args, "--")
+	for _, id := range data.Snapshots {
+		if !snapshotIdRegex.MatchString(id) {
+			return nil, ErrInvalidSnapshotId
+		}
+		args = append(args, id)
+	}
+	return args, nil
+}
+
+// Rewrite runs restic rewrite and writes all it prints to w. Space is only
+// freed by the next prune.
+func (r *Restic) Rewrite(ctx context.Context, repository Repository, data RewriteData, w io.Writer) error {
+	args, err := rewriteArgs(data)
+	if err != nil {
+		return err
+	}
+	log.Info("rewrite", "repository_id", repository.Id, "repo", MaskSecrets(repository.Path), "cmd", args, "request_id", r.requestId)
+	out := &flushWriter{w: w}
+	return r.streamOutErr(ctx, repository, args, out, out)
+}
+
+// serveRewrite streams the output of a rewrite as plain text, like a
+// repair it needs confirm unless it's a dry run.
+func serveRewrite(settings *Settings, scheduler *Scheduler, restic *Restic) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		repository := settings.Config.GetRepositoryById(c.Params("id"))
+		if repository == nil {
+			c.SendStatus(404)
+			return c.SendString("Repository not found")
+		}
+		var data RewriteData
+		if err := c.BodyParser(&data); err != nil {
+			c.SendStatus(400)
+			return c.SendString(err.Error())
+		}
+		if _, err := rewriteArgs(data); err != nil {
+			c.SendStatus(400)
+			return c.SendString(err.Error())
+		}
+		if !data.DryRun && !data.Confirm {
+			c.SendStatus(400)
+			return c.SendString("Rewriting changes the snapshots, set confirm or try dry_run first")
+		}
+		if !data.DryRun && scheduler.repositoryBusy(repository.Id) {
+			c.SendStatus(409)
+			return c.SendString("A schedule is running on this repository")
+		}
+
+		rq := restic.ForRequest(requestID(c))
+		return streamOutput(c, func(w io.Writer) error {
+			err := rq.Rewrite(context.Background(), *repository, data, w)
+			if err != nil {
+				log.Error("rewrite", "repository", repository.Name, "err", err)
+			}
+			return err
+		})
+	}
+}
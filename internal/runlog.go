@@ -0,0 +1,163 @@
+package internal
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+var ErrRunNotFound = errors.New("Run log not found")
+
+var runIdRegex = regexp.MustCompile(`^[A-Za-z0-9-]+$`)
+
+type RunInfo struct {
+	Id      string    `json:"id"`
+	Started time.Time `json:"started"`
+	Size    int64     `json:"size"`
+}
+
+// RunLog stores the complete output of one run of a schedule, gzipped.
+// stdout and stderr are written from separate goroutines.
+type RunLog struct {
+	mu sync.Mutex
+	f  *os.File
+	gz *gzip.Writer
+}
+
+// runLogs holds the logs of the running jobs by run id.
+var runLogs sync.Map
+
+func runLogDir(scheduleId string) string {
+	return filepath.Join(getPath(), "runs", scheduleId)
+}
+
+func runLogFile(scheduleId string, runId string) string {
+	return filepath.Join(runLogDir(scheduleId), runId+".log.gz")
+}
+
+// openRunLog starts capturing the output of a run, keep is the number of
+// runs kept per schedule. It returns nil when capturing is disabled.
+func openRunLog(job *Job, keep uint32) *RunLog {
+	if keep == 0 || job.RunId == "" {
+		return nil
+	}
+	if err := os.MkdirAll(runLogDir(job.Schedule.Id), 0700); err != nil {
+		jobLog(job).Error("run log: mkdir", "err", err)
+		return nil
+	}
+	f, err := os.OpenFile(runLogFile(job.Schedule.Id, job.RunId), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		jobLog(job).Error("run log: create", "err", err)
+		return nil
+	}
+	rl := &RunLog{f: f, gz: gzip.NewWriter(f)}
+	runLogs.Store(job.RunId, rl)
+	pruneRunLogs(job.Schedule.Id, int(keep))
+	return rl
+}
+
+func activeRunLog(job *Job) *RunLog {
+	if job == nil {
+		return nil
+	}
+	if rl, ok := runLogs.Load(job.RunId); ok {
+		return rl.(*RunLog)
+	}
+	return nil
+}
+
+func (rl *RunLog) Line(stream string, line string) {
+	if rl == nil {
+		return
+	}
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	if rl.gz == nil {
+		return
+	}
+	fmt.Fprintf(rl.gz, "%s %s %s\n", time.Now().Format(time.RFC3339), stream, MaskSecrets(line))
+}
+
+func closeRunLog(job *Job) {
+	rl := activeRunLog(job)
+	if rl == nil {
+		return
+	}
+	runLogs.Delete(job.RunId)
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.gz.Close()
+	rl.f.Close()
+	rl.gz = nil
+}
+
+// pruneRunLogs removes all but the newest keep logs of a schedule.
+func pruneRunLogs(scheduleId string, keep int) {
+	runs, err := RunLogs(scheduleId)
+	if err != nil {
+		return
+	}
+	for _, r := range runs[min(keep, len(runs)):] {
+		if err := os.Remove(runLogFile(scheduleId, r.Id)); err != nil {
+			log.Warn("run log: prune", "schedule_id", scheduleId, "run", r.Id, "err", err)
+		}
+	}
+}
+
+// RunLogs lists the stored runs of a schedule, newest first.
+func RunLogs(scheduleId string) ([]RunInfo, error) {
+	runs := []RunInfo{}
+	if !runIdRegex.MatchString(scheduleId) {
+		return runs, nil
+	}
+	entries, err := os.ReadDir(runLogDir(scheduleId))
+	if os.IsNotExist(err) {
+		return runs, nil
+	} else if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		id, ok := strings.CutSuffix(e.Name(), ".log.gz")
+		if !ok {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		runs = append(runs, RunInfo{Id: id, Started: info.ModTime(), Size: info.Size()})
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].Started.After(runs[j].Started) })
+	return runs, nil
+}
+
+// ReadRunLog writes the uncompressed log of a run to w.
+func ReadRunLog(scheduleId string, runId string, w io.Writer) error {
+	if !runIdRegex.MatchString(scheduleId) || !runIdRegex.MatchString(runId) {
+		return ErrRunNotFound
+	}
+	f, err := os.Open(runLogFile(scheduleId, runId))
+	if os.IsNotExist(err) {
+		return ErrRunNotFound
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	_, err = io.Copy(w, gz)
+	return err
+}
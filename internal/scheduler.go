@@ -3,16 +3,16 @@ package internal
 import (
 	"context"
 	"embed"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"slices"
 	"sync"
 	"time"
 
-	"github.com/adrg/xdg"
 	"github.com/charmbracelet/log"
-	"github.com/gen2brain/beeep"
 	"github.com/go-co-op/gocron/v2"
 	"github.com/google/uuid"
-	"github.com/thoas/go-funk"
 )
 
 type Job struct {
@@ -21,7 +21,14 @@ type Job struct {
 	Schedule Schedule `json:"schedule"`
 	Running  bool     `json:"running"`
 	Force    bool     `json:"force"`
+	// RunId tells the runs of a schedule apart, it is set when a run starts
+	RunId    string `json:"run_id"`
 	Canceler Canceler
+	skipped  bool
+	// blocked is why the run was refused before it started, if it was
+	blocked error
+	// eta estimates the time remaining of a running backup
+	eta *etaEstimator
 }
 
 type Canceler struct {
@@ -35,19 +42,38 @@ type MountTracker struct {
 }
 
 type Scheduler struct {
-	Gocron   gocron.Scheduler
-	restic   *Restic
-	Jobs     []Job
+	Gocron gocron.Scheduler
+	restic *Restic
+	jobs   *JobRegistry
+	// jmu guards the waiters and running listeners
 	jmu      sync.Mutex
 	settings *Settings
 	OutputCh *chan ChanMsg
 	ErrorCh  *chan ChanMsg
 	Assets   *embed.FS
+	Mailer   *Mailer
+	Notify   *Notifications
+	Desktop  *Desktop
+	Store    *Store
+
+	runningListeners []func(int)
+	waiters          map[string]chan error
+	manualOnly       bool
+
+	pmu         sync.Mutex
+	pause       PauseState
+	resumeTimer *time.Timer
+	maintenance Maintenance
+
+	// tmu guards the triggers watching backup sources and drives
+	tmu      sync.Mutex
+	triggers []trigger
 }
 
 func NewScheduler(
 	settings *Settings,
 	restic *Restic,
+	store *Store,
 	outch *chan ChanMsg,
 	errch *chan ChanMsg,
 ) (*Scheduler, error) {
@@ -55,8 +81,23 @@ func NewScheduler(
 	s := &Scheduler{}
 	s.settings = settings
 	s.restic = restic
+	s.Store = store
+	s.jobs = NewJobRegistry()
 	s.OutputCh = outch
 	s.ErrorCh = errch
+	s.Mailer = NewMailer(settings)
+	go s.Mailer.RunDigest()
+	go s.watchSleep()
+	s.pause = PauseState{Schedules: []string{}}
+	s.loadMaintenance()
+	s.Desktop = NewDesktop(settings)
+	s.Notify = NewNotifications(settings, store, map[string]Notifier{
+		"desktop":  s.Desktop,
+		"email":    s.Mailer,
+		"ntfy":     NewNtfy(settings),
+		"gotify":   NewGotify(settings),
+		"telegram": NewTelegram(settings),
+	})
 
 	if gc, err := gocron.NewScheduler(); err == nil {
 		s.Gocron = gc
@@ -68,89 +109,154 @@ func NewScheduler(
 
 }
 
-func (s *Scheduler) RunJobById(id string) {
-	for i, j := range s.Jobs {
-		if j.Id == id {
-			log.Info("Running job manually", "id", id)
-			s.Jobs[i].Force = true
+// RunJobById runs a schedule now, unless in maintenance mode.
+func (s *Scheduler) RunJobById(id string) error {
+	if m := s.PauseState().Maintenance; m.Enabled {
+		s.jobLog(id).Warn("Maintenance mode, not running job")
+		return m.err()
+	}
+	if !s.jobs.Update(id, func(j *Job) { j.Force = true }) {
+		return ErrScheduleNotFound
+	}
+	j, _ := s.jobs.Get(id)
+	jobLog(&j).Info("Running job manually")
+	if err := j.job.RunNow(); err != nil {
+		jobLog(&j).Error("Error running job manually", "err", err)
+		return err
+	}
+	return nil
+}
 
-			if err := j.job.RunNow(); err != nil {
-				log.Error("Error running job manually", "id", id, "err", err)
-			}
-			break
-		}
+// ManualOnly keeps the cron expressions from firing, for one-off runs from
+// the command line next to a running instance.
+func (s *Scheduler) ManualOnly() {
+	s.manualOnly = true
+}
+
+var ErrScheduleNotFound = errors.New("Schedule not found")
+
+// RunJobAndWait runs a schedule like RunJobById and blocks until it is
+// done, returning its error.
+func (s *Scheduler) RunJobAndWait(id string) error {
+	done := make(chan error, 1)
+	if _, ok := s.jobs.Get(id); !ok {
+		return ErrScheduleNotFound
+	}
+	s.jmu.Lock()
+	if s.waiters == nil {
+		s.waiters = map[string]chan error{}
+	}
+	s.waiters[id] = done
+	s.jmu.Unlock()
+	if err := s.RunJobById(id); err != nil {
+		s.jmu.Lock()
+		delete(s.waiters, id)
+		s.jmu.Unlock()
+		return err
+	}
+	return <-done
+}
+
+func (s *Scheduler) jobFinished(id string, err error) {
+	s.jmu.Lock()
+	done, ok := s.waiters[id]
+	delete(s.waiters, id)
+	s.jmu.Unlock()
+	if ok {
+		done <- err
 	}
 }
 
+// NextRun returns when a schedule runs next, false if it only runs manually.
+func (s *Scheduler) NextRun(id string) (time.Time, bool) {
+	if j, ok := s.jobs.Get(id); ok && j.Schedule.Cron != "" {
+		t, err := j.job.NextRun()
+		return t, err == nil
+	}
+	return time.Time{}, false
+}
+
 func (s *Scheduler) StopJobById(id string) {
-	for _, j := range s.Jobs {
-		if j.Id == id {
-			(*s.OutputCh) <- ChanMsg{Id: j.Schedule.Id, Msg: "{\"running\": false}", Time: time.Now()}
-			j.Canceler.Cancel()
-			log.Warn("Canceling context", "id", id)
-			break
-		}
+	if j, ok := s.jobs.Get(id); ok {
+		(*s.OutputCh) <- ChanMsg{Id: j.Schedule.Id, Type: MsgJobDone, Msg: "{\"running\": false}", Time: time.Now()}
+		j.Canceler.Cancel()
+		jobLog(&j).Warn("Canceling context")
 	}
 }
 
 func (s *Scheduler) DeleteRunningJob(id string) {
+	s.jobs.Update(id, func(j *Job) {
+		jobLog(j).Debug("Stopping running job")
+		j.Running = false
+		j.Force = false
+	})
+	s.runningChanged()
+}
+
+// OnRunningChange calls fn with the number of running jobs whenever a job
+// starts or finishes.
+func (s *Scheduler) OnRunningChange(fn func(running int)) {
 	s.jmu.Lock()
 	defer s.jmu.Unlock()
-	for i, j := range s.Jobs {
-		if j.Id == id {
+	s.runningListeners = append(s.runningListeners, fn)
+}
 
-			log.Debug("Stopping running job", "id", id)
-			s.Jobs[i].Running = false
-			s.Jobs[i].Force = false
-			break
-		}
+func (s *Scheduler) runningChanged() {
+	running := len(s.GetRunningJobs())
+	s.jmu.Lock()
+	listeners := s.runningListeners
+	s.jmu.Unlock()
+	for _, fn := range listeners {
+		fn(running)
 	}
 }
 
+// jobLog tags log lines with the ids of a run, so a log collector can
+// filter them.
+func jobLog(job *Job) *log.Logger {
+	return log.With("job_id", job.RunId, "schedule_id", job.Schedule.Id, "repository_id", job.Schedule.ToRepositoryId)
+}
+
+func (s *Scheduler) jobLog(id string) *log.Logger {
+	if j := s.FindJobById(id); j != nil {
+		return jobLog(j)
+	}
+	return log.With("schedule_id", id)
+}
+
+// FindJobById returns a copy of a job as it is now, nil if there is none.
 func (s *Scheduler) FindJobById(id string) *Job {
-	s.jmu.Lock()
-	defer s.jmu.Unlock()
-	for _, j := range s.Jobs {
-		if j.Id == id {
-			return &j
-		}
+	if j, ok := s.jobs.Get(id); ok {
+		return &j
 	}
 	return nil
 }
 
 func (s *Scheduler) SetRunningJob(id string) {
-	s.jmu.Lock()
-	defer s.jmu.Unlock()
-	for i, j := range s.Jobs {
-		if j.Id == id {
-
-			s.Jobs[i].Running = true
-			log.Debug("Setting forced running job", "id", id)
-
-			break
-		}
-	}
+	s.jobs.Update(id, func(j *Job) {
+		j.Running = true
+		j.RunId = uuid.NewString()
+		jobLog(j).Debug("Setting forced running job")
+	})
+	s.runningChanged()
 }
 
 func (s *Scheduler) RecreateCtx(name string) {
-	for i, j := range s.Jobs {
-		if j.job.Name() == name {
-			log.Debug("Recreating context for job", "id", name)
-			ctx, cancel := context.WithCancel(context.Background())
-			s.Jobs[i].Canceler.Ctx = ctx
-			s.Jobs[i].Canceler.Cancel = cancel
-			break
-		}
-	}
+	// jobs are named after their schedule
+	s.jobs.Update(name, func(j *Job) {
+		jobLog(j).Debug("Recreating context for job")
+		ctx, cancel := context.WithCancel(context.Background())
+		j.Canceler = Canceler{Ctx: ctx, Cancel: cancel}
+	})
 }
 
 func (s *Scheduler) GetRunningJobs() []Job {
-	s.jmu.Lock()
-	defer s.jmu.Unlock()
-	return funk.Filter(s.Jobs, func(j Job) bool { return j.Running == true }).([]Job)
+	return s.jobs.Running()
 }
 
-func (s *Scheduler) Notifiy(schedule Schedule, finished bool, hasError bool) {
+// describe returns what a schedule does and the names of its source and
+// target.
+func (s *Scheduler) describe(schedule Schedule) (string, string, string) {
 	what := ""
 	from := ""
 	to := ""
@@ -163,33 +269,92 @@ func (s *Scheduler) Notifiy(schedule Schedule, finished bool, hasError bool) {
 		break
 	case "prune-repository":
 		what = "Prune repository"
+		break
+	case "forget-repository":
+		what = "Forget snapshots in"
+		break
+	case "check-repository":
+		what = "Check repository"
 	}
 	if schedule.FromRepositoryId != "" {
-		r := s.settings.Config.GetRepositoryById(schedule.FromRepositoryId)
-		from = r.Name
+		if r := s.settings.Config.GetRepositoryById(schedule.FromRepositoryId); r != nil {
+			from = r.Name
+		}
 	}
 
 	if schedule.BackupId != "" {
-		b := s.settings.Config.GetBackupById(schedule.BackupId)
-		from = b.Name
+		if b := s.settings.Config.GetBackupById(schedule.BackupId); b != nil {
+			from = b.Name
+		}
 	}
 	if schedule.ToRepositoryId != "" {
-		r := s.settings.Config.GetRepositoryById(schedule.ToRepositoryId)
-		to = r.Name
+		if r := s.settings.Config.GetRepositoryById(schedule.ToRepositoryId); r != nil {
+			to = r.Name
+		}
 	}
+	return what, from, to
+}
+
+// ScheduleName is a readable name like "Backup Documents to NAS".
+func (s *Scheduler) ScheduleName(schedule Schedule) string {
+	what, from, to := s.describe(schedule)
+	if schedule.Maintenance() {
+		return fmt.Sprintf("%s %s", what, to)
+	}
+	return fmt.Sprintf("%s %s to %s", what, from, to)
+}
+
+func (s *Scheduler) Notifiy(schedule Schedule, finished bool, hasError bool) {
+	what, from, to := s.describe(schedule)
 	action := "started"
 	if finished {
 		action = "finished"
 	}
 	title := fmt.Sprintf("%s %s", what, action)
 	description := fmt.Sprintf("From %s to %s", from, to)
-	if schedule.Action == "prune-repository" {
+	if schedule.Maintenance() {
 		description = fmt.Sprintf("On %s", to)
 	}
 	if hasError {
 		title += " with error"
 	}
-	beeep.Notify(title, description, xdg.CacheHome+"/resticity/appicon_active.png")
+	if msg, err := json.Marshal(map[string]string{"title": title, "description": description}); err == nil {
+		(*s.OutputCh) <- ChanMsg{Id: schedule.Id, Type: MsgNotification, Msg: string(msg), Time: time.Now()}
+	}
+	// finished runs reach the desktop through the Desktop notifier
+	if !finished {
+		s.Desktop.Show(title, description)
+	}
+}
+
+// UnlockStale removes old locks from the repositories a schedule uses, so
+// a crashed run doesn't block all following ones.
+func (s *Scheduler) UnlockStale(schedule Schedule) {
+	hours := s.settings.Config.AppSettings.AutoUnlockHours
+	if hours == 0 {
+		return
+	}
+	for _, id := range []string{schedule.ToRepositoryId, schedule.FromRepositoryId} {
+		if id == "" {
+			continue
+		}
+		repository := s.settings.Config.GetRepositoryById(id)
+		if repository == nil {
+			continue
+		}
+		removed, err := s.restic.UnlockStale(*repository, time.Duration(hours)*time.Hour)
+		if err != nil {
+			s.jobLog(schedule.Id).Error("auto unlock", "repo", repository.Name, "err", err)
+			s.Notify.Warning("Auto unlock failed", repository.Name+": "+err.Error())
+			continue
+		}
+		if len(removed) > 0 {
+			s.jobLog(schedule.Id).Warn("auto unlock: removed stale locks", "repo", repository.Name, "locks", removed)
+			msg, _ := json.Marshal(map[string]any{"repository": repository.Id, "removed_locks": removed})
+			(*s.OutputCh) <- ChanMsg{Id: schedule.Id, Type: MsgLog, Msg: string(msg), Time: time.Now()}
+			s.Notify.Warning("Stale locks removed", fmt.Sprintf("%s: removed %d lock(s) older than %dh", repository.Name, len(removed), hours))
+		}
+	}
 }
 
 func (s *Scheduler) RescheduleBackups() {
@@ -200,7 +365,15 @@ func (s *Scheduler) RescheduleBackups() {
 		s.StopJobById(j.Id)
 	}
 
-	s.Jobs = []Job{}
+	// the old cron timers would keep firing next to the new ones
+	for _, j := range s.jobs.All() {
+		if j.job != nil {
+			if err := s.Gocron.RemoveJob(j.job.ID()); err != nil {
+				log.Debug("Removing job", "schedule_id", j.Id, "err", err)
+			}
+		}
+	}
+	s.jobs.Clear()
 	log.Info("Rescheduling backups")
 
 	s.settings.Refresh()
@@ -211,16 +384,53 @@ func (s *Scheduler) RescheduleBackups() {
 		t := time.Now().AddDate(1000, 0, 0)
 		jobDef := gocron.OneTimeJob(gocron.OneTimeJobStartDateTime(t))
 
-		if schedule.Cron != "" {
+		if schedule.Cron != "" && !s.manualOnly {
 			jobDef = gocron.CronJob(schedule.Cron, false)
 		}
 
 		j, err := s.Gocron.NewJob(
 			jobDef,
-			gocron.NewTask(func() {
-
-				s.restic.RunSchedule(s.FindJobById(schedule.Id))
-
+			gocron.NewTask(func() (err error) {
+				defer recoverAs("scheduler", &err)
+				if s.wasSkipped(schedule.Id) {
+					return nil
+				}
+				start := time.Now()
+				job := s.FindJobById(schedule.Id)
+				if job != nil {
+					job.eta = s.newETA(schedule, job.RunId)
+				}
+				var summary *BackupSummary
+				if job != nil {
+					err = job.blocked
+				}
+				if err == nil {
+					summary, err = s.restic.RunSchedule(job)
+				} else {
+					s.jobLog(schedule.Id).Warn("schedule blocked", "err", err)
+				}
+				report := JobReport{
+					ScheduleId: schedule.Id,
+					Action:     schedule.Action,
+					Name:       s.ScheduleName(schedule),
+					Started:    start,
+					Duration:   time.Since(start),
+					Summary:    summary,
+				}
+				if job != nil {
+					report.RunId = job.RunId
+				}
+				if err != nil {
+					report.Error = err.Error()
+					errorCenter.Report(ErrorSourceJob, schedule.Id, report.Name+" failed", report.Error)
+				}
+				s.Store.RecordRun(report, schedule.ToRepositoryId)
+				s.reportAnomaly(report)
+				if err == nil && slices.Contains(growthActions, schedule.Action) {
+					s.recordRepositorySize(schedule, report.RunId)
+				}
+				s.Notify.JobFinished(report)
+				return err
 			}),
 			gocron.WithName(schedule.Id),
 			gocron.WithTags(
@@ -230,15 +440,25 @@ func (s *Scheduler) RescheduleBackups() {
 			),
 			gocron.WithEventListeners(
 				gocron.BeforeJobRuns(func(jobID uuid.UUID, jobName string) {
+					if s.skipRun(jobName) {
+						return
+					}
 
-					(*s.OutputCh) <- ChanMsg{Id: jobName, Msg: "{\"running\": true}", Time: time.Now()}
+					(*s.OutputCh) <- ChanMsg{Id: jobName, Type: MsgJobStarted, Msg: "{\"running\": true}", Time: time.Now()}
 
-					log.Debug(
-						"before job run",
-						"id",
-						jobName,
-					)
+					s.jobLog(jobName).Debug("before job run")
 					s.SetRunningJob(jobName)
+					// checked before anything tells the outside a run started
+					blocked := s.readOnlyBlocks(schedule)
+					if blocked == nil {
+						blocked = s.quotaBlocks(schedule)
+					}
+					s.jobs.Update(jobName, func(j *Job) { j.blocked = blocked })
+					if blocked != nil {
+						return
+					}
+					s.UnlockStale(schedule)
+					pingSchedule(schedule, schedule.PingStartUrl)
 					if config.AppSettings.Notifications.OnScheduleStart {
 						s.Notifiy(schedule, false, false)
 					}
@@ -251,10 +471,15 @@ func (s *Scheduler) RescheduleBackups() {
 				}),
 				gocron.AfterJobRuns(
 					func(jobID uuid.UUID, jobName string) {
+						if s.clearSkipped(jobName) {
+							s.jobFinished(jobName, nil)
+							return
+						}
 
-						(*s.OutputCh) <- ChanMsg{Id: jobName, Msg: "{\"running\": false}", Time: time.Now()}
+						(*s.OutputCh) <- ChanMsg{Id: jobName, Type: MsgJobDone, Msg: "{\"running\": false}", Time: time.Now()}
 
-						log.Debug("after job run", "res", "success", "id", jobName)
+						s.jobLog(jobName).Debug("after job run", "res", "success")
+						go pingSchedule(schedule, schedule.PingSuccessUrl)
 
 						if config.AppSettings.Notifications.OnScheduleSuccess {
 							s.Notifiy(schedule, true, false)
@@ -268,13 +493,16 @@ func (s *Scheduler) RescheduleBackups() {
 						s.DeleteRunningJob(jobName)
 						s.RecreateCtx(jobName)
 						s.settings.SetLastRun(jobName, "")
+						s.jobFinished(jobName, nil)
 
 					},
 				),
 				gocron.AfterJobRunsWithError(
 					func(jobID uuid.UUID, jobName string, err error) {
 
-						(*s.OutputCh) <- ChanMsg{Id: jobName, Msg: "{\"running\": false}", Time: time.Now()}
+						done, _ := json.Marshal(map[string]any{"running": false, "error": err.Error()})
+						(*s.OutputCh) <- ChanMsg{Id: jobName, Type: MsgJobDone, Msg: string(done), Time: time.Now()}
+						go pingSchedule(schedule, schedule.PingFailUrl)
 
 						if config.AppSettings.Notifications.OnScheduleError {
 							s.Notifiy(schedule, true, true)
@@ -287,8 +515,9 @@ func (s *Scheduler) RescheduleBackups() {
 						}
 						s.DeleteRunningJob(jobName)
 						s.RecreateCtx(jobName)
-						log.Warn("after job run", "res", "error", "id", jobName, "err", err)
+						s.jobLog(jobName).Warn("after job run", "res", "error", "err", err)
 						s.settings.SetLastRun(jobName, err.Error())
+						s.jobFinished(jobName, err)
 					},
 				),
 			))
@@ -300,29 +529,27 @@ func (s *Scheduler) RescheduleBackups() {
 
 		ctx, cancel := context.WithCancel(context.Background())
 
-		s.Jobs = append(
-			s.Jobs,
-			Job{
-				job:      j,
-				Schedule: schedule,
-				Id:       schedule.Id,
-				Running:  false,
-				Force:    false,
-				Canceler: Canceler{Ctx: ctx, Cancel: cancel},
-			},
-		)
+		s.jobs.Add(Job{
+			job:      j,
+			Schedule: schedule,
+			Id:       schedule.Id,
+			Running:  false,
+			Force:    false,
+			Canceler: Canceler{Ctx: ctx, Cancel: cancel},
+		})
+
+	}
 
+	if !s.manualOnly {
+		s.startTriggers(config)
 	}
 
 	log.Debug("Rerunning terminated jobs", "jobs", len(running))
 
 	for _, r := range running {
-
-		for _, j := range s.Jobs {
-			if j.Id == r.Id {
-				time.Sleep(1 * time.Second)
-				s.RunJobById(j.Id)
-			}
+		if _, ok := s.jobs.Get(r.Id); ok {
+			time.Sleep(1 * time.Second)
+			s.RunJobById(r.Id)
 		}
 	}
 
@@ -1,200 +1,313 @@
 package internal
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
 	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/charmbracelet/log"
-	"github.com/goccy/go-json"
 	"github.com/gofiber/contrib/websocket"
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/compress"
 	"github.com/gofiber/fiber/v2/middleware/cors"
-	"github.com/thoas/go-funk"
+	"github.com/gofiber/fiber/v2/middleware/filesystem"
+	"github.com/gofiber/fiber/v2/middleware/limiter"
+	fiberrecover "github.com/gofiber/fiber/v2/middleware/recover"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
 )
 
-type client struct {
-	LastSeen time.Time
-}
-
-var clients = make(map[*websocket.Conn]client)
-var register = make(chan *websocket.Conn)
-var broadcast = make(chan string)
-var unregister = make(chan *websocket.Conn)
-var outs = []JobMsg{}
-var errs = []JobMsg{}
-
-var mountTracker = make(map[string]*MountTracker)
-
-func runHub() {
-	for {
-		select {
-		case connection := <-register:
-			clients[connection] = client{LastSeen: time.Now()}
-			log.Debug(
-				"connection registered",
-				"addr",
-				connection.RemoteAddr().String(),
-				"clients",
-				len(clients),
-			)
-
-		case message := <-broadcast:
-
-			for connection := range clients {
-				if err := connection.WriteMessage(websocket.TextMessage, []byte(message)); err != nil {
-					log.Error("write error:", err)
-
-					unregister <- connection
-					connection.WriteMessage(websocket.CloseMessage, []byte{})
-					connection.Close()
-
-				} else {
-					log.Debug("message sent", "addr", connection.RemoteAddr().String(), "msg", message)
-				}
-			}
+var httpServer *fiber.App
 
-		case connection := <-unregister:
-			addr := connection.RemoteAddr().String()
-			delete(clients, connection)
-			log.Debug(
-				"connection unregistered",
-				"addr",
-				addr,
-				"clients",
-				len(clients),
-			)
+// MaxBrowseLimit caps the entries returned per browse request.
+const MaxBrowseLimit = 1000
 
-		}
+// newRateLimiter limits requests per client IP. Failed login attempts are
+// always limited, so brute-forcing stays expensive even with the global
+// limiter disabled. A missing max falls back to defaultMax.
+func newRateLimiter(max int, defaultMax int, windowSeconds uint32, onlyFailed bool) fiber.Handler {
+	if max <= 0 {
+		max = defaultMax
 	}
-}
-
-func cleanClients() {
-	for {
-		time.Sleep(1 * time.Second)
-		for connection, client := range clients {
-			if time.Since(client.LastSeen) > 2*time.Second {
-				unregister <- connection
-
-			}
-		}
+	if windowSeconds == 0 {
+		windowSeconds = 60
 	}
+	return limiter.New(limiter.Config{
+		Max:                    max,
+		Expiration:             time.Duration(windowSeconds) * time.Second,
+		SkipSuccessfulRequests: onlyFailed,
+		KeyGenerator: func(c *fiber.Ctx) string {
+			return c.IP()
+		},
+		LimitReached: func(c *fiber.Ctx) error {
+			log.Warn("rate limit reached", "ip", c.IP(), "path", c.Path())
+			c.SendStatus(429)
+			return c.SendString("Too many requests")
+		},
+	})
 }
 
-func handlePing(c *websocket.Conn) {
-	for {
-		time.Sleep(1 * time.Second)
-		_, _, err := c.ReadMessage()
-		if err == nil {
-			go func() {
-				for connection, client := range clients {
-
-					if connection.RemoteAddr().String() == c.RemoteAddr().String() {
-						c := client
-						c.LastSeen = time.Now()
-						clients[connection] = c
-
-						break
-					}
-				}
-			}()
+// forwardedHeaders are set by reverse proxies for the client they forward.
+var forwardedHeaders = []string{fiber.HeaderXForwardedFor, fiber.HeaderForwarded, "X-Real-Ip"}
 
+// fromLocal tells whether the client runs on this machine. A reverse proxy
+// on the same machine connects from localhost for remote clients too, so
+// forwarded requests only count by the client IP of a trusted proxy.
+func fromLocal(c *fiber.Ctx) bool {
+	if c.App().Config().ProxyHeader != "" && c.IsProxyTrusted() {
+		ip := net.ParseIP(c.IP())
+		return ip != nil && ip.IsLoopback()
+	}
+	if !c.IsFromLocal() {
+		return false
+	}
+	for _, h := range forwardedHeaders {
+		if c.Get(h) != "" {
+			return false
 		}
 	}
+	return true
+}
 
+// defaultAllowedOrigins are the origins of the desktop app and the
+// frontend dev servers.
+var defaultAllowedOrigins = []string{
+	"wails://wails",
+	"wails://wails.localhost",
+	"http://wails.localhost",
+	"http://localhost:11278",
+	"http://127.0.0.1:11278",
+	"http://localhost:3000",
+	"http://localhost:34115",
 }
 
-func handleArray(arr []JobMsg, m JobMsg) []JobMsg {
-	if m.Id != "" {
-		if funk.Find(
-			arr,
-			func(arrm JobMsg) bool { return arrm.Id == m.Id },
-		) == nil {
-			arr = append(arr, m)
-		} else {
-			for i, arrm := range arr {
-				if arrm.Id == m.Id {
-					arr[i] = m
-					break
-				}
-			}
+// newCors only allows the given origins. The cors middleware rejects
+// non-http origins in AllowOrigins, so those, like wails://, are matched in
+// AllowOriginsFunc instead.
+func newCors(origins []string) fiber.Handler {
+	if len(origins) == 0 {
+		origins = defaultAllowedOrigins
+	}
+	static := []string{}
+	allowed := make(map[string]bool)
+	for _, o := range origins {
+		o = strings.TrimSuffix(strings.TrimSpace(o), "/")
+		if o == "*" || strings.HasPrefix(o, "http://") || strings.HasPrefix(o, "https://") {
+			static = append(static, o)
 		}
+		allowed[o] = true
 	}
-
-	return arr
+	if len(static) == 0 {
+		// an empty AllowOrigins would default to *
+		static = append(static, "http://localhost:11278")
+	}
+	return cors.New(cors.Config{
+		AllowOrigins: strings.Join(static, ","),
+		AllowOriginsFunc: func(origin string) bool {
+			return allowed[origin]
+		},
+		AllowHeaders: "Origin, Content-Type, Accept, Authorization, Last-Event-ID",
+		// downloads are fetched, the file name comes from this header
+		ExposeHeaders: "Content-Disposition",
+	})
 }
 
-func doBroadcast(outs []JobMsg, errs []JobMsg, mountTracker map[string]*MountTracker) {
-	o := funk.Filter(outs, func(o JobMsg) bool { return o.Out != "" && o.Out != "{}" })
-	e := funk.Filter(errs, func(o JobMsg) bool { return o.Err != "" && o.Err != "{}" })
-	arr := append(o.([]JobMsg), e.([]JobMsg)...)
-
-	m := []MountMsg{}
-	for _, mt := range mountTracker {
-		m = append(m, mt.mount)
+// requestID returns the id the requestid middleware assigned.
+func requestID(c *fiber.Ctx) string {
+	id, _ := c.Locals("requestid").(string)
+	return id
+}
 
+// validSnapshotParam rejects a :snapshot_id that isn't a snapshot id or
+// latest, before it can reach restic as a flag.
+func validSnapshotParam(c *fiber.Ctx) error {
+	if id := c.Params("snapshot_id"); id != "latest" && !snapshotIdRegex.MatchString(id) {
+		c.SendStatus(400)
+		return c.SendString(ErrInvalidSnapshotId.Error())
 	}
+	return c.Next()
+}
 
-	msg := map[string]interface{}{"jobs": arr, "mounts": m}
-	if j, err := json.Marshal(msg); err == nil {
-		broadcast <- string(j)
-
-	} else {
-		log.Error("socket: marshal", "err", err)
+// username is who acts in a request, for the config history.
+func username(c *fiber.Ctx) string {
+	if i := identityFromCtx(c); i != nil {
+		return i.Username
 	}
-
+	return ""
 }
 
-func handleChannels(
-	outputChan *chan ChanMsg,
-	errorChan *chan ChanMsg,
-
-) {
-	for {
-		select {
-		case o := <-*outputChan:
-			m := JobMsg{Id: o.Id, Out: o.Msg, Err: "", Time: o.Time}
-			outs = handleArray(outs, m)
-			doBroadcast(outs, errs, mountTracker)
-			break
-		case e := <-*errorChan:
-			m := JobMsg{Id: e.Id, Out: "", Err: e.Msg, Time: e.Time}
-			log.Warn(m)
-			errs = handleArray(errs, m)
-			doBroadcast(outs, errs, mountTracker)
-
-			break
-
+// requestLogger logs every API request once it is done.
+func requestLogger() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		err := c.Next()
+		status := c.Response().StatusCode()
+		if err != nil {
+			if e, ok := err.(*fiber.Error); ok {
+				status = e.Code
+			} else {
+				status = 500
+			}
 		}
-
+		args := []any{
+			"method", c.Method(),
+			"path", c.Path(),
+			"status", status,
+			"duration", time.Since(start),
+			"request_id", requestID(c),
+		}
+		switch {
+		case status >= 500:
+			log.Error("request", args...)
+		case status >= 400:
+			log.Warn("request", args...)
+		default:
+			log.Info("request", args...)
+		}
+		return err
 	}
 }
 
+// StartBackground runs the message hub, the config watcher and the job
+// output handler. RunServer starts them itself, the desktop app calls it
+// directly when the HTTP server is disabled.
+func StartBackground(scheduler *Scheduler, settings *Settings) {
+	go supervise("hub", runHub)
+	go supervise("config watcher", func() {
+		settings.Watch(func() {
+			ConfigureLogging(settings.Config.AppSettings.Logging)
+			scheduler.RescheduleBackups()
+			publish(Envelope{Type: MsgConfigReload, Timestamp: time.Now()})
+		})
+	})
+	handler := handleChanMsg
+	chanHandler.Store(&handler)
+}
+
 func RunServer(
 	scheduler *Scheduler,
 	restic *Restic,
 	settings *Settings,
-
-	outputChan *chan ChanMsg,
-	errorChan *chan ChanMsg,
+	auth *Auth,
+	public fs.FS,
 	version string,
 	build string,
-) {
+) error {
 
-	server := fiber.New()
-	server.Use(cors.New())
-	server.Static("/", "./public")
+	rl := settings.Config.AppSettings.RateLimit
+	server := fiber.New(fiber.Config{
+		ProxyHeader:             rl.ProxyHeader,
+		EnableTrustedProxyCheck: true,
+		TrustedProxies:          rl.TrustedProxies,
+	})
+	httpServer = server
+	server.Use(fiberrecover.New(fiberrecover.Config{
+		EnableStackTrace: true,
+		StackTraceHandler: func(c *fiber.Ctx, e any) {
+			reportPanic("api "+c.Method()+" "+c.Path(), e)
+		},
+	}))
+	server.Use(requestid.New())
+	server.Use(newCors(settings.Config.AppSettings.AllowedOrigins))
+	server.Use("/", filesystem.New(filesystem.Config{
+		Root: http.FS(public),
+		Next: func(c *fiber.Ctx) bool {
+			return strings.HasPrefix(c.Path(), "/api")
+		},
+	}))
 
 	cfg := websocket.Config{
 		RecoverHandler: func(conn *websocket.Conn) {
 			if err := recover(); err != nil {
+				reportPanic("websocket", err)
 				conn.WriteJSON(fiber.Map{"customError": "error occurred"})
 			}
 		},
 	}
 
 	api := server.Group("/api")
+	api.Use(requestLogger())
+	api.Use(compress.New(compress.Config{
+		// streamed responses have to reach the client unbuffered, archives
+		// are compressed already
+		Next: func(c *fiber.Ctx) bool {
+			return c.Path() == "/api/ws" || c.Path() == "/api/events" || c.Path() == "/api/applog" || strings.HasSuffix(c.Path(), "/download")
+		},
+	}))
+
+	if rl.Enabled {
+		api.Use(newRateLimiter(rl.Max, 300, rl.WindowSeconds, false))
+	}
+	api.Use(readOnlyGuard())
+
+	api.Get("/openapi.json", func(c *fiber.Ctx) error {
+		return c.JSON(OpenAPISpec(version))
+	})
+
+	api.Post("/auth/login", newRateLimiter(rl.AuthMax, 5, rl.WindowSeconds, true), func(c *fiber.Ctx) error {
+		var data LoginData
+		if err := c.BodyParser(&data); err != nil {
+			c.SendStatus(500)
+			return c.SendString(err.Error())
+		}
+		token, identity, err := auth.Users.Login(data.Username, data.Password)
+		if err != nil {
+			c.SendStatus(401)
+			return c.SendString(err.Error())
+		}
+		return c.JSON(fiber.Map{"token": token, "user": identity})
+	})
+
+	// webhooks bring their own token, they come before the API credentials
+	api.Post("/schedules/:id/trigger", webhookAuth(settings), auditLog(scheduler.Store), serveWebhookTrigger(scheduler))
+
+	api.Use(auth.Middleware())
+	api.Use(auditLog(scheduler.Store))
+
+	api.Get("/auth/me", func(c *fiber.Ctx) error {
+		return c.JSON(identityFromCtx(c))
+	})
+
+	api.Post("/auth/logout", func(c *fiber.Ctx) error {
+		auth.Users.Logout(tokenFromRequest(c))
+		return c.SendString("OK")
+	})
+
+	users := api.Group("/users", RequireRole(RoleAdmin))
+	users.Get("/", func(c *fiber.Ctx) error {
+		return c.JSON(auth.Users.List())
+	})
+	users.Post("/", func(c *fiber.Ctx) error {
+		var data UserData
+		if err := c.BodyParser(&data); err != nil {
+			c.SendStatus(500)
+			return c.SendString(err.Error())
+		}
+		u, err := auth.Users.Save(data)
+		if err != nil {
+			c.SendStatus(400)
+			return c.SendString(err.Error())
+		}
+		return c.JSON(u)
+	})
+	users.Delete("/:id", func(c *fiber.Ctx) error {
+		if err := auth.Users.Delete(c.Params("id")); err != nil {
+			c.SendStatus(404)
+			return c.SendString(err.Error())
+		}
+		return c.SendString("OK")
+	})
 
 	api.Use("/ws", func(c *fiber.Ctx) error {
 
@@ -205,62 +318,292 @@ func RunServer(
 		return fiber.ErrUpgradeRequired
 	})
 
-	go runHub()
-	go cleanClients()
-	go handleChannels(outputChan, errorChan)
-
-	api.Get("/ws", websocket.New(func(c *websocket.Conn) {
-
-		defer func() {
-			unregister <- c
-			c.Close()
-		}()
+	StartBackground(scheduler, settings)
 
-		register <- c
+	api.Get("/ws", websocket.New(serveClient, cfg))
 
-		handlePing(c)
+	api.Get("/events", streamEvents)
 
-	}, cfg))
+	api.Get("/activity", serveActivity(scheduler))
 
-	api.Get("/path/autocomplete", func(c *fiber.Ctx) error {
-		paths := []string{}
+	api.Get("/path/autocomplete", RequireRole(RoleOperator), func(c *fiber.Ctx) error {
 		path := c.Query("path")
-		if files, err := os.ReadDir(path); err == nil {
-			for _, f := range files {
-				if f.IsDir() {
-					paths = append(paths, f.Name())
-				}
-			}
-		} else {
+		paths, err := ListPath(path, c.QueryBool("files", false), c.QueryBool("hidden", true))
+		if err != nil {
 			log.Error("reading path", "path", path, "err", err.Error())
 		}
 		return c.JSON(paths)
 	})
 
-	api.Get("/schedules/:id/:action", func(c *fiber.Ctx) error {
+	api.Get("/path/remote-autocomplete", RequireRole(RoleOperator), func(c *fiber.Ctx) error {
+		paths, err := ListRemotePath(c.Query("path"))
+		if err != nil {
+			c.SendStatus(500)
+			return c.SendString(err.Error())
+		}
+		return c.JSON(paths)
+	})
+
+	api.Get("/schedules", func(c *fiber.Ctx) error {
+		settings.Refresh()
+		return c.JSON(settings.Config.FilterSchedules(ParseLabelFilter(c.Query("group"), c.Query("labels"))))
+	})
+
+	api.Get("/labels", func(c *fiber.Ctx) error {
+		settings.Refresh()
+		return c.JSON(settings.Config.LabelIndex())
+	})
+
+	api.Get("/schedules/last-runs", func(c *fiber.Ctx) error {
+		runs, err := scheduler.Store.LastRuns()
+		if err != nil {
+			c.SendStatus(500)
+			return c.SendString(err.Error())
+		}
+		if filter := ParseLabelFilter(c.Query("group"), c.Query("labels")); !filter.Empty() {
+			settings.Refresh()
+			ids := map[string]bool{}
+			for _, s := range settings.Config.FilterSchedules(filter) {
+				ids[s.Id] = true
+			}
+			runs = slices.DeleteFunc(runs, func(r RunRecord) bool { return !ids[r.ScheduleId] })
+		}
+		return c.JSON(runs)
+	})
+
+	api.Get("/schedules/:id/runs", func(c *fiber.Ctx) error {
+		runs, err := RunLogs(c.Params("id"))
+		if err != nil {
+			c.SendStatus(500)
+			return c.SendString(err.Error())
+		}
+		return c.JSON(runs)
+	})
+
+	api.Get("/schedules/:id/runs/:run_id/log", func(c *fiber.Ctx) error {
+		var buf bytes.Buffer
+		if err := ReadRunLog(c.Params("id"), c.Params("run_id"), &buf); errors.Is(err, ErrRunNotFound) {
+			c.SendStatus(404)
+			return c.SendString(err.Error())
+		} else if err != nil {
+			c.SendStatus(500)
+			return c.SendString(err.Error())
+		}
+		c.Set("Content-Type", "text/plain; charset=utf-8")
+		return c.Send(buf.Bytes())
+	})
+
+	api.Post("/schedules/validate", serveCronPreview())
+
+	api.Post("/schedules/:id/webhook-token", RequireRole(RoleAdmin), func(c *fiber.Ctx) error {
+		settings.Refresh()
+		token, err := settings.SetWebhookToken(c.Params("id"), username(c))
+		if errors.Is(err, ErrScheduleNotFound) {
+			c.SendStatus(404)
+			return c.SendString(err.Error())
+		} else if err != nil {
+			c.SendStatus(500)
+			return c.SendString(err.Error())
+		}
+		return c.JSON(fiber.Map{"token": token})
+	})
+
+	api.Delete("/schedules/:id/webhook-token", RequireRole(RoleAdmin), func(c *fiber.Ctx) error {
+		settings.Refresh()
+		if err := settings.RevokeWebhookToken(c.Params("id"), username(c)); errors.Is(err, ErrScheduleNotFound) {
+			c.SendStatus(404)
+			return c.SendString(err.Error())
+		} else if err != nil {
+			c.SendStatus(500)
+			return c.SendString(err.Error())
+		}
+		return c.SendString("OK")
+	})
+
+	api.Get("/schedules/:id/:action", RequireRole(RoleOperator), func(c *fiber.Ctx) error {
 		switch c.Params("action") {
 		case "run":
-			scheduler.RunJobById(c.Params("id"))
-			break
+			if err := scheduler.RunJobById(c.Params("id")); errors.Is(err, ErrMaintenance) {
+				c.SendStatus(409)
+				return c.SendString(err.Error())
+			}
 		case "stop":
 			scheduler.StopJobById(c.Params("id"))
 			break
+		case "pause":
+			return c.JSON(scheduler.PauseSchedule(c.Params("id"), true))
+		case "resume":
+			return c.JSON(scheduler.PauseSchedule(c.Params("id"), false))
 		}
 
 		return c.SendString(c.Params("action") + " schedule in the background")
 	})
 
+	api.Post("/instance/show", RequireRole(RoleAdmin), func(c *fiber.Ctx) error {
+		if showWindow == nil {
+			return c.SendString("headless")
+		}
+		showWindow()
+		return c.SendString("OK")
+	})
+
+	api.Get("/pause", func(c *fiber.Ctx) error {
+		return c.JSON(scheduler.PauseState())
+	})
+
+	api.Post("/pause", RequireRole(RoleOperator), func(c *fiber.Ctx) error {
+		d := time.Duration(0)
+		if c.Query("duration") != "" {
+			var err error
+			if d, err = time.ParseDuration(c.Query("duration")); err != nil || d < 0 {
+				c.SendStatus(400)
+				return c.SendString("invalid duration, e.g. 1h or 30m")
+			}
+		}
+		return c.JSON(scheduler.Pause(d))
+	})
+
+	api.Delete("/pause", RequireRole(RoleOperator), func(c *fiber.Ctx) error {
+		scheduler.Resume()
+		return c.JSON(scheduler.PauseState())
+	})
+
+	api.Get("/errors", func(c *fiber.Ctx) error {
+		return c.JSON(errorCenter.List())
+	})
+
+	api.Post("/errors/acknowledge", RequireRole(RoleOperator), func(c *fiber.Ctx) error {
+		errorCenter.Acknowledge("")
+		return c.JSON(errorCenter.List())
+	})
+
+	api.Post("/errors/:id/acknowledge", RequireRole(RoleOperator), func(c *fiber.Ctx) error {
+		if err := errorCenter.Acknowledge(c.Params("id")); err != nil {
+			c.SendStatus(404)
+			return c.SendString(err.Error())
+		}
+		return c.JSON(errorCenter.List())
+	})
+
+	api.Delete("/errors", RequireRole(RoleOperator), func(c *fiber.Ctx) error {
+		errorCenter.Dismiss("")
+		return c.JSON(errorCenter.List())
+	})
+
+	api.Delete("/errors/:id", RequireRole(RoleOperator), func(c *fiber.Ctx) error {
+		if err := errorCenter.Dismiss(c.Params("id")); err != nil {
+			c.SendStatus(404)
+			return c.SendString(err.Error())
+		}
+		return c.JSON(errorCenter.List())
+	})
+
+	api.Post("/maintenance", RequireRole(RoleAdmin), func(c *fiber.Ctx) error {
+		var data MaintenanceData
+		if len(c.Body()) > 0 {
+			if err := c.BodyParser(&data); err != nil {
+				c.SendStatus(400)
+				return c.SendString(err.Error())
+			}
+		}
+		return c.JSON(scheduler.SetMaintenance(true, data.Reason))
+	})
+
+	api.Delete("/maintenance", RequireRole(RoleAdmin), func(c *fiber.Ctx) error {
+		return c.JSON(scheduler.SetMaintenance(false, ""))
+	})
+
+	api.Post("/notifications/test/:provider", RequireRole(RoleAdmin), func(c *fiber.Ctx) error {
+		if err := scheduler.Notify.SendTest(c.Params("provider")); err != nil {
+			if errors.Is(err, ErrUnknownNotifier) {
+				c.SendStatus(404)
+			} else {
+				c.SendStatus(500)
+			}
+			return c.SendString(err.Error())
+		}
+		return c.SendString("OK")
+	})
+
+	api.Post("/token/rotate", RequireRole(RoleAdmin), func(c *fiber.Ctx) error {
+		token, err := auth.Rotate()
+		if err != nil {
+			c.SendStatus(500)
+			return c.SendString(err.Error())
+		}
+		return c.JSON(fiber.Map{"token": token})
+	})
+
+	api.Get("/setup", func(c *fiber.Ctx) error {
+		settings.Refresh()
+		return c.JSON(settings.SetupStatus())
+	})
+
+	api.Get("/setup/repositories", RequireRole(RoleAdmin), func(c *fiber.Ctx) error {
+		settings.Refresh()
+		extra := []string{}
+		for _, p := range strings.Split(c.Query("paths"), ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				extra = append(extra, p)
+			}
+		}
+		return c.JSON(settings.DetectRepositories(extra))
+	})
+
+	api.Post("/setup", RequireRole(RoleAdmin), func(c *fiber.Ctx) error {
+		var data SetupData
+		if err := c.BodyParser(&data); err != nil {
+			c.SendStatus(400)
+			return c.SendString(err.Error())
+		}
+		settings.Refresh()
+		config, errs, err := settings.Setup(data, c.QueryBool("dry_run"), username(c))
+		if len(errs) > 0 {
+			c.SendStatus(422)
+			return c.JSON(fiber.Map{"errors": errs})
+		}
+		if errors.Is(err, ErrAlreadySetUp) {
+			c.SendStatus(409)
+			return c.SendString(err.Error())
+		}
+		if err != nil {
+			c.SendStatus(500)
+			return c.SendString(err.Error())
+		}
+		if !c.QueryBool("dry_run") {
+			scheduler.RescheduleBackups()
+		}
+		return c.JSON(config.Redacted())
+	})
+
 	api.Get("/version", func(c *fiber.Ctx) error {
 		log.Debug(version, build)
-		return c.JSON(fiber.Map{"version": version, "build": build})
+		return c.JSON(fiber.Map{"version": version, "build": build, "read_only": readOnly})
+	})
+
+	api.Get("/applog", RequireRole(RoleOperator), serveAppLog)
+
+	api.Get("/history/export", serveHistoryExport(settings, scheduler))
+	api.Get("/stats/schedules", serveStats(scheduler.Store, "schedule"))
+	api.Get("/stats/schedules/:id", serveStats(scheduler.Store, "schedule"))
+	api.Get("/stats/repositories", serveStats(scheduler.Store, "repository"))
+	api.Get("/stats/repositories/:id", serveStats(scheduler.Store, "repository"))
+
+	api.Get("/audit", RequireRole(RoleAdmin), func(c *fiber.Ctx) error {
+		entries, err := scheduler.Store.AuditLog(c.QueryInt("limit", 200))
+		if err != nil {
+			c.SendStatus(500)
+			return c.SendString(err.Error())
+		}
+		return c.JSON(entries)
 	})
 
-	api.Get("/logs", func(c *fiber.Ctx) error {
+	api.Get("/logs", RequireRole(RoleOperator), func(c *fiber.Ctx) error {
 		logs, erros := GetLogFiles()
 		return c.JSON(fiber.Map{"logs": logs, "errors": erros})
 	})
 
-	api.Get("/logs/:file", func(c *fiber.Ctx) error {
+	api.Get("/logs/:file", RequireRole(RoleOperator), func(c *fiber.Ctx) error {
 		log, err := GetLogFileContent(c.Params("file"))
 		if err != nil {
 			c.SendStatus(500)
@@ -269,12 +612,13 @@ func RunServer(
 		return c.SendString(string(log))
 	})
 
-	api.Post("/check", func(c *fiber.Ctx) error {
+	api.Post("/check", RequireRole(RoleAdmin), func(c *fiber.Ctx) error {
 		var r Repository
 		if err := c.BodyParser(&r); err != nil {
 			c.SendStatus(500)
 			return c.SendString(err.Error())
 		}
+		r.RestoreSecrets(settings.Config)
 
 		if r.PasswordFile != "" {
 			_, err := os.Stat(r.PasswordFile)
@@ -295,25 +639,33 @@ func RunServer(
 
 		}
 
-		if _, err := restic.Exec(r, []string{"cat", "config"}, []string{}, nil); err != nil {
-			if strings.Contains(err.Error(), "key does not exist") ||
-				strings.Contains(err.Error(), "config:") {
-				return c.SendString("OK_REPO_EMPTY")
+		status, err := restic.ForRequest(requestID(c)).Probe(r)
+		switch status {
+		case RepoEmpty, RepoExisting:
+			return c.SendString(status)
+		case RepoWrongPassword, RepoAccessDenied:
+			c.SendStatus(422)
+		default:
+			c.SendStatus(502)
+			if saved := settings.Config.GetRepositoryById(r.Id); saved != nil {
+				errorCenter.Report(ErrorSourceRepository, r.Id, saved.Name+" is unreachable", status+": "+err.Error())
 			}
-			c.SendStatus(500)
-			return c.SendString(err.Error())
-		} else {
-			return c.SendString("OK_REPO_EXISTING")
 		}
+		return c.SendString(status + ": " + err.Error())
 
 	})
-	api.Post("/init", func(c *fiber.Ctx) error {
-		var r Repository
-		if err := c.BodyParser(&r); err != nil {
+	api.Post("/init", RequireRole(RoleAdmin), func(c *fiber.Ctx) error {
+		var data InitData
+		if err := c.BodyParser(&data); err != nil {
 			c.SendStatus(500)
 			return c.SendString(err.Error())
 		}
-		if _, err := restic.Exec(r, []string{"init"}, []string{}, nil); err != nil {
+		data.Repository.RestoreSecrets(settings.Config)
+		if settings.Config.readOnlyPath(data.Path) {
+			c.SendStatus(403)
+			return c.SendString(ErrRepositoryReadOnly.Error())
+		}
+		if err := restic.ForRequest(requestID(c)).Init(data); err != nil {
 			c.SendStatus(500)
 			return c.SendString(err.Error())
 		}
@@ -324,25 +676,254 @@ func RunServer(
 	backups := api.Group("/backups")
 	config.Get("/", func(c *fiber.Ctx) error {
 		settings.Refresh()
-		return c.JSON(settings.Config)
+		// the desktop app runs on the same machine and may show secrets
+		if c.QueryBool("reveal") && fromLocal(c) && hasRole(c, RoleAdmin) {
+			return c.JSON(settings.Config)
+		}
+		return c.JSON(settings.Config.Redacted())
 	})
-	config.Post("/", func(c *fiber.Ctx) error {
+	config.Get("/export", RequireRole(RoleAdmin), func(c *fiber.Ctx) error {
+		settings.Refresh()
+		export := settings.Config
+		// like reveal, secrets only leave for the local machine
+		if c.QueryBool("redact", true) || !fromLocal(c) {
+			export = export.Redacted()
+		}
+		c.Set(fiber.HeaderContentDisposition, `attachment; filename="resticity-config.json"`)
+		return c.JSON(export)
+	})
+	config.Post("/import", RequireRole(RoleAdmin), func(c *fiber.Ctx) error {
+		settings.Refresh()
+		imported, err := settings.ParseImport(c.Body())
+		if err != nil {
+			c.SendStatus(400)
+			return c.SendString(err.Error())
+		}
+		if errs := imported.Validate(); len(errs) > 0 {
+			c.SendStatus(422)
+			return c.JSON(fiber.Map{"errors": errs})
+		}
+		keepRunState(&imported, settings.Config)
+		diff := DiffConfig(settings.Config, imported)
+		if c.QueryBool("dry_run") {
+			return c.JSON(diff)
+		}
+		if err := settings.SaveVersion(imported, username(c)); err != nil {
+			c.SendStatus(500)
+			return c.SendString(err.Error())
+		}
+		scheduler.RescheduleBackups()
+		return c.JSON(diff)
+	})
+	config.Post("/import/:tool", RequireRole(RoleAdmin), func(c *fiber.Ctx) error {
+		var data RepositoryImportData
+		if err := c.BodyParser(&data); err != nil {
+			c.SendStatus(400)
+			return c.SendString(err.Error())
+		}
+		parsed, err := ParseToolConfig(c.Params("tool"), data.Text)
+		if err != nil {
+			c.SendStatus(400)
+			return c.SendString(err.Error())
+		}
+		settings.Refresh()
+		res, errs, err := settings.ImportToolConfig(parsed, c.QueryBool("dry_run"), username(c))
+		if len(errs) > 0 {
+			c.SendStatus(422)
+			return c.JSON(fiber.Map{"errors": errs})
+		}
+		if err != nil {
+			c.SendStatus(500)
+			return c.SendString(err.Error())
+		}
+		if !c.QueryBool("dry_run") {
+			scheduler.RescheduleBackups()
+		}
+		return c.JSON(res)
+	})
+	config.Post("/", RequireRole(RoleAdmin), func(c *fiber.Ctx) error {
 
 		s := new(Config)
 		if err := c.BodyParser(s); err != nil {
 			c.SendStatus(500)
 			return c.SendString(err.Error())
 		}
-		settings.Save(*s)
+		errs, err := settings.Update(*s, username(c))
+		if len(errs) > 0 {
+			c.SendStatus(422)
+			return c.JSON(fiber.Map{"errors": errs})
+		}
+		if err != nil {
+			c.SendStatus(500)
+			return c.SendString(err.Error())
+		}
+		scheduler.RescheduleBackups()
+		return c.SendString("OK")
+	})
+
+	api.Get("/autostart", func(c *fiber.Ctx) error {
+		return c.JSON(settings.AutostartState())
+	})
+	api.Put("/autostart", RequireRole(RoleAdmin), func(c *fiber.Ctx) error {
+		var a AppSettingsAutostart
+		if err := c.BodyParser(&a); err != nil {
+			c.SendStatus(500)
+			return c.SendString(err.Error())
+		}
+		settings.Refresh()
+		cfg := settings.Config
+		cfg.AppSettings.Autostart = a
+		if err := settings.SaveVersion(cfg, username(c)); err != nil {
+			c.SendStatus(500)
+			return c.SendString(err.Error())
+		}
+		if err := settings.SyncAutostart(); err != nil {
+			c.SendStatus(500)
+			return c.SendString(err.Error())
+		}
+		return c.JSON(settings.AutostartState())
+	})
+
+	api.Get("/profiles", func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{"active": settings.Profile(), "profiles": settings.Profiles()})
+	})
+	api.Post("/profiles/:name", RequireRole(RoleAdmin), func(c *fiber.Ctx) error {
+		if len(scheduler.GetRunningJobs()) > 0 {
+			c.SendStatus(409)
+			return c.SendString("Wait for running jobs to finish before switching profiles")
+		}
+		if err := settings.UseProfile(c.Params("name")); err != nil {
+			c.SendStatus(400)
+			return c.SendString(err.Error())
+		}
+		scheduler.RescheduleBackups()
+		return c.JSON(fiber.Map{"active": settings.Profile(), "profiles": settings.Profiles()})
+	})
+
+	config.Get("/history", func(c *fiber.Ctx) error {
+		entries, err := settings.History()
+		if err != nil {
+			c.SendStatus(500)
+			return c.SendString(err.Error())
+		}
+		return c.JSON(entries)
+	})
+	config.Get("/history/:id/diff", RequireRole(RoleAdmin), func(c *fiber.Ctx) error {
+		entry, err := settings.HistoryEntry(c.Params("id"))
+		if err != nil {
+			if errors.Is(err, ErrHistoryNotFound) {
+				c.SendStatus(404)
+			} else {
+				c.SendStatus(500)
+			}
+			return c.SendString(err.Error())
+		}
+		settings.Refresh()
+		// what a rollback would change
+		return c.JSON(DiffConfig(settings.Config, *entry.Config))
+	})
+	config.Post("/history/:id/rollback", RequireRole(RoleAdmin), func(c *fiber.Ctx) error {
+		entry, err := settings.HistoryEntry(c.Params("id"))
+		if err != nil {
+			if errors.Is(err, ErrHistoryNotFound) {
+				c.SendStatus(404)
+			} else {
+				c.SendStatus(500)
+			}
+			return c.SendString(err.Error())
+		}
+		settings.Refresh()
+		restored := *entry.Config
+		keepRunState(&restored, settings.Config)
+		if errs := restored.Validate(); len(errs) > 0 {
+			c.SendStatus(422)
+			return c.JSON(fiber.Map{"errors": errs})
+		}
+		if err := settings.SaveVersion(restored, username(c)); err != nil {
+			c.SendStatus(500)
+			return c.SendString(err.Error())
+		}
 		scheduler.RescheduleBackups()
 		return c.SendString("OK")
 	})
 
 	repositories := api.Group("/repositories")
 
+	repositories.Get("/", func(c *fiber.Ctx) error {
+		settings.Refresh()
+		return c.JSON(Config{Repositories: settings.Config.FilterRepositories(ParseLabelFilter(c.Query("group"), c.Query("labels")))}.Redacted().Repositories)
+	})
+
+	repositories.Post("/test-credentials", RequireRole(RoleAdmin), func(c *fiber.Ctx) error {
+		var r Repository
+		if err := c.BodyParser(&r); err != nil {
+			c.SendStatus(500)
+			return c.SendString(err.Error())
+		}
+		r.RestoreSecrets(settings.Config)
+		return c.JSON(restic.ForRequest(requestID(c)).TestCredentials(r, 10*time.Second))
+	})
+
+	repositories.Post("/import", RequireRole(RoleAdmin), func(c *fiber.Ctx) error {
+		var data RepositoryImportData
+		if err := c.BodyParser(&data); err != nil {
+			c.SendStatus(400)
+			return c.SendString(err.Error())
+		}
+		settings.Refresh()
+		res, errs, err := settings.ImportRepositories(data.Text, c.QueryBool("dry_run"), username(c))
+		if len(errs) > 0 {
+			c.SendStatus(422)
+			return c.JSON(fiber.Map{"errors": errs})
+		}
+		if err != nil {
+			c.SendStatus(500)
+			return c.SendString(err.Error())
+		}
+		if !c.QueryBool("dry_run") && len(res.Repositories) > 0 {
+			scheduler.RescheduleBackups()
+		}
+		return c.JSON(res)
+	})
+
+	// only removes the repository from the config, its data is left alone
+	repositories.Delete("/:id", RequireRole(RoleAdmin), func(c *fiber.Ctx) error {
+		settings.Refresh()
+		config := settings.Config
+		if config.GetRepositoryById(c.Params("id")) == nil {
+			c.SendStatus(404)
+			return c.SendString("Repository not found")
+		}
+		if schedules := config.SchedulesUsingRepository(c.Params("id")); len(schedules) > 0 {
+			c.Status(409)
+			return c.JSON(fiber.Map{"schedules": schedules})
+		}
+		repos := []Repository{}
+		for _, r := range config.Repositories {
+			if r.Id != c.Params("id") {
+				repos = append(repos, r)
+			}
+		}
+		config.Repositories = repos
+		if err := settings.SaveVersion(config, username(c)); err != nil {
+			c.SendStatus(500)
+			return c.SendString(err.Error())
+		}
+		return c.SendString("OK")
+	})
+
+	repositories.Get("/:id/growth", serveGrowth(scheduler.Store))
+	repositories.Post("/:id/repair/:what", RequireRole(RoleAdmin), readOnlyRepository(settings), serveRepair(settings, scheduler, restic))
+	repositories.Post("/:id/rewrite", RequireRole(RoleAdmin), readOnlyRepository(settings), serveRewrite(settings, scheduler, restic))
+	repositories.Post("/:id/restic", RequireRole(RoleAdmin), serveResticCommand(settings, scheduler, restic, auth))
+
 	repositories.Post("/:id/:action", func(c *fiber.Ctx) error {
 		act := c.Params("action")
 
+		if act != "snapshots" && act != "forget-preview" && !hasRole(c, RoleOperator) {
+			return forbidden(c)
+		}
+
 		switch act {
 		case "mount":
 			var data MountData
@@ -351,18 +932,30 @@ func RunServer(
 				return c.SendString(err.Error())
 			}
 
+			repository := settings.Config.GetRepositoryById(c.Params("id"))
+			if repository == nil {
+				c.SendStatus(404)
+				return c.SendString("Repository not found")
+			}
+
+			rq := restic.ForRequest(requestID(c))
 			go func(id string) {
 				ctx, cancel := context.WithCancel(context.Background())
-				mountTracker[data.Path] = &MountTracker{
+				tracker := &MountTracker{
 					canceler: Canceler{Ctx: ctx, Cancel: cancel},
 					mount:    MountMsg{Id: id, Path: data.Path},
 				}
-				doBroadcast(outs, errs, mountTracker)
-				restic.Exec(
-					*settings.Config.GetRepositoryById(id),
-					[]string{act, FixPath(data.Path)},
+				stateMux.Lock()
+				mountTracker[data.Path] = tracker
+				stateMux.Unlock()
+				broadcastMounts()
+				mount := scheduler.Store.MountStarted(id, data.Path)
+				defer scheduler.Store.MountEnded(mount)
+				rq.Exec(
+					*repository,
+					[]string{act, "--", FixPath(data.Path)},
 					[]string{},
-					&mountTracker[data.Path].canceler,
+					&tracker.canceler,
 				)
 			}(c.Params("id"))
 
@@ -374,10 +967,13 @@ func RunServer(
 				return c.SendString(err.Error())
 			}
 
-			if tracker, ok := mountTracker[data.Path]; ok {
+			stateMux.Lock()
+			tracker, ok := mountTracker[data.Path]
+			delete(mountTracker, data.Path)
+			stateMux.Unlock()
+			if ok {
 				log.Debug("canceling mount", "path", data.Path, "sig", os.Interrupt)
-				delete(mountTracker, data.Path)
-				doBroadcast(outs, errs, mountTracker)
+				broadcastMounts()
 				tracker.canceler.Cancel()
 				tracker.canceler.Ctx.Done()
 
@@ -389,30 +985,58 @@ func RunServer(
 			if groupBy == "" {
 				groupBy = "host"
 			}
-			res, err := restic.Exec(
-				*settings.Config.GetRepositoryById(c.Params("id")),
-				[]string{act, "--group-by", groupBy},
-				[]string{},
-				nil,
+			repository := settings.Config.GetRepositoryById(c.Params("id"))
+			if repository == nil {
+				c.SendStatus(404)
+				return c.SendString("Repository not found")
+			}
+			data, err := restic.ForRequest(requestID(c)).Snapshots(
+				*repository,
+				groupBy,
 			)
 			if err != nil {
 				c.SendStatus(500)
 				return c.SendString(err.Error())
 			}
-			var data []SnapshotGroup
-
-			if err := json.Unmarshal([]byte(res), &data); err != nil {
+			return c.JSON(data)
+		case "forget-preview":
+			var data ForgetPreviewData
+			if len(c.Body()) > 0 {
+				if err := c.BodyParser(&data); err != nil {
+					c.SendStatus(400)
+					return c.SendString(err.Error())
+				}
+			}
+			repository := settings.Config.GetRepositoryById(c.Params("id"))
+			if repository == nil {
+				c.SendStatus(404)
+				return c.SendString("Repository not found")
+			}
+			policy := data.PruneParams
+			if len(policy) == 0 {
+				policy = repository.PruneParams
+			}
+			groups, err := restic.ForRequest(requestID(c)).ForgetPreview(*repository, policy)
+			if err == ErrNoRetentionPolicy {
+				c.SendStatus(400)
+				return c.SendString(err.Error())
+			}
+			if err != nil {
 				c.SendStatus(500)
 				return c.SendString(err.Error())
 			}
-			return c.JSON(data)
+			return c.JSON(groups)
 		}
 
 		return c.SendString("Unknown action")
 
 	})
 
-	repositories.Post("/:id/snapshots/:snapshot_id/:action", func(c *fiber.Ctx) error {
+	repositories.Post("/:id/snapshots/:snapshot_id/:action", validSnapshotParam, func(c *fiber.Ctx) error {
+		if c.Params("action") != "browse" && c.Params("action") != "analyze" && !hasRole(c, RoleOperator) {
+			return forbidden(c)
+		}
+
 		switch c.Params("action") {
 		case "browse":
 			var data BrowseData
@@ -420,10 +1044,31 @@ func RunServer(
 				c.SendStatus(500)
 				return c.SendString(err.Error())
 			}
-			res, err := restic.BrowseSnapshot(
-				*settings.Config.GetRepositoryById(c.Params("id")),
+			opts := BrowseOptions{
+				Sort:      c.Query("sort"),
+				Order:     c.Query("order"),
+				Filter:    c.Query("filter"),
+				DirsFirst: c.QueryBool("dirs_first", false),
+			}
+			if err := opts.Validate(); err != nil {
+				c.SendStatus(400)
+				return c.SendString(err.Error())
+			}
+			if data.Limit <= 0 || data.Limit > MaxBrowseLimit {
+				data.Limit = MaxBrowseLimit
+			}
+			repository := settings.Config.GetRepositoryById(c.Params("id"))
+			if repository == nil {
+				c.SendStatus(404)
+				return c.SendString("Repository not found")
+			}
+			res, err := restic.ForRequest(requestID(c)).BrowseSnapshot(
+				*repository,
 				c.Params("snapshot_id"),
 				FixPath(data.Path),
+				data.Offset,
+				data.Limit,
+				opts,
 			)
 			if err != nil {
 				c.SendStatus(500)
@@ -432,35 +1077,215 @@ func RunServer(
 			}
 			return c.JSON(res)
 
+		case "analyze":
+			var data AnalyzeData
+			if err := c.BodyParser(&data); err != nil {
+				c.SendStatus(400)
+				return c.SendString(err.Error())
+			}
+			repository := settings.Config.GetRepositoryById(c.Params("id"))
+			if repository == nil {
+				c.SendStatus(404)
+				return c.SendString("Repository not found")
+			}
+			data.Path = FixPath(data.Path)
+			res, err := restic.ForRequest(requestID(c)).AnalyzeSnapshot(*repository, c.Params("snapshot_id"), data)
+			if err != nil {
+				c.SendStatus(500)
+				return c.SendString(err.Error())
+			}
+			return c.JSON(res)
+
+		case "restore-check":
+			var data RestoreData
+			if err := c.BodyParser(&data); err != nil {
+				c.SendStatus(500)
+				return c.SendString(err.Error())
+			}
+			repository := settings.Config.GetRepositoryById(c.Params("id"))
+			if repository == nil {
+				c.SendStatus(404)
+				return c.SendString("Repository not found")
+			}
+			return c.JSON(restic.ForRequest(requestID(c)).CheckRestore(
+				*repository,
+				c.Params("snapshot_id"),
+				data,
+			))
+
 		case "restore":
 			var data RestoreData
 			if err := c.BodyParser(&data); err != nil {
 				c.SendStatus(500)
 				return c.SendString(err.Error())
 			} else {
+				repository := settings.Config.GetRepositoryById(c.Params("id"))
+				if repository == nil {
+					c.SendStatus(404)
+					return c.SendString("Repository not found")
+				}
+				if !data.Force {
+					check := restic.ForRequest(requestID(c)).CheckRestore(
+						*repository,
+						c.Params("snapshot_id"),
+						data,
+					)
+					if len(check.Warnings) > 0 {
+						c.Status(409)
+						return c.JSON(check)
+					}
+				}
 
-				if _, err := restic.Exec(
-					*settings.Config.GetRepositoryById(c.Params("id")),
-					[]string{"restore",
-						c.Params("snapshot_id") + ":" + FixPath(data.RootPath),
-						"--target",
-						MaybeToWindowsPath(data.ToPath),
-						"--include", FixPath(strings.Replace(data.FromPath, FixPath(data.RootPath), "", -1))}, []string{}, nil,
+				if err := restic.ForRequest(requestID(c)).Restore(
+					*repository,
+					c.Params("snapshot_id"),
+					data,
 				); err != nil {
 					c.SendStatus(500)
 					return c.SendString(err.Error())
 				}
 				return c.SendString("OK")
 			}
+		case "pin", "unpin":
+			repository := settings.Config.GetRepositoryById(c.Params("id"))
+			if repository == nil {
+				c.SendStatus(404)
+				return c.SendString("Repository not found")
+			}
+			if repository.ReadOnly {
+				c.SendStatus(403)
+				return c.SendString(ErrRepositoryReadOnly.Error())
+			}
+			err := restic.ForRequest(requestID(c)).PinSnapshot(*repository, c.Params("snapshot_id"), c.Params("action") == "pin")
+			if err == ErrInvalidSnapshotId {
+				c.SendStatus(400)
+				return c.SendString(err.Error())
+			}
+			if err != nil {
+				c.SendStatus(500)
+				return c.SendString(err.Error())
+			}
+			return c.SendString("OK")
 		}
 
 		return c.SendString(c.Params("action"))
 	})
 
+	repositories.Get("/:id/snapshots/:snapshot_id/download", RequireRole(RoleOperator), validSnapshotParam, func(c *fiber.Ctx) error {
+		repository := settings.Config.GetRepositoryById(c.Params("id"))
+		if repository == nil {
+			c.SendStatus(404)
+			return c.SendString("Repository not found")
+		}
+		path := FixPath(c.Query("path", "/"))
+		format := c.Query("format", "tar.gz")
+		if format == "file" {
+			return serveFileDump(c, restic.ForRequest(requestID(c)), *repository, c.Params("snapshot_id"), path)
+		}
+		archive := ""
+		switch format {
+		case "tar", "tar.gz":
+			archive = "tar"
+		case "zip":
+			archive = "zip"
+		default:
+			c.SendStatus(400)
+			return c.SendString("Unknown format")
+		}
+
+		name := filepath.Base(path)
+		if name == "/" || name == "." {
+			name = "root"
+		}
+		snapshotId := c.Params("snapshot_id")
+		c.Set("Content-Type", "application/octet-stream")
+		c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", snapshotId+"-"+name+"."+format))
+
+		rq := restic.ForRequest(requestID(c))
+		c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+			var out io.Writer = w
+			var gz *gzip.Writer
+			if format == "tar.gz" {
+				gz = gzip.NewWriter(w)
+				out = gz
+			}
+			// headers are already sent, errors can only be logged
+			if err := rq.Dump(*repository, snapshotId, path, archive, out); err != nil {
+				log.Error("download", "snapshot", snapshotId, "path", path, "err", err)
+			}
+			if gz != nil {
+				gz.Close()
+			}
+			w.Flush()
+		})
+		return nil
+	})
+
 	backups.Get("/", func(c *fiber.Ctx) error {
 
 		return c.SendString("Hello, World!")
 	})
 
-	server.Listen("0.0.0.0:11278")
+	backups.Post("/:id/restore-latest", RequireRole(RoleOperator), func(c *fiber.Ctx) error {
+		var data LatestRestoreData
+		if err := c.BodyParser(&data); err != nil {
+			c.SendStatus(400)
+			return c.SendString(err.Error())
+		}
+		settings.Refresh()
+		backup := settings.Config.GetBackupById(c.Params("id"))
+		if backup == nil {
+			c.SendStatus(404)
+			return c.SendString("Backup not found")
+		}
+		if data.RepositoryId == "" && len(backup.Targets) > 0 {
+			data.RepositoryId = backup.Targets[0]
+		}
+		if !slices.Contains(backup.Targets, data.RepositoryId) {
+			c.SendStatus(400)
+			return c.SendString(ErrNotBackupTarget.Error())
+		}
+		repository := settings.Config.GetRepositoryById(data.RepositoryId)
+		if repository == nil {
+			c.SendStatus(404)
+			return c.SendString("Repository not found")
+		}
+		res, err := restic.ForRequest(requestID(c)).RestoreLatest(*repository, *backup, data)
+		switch {
+		case errors.Is(err, ErrNoRestoreTarget), errors.Is(err, ErrNotBackupPath):
+			c.SendStatus(400)
+			return c.SendString(err.Error())
+		case errors.Is(err, ErrNoSnapshot):
+			c.SendStatus(404)
+			return c.SendString(err.Error())
+		case errors.Is(err, ErrRestoreHasIssues):
+			c.Status(409)
+			return c.JSON(res)
+		case err != nil:
+			c.SendStatus(500)
+			return c.SendString(err.Error())
+		}
+		return c.JSON(res)
+	})
+
+	return server.Listen("0.0.0.0:11278")
+}
+
+// ShutdownServer sends a close frame to all websocket clients and waits up
+// to timeout for in-flight requests before releasing the listener.
+func ShutdownServer(timeout time.Duration) error {
+	if httpServer == nil {
+		return nil
+	}
+	log.Info("Shutting down server")
+	events.Close()
+	appLog.Close()
+	done := make(chan bool)
+	select {
+	case closeAll <- done:
+		<-done
+	case <-time.After(timeout):
+		log.Warn("server: timeout closing websocket clients")
+	}
+	return httpServer.ShutdownWithTimeout(timeout)
 }
@@ -5,14 +5,13 @@ import (
 	"io"
 	"os"
 	"path/filepath"
-	"sync"
 	"time"
 
 	"github.com/adrg/xdg"
 	"github.com/charmbracelet/log"
 )
 
-func NewSettings(flagFile string) *Settings {
+func NewSettings(flagFile string, profile string) *Settings {
 	s := &Settings{}
 	s.file = flagFile
 
@@ -30,23 +29,46 @@ func NewSettings(flagFile string) *Settings {
 	if s.file == "" {
 		s.file = filepath.Join(xdg.ConfigHome, "resticity", "config.json")
 	}
+	s.base = s.file
+
+	if profile == "" {
+		profile = os.Getenv("RESTICITY_PROFILE")
+	}
+	if err := s.UseProfile(profile); err != nil {
+		log.Error("settings: profile", "profile", profile, "err", err)
+		s.UseProfile(DefaultProfile)
+	}
+
+	return s
+}
+
+// UseProfile switches to the config file of a profile, creating it when
+// it doesn't exist yet.
+func (s *Settings) UseProfile(name string) error {
+	if name == "" {
+		name = DefaultProfile
+	}
+	if !profileNameRegex.MatchString(name) {
+		return ErrInvalidProfile
+	}
+	s.mux.Lock()
+	s.file = s.profileFile(name)
+	s.profile = name
+	s.mux.Unlock()
 
 	if _, err := os.Stat(s.file); os.IsNotExist(err) {
-		os.Mkdir(filepath.Dir(s.file), 0755)
+		os.MkdirAll(filepath.Dir(s.file), 0755)
 		os.Create(s.file)
 		s.Init()
 	} else {
-		log.Info("Loading existing settings", "file", s.file)
+		log.Info("Loading existing settings", "file", s.file, "profile", name)
 		if s.FileEmpty() {
 			s.Init()
 		} else {
 			s.Config = s.readFile()
 		}
 	}
-
-	s.mux = sync.Mutex{}
-
-	return s
+	return nil
 }
 
 func (s *Settings) Init() {
@@ -56,7 +78,7 @@ func (s *Settings) Init() {
 }
 
 func (s *Settings) freshConfig() Config {
-	c := Config{}
+	c := Config{SchemaVersion: currentSchemaVersion}
 	c.Repositories = []Repository{}
 	c.Backups = []Backup{}
 	c.Schedules = []Schedule{}
@@ -66,6 +88,7 @@ func (s *Settings) freshConfig() Config {
 			OnScheduleError:   true,
 			OnScheduleSuccess: true,
 			OnScheduleStart:   true,
+			OnWarning:         true,
 		},
 		Hooks: AppSettingsHooks{
 			OnScheduleError:   "",
@@ -73,6 +96,45 @@ func (s *Settings) freshConfig() Config {
 			OnScheduleStart:   "",
 		},
 		PreserveErrorLogsDays: 7,
+		Logging: AppSettingsLogging{
+			Level:     "info",
+			Format:    "text",
+			MaxSizeMb: 10,
+			MaxFiles:  5,
+		},
+		RateLimit: AppSettingsRateLimit{
+			Enabled:        true,
+			Max:            300,
+			AuthMax:        5,
+			WindowSeconds:  60,
+			ProxyHeader:    "",
+			TrustedProxies: []string{"127.0.0.1", "::1"},
+		},
+		AllowedOrigins: append([]string{}, defaultAllowedOrigins...),
+		ConfigHistory:  20,
+		RunLogs:        20,
+		AnomalyPercent: 50,
+		Smtp: AppSettingsSmtp{
+			Port:       587,
+			To:         []string{},
+			OnFailure:  true,
+			DigestHour: 8,
+		},
+		Ntfy: AppSettingsNtfy{
+			Server:          "https://ntfy.sh",
+			OnFailure:       true,
+			PriorityFailure: 4,
+			PrioritySuccess: 2,
+		},
+		Gotify: AppSettingsGotify{
+			OnFailure:       true,
+			PriorityFailure: 8,
+			PrioritySuccess: 2,
+		},
+		Telegram: AppSettingsTelegram{
+			OnFailure: true,
+			OnWarning: true,
+		},
 	}
 	return c
 }
@@ -99,6 +161,18 @@ func (c *Config) GetRepositoryById(id string) *Repository {
 	return nil
 }
 
+// SchedulesUsingRepository returns the schedules backing up to or copying
+// from a repository.
+func (c *Config) SchedulesUsingRepository(id string) []Schedule {
+	schedules := []Schedule{}
+	for _, s := range c.Schedules {
+		if s.ToRepositoryId == id || s.FromRepositoryId == id {
+			schedules = append(schedules, s)
+		}
+	}
+	return schedules
+}
+
 func (c *Config) GetScheduleObject(s *Schedule) ScheduleObject {
 	so := ScheduleObject{}
 	so.Schedule = *s
@@ -117,6 +191,20 @@ func (c *Config) GetBackupById(id string) *Backup {
 	return nil
 }
 
+// Maintenance schedules work on one repository instead of copying into it.
+func (s Schedule) Maintenance() bool {
+	return s.Action == "prune-repository" || s.Action == "forget-repository" || s.Action == "check-repository"
+}
+
+// Retention is the forget policy of a prune or forget schedule, its own or
+// the one of the repository.
+func (s Schedule) Retention(repository Repository) [][]string {
+	if len(s.PruneParams) > 0 {
+		return s.PruneParams
+	}
+	return repository.PruneParams
+}
+
 func (s *Settings) FileEmpty() bool {
 	data, err := os.ReadFile(s.file)
 	if err != nil {
@@ -131,14 +219,30 @@ func (s *Settings) readFile() Config {
 	defer s.mux.Unlock()
 	data := s.freshConfig()
 	if file, err := os.Open(s.file); err == nil {
+		defer file.Close()
 		if str, err := io.ReadAll(file); err == nil {
-			if err := json.Unmarshal([]byte(str), &data); err != nil {
+			migrated, from, err := migrateConfig(str)
+			if err != nil {
+				log.Error("settings: migrate", "err", err)
+			}
+			if err := json.Unmarshal(migrated, &data); err != nil {
 				log.Error("settings: unmarshal", "err", err)
 			}
+			if s.stamp.file != s.file {
+				// first load of this file, changes from now on are for Watch
+				s.stamp = stampOf(s.file)
+			}
+			if from < currentSchemaVersion && err == nil {
+				backupConfigFile(s.file, str, from)
+				s.write(data)
+			} else if from > currentSchemaVersion {
+				log.Warn("settings: file is from a newer version, unknown fields are lost on save", "version", from)
+			}
 		}
 	} else {
 		log.Error("settings: read file", "err", err)
 	}
+	secrets.update(data)
 	return data
 }
 
@@ -149,14 +253,23 @@ func (s *Settings) Refresh() {
 func (s *Settings) Save(data Config) error {
 	s.mux.Lock()
 	defer s.mux.Unlock()
+	data.SchemaVersion = currentSchemaVersion
 	s.Config = data
+	secrets.update(data)
 	log.Debug("Saving settings")
-	if str, err := json.MarshalIndent(s.Config, " ", " "); err == nil {
+	return s.write(s.Config)
+}
+
+// write stores the config without locking, callers hold s.mux.
+func (s *Settings) write(data Config) error {
+	if str, err := json.MarshalIndent(data, " ", " "); err == nil {
 		log.Info("Settings saved")
-		if err := os.WriteFile(s.file, str, 0644); err != nil {
+		if err := writeFileAtomic(s.file, str, 0644); err != nil {
 			log.Error("settings: write", "err", err)
+			errorCenter.Report(ErrorSourceConfig, s.file, "Config could not be saved", err.Error())
 			return err
 		}
+		s.stamp = stampOf(s.file)
 	} else {
 		log.Error("settings: marshal indent", "err", err)
 		return err
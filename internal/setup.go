@@ -0,0 +1,224 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/adrg/xdg"
+)
+
+// SetupStatus is what the first run wizard starts from.
+type SetupStatus struct {
+	// FirstRun is true while the config has no repositories, backups or
+	// schedules, only then POST /setup is accepted
+	FirstRun   bool       `json:"first_run"`
+	Restic     ResticInfo `json:"restic"`
+	ConfigFile string     `json:"config_file"`
+	// CacheDir is suggested for app_settings.cache_dir, restic's default
+	CacheDir string `json:"cache_dir"`
+}
+
+type ResticInfo struct {
+	Found   bool   `json:"found"`
+	Path    string `json:"path"`
+	Version string `json:"version"`
+	Error   string `json:"error"`
+}
+
+// DetectedRepository is a restic repository found on disk.
+type DetectedRepository struct {
+	Path string `json:"path"`
+	// Location is the searched directory it was found in
+	Location   string `json:"location"`
+	Configured bool   `json:"configured"`
+}
+
+// SetupData is the initial config created by the wizard.
+type SetupData struct {
+	Repositories []Repository `json:"repositories"`
+	Backups      []Backup     `json:"backups"`
+	Schedules    []Schedule   `json:"schedules"`
+	CacheDir     string       `json:"cache_dir"`
+}
+
+var ErrAlreadySetUp = errors.New("Already set up, the config has repositories, backups or schedules")
+
+var resticVersionRegex = regexp.MustCompile(`restic (\d+\.\d+\.\d+\S*)`)
+
+const (
+	// directories below a location that are searched for repositories
+	repositorySearchDepth = 3
+	// directories looked at per location at most, so a huge home
+	// directory doesn't block the wizard
+	repositorySearchLimit = 5000
+)
+
+func (s *Settings) firstRun() bool {
+	c := s.Config
+	return len(c.Repositories) == 0 && len(c.Backups) == 0 && len(c.Schedules) == 0
+}
+
+func (s *Settings) SetupStatus() SetupStatus {
+	s.mux.Lock()
+	file := s.file
+	s.mux.Unlock()
+	return SetupStatus{
+		FirstRun:   s.firstRun(),
+		Restic:     detectRestic(),
+		ConfigFile: file,
+		CacheDir:   defaultCacheDir(),
+	}
+}
+
+// detectRestic looks for restic the same way runs do and asks it for its
+// version.
+func detectRestic() ResticInfo {
+	bin, opts, err := resticBinary()
+	if err != nil {
+		return ResticInfo{Error: "restic not found, install it or put it next to resticity"}
+	}
+	info := ResticInfo{Found: true, Path: bin}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, bin, append(opts, "version")...).Output()
+	if err != nil {
+		info.Error = err.Error()
+		return info
+	}
+	if m := resticVersionRegex.FindStringSubmatch(string(out)); m != nil {
+		info.Version = m[1]
+	} else {
+		info.Version = strings.TrimSpace(string(out))
+	}
+	return info
+}
+
+// defaultCacheDir is where restic keeps its cache when not told otherwise.
+func defaultCacheDir() string {
+	if dir := os.Getenv("RESTIC_CACHE_DIR"); dir != "" {
+		return dir
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "restic")
+}
+
+// repositoryLocations are the directories repositories usually live in:
+// the home directory, mounted drives and common backup directories.
+func repositoryLocations() []string {
+	home, _ := os.UserHomeDir()
+	dirs := []string{}
+	if home != "" {
+		dirs = append(dirs, home)
+	}
+	dirs = append(dirs, filepath.Join(xdg.DataHome, "restic"))
+	switch runtime.GOOS {
+	case "windows":
+		for _, d := range "DEFGHIJKLMNOPQRSTUVWXYZ" {
+			dirs = append(dirs, string(d)+`:\`)
+		}
+	case "darwin":
+		dirs = append(dirs, "/Volumes")
+	default:
+		dirs = append(dirs, "/mnt", "/media", "/run/media", "/srv", "/backup", "/backups", "/var/backups")
+	}
+	return dirs
+}
+
+// isResticRepository tells a repository by its config file and key
+// directory.
+func isResticRepository(dir string) bool {
+	if st, err := os.Stat(filepath.Join(dir, "config")); err != nil || st.IsDir() {
+		return false
+	}
+	st, err := os.Stat(filepath.Join(dir, "keys"))
+	return err == nil && st.IsDir()
+}
+
+// DetectRepositories searches the common locations and extra for local
+// repositories, those already in the config are marked.
+func (s *Settings) DetectRepositories(extra []string) []DetectedRepository {
+	configured := map[string]bool{}
+	for _, r := range s.Config.Repositories {
+		configured[filepath.Clean(ExpandEnvRefs(r.Path))] = true
+	}
+	found := []DetectedRepository{}
+	seen := map[string]bool{}
+	for _, location := range append(repositoryLocations(), extra...) {
+		location = filepath.Clean(ExpandPath(location))
+		if st, err := os.Stat(location); err != nil || !st.IsDir() {
+			continue
+		}
+		visited := 0
+		var walk func(dir string, depth int)
+		walk = func(dir string, depth int) {
+			if seen[dir] || visited >= repositorySearchLimit {
+				return
+			}
+			seen[dir] = true
+			visited++
+			if isResticRepository(dir) {
+				found = append(found, DetectedRepository{Path: dir, Location: location, Configured: configured[dir]})
+				return
+			}
+			if depth == repositorySearchDepth {
+				return
+			}
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				return
+			}
+			for _, e := range entries {
+				if e.IsDir() && !strings.HasPrefix(e.Name(), ".") {
+					walk(filepath.Join(dir, e.Name()), depth+1)
+				}
+			}
+		}
+		walk(location, 0)
+	}
+	return found
+}
+
+// Setup creates the initial config in one save, nothing is written when
+// any part of it is invalid. It's refused once something is configured.
+func (s *Settings) Setup(data SetupData, dryRun bool, user string) (Config, []FieldError, error) {
+	if !s.firstRun() {
+		return Config{}, nil, ErrAlreadySetUp
+	}
+	c := s.freshConfig()
+	c.AppSettings = s.Config.AppSettings
+	if data.Repositories != nil {
+		c.Repositories = data.Repositories
+	}
+	if data.Backups != nil {
+		c.Backups = data.Backups
+	}
+	if data.Schedules != nil {
+		c.Schedules = data.Schedules
+	}
+	c.AppSettings.CacheDir = data.CacheDir
+	if errs := c.Validate(); len(errs) > 0 {
+		return Config{}, errs, nil
+	}
+	if dryRun {
+		return c, nil, nil
+	}
+	if data.CacheDir != "" && !strings.HasPrefix(data.CacheDir, "${") {
+		if err := os.MkdirAll(data.CacheDir, 0700); err != nil {
+			return Config{}, nil, err
+		}
+	}
+	if err := s.SaveVersion(c, user); err != nil {
+		return Config{}, nil, err
+	}
+	return c, nil, nil
+}
@@ -0,0 +1,82 @@
+package internal
+
+import (
+	"slices"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+const (
+	// sleepCheckInterval is how often the wall clock is compared
+	sleepCheckInterval = 30 * time.Second
+	// sleepMinGap is how far behind a check has to be to count as sleep
+	sleepMinGap = 2 * time.Minute
+)
+
+// watchSleep notices when the machine was suspended. Go's timers, and with
+// them gocron, don't count the time asleep, so cron runs fire late or in a
+// burst afterwards. The check compares wall clock times, which works
+// the same on Linux, macOS and Windows without listening to their power
+// events.
+func (s *Scheduler) watchSleep() {
+	ticker := time.NewTicker(sleepCheckInterval)
+	defer ticker.Stop()
+	last := time.Now().Round(0)
+	next := s.nextRuns()
+	pending := time.Time{}
+	for range ticker.C {
+		now := time.Now().Round(0)
+		if gap := now.Sub(last) - sleepCheckInterval; gap > sleepMinGap {
+			log.Info("Resumed after sleep", "slept", gap.Round(time.Second))
+			if pending.IsZero() {
+				pending = last
+			}
+		}
+		last = now
+		// running jobs finish first, rescheduling would restart them
+		if !pending.IsZero() && len(s.GetRunningJobs()) == 0 {
+			s.resumed(pending, next)
+			pending = time.Time{}
+		}
+		if pending.IsZero() {
+			next = s.nextRuns()
+		}
+	}
+}
+
+// nextRuns remembers when each schedule runs next, to find the runs missed
+// while asleep.
+func (s *Scheduler) nextRuns() map[string]time.Time {
+	next := map[string]time.Time{}
+	for _, j := range s.jobs.All() {
+		if t, ok := s.NextRun(j.Id); ok {
+			next[j.Id] = t
+		}
+	}
+	return next
+}
+
+// resumed recreates the cron timers and, with CatchUpAfterSleep, runs the
+// schedules that should have run since asleep once.
+func (s *Scheduler) resumed(asleep time.Time, next map[string]time.Time) {
+	s.RescheduleBackups()
+	if !s.settings.Config.AppSettings.CatchUpAfterSleep {
+		return
+	}
+	pause := s.PauseState()
+	now := time.Now()
+	for id, t := range next {
+		if t.Before(asleep) || t.After(now) || pause.Paused || slices.Contains(pause.Schedules, id) {
+			continue
+		}
+		// some platforms fire the missed timer on wake up themselves
+		if j, ok := s.jobs.Get(id); ok {
+			if last, err := time.Parse(time.RFC3339, j.Schedule.LastRun); err == nil && last.After(t) {
+				continue
+			}
+		}
+		s.jobLog(id).Info("Catching up run missed while asleep", "missed", t)
+		s.RunJobById(id)
+	}
+}
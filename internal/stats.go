@@ -0,0 +1,120 @@
+package internal
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RunStats sums up the runs of a schedule, a repository or a period, the
+// numbers come from the backup summaries.
+type RunStats struct {
+	Key                 string  `json:"key"`
+	Runs                int     `json:"runs"`
+	Failed              int     `json:"failed"`
+	DurationSeconds     float64 `json:"duration_seconds"`
+	FilesNew            uint64  `json:"files_new"`
+	FilesChanged        uint64  `json:"files_changed"`
+	DataAdded           uint64  `json:"data_added"`
+	DataAddedPacked     uint64  `json:"data_added_packed"`
+	TotalBytesProcessed uint64  `json:"total_bytes_processed"`
+}
+
+var ErrInvalidBucket = errors.New("Invalid bucket, use day, week or month")
+
+// statsKeys group runs, either by schedule, by repository or by period in
+// local time. Only these are put into the query.
+var statsKeys = map[string]string{
+	"schedule":   "r.schedule_id",
+	"repository": "r.repository_id",
+	"day":        "strftime('%Y-%m-%d', r.started / 1000, 'unixepoch', 'localtime')",
+	"week":       "strftime('%Y-W%W', r.started / 1000, 'unixepoch', 'localtime')",
+	"month":      "strftime('%Y-%m', r.started / 1000, 'unixepoch', 'localtime')",
+}
+
+// Stats groups the runs since the given time by key, filtered by schedule
+// or repository unless they are empty.
+func (s *Store) Stats(key string, scheduleId string, repositoryId string, since time.Time) ([]RunStats, error) {
+	stats := []RunStats{}
+	expr, ok := statsKeys[key]
+	if !ok {
+		return nil, ErrInvalidBucket
+	}
+	if s == nil {
+		return stats, nil
+	}
+	rows, err := s.db.Query(`
+		SELECT key, COUNT(*), SUM(failed), SUM(duration_ms) / 1000.0,
+			SUM(files_new), SUM(files_changed), SUM(data_added), SUM(data_added_packed), SUM(total_bytes_processed)
+		FROM (
+			SELECT `+expr+` AS key, r.error != '' AS failed, r.duration_ms,
+				COALESCE(SUM(CASE WHEN m.name = 'files_new' THEN m.value END), 0) AS files_new,
+				COALESCE(SUM(CASE WHEN m.name = 'files_changed' THEN m.value END), 0) AS files_changed,
+				COALESCE(SUM(CASE WHEN m.name = 'data_added' THEN m.value END), 0) AS data_added,
+				COALESCE(SUM(CASE WHEN m.name = 'data_added_packed' THEN m.value END), 0) AS data_added_packed,
+				COALESCE(SUM(CASE WHEN m.name = 'total_bytes_processed' THEN m.value END), 0) AS total_bytes_processed
+			FROM runs r LEFT JOIN metrics m ON m.run_id = r.id
+			WHERE r.started >= ? AND (? = '' OR r.schedule_id = ?) AND (? = '' OR r.repository_id = ?)
+			GROUP BY r.id
+		)
+		GROUP BY key ORDER BY key`,
+		toMillis(since), scheduleId, scheduleId, repositoryId, repositoryId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var st RunStats
+		var filesNew, filesChanged, dataAdded, dataAddedPacked, bytesProcessed float64
+		if err := rows.Scan(&st.Key, &st.Runs, &st.Failed, &st.DurationSeconds, &filesNew, &filesChanged, &dataAdded, &dataAddedPacked, &bytesProcessed); err != nil {
+			return nil, err
+		}
+		st.FilesNew = uint64(filesNew)
+		st.FilesChanged = uint64(filesChanged)
+		st.DataAdded = uint64(dataAdded)
+		st.DataAddedPacked = uint64(dataAddedPacked)
+		st.TotalBytesProcessed = uint64(bytesProcessed)
+		stats = append(stats, st)
+	}
+	return stats, rows.Err()
+}
+
+const defaultStatsSince = 30 * 24 * time.Hour
+
+// serveStats answers the stats endpoints. Without an id the runs are
+// summed per schedule or repository, with one over time in buckets.
+func serveStats(store *Store, by string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		since := time.Now().Add(-defaultStatsSince)
+		if c.Query("since") != "" {
+			var err error
+			if since, err = parseSince(c.Query("since")); err != nil {
+				c.SendStatus(400)
+				return c.SendString("Invalid since, use RFC 3339 or a duration like 30d")
+			}
+		}
+		id := c.Params("id")
+		key := by
+		if id != "" {
+			key = c.Query("bucket", "day")
+			if key != "day" && key != "week" && key != "month" {
+				c.SendStatus(400)
+				return c.SendString(ErrInvalidBucket.Error())
+			}
+		}
+		var stats []RunStats
+		var err error
+		if by == "schedule" {
+			stats, err = store.Stats(key, id, "", since)
+		} else {
+			stats, err = store.Stats(key, "", id, since)
+		}
+		if err != nil {
+			c.SendStatus(500)
+			return c.SendString(err.Error())
+		}
+		return c.JSON(stats)
+	}
+}
@@ -0,0 +1,511 @@
+package internal
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/charmbracelet/log"
+	_ "modernc.org/sqlite"
+)
+
+// Store keeps runs, notifications, the audit log and restart state in
+// state.db next to the config file. A nil Store records nothing.
+type Store struct {
+	db *sql.DB
+}
+
+// storeKeepRows is how many audit entries and notifications are kept,
+// older ones are removed on start.
+const storeKeepRows = 10000
+
+// storeMigrations[i] upgrades the schema from user_version i to i+1, add
+// new ones at the end and never change released ones.
+var storeMigrations = []string{
+	`CREATE TABLE runs (
+		id TEXT PRIMARY KEY,
+		schedule_id TEXT NOT NULL,
+		action TEXT NOT NULL,
+		started INTEGER NOT NULL,
+		duration_ms INTEGER NOT NULL,
+		error TEXT NOT NULL DEFAULT '',
+		snapshot_id TEXT NOT NULL DEFAULT ''
+	);
+	CREATE INDEX runs_schedule ON runs (schedule_id, started);
+
+	CREATE TABLE metrics (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		time INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		run_id TEXT NOT NULL DEFAULT '',
+		schedule_id TEXT NOT NULL DEFAULT '',
+		repository_id TEXT NOT NULL DEFAULT '',
+		value REAL NOT NULL
+	);
+	CREATE INDEX metrics_name ON metrics (name, repository_id, time);
+
+	CREATE TABLE notifications (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		time INTEGER NOT NULL,
+		notifier TEXT NOT NULL,
+		event TEXT NOT NULL,
+		schedule_id TEXT NOT NULL DEFAULT '',
+		title TEXT NOT NULL DEFAULT '',
+		error TEXT NOT NULL DEFAULT ''
+	);
+
+	CREATE TABLE mounts (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		repository_id TEXT NOT NULL,
+		path TEXT NOT NULL,
+		mounted INTEGER NOT NULL,
+		unmounted INTEGER
+	);
+
+	CREATE TABLE audit (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		time INTEGER NOT NULL,
+		user TEXT NOT NULL,
+		role TEXT NOT NULL,
+		method TEXT NOT NULL,
+		path TEXT NOT NULL,
+		status INTEGER NOT NULL,
+		summary TEXT NOT NULL,
+		request_id TEXT NOT NULL DEFAULT ''
+	);
+	CREATE INDEX audit_time ON audit (time);`,
+	`ALTER TABLE runs ADD COLUMN repository_id TEXT NOT NULL DEFAULT '';
+	CREATE INDEX runs_repository ON runs (repository_id, started);`,
+	`ALTER TABLE runs ADD COLUMN summary TEXT NOT NULL DEFAULT '';`,
+	`CREATE TABLE state (
+		key TEXT PRIMARY KEY,
+		value TEXT NOT NULL
+	);`,
+}
+
+// OpenStore opens or creates the database and brings its schema up to
+// date.
+func OpenStore(path string) (*Store, error) {
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)")
+	if err != nil {
+		return nil, err
+	}
+	// sqlite allows one writer, queueing them here avoids busy errors
+	db.SetMaxOpenConns(1)
+	s := &Store{db: db}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	for _, table := range []string{"audit", "notifications"} {
+		if _, err := db.Exec(`DELETE FROM `+table+` WHERE id <= (SELECT MAX(id) FROM `+table+`) - ?`, storeKeepRows); err != nil {
+			log.Warn("store: prune", "table", table, "err", err)
+		}
+	}
+	// mounts don't survive the process that started them
+	if _, err := db.Exec(`UPDATE mounts SET unmounted = ? WHERE unmounted IS NULL`, toMillis(time.Now())); err != nil {
+		log.Warn("store: close stale mounts", "err", err)
+	}
+	return s, nil
+}
+
+func (s *Store) migrate() error {
+	var version int
+	if err := s.db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return err
+	}
+	for v := version; v < len(storeMigrations); v++ {
+		log.Info("store: migrating", "from", v, "to", v+1)
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(storeMigrations[v]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("store: migration %d: %w", v+1, err)
+		}
+		// PRAGMA doesn't take parameters
+		if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, v+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) Close() error {
+	if s == nil {
+		return nil
+	}
+	return s.db.Close()
+}
+
+func toMillis(t time.Time) int64 {
+	return t.UnixMilli()
+}
+
+func fromMillis(ms int64) time.Time {
+	return time.UnixMilli(ms)
+}
+
+// exec runs a write, errors are logged since losing a record must not stop
+// what it describes.
+func (s *Store) exec(what string, query string, args ...any) (sql.Result, error) {
+	if s == nil {
+		return nil, nil
+	}
+	res, err := s.db.Exec(query, args...)
+	if err != nil {
+		log.Error("store: "+what, "err", err)
+	}
+	return res, err
+}
+
+type RunRecord struct {
+	Id           string        `json:"id"`
+	ScheduleId   string        `json:"schedule_id"`
+	Action       string        `json:"action"`
+	Started      time.Time     `json:"started"`
+	Duration     time.Duration `json:"duration"`
+	Error        string        `json:"error"`
+	SnapshotId   string        `json:"snapshot_id"`
+	RepositoryId string        `json:"repository_id"`
+	// Summary is the end of a backup's output, nil for other actions
+	Summary *BackupSummary `json:"summary,omitempty"`
+}
+
+type Metric struct {
+	Time         time.Time `json:"time"`
+	Name         string    `json:"name"`
+	RunId        string    `json:"run_id"`
+	ScheduleId   string    `json:"schedule_id"`
+	RepositoryId string    `json:"repository_id"`
+	Value        float64   `json:"value"`
+}
+
+type NotificationRecord struct {
+	Time       time.Time `json:"time"`
+	Notifier   string    `json:"notifier"`
+	Event      string    `json:"event"`
+	ScheduleId string    `json:"schedule_id"`
+	Title      string    `json:"title"`
+	Error      string    `json:"error"`
+}
+
+type MountRecord struct {
+	Id           int64      `json:"id"`
+	RepositoryId string     `json:"repository_id"`
+	Path         string     `json:"path"`
+	Mounted      time.Time  `json:"mounted"`
+	Unmounted    *time.Time `json:"unmounted"`
+}
+
+// RecordRun saves a finished run and the numbers of its backup summary as
+// metrics, repositoryId is the repository written to.
+func (s *Store) RecordRun(report JobReport, repositoryId string) {
+	if s == nil || report.RunId == "" {
+		return
+	}
+	r := RunRecord{
+		Id:           report.RunId,
+		ScheduleId:   report.ScheduleId,
+		Action:       report.Action,
+		Started:      report.Started,
+		Duration:     report.Duration,
+		Error:        report.Error,
+		RepositoryId: repositoryId,
+	}
+	summary := ""
+	if report.Summary != nil {
+		r.SnapshotId = report.Summary.SnapshotId
+		if j, err := json.Marshal(report.Summary); err == nil {
+			summary = string(j)
+		}
+	}
+	s.exec("record run",
+		`INSERT OR REPLACE INTO runs (id, schedule_id, action, started, duration_ms, error, snapshot_id, repository_id, summary) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.Id, r.ScheduleId, r.Action, toMillis(r.Started), r.Duration.Milliseconds(), r.Error, r.SnapshotId, r.RepositoryId, summary,
+	)
+	if sum := report.Summary; sum != nil {
+		for name, value := range map[string]float64{
+			"files_new":             float64(sum.FilesNew),
+			"files_changed":         float64(sum.FilesChanged),
+			"files_unmodified":      float64(sum.FilesUnmodified),
+			"data_added":            float64(sum.DataAdded),
+			"data_added_packed":     float64(sum.DataAddedPacked),
+			"total_files_processed": float64(sum.TotalFilesProcessed),
+			"total_bytes_processed": float64(sum.TotalBytesProcessed),
+			"total_duration":        sum.TotalDuration,
+		} {
+			s.RecordMetric(Metric{Time: report.Started, Name: name, RunId: r.Id, ScheduleId: r.ScheduleId, RepositoryId: repositoryId, Value: value})
+		}
+	}
+}
+
+// Runs returns the runs of a schedule, all schedules if it is empty,
+// newest first.
+func (s *Store) Runs(scheduleId string, limit int) ([]RunRecord, error) {
+	if s == nil {
+		return []RunRecord{}, nil
+	}
+	return s.queryRuns(
+		`SELECT `+runColumns+` FROM runs
+		WHERE ? = '' OR schedule_id = ? ORDER BY started DESC LIMIT ?`,
+		scheduleId, scheduleId, sqlLimit(limit),
+	)
+}
+
+// RunsBetween returns the runs started in [from, to), oldest first. A zero
+// to means until now.
+func (s *Store) RunsBetween(from time.Time, to time.Time) ([]RunRecord, error) {
+	if s == nil {
+		return []RunRecord{}, nil
+	}
+	if to.IsZero() {
+		to = time.Now()
+	}
+	return s.queryRuns(
+		`SELECT `+runColumns+` FROM runs
+		WHERE started >= ? AND started < ? ORDER BY started, id`,
+		toMillis(from), toMillis(to),
+	)
+}
+
+// LastRuns returns the latest run of every schedule, so the state of the
+// last runs is known right after a restart.
+func (s *Store) LastRuns() ([]RunRecord, error) {
+	if s == nil {
+		return []RunRecord{}, nil
+	}
+	return s.queryRuns(
+		`SELECT ` + runColumns + ` FROM runs r
+		WHERE started = (SELECT MAX(started) FROM runs WHERE schedule_id = r.schedule_id)
+		ORDER BY schedule_id`,
+	)
+}
+
+const runColumns = `id, schedule_id, action, started, duration_ms, error, snapshot_id, repository_id, summary`
+
+func (s *Store) queryRuns(query string, args ...any) ([]RunRecord, error) {
+	runs := []RunRecord{}
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var r RunRecord
+		var started, duration int64
+		var summary string
+		if err := rows.Scan(&r.Id, &r.ScheduleId, &r.Action, &started, &duration, &r.Error, &r.SnapshotId, &r.RepositoryId, &summary); err != nil {
+			return nil, err
+		}
+		r.Started = fromMillis(started)
+		r.Duration = time.Duration(duration) * time.Millisecond
+		if summary != "" {
+			r.Summary = &BackupSummary{}
+			if err := json.Unmarshal([]byte(summary), r.Summary); err != nil {
+				r.Summary = nil
+			}
+		}
+		runs = append(runs, r)
+	}
+	return runs, rows.Err()
+}
+
+func (s *Store) RecordMetric(m Metric) {
+	if m.Time.IsZero() {
+		m.Time = time.Now()
+	}
+	s.exec("record metric",
+		`INSERT INTO metrics (time, name, run_id, schedule_id, repository_id, value) VALUES (?, ?, ?, ?, ?, ?)`,
+		toMillis(m.Time), m.Name, m.RunId, m.ScheduleId, m.RepositoryId, m.Value,
+	)
+}
+
+// Metrics returns the values of a metric since the given time, oldest
+// first, an empty repositoryId matches all repositories.
+func (s *Store) Metrics(name string, repositoryId string, since time.Time) ([]Metric, error) {
+	metrics := []Metric{}
+	if s == nil {
+		return metrics, nil
+	}
+	rows, err := s.db.Query(
+		`SELECT time, name, run_id, schedule_id, repository_id, value FROM metrics
+		WHERE name = ? AND (? = '' OR repository_id = ?) AND time >= ? ORDER BY time`,
+		name, repositoryId, repositoryId, toMillis(since),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var m Metric
+		var t int64
+		if err := rows.Scan(&t, &m.Name, &m.RunId, &m.ScheduleId, &m.RepositoryId, &m.Value); err != nil {
+			return nil, err
+		}
+		m.Time = fromMillis(t)
+		metrics = append(metrics, m)
+	}
+	return metrics, rows.Err()
+}
+
+func (s *Store) RecordNotification(n NotificationRecord) {
+	if n.Time.IsZero() {
+		n.Time = time.Now()
+	}
+	s.exec("record notification",
+		`INSERT INTO notifications (time, notifier, event, schedule_id, title, error) VALUES (?, ?, ?, ?, ?, ?)`,
+		toMillis(n.Time), n.Notifier, n.Event, n.ScheduleId, n.Title, n.Error,
+	)
+}
+
+// Notifications returns the latest sent notifications, newest first.
+func (s *Store) Notifications(limit int) ([]NotificationRecord, error) {
+	notifications := []NotificationRecord{}
+	if s == nil {
+		return notifications, nil
+	}
+	rows, err := s.db.Query(
+		`SELECT time, notifier, event, schedule_id, title, error FROM notifications ORDER BY time DESC LIMIT ?`,
+		sqlLimit(limit),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var n NotificationRecord
+		var t int64
+		if err := rows.Scan(&t, &n.Notifier, &n.Event, &n.ScheduleId, &n.Title, &n.Error); err != nil {
+			return nil, err
+		}
+		n.Time = fromMillis(t)
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+// MountStarted records a mount and returns its id for MountEnded.
+func (s *Store) MountStarted(repositoryId string, path string) int64 {
+	res, err := s.exec("record mount",
+		`INSERT INTO mounts (repository_id, path, mounted) VALUES (?, ?, ?)`,
+		repositoryId, path, toMillis(time.Now()),
+	)
+	if err != nil || res == nil {
+		return 0
+	}
+	id, _ := res.LastInsertId()
+	return id
+}
+
+func (s *Store) MountEnded(id int64) {
+	if id == 0 {
+		return
+	}
+	s.exec("record unmount", `UPDATE mounts SET unmounted = ? WHERE id = ?`, toMillis(time.Now()), id)
+}
+
+// Mounts returns the latest mounts, newest first.
+func (s *Store) Mounts(limit int) ([]MountRecord, error) {
+	mounts := []MountRecord{}
+	if s == nil {
+		return mounts, nil
+	}
+	rows, err := s.db.Query(
+		`SELECT id, repository_id, path, mounted, unmounted FROM mounts ORDER BY mounted DESC LIMIT ?`,
+		sqlLimit(limit),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var m MountRecord
+		var mounted int64
+		var unmounted sql.NullInt64
+		if err := rows.Scan(&m.Id, &m.RepositoryId, &m.Path, &mounted, &unmounted); err != nil {
+			return nil, err
+		}
+		m.Mounted = fromMillis(mounted)
+		if unmounted.Valid {
+			t := fromMillis(unmounted.Int64)
+			m.Unmounted = &t
+		}
+		mounts = append(mounts, m)
+	}
+	return mounts, rows.Err()
+}
+
+// Audit appends an entry to the audit log.
+func (s *Store) Audit(e AuditEntry) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	s.exec("audit",
+		`INSERT INTO audit (time, user, role, method, path, status, summary, request_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		toMillis(e.Time), e.User, string(e.Role), e.Method, e.Path, e.Status, e.Summary, e.RequestId,
+	)
+}
+
+// AuditLog returns the latest entries, newest first, limit 0 returns all.
+func (s *Store) AuditLog(limit int) ([]AuditEntry, error) {
+	entries := []AuditEntry{}
+	if s == nil {
+		return entries, nil
+	}
+	rows, err := s.db.Query(
+		`SELECT time, user, role, method, path, status, summary, request_id FROM audit ORDER BY time DESC, id DESC LIMIT ?`,
+		sqlLimit(limit),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e AuditEntry
+		var t int64
+		var role string
+		if err := rows.Scan(&t, &e.User, &role, &e.Method, &e.Path, &e.Status, &e.Summary, &e.RequestId); err != nil {
+			return nil, err
+		}
+		e.Time = fromMillis(t)
+		e.Role = Role(role)
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// SetState keeps a value under key, an empty value removes it.
+func (s *Store) SetState(key string, value string) {
+	if value == "" {
+		s.exec("state", `DELETE FROM state WHERE key = ?`, key)
+		return
+	}
+	s.exec("state", `INSERT INTO state (key, value) VALUES (?, ?) ON CONFLICT (key) DO UPDATE SET value = excluded.value`, key, value)
+}
+
+// State returns the value kept under key, empty if there is none.
+func (s *Store) State(key string) string {
+	if s == nil {
+		return ""
+	}
+	var value string
+	if err := s.db.QueryRow(`SELECT value FROM state WHERE key = ?`, key).Scan(&value); err != nil && err != sql.ErrNoRows {
+		log.Error("store: state", "key", key, "err", err)
+	}
+	return value
+}
+
+// sqlLimit maps 0 to no limit, which sqlite spells -1.
+func sqlLimit(limit int) int {
+	if limit <= 0 {
+		return -1
+	}
+	return limit
+}
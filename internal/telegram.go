@@ -0,0 +1,134 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/goccy/go-json"
+)
+
+// Telegram sends schedule reports and repository warnings through a bot.
+type Telegram struct {
+	settings *Settings
+	client   *http.Client
+}
+
+func NewTelegram(settings *Settings) *Telegram {
+	return &Telegram{settings: settings, client: &http.Client{Timeout: 15 * time.Second}}
+}
+
+func (t *Telegram) JobFinished(report JobReport) {
+	cfg := t.settings.Config.AppSettings.Telegram
+	if !cfg.Enabled {
+		return
+	}
+	failed := report.Error != ""
+	if (failed && !cfg.OnFailure) || (!failed && !cfg.OnSuccess) {
+		return
+	}
+	icon, status := "✅", "succeeded"
+	if failed {
+		icon, status = "❌", "failed"
+	}
+	lines := []string{
+		fmt.Sprintf("%s <b>%s</b> %s", icon, html.EscapeString(report.Name), status),
+		"Duration: " + report.Duration.Round(time.Second).String(),
+	}
+	if report.Summary != nil {
+		lines = append(lines,
+			"Snapshot: <code>"+html.EscapeString(report.Summary.SnapshotId)+"</code>",
+			fmt.Sprintf("Added: %d bytes (%d new, %d changed files)", report.Summary.DataAdded, report.Summary.FilesNew, report.Summary.FilesChanged),
+		)
+	}
+	if failed {
+		lines = append(lines, "<pre>"+html.EscapeString(truncate(report.Error, 3000))+"</pre>")
+	}
+	if err := t.Send(strings.Join(lines, "\n"), t.runAgainLink(report.ScheduleId)); err != nil {
+		log.Error("telegram: send report", "err", err)
+	}
+}
+
+func (t *Telegram) Warning(title string, msg string) {
+	cfg := t.settings.Config.AppSettings.Telegram
+	if !cfg.Enabled || !cfg.OnWarning {
+		return
+	}
+	text := fmt.Sprintf("⚠️ <b>%s</b>\n%s", html.EscapeString(title), html.EscapeString(msg))
+	if err := t.Send(text, ""); err != nil {
+		log.Error("telegram: send warning", "err", err)
+	}
+}
+
+func (t *Telegram) Message(title string, body string, failure bool) error {
+	if !t.settings.Config.AppSettings.Telegram.Enabled {
+		return nil
+	}
+	icon := "✅"
+	if failure {
+		icon = "❌"
+	}
+	return t.Send(fmt.Sprintf("%s <b>%s</b>\n%s", icon, html.EscapeString(title), html.EscapeString(truncate(body, 3500))), "")
+}
+
+func (t *Telegram) SendTest() error {
+	return t.Send("🔔 <b>resticity</b>\nTelegram notifications are set up correctly.", "")
+}
+
+// runAgainLink opens the schedules page, which asks to run the schedule.
+func (t *Telegram) runAgainLink(scheduleId string) string {
+	base := strings.TrimSuffix(t.settings.Config.AppSettings.Telegram.UiUrl, "/")
+	if base == "" || scheduleId == "" {
+		return ""
+	}
+	return base + "/schedules?run=" + url.QueryEscape(scheduleId)
+}
+
+// Send posts an HTML formatted message, with a "Run again" button when
+// link is set.
+func (t *Telegram) Send(text string, link string) error {
+	cfg := t.settings.Config.AppSettings.Telegram
+	if cfg.BotToken == "" || cfg.ChatId == "" {
+		return errors.New("Telegram bot token and chat id are required")
+	}
+	msg := map[string]any{
+		"chat_id":                  cfg.ChatId,
+		"text":                     text,
+		"parse_mode":               "HTML",
+		"disable_web_page_preview": true,
+	}
+	if link != "" {
+		msg["reply_markup"] = map[string]any{
+			"inline_keyboard": [][]map[string]string{{{"text": "Run again", "url": link}}},
+		}
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	res, err := t.client.Post("https://api.telegram.org/bot"+cfg.BotToken+"/sendMessage", "application/json", bytes.NewReader(data))
+	if err != nil {
+		// the error contains the request url and with it the token
+		return errors.New(strings.ReplaceAll(err.Error(), cfg.BotToken, "***"))
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("Telegram responded %d: %s", res.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	return strings.ToValidUTF8(s[:max], "") + "…"
+}
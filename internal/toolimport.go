@@ -0,0 +1,146 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// importTools are the backup tools whose config can be taken over.
+var importTools = []string{"autorestic", "backrest"}
+
+// ToolImport is what an autorestic or backrest config adds to the current
+// config, with secrets redacted.
+type ToolImport struct {
+	Diff         ConfigDiff   `json:"diff"`
+	Repositories []Repository `json:"repositories"`
+	Backups      []Backup     `json:"backups"`
+	Schedules    []Schedule   `json:"schedules"`
+	// Skipped are repository locations already configured, backups into
+	// them use the configured repository
+	Skipped  []string `json:"skipped"`
+	Warnings []string `json:"warnings"`
+}
+
+// toolConfig is a parsed config of another tool, schedules point at the
+// ids of its repositories and backups.
+type toolConfig struct {
+	repositories []Repository
+	backups      []Backup
+	schedules    []Schedule
+	warnings     []string
+}
+
+func (t *toolConfig) warn(format string, args ...any) {
+	t.warnings = append(t.warnings, fmt.Sprintf(format, args...))
+}
+
+// addBackup adds a backup of paths into targets, the first path is the
+// backup's path and the others are passed to restic next to it.
+func (t *toolConfig) addBackup(name string, paths []string, params [][]string, targets []string) *Backup {
+	if len(paths) == 0 {
+		t.warn("%s has no paths, it was left out", name)
+		return nil
+	}
+	if len(paths) > 1 {
+		params = append([][]string{paths[1:]}, params...)
+	}
+	t.backups = append(t.backups, Backup{
+		Id:           uuid.NewString(),
+		Name:         name,
+		Path:         paths[0],
+		BackupParams: params,
+		Targets:      targets,
+	})
+	return &t.backups[len(t.backups)-1]
+}
+
+func (t *toolConfig) addSchedule(action string, backupId string, repositoryId string, cron string, retention [][]string) {
+	t.schedules = append(t.schedules, Schedule{
+		Id:             uuid.NewString(),
+		Action:         action,
+		BackupId:       backupId,
+		ToRepositoryId: repositoryId,
+		Cron:           cron,
+		Active:         cron != "",
+		PruneParams:    retention,
+	})
+}
+
+// ParseToolConfig reads the config of autorestic (.autorestic.yml) or
+// backrest (config.json).
+func ParseToolConfig(tool string, text string) (toolConfig, error) {
+	switch tool {
+	case "autorestic":
+		return parseAutorestic(text)
+	case "backrest":
+		return parseBackrest(text)
+	}
+	return toolConfig{}, fmt.Errorf("unknown tool %s, expected one of %s", tool, strings.Join(importTools, ", "))
+}
+
+// ImportToolConfig adds what was parsed from another tool to the config.
+// Repositories whose location is already configured aren't added again,
+// the backups and schedules use the configured one. With dryRun nothing is
+// saved.
+func (s *Settings) ImportToolConfig(t toolConfig, dryRun bool, user string) (ToolImport, []FieldError, error) {
+	res := ToolImport{Repositories: []Repository{}, Backups: []Backup{}, Schedules: []Schedule{}, Skipped: []string{}, Warnings: t.warnings}
+	config := s.Config
+	config.Repositories = append([]Repository{}, s.Config.Repositories...)
+	config.Backups = append([]Backup{}, s.Config.Backups...)
+	config.Schedules = append([]Schedule{}, s.Config.Schedules...)
+
+	ids := map[string]string{}
+	for _, r := range t.repositories {
+		names := map[string]bool{}
+		for _, c := range config.Repositories {
+			if c.Path == r.Path {
+				ids[r.Id] = c.Id
+			}
+			names[c.Name] = true
+		}
+		if _, ok := ids[r.Id]; ok {
+			res.Skipped = append(res.Skipped, r.Path)
+			continue
+		}
+		ids[r.Id] = r.Id
+		for n, name := 2, r.Name; names[r.Name]; n++ {
+			r.Name = fmt.Sprintf("%s %d", name, n)
+		}
+		config.Repositories = append(config.Repositories, r)
+		redact(r.secretFields())
+		res.Repositories = append(res.Repositories, r)
+	}
+	for _, b := range t.backups {
+		targets := []string{}
+		for _, id := range b.Targets {
+			targets = append(targets, ids[id])
+		}
+		b.Targets = targets
+		config.Backups = append(config.Backups, b)
+		res.Backups = append(res.Backups, b)
+	}
+	for _, sc := range t.schedules {
+		sc.ToRepositoryId = ids[sc.ToRepositoryId]
+		config.Schedules = append(config.Schedules, sc)
+		res.Schedules = append(res.Schedules, sc)
+	}
+
+	res.Diff = DiffConfig(s.Config, config)
+	if errs := config.Validate(); len(errs) > 0 {
+		return res, errs, nil
+	}
+	if dryRun {
+		return res, nil, nil
+	}
+	return res, nil, s.SaveVersion(config, user)
+}
+
+// retentionParam is a --keep-* option, nothing for a count of 0.
+func retentionParam(policy [][]string, flag string, n int) [][]string {
+	if n <= 0 {
+		return policy
+	}
+	return append(policy, []string{flag, fmt.Sprint(n)})
+}
@@ -0,0 +1,176 @@
+package internal
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	defaultQuietMinutes       = 5
+	defaultMinIntervalMinutes = 60
+)
+
+// trigger runs a schedule on events until stopped.
+type trigger interface {
+	stop()
+}
+
+// changeTrigger watches the source of a backup and runs its schedule once
+// the source has been quiet for a while after a change.
+type changeTrigger struct {
+	scheduleId  string
+	quiet       time.Duration
+	minInterval time.Duration
+	watcher     *fsnotify.Watcher
+	done        chan struct{}
+}
+
+func (t ScheduleTrigger) quiet() time.Duration {
+	if t.QuietMinutes == 0 {
+		return defaultQuietMinutes * time.Minute
+	}
+	return time.Duration(t.QuietMinutes) * time.Minute
+}
+
+func (t ScheduleTrigger) minInterval() time.Duration {
+	if t.MinIntervalMinutes == 0 {
+		return defaultMinIntervalMinutes * time.Minute
+	}
+	return time.Duration(t.MinIntervalMinutes) * time.Minute
+}
+
+// startTriggers replaces the running triggers with those of the config.
+func (s *Scheduler) startTriggers(config Config) {
+	s.tmu.Lock()
+	defer s.tmu.Unlock()
+	for _, t := range s.triggers {
+		t.stop()
+	}
+	s.triggers = nil
+	for _, schedule := range config.Schedules {
+		if schedule.Trigger.Type == "device" {
+			t := &deviceTrigger{schedule: schedule, done: make(chan struct{})}
+			s.triggers = append(s.triggers, t)
+			go t.run(s)
+			continue
+		}
+		if schedule.Trigger.Type != "change" || schedule.Action != "backup" {
+			continue
+		}
+		backup := config.GetBackupById(schedule.BackupId)
+		if backup == nil {
+			continue
+		}
+		t, err := newChangeTrigger(schedule, backup.Path)
+		if err != nil {
+			s.jobLog(schedule.Id).Error("change trigger", "path", backup.Path, "err", err)
+			continue
+		}
+		s.triggers = append(s.triggers, t)
+		go t.run(s)
+	}
+}
+
+func newChangeTrigger(schedule Schedule, path string) (*changeTrigger, error) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	t := &changeTrigger{
+		scheduleId:  schedule.Id,
+		quiet:       schedule.Trigger.quiet(),
+		minInterval: schedule.Trigger.minInterval(),
+		watcher:     w,
+		done:        make(chan struct{}),
+	}
+	if err := t.addTree(path); err != nil {
+		w.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+// addTree watches a directory and all below it, fsnotify isn't recursive.
+// Directories that can't be watched, e.g. over the inotify limit, are
+// logged and skipped.
+func (t *changeTrigger) addTree(root string) error {
+	if _, err := os.Stat(root); err != nil {
+		return err
+	}
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		if err := t.watcher.Add(path); err != nil {
+			log.Warn("change trigger: not watching", "path", path, "err", err)
+		}
+		return nil
+	})
+}
+
+func (t *changeTrigger) stop() {
+	close(t.done)
+	t.watcher.Close()
+}
+
+// run waits until there were changes and none for the quiet time, then runs
+// the schedule, at most once per minInterval. Paused schedules skip it and
+// a running backup postpones it.
+func (t *changeTrigger) run(s *Scheduler) {
+	var lastRun time.Time
+	timer := time.NewTimer(0)
+	if !timer.Stop() {
+		<-timer.C
+	}
+	changed := false
+	for {
+		select {
+		case <-t.done:
+			timer.Stop()
+			return
+		case ev, ok := <-t.watcher.Events:
+			if !ok {
+				return
+			}
+			if ev.Has(fsnotify.Create) {
+				if st, err := os.Stat(ev.Name); err == nil && st.IsDir() {
+					t.addTree(ev.Name)
+				}
+			}
+			changed = true
+			timer.Reset(t.quiet)
+		case err, ok := <-t.watcher.Errors:
+			if !ok {
+				return
+			}
+			s.jobLog(t.scheduleId).Warn("change trigger", "err", err)
+		case <-timer.C:
+			if !changed {
+				continue
+			}
+			if wait := t.minInterval - time.Since(lastRun); wait > 0 {
+				timer.Reset(wait)
+				continue
+			}
+			if j, ok := s.jobs.Get(t.scheduleId); ok && j.Running {
+				timer.Reset(t.quiet)
+				continue
+			}
+			changed = false
+			pause := s.PauseState()
+			if pause.Paused || slices.Contains(pause.Schedules, t.scheduleId) {
+				s.jobLog(t.scheduleId).Info("Paused, skipping backup on change")
+				continue
+			}
+			lastRun = time.Now()
+			s.jobLog(t.scheduleId).Info("Source changed, running backup")
+			s.RunJobById(t.scheduleId)
+		}
+	}
+}
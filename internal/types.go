@@ -6,31 +6,60 @@ import (
 )
 
 type Settings struct {
-	file   string
-	Config Config `json:"config"`
-	mux    sync.Mutex
+	file    string
+	base    string
+	profile string
+	stamp   fileStamp
+	Config  Config `json:"config"`
+	mux     sync.Mutex
 }
 
 type S3Options struct {
 	S3Key    string `json:"s3_key"`
 	S3Secret string `json:"s3_secret"`
+	// S3SessionToken comes with temporary keys, e.g. of an assumed role
+	S3SessionToken string `json:"s3_session_token"`
+	// S3Profile and S3SharedCredentialsFile pick the keys from an AWS
+	// credentials file instead, which restic reads each time it runs
+	S3Profile               string `json:"s3_profile"`
+	S3SharedCredentialsFile string `json:"s3_shared_credentials_file"`
 }
 
 type AzureOptions struct {
 	AzureAccountName string `json:"azure_account_name"`
 	AzureAccountKey  string `json:"azure_account_key"`
 	AzureAccountSas  string `json:"azure_account_sas"`
+	// AzureEndpointSuffix is for clouds other than the public one, e.g.
+	// core.chinacloudapi.cn
+	AzureEndpointSuffix string `json:"azure_endpoint_suffix"`
 }
 
 type GcsOptions struct {
-	GoogleProjectId              string `json:"google_project_id"`
+	GoogleProjectId string `json:"google_project_id"`
+	// GoogleApplicationCredentials is the path of a service account key
 	GoogleApplicationCredentials string `json:"google_application_credentials"`
+	// GoogleCredentialsJson is a service account key pasted as is, used
+	// when there is no path
+	GoogleCredentialsJson string `json:"google_credentials_json"`
+}
+
+// TLSOptions are for backends with certificates of a private CA, like a
+// self-hosted rest-server or MinIO.
+type TLSOptions struct {
+	// TLSCACert is a PEM file of the CA to trust next to the system ones
+	TLSCACert string `json:"tls_cacert"`
+	// TLSClientCert is a PEM file with the client certificate and its key
+	TLSClientCert string `json:"tls_client_cert"`
+	// TLSInsecure skips verifying the server's certificate, anyone in
+	// between can read and change the traffic
+	TLSInsecure bool `json:"tls_insecure"`
 }
 
 type Options struct {
 	S3Options
 	AzureOptions
 	GcsOptions
+	TLSOptions
 }
 
 type GroupKey struct {
@@ -61,10 +90,24 @@ type FileDescriptor struct {
 	Name  string `json:"name"`
 	Type  string `json:"type"`
 	Path  string `json:"path"`
-	Size  uint32 `json:"size"`
+	Size  uint64 `json:"size"`
 	Mtime string `json:"mtime"`
 }
 
+type BrowseOptions struct {
+	Sort      string
+	Order     string
+	Filter    string
+	DirsFirst bool
+}
+
+type BrowseResult struct {
+	Items  []FileDescriptor `json:"items"`
+	Total  int              `json:"total"`
+	Offset int              `json:"offset"`
+	Limit  int              `json:"limit"`
+}
+
 type Repository struct {
 	Id           string     `json:"id"`
 	Name         string     `json:"name"`
@@ -74,15 +117,71 @@ type Repository struct {
 	Password     string     `json:"password"`
 	PasswordFile string     `json:"password_file"`
 	Options      Options    `json:"options"`
+	Compression  string     `json:"compression"`
+	// Env is passed to restic as is, for backend options without a field
+	Env   map[string]string `json:"env"`
+	Quota RepositoryQuota   `json:"quota"`
+	// ReadOnly refuses forget, prune, rewrite, repair and other changes to
+	// existing snapshots through resticity, backups still go in
+	ReadOnly bool `json:"read_only"`
+	// Group and Labels organize the list, list endpoints filter by them
+	Group  string   `json:"group"`
+	Labels []string `json:"labels"`
+}
+
+// InitData is a repository with the options only needed to create it.
+// CopyChunkerParamsFrom is the id of a configured repository whose chunker
+// parameters are copied, so copying snapshots between both deduplicates.
+type InitData struct {
+	Repository
+	RepositoryVersion     string `json:"repository_version"`
+	CopyChunkerParamsFrom string `json:"copy_chunker_params_from"`
+}
+
+// BackupSummary is the last message of restic backup --json.
+type BackupSummary struct {
+	FilesNew            uint64  `json:"files_new"`
+	FilesChanged        uint64  `json:"files_changed"`
+	FilesUnmodified     uint64  `json:"files_unmodified"`
+	DataAdded           uint64  `json:"data_added"`
+	DataAddedPacked     uint64  `json:"data_added_packed"`
+	TotalFilesProcessed uint64  `json:"total_files_processed"`
+	TotalBytesProcessed uint64  `json:"total_bytes_processed"`
+	TotalDuration       float64 `json:"total_duration"`
+	SnapshotId          string  `json:"snapshot_id"`
+}
+
+type CredentialsCheck struct {
+	Ok      bool   `json:"ok"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
 }
 
 type Backup struct {
-	Id           string     `json:"id"`
-	Path         string     `json:"path"`
-	Name         string     `json:"name"`
-	Cron         string     `json:"cron"`
-	BackupParams [][]string `json:"backup_params"`
-	Targets      []string   `json:"targets"`
+	Id           string       `json:"id"`
+	Path         string       `json:"path"`
+	Name         string       `json:"name"`
+	Cron         string       `json:"cron"`
+	BackupParams [][]string   `json:"backup_params"`
+	Targets      []string     `json:"targets"`
+	Tuning       BackupTuning `json:"tuning"`
+}
+
+// BackupTuning trades restic's defaults for speed on slow disks, network
+// filesystems and snapshots of filesystems.
+type BackupTuning struct {
+	// ReadConcurrency is the number of files read at once, restic reads 2
+	// when it's 0. Spinning disks are faster with 1, SSDs and network
+	// filesystems with more
+	ReadConcurrency uint `json:"read_concurrency"`
+	// NoScan skips counting the files first, which also drops the progress
+	// percentage and ETA
+	NoScan bool `json:"no_scan"`
+	// IgnoreInode and IgnoreCtime stop files from being read again only
+	// because their inode or ctime changed, e.g. on network filesystems or
+	// btrfs and ZFS snapshots mounted anew for each backup
+	IgnoreInode bool `json:"ignore_inode"`
+	IgnoreCtime bool `json:"ignore_ctime"`
 }
 
 type Schedule struct {
@@ -95,12 +194,48 @@ type Schedule struct {
 	Active           bool   `json:"active"`
 	LastRun          string `json:"last_run"`
 	LastError        string `json:"last_error"`
+	PingStartUrl     string `json:"ping_start_url"`
+	PingSuccessUrl   string `json:"ping_success_url"`
+	PingFailUrl      string `json:"ping_fail_url"`
+	// PruneParams is the retention policy of prune and forget schedules,
+	// the one of the repository is used when it's empty
+	PruneParams [][]string `json:"prune_params"`
+	// Trigger starts the schedule on events, next to its cron expression
+	Trigger ScheduleTrigger `json:"trigger"`
+	// WebhookTokenHash is the SHA-256 of the token that may trigger the
+	// schedule through its webhook, empty when it has none
+	WebhookTokenHash string `json:"webhook_token_hash"`
+	// Group and Labels organize the list, like those of repositories
+	Group  string   `json:"group"`
+	Labels []string `json:"labels"`
+}
+
+// ScheduleTrigger starts a schedule when something happens instead of at
+// fixed times.
+type ScheduleTrigger struct {
+	// Type is empty for none, "change" to back up after the source changed or
+	// "device" to run when a drive is plugged in
+	Type string `json:"type"`
+	// QuietMinutes without changes before the backup starts, 5 when 0
+	QuietMinutes uint32 `json:"quiet_minutes"`
+	// MinIntervalMinutes between two triggered backups, 60 when 0
+	MinIntervalMinutes uint32 `json:"min_interval_minutes"`
+	// Mountpoint of the drive, e.g. /media/backup or E:\
+	Mountpoint string `json:"mountpoint"`
+	// Uuid of the drive's filesystem, Linux only
+	Uuid string `json:"uuid"`
 }
 
 type AppSettingsNotifications struct {
 	OnScheduleError   bool `json:"on_schedule_error"`
 	OnScheduleSuccess bool `json:"on_schedule_success"`
 	OnScheduleStart   bool `json:"on_schedule_start"`
+	OnWarning         bool `json:"on_warning"`
+}
+
+type AppSettingsAutostart struct {
+	Enabled  bool `json:"enabled"`
+	Headless bool `json:"headless"`
 }
 
 type AppSettingsHooks struct {
@@ -109,32 +244,172 @@ type AppSettingsHooks struct {
 	OnScheduleStart   string `json:"on_schedule_start"`
 }
 
+// AppSettingsRateLimit is applied when the server starts, changes need a
+// restart to take effect.
+type AppSettingsRateLimit struct {
+	Enabled       bool   `json:"enabled"`
+	Max           int    `json:"max"`
+	AuthMax       int    `json:"auth_max"`
+	WindowSeconds uint32 `json:"window_seconds"`
+	ProxyHeader   string `json:"proxy_header"`
+	// TrustedProxies are the IPs or CIDR ranges proxy_header is read from,
+	// it's ignored for every other client
+	TrustedProxies []string `json:"trusted_proxies"`
+}
+
+// AppSettingsLogging controls the log file of resticity itself, not the
+// output of the jobs. Format is text or json, the latter for shipping the
+// log to Loki or Elasticsearch.
+type AppSettingsLogging struct {
+	Level     string `json:"level"`
+	Format    string `json:"format"`
+	MaxSizeMb uint32 `json:"max_size_mb"`
+	MaxFiles  uint32 `json:"max_files"`
+}
+
+type AppSettingsSmtp struct {
+	Enabled     bool     `json:"enabled"`
+	Host        string   `json:"host"`
+	Port        uint16   `json:"port"`
+	Username    string   `json:"username"`
+	Password    string   `json:"password"`
+	From        string   `json:"from"`
+	To          []string `json:"to"`
+	OnFailure   bool     `json:"on_failure"`
+	OnSuccess   bool     `json:"on_success"`
+	DailyDigest bool     `json:"daily_digest"`
+	DigestHour  uint8    `json:"digest_hour"`
+}
+
+// AppSettingsNtfy priorities follow ntfy, 1 (min) to 5 (urgent).
+type AppSettingsNtfy struct {
+	Enabled         bool   `json:"enabled"`
+	Server          string `json:"server"`
+	Topic           string `json:"topic"`
+	Token           string `json:"token"`
+	OnFailure       bool   `json:"on_failure"`
+	OnSuccess       bool   `json:"on_success"`
+	PriorityFailure uint8  `json:"priority_failure"`
+	PrioritySuccess uint8  `json:"priority_success"`
+}
+
+// AppSettingsGotify priorities follow Gotify, 0 (lowest) to 10.
+type AppSettingsGotify struct {
+	Enabled         bool   `json:"enabled"`
+	Server          string `json:"server"`
+	Token           string `json:"token"`
+	OnFailure       bool   `json:"on_failure"`
+	OnSuccess       bool   `json:"on_success"`
+	PriorityFailure uint8  `json:"priority_failure"`
+	PrioritySuccess uint8  `json:"priority_success"`
+}
+
+// AppSettingsTelegram UiUrl is where the UI is reachable from the phone,
+// used for the "Run again" button.
+type AppSettingsTelegram struct {
+	Enabled   bool   `json:"enabled"`
+	BotToken  string `json:"bot_token"`
+	ChatId    string `json:"chat_id"`
+	OnFailure bool   `json:"on_failure"`
+	OnSuccess bool   `json:"on_success"`
+	OnWarning bool   `json:"on_warning"`
+	UiUrl     string `json:"ui_url"`
+}
+
+// NotificationRule sends an event to the listed notifiers. Title and Body
+// are Go templates executed on the Event, empty ones use the default text.
+type NotificationRule struct {
+	Id        string   `json:"id"`
+	Event     string   `json:"event"`
+	Schedules []string `json:"schedules"`
+	// job_failed only: notify from this many failed runs in a row on
+	Consecutive uint32   `json:"consecutive"`
+	Notifiers   []string `json:"notifiers"`
+	Title       string   `json:"title"`
+	Body        string   `json:"body"`
+}
+
 type AppSettings struct {
 	Theme                 string                   `json:"theme"`
 	PreserveErrorLogsDays uint32                   `json:"preserve_error_logs_days"`
 	Hooks                 AppSettingsHooks         `json:"hooks"`
 	Notifications         AppSettingsNotifications `json:"notifications"`
+	RateLimit             AppSettingsRateLimit     `json:"rate_limit"`
+	Smtp                  AppSettingsSmtp          `json:"smtp"`
+	Ntfy                  AppSettingsNtfy          `json:"ntfy"`
+	Gotify                AppSettingsGotify        `json:"gotify"`
+	Telegram              AppSettingsTelegram      `json:"telegram"`
+	NotificationRules     []NotificationRule       `json:"notification_rules"`
+	Autostart             AppSettingsAutostart     `json:"autostart"`
+	Logging               AppSettingsLogging       `json:"logging"`
+	// locks older than this are removed before a schedule runs, 0 disables it
+	AutoUnlockHours uint32 `json:"auto_unlock_hours"`
+	// origins allowed to call the API from a browser, applied on start
+	AllowedOrigins []string `json:"allowed_origins"`
+	// versions of the config kept for rollback, 0 disables the history
+	ConfigHistory uint32 `json:"config_history"`
+	// runs per schedule whose output is kept, 0 disables it
+	RunLogs uint32 `json:"run_logs"`
+	// backups processing less than this percentage of the usual files or
+	// bytes are reported, 0 disables it
+	AnomalyPercent uint32 `json:"anomaly_percent"`
+	// runs schedules once that should have run while the machine was asleep
+	CatchUpAfterSleep bool `json:"catch_up_after_sleep"`
+	// restic's cache, empty uses restic's default
+	CacheDir string `json:"cache_dir"`
 }
 
 type Config struct {
-	Repositories []Repository `json:"repositories"`
-	Backups      []Backup     `json:"backups"`
-	Schedules    []Schedule   `json:"schedules"`
-	AppSettings  AppSettings  `json:"app_settings"`
+	SchemaVersion int          `json:"schema_version"`
+	Repositories  []Repository `json:"repositories"`
+	Backups       []Backup     `json:"backups"`
+	Schedules     []Schedule   `json:"schedules"`
+	AppSettings   AppSettings  `json:"app_settings"`
 }
 
 type BrowseData struct {
-	Path string `json:"path"`
+	Path   string `json:"path"`
+	Offset int    `json:"offset"`
+	Limit  int    `json:"limit"`
 }
 
 type MountData struct {
 	Path string `json:"path"`
 }
 
+type PathEntry struct {
+	Name  string `json:"name"`
+	Path  string `json:"path"`
+	IsDir bool   `json:"is_dir"`
+	Size  int64  `json:"size"`
+}
+
 type RestoreData struct {
 	RootPath string `json:"root_path"`
 	FromPath string `json:"from_path"`
 	ToPath   string `json:"to_path"`
+	Force    bool   `json:"force"`
+}
+
+const (
+	RestoreTargetMissing     = "target_missing"
+	RestoreTargetNotDir      = "target_not_dir"
+	RestoreTargetNotWritable = "target_not_writable"
+	RestoreNotEnoughSpace    = "not_enough_space"
+	RestoreSizeUnknown       = "size_unknown"
+)
+
+type RestoreWarning struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// RestoreCheck is returned before a restore, the UI has to confirm any
+// warnings by sending the restore again with force.
+type RestoreCheck struct {
+	Size     uint64           `json:"size"`
+	Free     uint64           `json:"free"`
+	Warnings []RestoreWarning `json:"warnings"`
 }
 
 type Output struct {
@@ -149,17 +424,36 @@ type MsgJob struct {
 	Force    bool     `json:"force"`
 }
 
+const (
+	MsgJobStarted         = "job_started"
+	MsgJobProgress        = "job_progress"
+	MsgJobDone            = "job_done"
+	MsgLog                = "log"
+	MsgError              = "error"
+	MsgNotification       = "notification"
+	MsgMounts             = "mounts"
+	MsgConfigReload       = "config_reloaded"
+	MsgPause              = "pause"
+	MsgComponentRestarted = "component_restarted"
+	MsgWarning            = "warning"
+	MsgErrors             = "errors"
+)
+
 type ChanMsg struct {
-	Id   string
-	Msg  string
-	Time time.Time
+	Id        string
+	Type      string
+	Msg       string
+	Time      time.Time
+	RequestId string
 }
 
-type JobMsg struct {
-	Id   string    `json:"id"`
-	Out  string    `json:"out"`
-	Err  string    `json:"err"`
-	Time time.Time `json:"time"`
+// Envelope wraps every message sent to websocket and SSE clients.
+type Envelope struct {
+	Type      string    `json:"type"`
+	Id        string    `json:"id"`
+	Payload   any       `json:"payload"`
+	Timestamp time.Time `json:"timestamp"`
+	RequestId string    `json:"request_id,omitempty"`
 }
 
 type MountMsg struct {
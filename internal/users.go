@@ -0,0 +1,255 @@
+package internal
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type Role string
+
+const (
+	RoleReadOnly Role = "read-only"
+	RoleOperator Role = "operator"
+	RoleAdmin    Role = "admin"
+)
+
+var roleRank = map[Role]int{
+	RoleReadOnly: 1,
+	RoleOperator: 2,
+	RoleAdmin:    3,
+}
+
+func (r Role) Valid() bool {
+	_, ok := roleRank[r]
+	return ok
+}
+
+// Allows reports whether r grants at least the permissions of required.
+func (r Role) Allows(required Role) bool {
+	return roleRank[r] >= roleRank[required]
+}
+
+type User struct {
+	Id           string `json:"id"`
+	Username     string `json:"username"`
+	PasswordHash string `json:"password_hash,omitempty"`
+	Role         Role   `json:"role"`
+}
+
+type UserData struct {
+	Id       string `json:"id"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Role     Role   `json:"role"`
+}
+
+type LoginData struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type Identity struct {
+	Username string `json:"username"`
+	Role     Role   `json:"role"`
+}
+
+type session struct {
+	userId  string
+	expires time.Time
+}
+
+const sessionTTL = 24 * time.Hour
+
+type Users struct {
+	file     string
+	users    []User
+	sessions map[string]session
+	mux      sync.RWMutex
+}
+
+func NewUsers(settings *Settings) *Users {
+	u := &Users{}
+	u.file = filepath.Join(filepath.Dir(settings.file), "users.json")
+	u.users = []User{}
+	u.sessions = make(map[string]session)
+
+	if data, err := os.ReadFile(u.file); err == nil {
+		if err := json.Unmarshal(data, &u.users); err != nil {
+			log.Error("users: unmarshal", "err", err)
+		}
+	} else if !os.IsNotExist(err) {
+		log.Error("users: read file", "err", err)
+	}
+
+	return u
+}
+
+func (u *Users) save() error {
+	str, err := json.MarshalIndent(u.users, " ", " ")
+	if err != nil {
+		log.Error("users: marshal indent", "err", err)
+		return err
+	}
+	if err := os.WriteFile(u.file, str, 0600); err != nil {
+		log.Error("users: write", "err", err)
+		return err
+	}
+	return nil
+}
+
+func (u *Users) List() []User {
+	u.mux.RLock()
+	defer u.mux.RUnlock()
+	list := []User{}
+	for _, usr := range u.users {
+		usr.PasswordHash = ""
+		list = append(list, usr)
+	}
+	return list
+}
+
+// Save creates a new user or updates an existing one. An empty password
+// keeps the current one.
+func (u *Users) Save(data UserData) (User, error) {
+	if data.Username == "" {
+		return User{}, errors.New("username is required")
+	}
+	if !data.Role.Valid() {
+		return User{}, errors.New("invalid role: " + string(data.Role))
+	}
+
+	u.mux.Lock()
+	defer u.mux.Unlock()
+
+	idx := -1
+	for i, usr := range u.users {
+		if data.Id != "" && usr.Id == data.Id {
+			idx = i
+		} else if usr.Username == data.Username {
+			return User{}, errors.New("username already exists")
+		}
+	}
+
+	usr := User{Id: data.Id, Username: data.Username, Role: data.Role}
+	if idx >= 0 {
+		usr.PasswordHash = u.users[idx].PasswordHash
+	} else {
+		usr.Id = uuid.New().String()
+	}
+
+	if data.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(data.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return User{}, err
+		}
+		usr.PasswordHash = string(hash)
+	}
+	if usr.PasswordHash == "" {
+		return User{}, errors.New("password is required")
+	}
+
+	if idx >= 0 {
+		u.users[idx] = usr
+		if data.Password != "" {
+			// whoever knew the old password is logged out
+			u.dropSessions(usr.Id)
+		}
+	} else {
+		u.users = append(u.users, usr)
+	}
+
+	if err := u.save(); err != nil {
+		return User{}, err
+	}
+	usr.PasswordHash = ""
+	return usr, nil
+}
+
+func (u *Users) Delete(id string) error {
+	u.mux.Lock()
+	defer u.mux.Unlock()
+	for i, usr := range u.users {
+		if usr.Id == id {
+			u.users = append(u.users[:i], u.users[i+1:]...)
+			u.dropSessions(id)
+			return u.save()
+		}
+	}
+	return errors.New("user not found")
+}
+
+// dropSessions logs a user out everywhere, expects mux to be held.
+func (u *Users) dropSessions(userId string) {
+	for t, s := range u.sessions {
+		if s.userId == userId {
+			delete(u.sessions, t)
+		}
+	}
+}
+
+// dummyHash is compared for unknown usernames, so they take as long as a
+// wrong password and don't give away which users exist.
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("resticity"), bcrypt.DefaultCost)
+	return hash
+})
+
+func (u *Users) Login(username string, password string) (string, *Identity, error) {
+	u.mux.Lock()
+	defer u.mux.Unlock()
+	var usr *User
+	hash := dummyHash()
+	for i := range u.users {
+		if u.users[i].Username == username {
+			usr = &u.users[i]
+			hash = []byte(usr.PasswordHash)
+			break
+		}
+	}
+	if err := bcrypt.CompareHashAndPassword(hash, []byte(password)); err != nil || usr == nil {
+		return "", nil, errors.New("invalid username or password")
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, err
+	}
+	token := hex.EncodeToString(b)
+	u.sessions[token] = session{userId: usr.Id, expires: time.Now().Add(sessionTTL)}
+	return token, &Identity{Username: usr.Username, Role: usr.Role}, nil
+}
+
+func (u *Users) Logout(token string) {
+	u.mux.Lock()
+	defer u.mux.Unlock()
+	delete(u.sessions, token)
+}
+
+// Identify resolves a session token to the user it belongs to.
+func (u *Users) Identify(token string) *Identity {
+	u.mux.Lock()
+	defer u.mux.Unlock()
+	s, ok := u.sessions[token]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(s.expires) {
+		delete(u.sessions, token)
+		return nil
+	}
+	for _, usr := range u.users {
+		if usr.Id == s.userId {
+			return &Identity{Username: usr.Username, Role: usr.Role}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+package internal
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/goccy/go-json"
+	"github.com/robfig/cron/v3"
+)
+
+// FieldError points at the invalid value, e.g. schedules[2].cron.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// fieldErrorsText lists errs one per line, for messages outside the API.
+func fieldErrorsText(errs []FieldError) string {
+	lines := []string{}
+	for _, e := range errs {
+		lines = append(lines, e.Field+": "+e.Message)
+	}
+	return strings.Join(lines, "\n")
+}
+
+var scheduleActions = []string{"backup", "copy-snapshots", "prune-repository", "forget-repository", "check-repository"}
+
+var triggerTypes = []string{"change", "device"}
+
+var envNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+var notificationEvents = []string{EventJobFailed, EventJobSucceeded, EventCheckFailed, EventWarning}
+
+// Validate checks what the scheduler relies on, so a broken config is
+// rejected instead of saved.
+func (c *Config) Validate() []FieldError {
+	errs := []FieldError{}
+	add := func(field string, format string, args ...any) {
+		errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	repositories := map[string]bool{}
+	for i, r := range c.Repositories {
+		f := fmt.Sprintf("repositories[%d]", i)
+		if r.Id == "" {
+			add(f+".id", "is required")
+		} else if repositories[r.Id] {
+			add(f+".id", "duplicate id %s", r.Id)
+		}
+		repositories[r.Id] = true
+		for _, t := range r.Quota.WarnAt {
+			if t == 0 || t > 100 {
+				add(f+".quota.warn_at", "thresholds must be between 1 and 100")
+				break
+			}
+		}
+		if r.Quota.Block && r.Quota.Bytes == 0 {
+			add(f+".quota.bytes", "is required to block backups")
+		}
+		if r.Name == "" {
+			add(f+".name", "is required")
+		}
+		if r.Path == "" {
+			add(f+".path", "is required")
+		} else if r.Type == "local" && !strings.HasPrefix(r.Path, "${") && !filepath.IsAbs(r.Path) {
+			add(f+".path", "must be an absolute path")
+		}
+		if r.PasswordFile != "" && !strings.HasPrefix(r.PasswordFile, "${") && !filepath.IsAbs(r.PasswordFile) {
+			add(f+".password_file", "must be an absolute path")
+		}
+		if p := r.Options.S3SharedCredentialsFile; p != "" && !strings.HasPrefix(p, "${") && !filepath.IsAbs(p) {
+			add(f+".options.s3_shared_credentials_file", "must be an absolute path")
+		}
+		if p := r.Options.TLSCACert; p != "" && !strings.HasPrefix(p, "${") && !filepath.IsAbs(p) {
+			add(f+".options.tls_cacert", "must be an absolute path")
+		}
+		if p := r.Options.TLSClientCert; p != "" && !strings.HasPrefix(p, "${") && !filepath.IsAbs(p) {
+			add(f+".options.tls_client_cert", "must be an absolute path")
+		}
+		if k := r.Options.GoogleCredentialsJson; k != "" && k != redacted && !json.Valid([]byte(k)) {
+			add(f+".options.google_credentials_json", "must be the JSON key of a service account")
+		}
+		for k := range r.Env {
+			if !envNameRegex.MatchString(k) {
+				add(f+".env", "invalid variable name %q", k)
+			}
+		}
+		validateLabels(f, r.Group, r.Labels, add)
+	}
+
+	backups := map[string]bool{}
+	for i, b := range c.Backups {
+		f := fmt.Sprintf("backups[%d]", i)
+		if b.Id == "" {
+			add(f+".id", "is required")
+		} else if backups[b.Id] {
+			add(f+".id", "duplicate id %s", b.Id)
+		}
+		backups[b.Id] = true
+		if !filepath.IsAbs(b.Path) {
+			add(f+".path", "must be an absolute path")
+		}
+		for j, t := range b.Targets {
+			if !repositories[t] {
+				add(fmt.Sprintf("%s.targets[%d]", f, j), "unknown repository %s", t)
+			}
+		}
+	}
+
+	schedules := map[string]bool{}
+	for i, s := range c.Schedules {
+		f := fmt.Sprintf("schedules[%d]", i)
+		if s.Id == "" {
+			add(f+".id", "is required")
+		} else if schedules[s.Id] {
+			add(f+".id", "duplicate id %s", s.Id)
+		}
+		schedules[s.Id] = true
+		if !slices.Contains(scheduleActions, s.Action) {
+			add(f+".action", "unknown action %s", s.Action)
+		}
+		if !repositories[s.ToRepositoryId] {
+			add(f+".to_repository_id", "unknown repository %s", s.ToRepositoryId)
+		}
+		if s.Action == "backup" && !backups[s.BackupId] {
+			add(f+".backup_id", "unknown backup %s", s.BackupId)
+		}
+		if s.Action == "copy-snapshots" && !repositories[s.FromRepositoryId] {
+			add(f+".from_repository_id", "unknown repository %s", s.FromRepositoryId)
+		}
+		for j, p := range s.PruneParams {
+			if !isRetentionParam(p) {
+				add(fmt.Sprintf("%s.prune_params[%d]", f, j), "must be a --keep-* option")
+			}
+		}
+		if r := c.GetRepositoryById(s.ToRepositoryId); r != nil && r.ReadOnly && slices.Contains(destructiveActions, s.Action) {
+			add(f+".action", "%s is read-only, it can't be pruned or forgotten", r.Name)
+		}
+		if s.Action == "forget-repository" && len(s.PruneParams) == 0 {
+			if r := c.GetRepositoryById(s.ToRepositoryId); r != nil && len(r.PruneParams) == 0 {
+				add(f+".prune_params", "is required, the repository has no retention policy")
+			}
+		}
+		if s.Trigger.Type != "" && !slices.Contains(triggerTypes, s.Trigger.Type) {
+			add(f+".trigger.type", "unknown trigger %s", s.Trigger.Type)
+		}
+		if s.Trigger.Type == "change" && s.Action != "backup" {
+			add(f+".trigger.type", "change triggers are only for backups")
+		}
+		if s.Trigger.Type == "device" && s.Trigger.Mountpoint == "" && s.Trigger.Uuid == "" {
+			add(f+".trigger.mountpoint", "is required, or a uuid")
+		}
+		if s.Cron != "" {
+			if _, err := cron.ParseStandard(s.Cron); err != nil {
+				add(f+".cron", "invalid cron expression: %s", err.Error())
+			}
+		}
+		validateLabels(f, s.Group, s.Labels, add)
+	}
+
+	if l := c.AppSettings.Logging.Level; l != "" && !slices.Contains(logLevels, l) {
+		add("app_settings.logging.level", "unknown log level %s", l)
+	}
+	if f := c.AppSettings.Logging.Format; f != "" && !slices.Contains(logFormats, f) {
+		add("app_settings.logging.format", "unknown log format %s", f)
+	}
+
+	for i, p := range c.AppSettings.RateLimit.TrustedProxies {
+		if net.ParseIP(p) == nil {
+			if _, _, err := net.ParseCIDR(p); err != nil {
+				add(fmt.Sprintf("app_settings.rate_limit.trusted_proxies[%d]", i), "must be an IP address or CIDR range")
+			}
+		}
+	}
+
+	if d := c.AppSettings.CacheDir; d != "" && !strings.HasPrefix(d, "${") && !filepath.IsAbs(d) {
+		add("app_settings.cache_dir", "must be an absolute path")
+	}
+
+	if c.AppSettings.AnomalyPercent > 100 {
+		add("app_settings.anomaly_percent", "must be between 0 and 100")
+	}
+
+	for i, r := range c.AppSettings.NotificationRules {
+		f := fmt.Sprintf("app_settings.notification_rules[%d]", i)
+		if !slices.Contains(notificationEvents, r.Event) {
+			add(f+".event", "unknown event %s", r.Event)
+		}
+		for j, id := range r.Schedules {
+			if !schedules[id] {
+				add(fmt.Sprintf("%s.schedules[%d]", f, j), "unknown schedule %s", id)
+			}
+		}
+		for name, text := range map[string]string{"title": r.Title, "body": r.Body} {
+			if _, err := template.New(name).Parse(text); err != nil {
+				add(f+"."+name, "invalid template: %s", err.Error())
+			}
+		}
+	}
+	return errs
+}
+
+func validateLabels(f string, group string, labels []string, add func(string, string, ...any)) {
+	if !validLabel(group) {
+		add(f+".group", "must not contain commas or surrounding spaces")
+	}
+	for j, l := range labels {
+		if l == "" || !validLabel(l) {
+			add(fmt.Sprintf("%s.labels[%d]", f, j), "must not be empty or contain commas or surrounding spaces")
+		}
+	}
+}
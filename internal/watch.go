@@ -0,0 +1,106 @@
+package internal
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/fsnotify/fsnotify"
+)
+
+// settingsWatchDelay lets an editor finish writing before the file is read,
+// saving often takes several writes and renames.
+const settingsWatchDelay = 500 * time.Millisecond
+
+type fileStamp struct {
+	file    string
+	modTime time.Time
+	size    int64
+}
+
+func stampOf(file string) fileStamp {
+	st, err := os.Stat(file)
+	if err != nil {
+		return fileStamp{file: file}
+	}
+	return fileStamp{file: file, modTime: st.ModTime(), size: st.Size()}
+}
+
+// Watch calls onReload after reloading the settings file when it was
+// changed by something else than resticity, e.g. an editor over SSH or
+// configuration management. The directory is watched, not the file, so
+// files replaced by a rename are noticed as well. Half written files are
+// skipped until they are valid JSON again.
+func (s *Settings) Watch(onReload func()) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Error("settings: watch", "err", err)
+		return
+	}
+	defer w.Close()
+	s.mux.Lock()
+	dir := filepath.Dir(s.file)
+	s.mux.Unlock()
+	if err := w.Add(dir); err != nil {
+		log.Error("settings: watch", "dir", dir, "err", err)
+		return
+	}
+
+	timer := time.NewTimer(0)
+	if !timer.Stop() {
+		<-timer.C
+	}
+	for {
+		select {
+		case ev, ok := <-w.Events:
+			if !ok {
+				return
+			}
+			s.mux.Lock()
+			// profiles are switched in the same directory
+			current := filepath.Clean(ev.Name) == filepath.Clean(s.file)
+			s.mux.Unlock()
+			if current && !ev.Has(fsnotify.Chmod) {
+				timer.Reset(settingsWatchDelay)
+			}
+		case err, ok := <-w.Errors:
+			if !ok {
+				return
+			}
+			log.Warn("settings: watch", "err", err)
+		case <-timer.C:
+			s.reloadChanged(onReload)
+		}
+	}
+}
+
+// reloadChanged reloads the settings file unless it's unchanged since
+// resticity read or wrote it last.
+func (s *Settings) reloadChanged(onReload func()) {
+	s.mux.Lock()
+	file, seen := s.file, s.stamp
+	s.mux.Unlock()
+
+	current := stampOf(file)
+	if current == seen || current.modTime.IsZero() {
+		return
+	}
+	data, err := os.ReadFile(file)
+	if err != nil || !json.Valid(data) {
+		log.Warn("settings: changed on disk but not valid JSON, waiting", "file", file)
+		errorCenter.Report(ErrorSourceConfig, file, "Config file is not valid JSON", "Changes on disk are ignored until the file is fixed: "+file)
+		return
+	}
+	log.Info("settings: changed on disk, reloading", "file", file)
+	s.mux.Lock()
+	s.stamp = current
+	s.mux.Unlock()
+	s.Refresh()
+	if errs := s.Config.Validate(); len(errs) > 0 {
+		log.Warn("settings: reloaded config has errors", "errors", errs)
+		errorCenter.Report(ErrorSourceConfig, file, "Reloaded config has errors", fieldErrorsText(errs))
+	}
+	onReload()
+}
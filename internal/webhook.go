@@ -0,0 +1,98 @@
+package internal
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// webhookIdentity is who triggered runs appear as in the audit log.
+var webhookIdentity = Identity{Username: "webhook", Role: RoleOperator}
+
+// hashWebhookToken is what the config keeps of a webhook token, the token
+// itself is only shown once.
+func hashWebhookToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// SetWebhookToken creates a new webhook token for a schedule, replacing
+// the old one, and returns it.
+func (s *Settings) SetWebhookToken(id string, user string) (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+	if err := s.setWebhookHash(id, hashWebhookToken(token), user); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// RevokeWebhookToken removes the webhook token of a schedule.
+func (s *Settings) RevokeWebhookToken(id string, user string) error {
+	return s.setWebhookHash(id, "", user)
+}
+
+// setWebhookHash saves the hash as a new config version, the schedules are
+// copied so the current config only changes once it's saved.
+func (s *Settings) setWebhookHash(id string, hash string, user string) error {
+	config := s.Config
+	config.Schedules = append([]Schedule{}, config.Schedules...)
+	for i, j := range config.Schedules {
+		if j.Id == id {
+			config.Schedules[i].WebhookTokenHash = hash
+			return s.SaveVersion(config, user)
+		}
+	}
+	return ErrScheduleNotFound
+}
+
+// webhookAuth lets a request in with the webhook token of the schedule in
+// the path instead of API credentials. It only grants triggering that one
+// schedule.
+func webhookAuth(settings *Settings) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		token := tokenFromRequest(c)
+		var hash string
+		for _, s := range settings.Config.Schedules {
+			if s.Id == c.Params("id") {
+				hash = s.WebhookTokenHash
+			}
+		}
+		if hash == "" || token == "" || subtle.ConstantTimeCompare([]byte(hash), []byte(hashWebhookToken(token))) != 1 {
+			c.SendStatus(401)
+			return c.SendString("Unauthorized")
+		}
+		identity := webhookIdentity
+		c.Locals("identity", &identity)
+		return c.Next()
+	}
+}
+
+// serveWebhookTrigger starts a run like the run button, refusing while the
+// schedule is still running or in maintenance mode.
+func serveWebhookTrigger(scheduler *Scheduler) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		job := scheduler.FindJobById(c.Params("id"))
+		if job == nil {
+			c.SendStatus(404)
+			return c.SendString(ErrScheduleNotFound.Error())
+		}
+		if job.Running {
+			c.SendStatus(409)
+			return c.SendString("The schedule is already running")
+		}
+		jobLog(job).Info("Run triggered by webhook", "ip", c.IP())
+		if err := scheduler.RunJobById(job.Id); err != nil {
+			c.SendStatus(503)
+			return c.SendString(err.Error())
+		}
+		c.Status(202)
+		return c.JSON(fiber.Map{"schedule_id": job.Id, "status": "started"})
+	}
+}
@@ -1,11 +1,12 @@
 package main
 
 import (
-	"embed"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
 
+	"github.com/ad-on-is/resticity/frontend"
 	"github.com/ad-on-is/resticity/internal"
 
 	"github.com/charmbracelet/log"
@@ -15,8 +16,7 @@ import (
 	"github.com/wailsapp/wails/v2/pkg/options/assetserver"
 )
 
-//go:embed all:frontend/.output/public
-var assets embed.FS
+var assets = frontend.Assets
 
 var (
 	Version string
@@ -35,22 +35,57 @@ func main() {
 	if r.FlagArgs.Help {
 		fmt.Println("resticity " + Version + " (build " + Build + ")")
 		flag.PrintDefaults()
+		internal.PrintCommands(os.Stdout)
+		os.Exit(0)
+	}
+
+	if len(r.Command()) > 0 {
+		runCommand(r, err)
+	}
+
+	if errors.Is(err, internal.ErrAlreadyRunning) {
+		log.Info("Resticity is already running, showing its window")
+		if err := internal.ShowRunningInstance(r.Auth.Token()); err != nil {
+			log.Error("Resticity is already running", "error", err)
+			os.Exit(1)
+		}
 		os.Exit(0)
 	}
 
 	r.Scheduler.Assets = &assets
 	if err == nil {
+		public, err := frontend.Public(r.FlagArgs.FrontendDir)
+		if err != nil {
+			log.Error("Resticity failed to load frontend", "error", err)
+			os.Exit(1)
+		}
+		if r.Headless() {
+			if err := r.Serve(public, Version, Build); err != nil {
+				log.Error("Resticity failed to serve", "error", err)
+				os.Exit(1)
+			}
+			return
+		}
+		r.Scheduler.Desktop.Enable()
 		(r.Scheduler).RescheduleBackups()
-		go internal.RunServer(
-			r.Scheduler,
-			r.Restic,
-			r.Settings,
-			&r.OutputChan,
-			&r.ErrorChan,
-			Version,
-			Build,
-		)
-		Desktop(r.Scheduler, r.Restic, r.Settings, r.FlagArgs.Background)
+		if r.NoServer() {
+			internal.StartBackground(r.Scheduler, r.Settings)
+		} else {
+			go func() {
+				if err := internal.RunServer(
+					r.Scheduler,
+					r.Restic,
+					r.Settings,
+					r.Auth,
+					public,
+					Version,
+					Build,
+				); err != nil {
+					log.Error("server: listen", "err", err)
+				}
+			}()
+		}
+		Desktop(r.Scheduler, r.Restic, r.Settings, r.Auth, r.State, r.FlagArgs.Background)
 	} else {
 		log.Error("Resticity failed to start", "error", err)
 		os.Exit(1)
@@ -62,15 +97,24 @@ func Desktop(
 	scheduler *internal.Scheduler,
 	restic *internal.Restic,
 	settings *internal.Settings,
+	auth *internal.Auth,
+	state *internal.AppState,
 	isHidden bool,
 ) {
+	window := state.Window()
+	isHidden = isHidden || window.Hidden
+	startState := options.Normal
+	if window.Maximised {
+		startState = options.Maximised
+	}
 	// Create an instance of the app structure
-	app := NewApp(restic, scheduler, settings, &assets)
+	app := NewApp(restic, scheduler, settings, auth, state, &assets, isHidden)
 	// Create application with options
 	err := wails.Run(&options.App{
 		Title:             "resticity",
-		Width:             1024,
-		Height:            768,
+		Width:             window.Width,
+		Height:            window.Height,
+		WindowStartState:  startState,
 		HideWindowOnClose: true,
 		StartHidden:       isHidden,
 
@@ -80,12 +124,30 @@ func Desktop(
 		},
 		BackgroundColour: &options.RGBA{R: 27, G: 38, B: 54, A: 1},
 		OnStartup:        app.startup,
+		OnDomReady:       app.domReady,
+		OnBeforeClose:    app.beforeClose,
+		OnShutdown:       app.shutdown,
 		Bind: []interface{}{
 			app,
 		},
 	})
 
 	if err != nil {
-		println("Error:", err.Error())
+		log.Error("Resticity failed to run", "error", err)
+	}
+}
+
+// runCommand runs a command given on the command line instead of the app
+// and exits.
+func runCommand(r internal.Resticity, err error) {
+	if err != nil {
+		log.Error("Resticity failed to start", "error", err)
+		os.Exit(1)
+	}
+	public, err := frontend.Public(r.FlagArgs.FrontendDir)
+	if err != nil {
+		log.Error("Resticity failed to load frontend", "error", err)
+		os.Exit(1)
 	}
+	os.Exit(r.RunCommand(public, Version, Build))
 }